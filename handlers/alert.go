@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// storageAlertsMailBody returns the digest of the alerts of an entity
+func storageAlertsMailBody(alerts []models.StorageAlert) string {
+	var body strings.Builder
+
+	for _, a := range alerts {
+		kind := global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "alert_" + a.StorageAlertKind, PluralCount: 1})
+		body.WriteString(fmt.Sprintf("- %s: %s", kind, a.NameLabel))
+		if a.StorageBarecode.Valid {
+			body.WriteString(" (" + a.StorageBarecode.String + ")")
+		}
+		body.WriteString(" - " + a.StoreLocationFullPath)
+		switch a.StorageAlertKind {
+		case "opened":
+			body.WriteString(" - " + a.StorageOpeningDate.Time.Format("2006-01-02"))
+		default:
+			body.WriteString(" - " + a.StorageExpirationDate.Time.Format("2006-01-02"))
+		}
+		body.WriteString("\r\n")
+	}
+
+	return body.String()
+}
+
+// sendStorageAlerts emails the entity managers a digest of their storages
+// expiring soon, expired or opened for too long, and records the sent alerts
+func (env *Env) sendStorageAlerts() error {
+	var (
+		err      error
+		alerts   []models.StorageAlert
+		managers []models.Person
+	)
+
+	now := time.Now()
+	if alerts, err = env.DB.GetStorageAlerts(now); err != nil {
+		return err
+	}
+
+	// grouping alerts by entity, they are sorted by entity
+	var entityalerts [][]models.StorageAlert
+	for i, a := range alerts {
+		if i == 0 || a.EntityID != alerts[i-1].EntityID {
+			entityalerts = append(entityalerts, []models.StorageAlert{})
+		}
+		entityalerts[len(entityalerts)-1] = append(entityalerts[len(entityalerts)-1], a)
+	}
+
+	for _, ea := range entityalerts {
+		if managers, err = env.DB.GetEntityPeople(ea[0].EntityID); err != nil {
+			return err
+		}
+		// the alerts will be sent when the entity has a manager
+		if len(managers) == 0 {
+			log.WithFields(log.Fields{"entity": ea[0].EntityName}).Debug("sendStorageAlerts no manager")
+			continue
+		}
+
+		msgsubject := fmt.Sprintf(global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "alert_mailsubject", PluralCount: 1}), ea[0].EntityName)
+		msgbody := storageAlertsMailBody(ea)
+		sent := false
+		for _, m := range managers {
+			if err = sendMail(m.PersonEmail, msgsubject, msgbody); err != nil {
+				log.Error("storage alerts mail to " + m.PersonEmail + " - " + err.Error())
+				continue
+			}
+			sent = true
+		}
+		if !sent {
+			continue
+		}
+
+		if err = env.DB.CreateAlertNotifications(ea, now); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{"entity": ea[0].EntityName, "alerts": len(ea)}).Info("storage alerts sent")
+	}
+
+	return nil
+}
+
+// RunAlertScheduler sends the storage alerts digests
+// and the overdue borrowings reminders every interval
+func (env *Env) RunAlertScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := env.sendStorageAlerts(); err != nil {
+			log.Error("storage alerts - " + err.Error())
+		}
+		if err := env.sendBorrowingReminders(); err != nil {
+			log.Error("borrowing reminders - " + err.Error())
+		}
+		<-ticker.C
+	}
+}
+
+/*
+	REST handlers
+*/
+
+// GetEntityAlertSettingHandler returns a json of the storage alerts thresholds of the entity with the requested id
+func (env *Env) GetEntityAlertSettingHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		a   models.AlertSetting
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if a, err = env.DB.GetAlertSetting(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the alert setting",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(a)
+	return nil
+}
+
+// UpdateEntityAlertSettingHandler updates the storage alerts thresholds of the entity with the requested id
+func (env *Env) UpdateEntityAlertSettingHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		a   models.AlertSetting
+	)
+
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	if err = global.Decoder.Decode(&a, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	a.AlertSettingEntityID = id
+	log.WithFields(log.Fields{"a": a}).Debug("UpdateEntityAlertSettingHandler")
+
+	if a.AlertSettingExpiringDays < 0 || a.AlertSettingOpenedMonths < 0 {
+		return &helpers.AppError{
+			Error:   errors.New("negative threshold"),
+			Message: "thresholds must be positive",
+			Code:    http.StatusBadRequest}
+	}
+
+	if err = env.DB.UpdateAlertSetting(a); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "update alert setting error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(a)
+	return nil
+}
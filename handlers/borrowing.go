@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// sendBorrowingReminders emails the borrowers of the overdue storages
+// and records the sent reminders
+func (env *Env) sendBorrowingReminders() error {
+	var (
+		err error
+		bs  []models.Borrowing
+	)
+
+	now := time.Now()
+	if bs, err = env.DB.GetOverdueBorrowings(now); err != nil {
+		return err
+	}
+
+	msgsubject := global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "borrowing_mailsubject", PluralCount: 1})
+	for _, b := range bs {
+		msgbody := fmt.Sprintf(global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "borrowing_mailbody", PluralCount: 1}),
+			b.Storage.Product.NameLabel,
+			b.Storage.StorageBarecode.String,
+			b.BorrowingDate.Time.Format("2006-01-02"),
+			b.BorrowingDueDate.Time.Format("2006-01-02"),
+			b.Storage.StoreLocation.StoreLocationFullPath)
+		if err = sendMail(b.Borrower.PersonEmail, msgsubject, msgbody); err != nil {
+			log.Error("borrowing reminder mail to " + b.Borrower.PersonEmail + " - " + err.Error())
+			continue
+		}
+		if err = env.DB.UpdateBorrowingReminder(int(b.BorrowingID.Int64), now); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{"borrower": b.Borrower.PersonEmail, "storage": b.Storage.StorageID.Int64}).Info("borrowing reminder sent")
+	}
+
+	return nil
+}
+
+/*
+	REST handlers
+*/
+
+// GetEntityBorrowingsHandler returns a json list of the borrowings of the storages of the entity with the requested id
+// filtered by the "state" request parameter: active, overdue, returned or empty for all
+func (env *Env) GetEntityBorrowingsHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		bs  []models.Borrowing
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if bs, err = env.DB.GetEntityBorrowings(id, r.URL.Query().Get("state")); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the entity borrowings",
+			Code:    http.StatusInternalServerError}
+	}
+
+	type resp struct {
+		Rows  []models.Borrowing `json:"rows"`
+		Total int                `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: bs, Total: len(bs)})
+	return nil
+}
+
+// GetPersonBorrowingsHandler returns a json list of the borrowings of the person with the requested id
+// filtered by the "state" request parameter: active, overdue, returned or empty for all
+func (env *Env) GetPersonBorrowingsHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		bs  []models.Borrowing
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if bs, err = env.DB.GetPersonBorrowings(id, r.URL.Query().Get("state")); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the person borrowings",
+			Code:    http.StatusInternalServerError}
+	}
+
+	type resp struct {
+		Rows  []models.Borrowing `json:"rows"`
+		Total int                `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: bs, Total: len(bs)})
+	return nil
+}
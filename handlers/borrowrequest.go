@@ -0,0 +1,458 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// borrowRequestDecision is the form sent by a manager to accept a borrow request
+type borrowRequestDecision struct {
+	StorageID             int             `schema:"storage_id"`
+	Kind                  string          `schema:"borrowrequest_kind"` // borrowing or transfer
+	TargetStoreLocationID int             `schema:"target_storelocation_id"`
+	BorrowingDueDate      global.NullTime `schema:"borrowing_duedate"`
+	Message               string          `schema:"borrowrequestmessage_text"`
+}
+
+// sendBorrowRequestMail emails the other participants of the borrow request br
+// (the requester or the holding entity managers) that the person with id from
+// sent the message text
+func (env *Env) sendBorrowRequestMail(br models.BorrowRequest, from int, text string) {
+	var (
+		err      error
+		managers []models.Person
+		to       []string
+	)
+
+	if global.MailServerAddress == "" {
+		return
+	}
+	if managers, err = env.DB.GetEntityPeople(br.EntityID); err != nil {
+		log.Error("borrow request managers - " + err.Error())
+		return
+	}
+
+	if from == br.PersonID {
+		for _, m := range managers {
+			to = append(to, m.PersonEmail)
+		}
+	} else {
+		to = append(to, br.PersonEmail)
+	}
+
+	msgsubject := fmt.Sprintf(global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "borrowrequest_mailsubject", PluralCount: 1}), br.NameLabel, br.EntityName)
+	msgbody := fmt.Sprintf(global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "borrowrequest_mailbody", PluralCount: 1}),
+		br.PersonEmail, br.NameLabel, br.EntityName, br.BorrowRequestStatus, text)
+	for _, t := range to {
+		if err = sendMail(t, msgsubject, msgbody); err != nil {
+			log.Error("borrow request mail to " + t + " - " + err.Error())
+		}
+	}
+}
+
+// getBorrowRequest returns the borrow request with id passed in the request vars
+// if the logged user is its requester, a manager of its holding entity or an admin.
+// manager is true if the logged user can accept or refuse the request
+func (env *Env) getBorrowRequest(r *http.Request) (br models.BorrowRequest, manager bool, aerr *helpers.AppError) {
+	var (
+		err      error
+		id       int
+		admin    bool
+		managers []models.Person
+	)
+	vars := mux.Vars(r)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return models.BorrowRequest{}, false, &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	if br, err = env.DB.GetBorrowRequest(id); err != nil {
+		return models.BorrowRequest{}, false, &helpers.AppError{
+			Error:   err,
+			Message: "error getting the borrow request",
+			Code:    http.StatusNotFound}
+	}
+
+	// retrieving the logged user id from request context
+	c := helpers.ContainerFromRequestContext(r)
+
+	if admin, err = env.DB.IsPersonAdmin(c.PersonID); err != nil {
+		return models.BorrowRequest{}, false, &helpers.AppError{
+			Error:   err,
+			Message: "error getting admin status",
+			Code:    http.StatusInternalServerError}
+	}
+	if admin {
+		return br, true, nil
+	}
+	if managers, err = env.DB.GetEntityPeople(br.EntityID); err != nil {
+		return models.BorrowRequest{}, false, &helpers.AppError{
+			Error:   err,
+			Message: "error getting the entity managers",
+			Code:    http.StatusInternalServerError}
+	}
+	for _, m := range managers {
+		if m.PersonID == c.PersonID {
+			return br, true, nil
+		}
+	}
+	if br.PersonID == c.PersonID {
+		return br, false, nil
+	}
+
+	return models.BorrowRequest{}, false, &helpers.AppError{
+		Message: "only the requester and the entity managers can access a borrow request",
+		Code:    http.StatusForbidden}
+}
+
+// borrowRequestError returns the application error of the borrow request error err
+func borrowRequestError(err error, message string) *helpers.AppError {
+	switch err {
+	case models.ErrBorrowRequestEntity:
+		return &helpers.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusBadRequest}
+	case models.ErrBorrowRequestNotPending, models.ErrBorrowRequestStorageBorrowed:
+		return &helpers.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusConflict}
+	}
+	return transferError(err, message)
+}
+
+/*
+	REST handlers
+*/
+
+// CreateBorrowRequestHandler sends a borrow request of a product to the managers of the entity holding it
+func (env *Env) CreateBorrowRequestHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err error
+		id  int
+		br  models.BorrowRequest
+	)
+
+	// parsing request form
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	// the first message of the thread
+	message := r.PostForm.Get("borrowrequestmessage_text")
+	r.PostForm.Del("borrowrequestmessage_text")
+	// decoding request form
+	if err = global.Decoder.Decode(&br, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	if br.BorrowRequestQuantity.Valid && br.BorrowRequestQuantity.Float64 <= 0 {
+		return &helpers.AppError{
+			Error:   errors.New("wrong quantity"),
+			Message: "the requested quantity must be positive",
+			Code:    http.StatusBadRequest}
+	}
+
+	// retrieving the logged user id from request context
+	c := helpers.ContainerFromRequestContext(r)
+	br.PersonID = c.PersonID
+	log.WithFields(log.Fields{"br": br}).Debug("CreateBorrowRequestHandler")
+
+	if id, err = env.DB.CreateBorrowRequest(br, message); err != nil {
+		return borrowRequestError(err, "create borrow request error")
+	}
+	if br, err = env.DB.GetBorrowRequest(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the borrow request",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// asking the holding entity managers
+	go env.sendBorrowRequestMail(br, br.PersonID, message)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(br)
+	return nil
+}
+
+// GetBorrowRequestsHandler returns a json list of the borrow requests sent by the logged user
+// or addressed to the entities the logged user manages
+func (env *Env) GetBorrowRequestsHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err error
+		brs []models.BorrowRequest
+	)
+
+	c := helpers.ContainerFromRequestContext(r)
+	if brs, err = env.DB.GetPersonBorrowRequests(c.PersonID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the borrow requests",
+			Code:    http.StatusInternalServerError}
+	}
+
+	type resp struct {
+		Rows  []models.BorrowRequest `json:"rows"`
+		Total int                    `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: brs, Total: len(brs)})
+	return nil
+}
+
+// GetBorrowRequestHandler returns a json of the borrow request with the requested id and its messages
+func (env *Env) GetBorrowRequestHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		aerr *helpers.AppError
+		br   models.BorrowRequest
+	)
+
+	if br, _, aerr = env.getBorrowRequest(r); aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(br)
+	return nil
+}
+
+// CreateBorrowRequestMessageHandler adds a message to the thread of the borrow request with the requested id
+func (env *Env) CreateBorrowRequestMessageHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err  error
+		aerr *helpers.AppError
+		br   models.BorrowRequest
+		m    models.BorrowRequestMessage
+	)
+
+	if br, _, aerr = env.getBorrowRequest(r); aerr != nil {
+		return aerr
+	}
+
+	// parsing request form
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	// decoding request form
+	if err = global.Decoder.Decode(&m, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	if m.BorrowRequestMessageText == "" {
+		return &helpers.AppError{
+			Error:   errors.New("empty message"),
+			Message: "the message can not be empty",
+			Code:    http.StatusBadRequest}
+	}
+
+	c := helpers.ContainerFromRequestContext(r)
+	m.BorrowRequestID = br.BorrowRequestID
+	m.PersonID = c.PersonID
+	if _, err = env.DB.CreateBorrowRequestMessage(m); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "create borrow request message error",
+			Code:    http.StatusInternalServerError}
+	}
+	if br, err = env.DB.GetBorrowRequest(br.BorrowRequestID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the borrow request",
+			Code:    http.StatusInternalServerError}
+	}
+
+	go env.sendBorrowRequestMail(br, m.PersonID, m.BorrowRequestMessageText)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(br)
+	return nil
+}
+
+// AcceptBorrowRequestHandler accepts the borrow request with the requested id
+// lending one of the entity storages to the requester
+// or transferring it to one of the requester store locations
+func (env *Env) AcceptBorrowRequestHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err     error
+		aerr    *helpers.AppError
+		manager bool
+		br      models.BorrowRequest
+		d       borrowRequestDecision
+		s       models.Storage
+	)
+
+	if br, manager, aerr = env.getBorrowRequest(r); aerr != nil {
+		return aerr
+	}
+	if !manager {
+		return &helpers.AppError{
+			Message: "only the entity managers can accept or refuse a borrow request",
+			Code:    http.StatusForbidden}
+	}
+	if br.BorrowRequestStatus != "pending" {
+		return borrowRequestError(models.ErrBorrowRequestNotPending, "")
+	}
+
+	// parsing request form
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	// decoding request form
+	if err = global.Decoder.Decode(&d, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	log.WithFields(log.Fields{"br": br, "d": d}).Debug("AcceptBorrowRequestHandler")
+
+	// the storage must be one of the requested product in the holding entity
+	if s, err = env.DB.GetStorage(d.StorageID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the storage",
+			Code:    http.StatusBadRequest}
+	}
+	if s.ProductID != br.ProductID || s.EntityID != br.EntityID {
+		return &helpers.AppError{
+			Error:   errors.New("wrong storage"),
+			Message: "the storage must be a storage of the requested product in the entity",
+			Code:    http.StatusBadRequest}
+	}
+
+	if d.Kind != "borrowing" && d.Kind != "transfer" {
+		return &helpers.AppError{
+			Error:   errors.New("wrong kind"),
+			Message: "the borrow request kind must be borrowing or transfer",
+			Code:    http.StatusBadRequest}
+	}
+
+	c := helpers.ContainerFromRequestContext(r)
+	b := models.Borrowing{
+		BorrowingDueDate: d.BorrowingDueDate,
+		Person:           models.Person{PersonID: c.PersonID},
+		Borrower:         &models.Person{PersonID: br.PersonID},
+	}
+	t := models.Transfer{
+		TargetStoreLocationID: d.TargetStoreLocationID,
+		PersonID:              br.PersonID,
+	}
+	br.BorrowRequestKind = sql.NullString{Valid: true, String: d.Kind}
+	br.StorageID = sql.NullInt64{Valid: true, Int64: int64(d.StorageID)}
+	if err = env.DB.AcceptBorrowRequest(br, c.PersonID, b, t); err != nil {
+		return borrowRequestError(err, "accept borrow request error")
+	}
+	if d.Message != "" {
+		if _, err = env.DB.CreateBorrowRequestMessage(models.BorrowRequestMessage{
+			BorrowRequestMessageText: d.Message,
+			BorrowRequestID:          br.BorrowRequestID,
+			PersonID:                 c.PersonID}); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "create borrow request message error",
+				Code:    http.StatusInternalServerError}
+		}
+	}
+	if br, err = env.DB.GetBorrowRequest(br.BorrowRequestID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the borrow request",
+			Code:    http.StatusInternalServerError}
+	}
+
+	go env.sendBorrowRequestMail(br, c.PersonID, d.Message)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(br)
+	return nil
+}
+
+// RefuseBorrowRequestHandler refuses the borrow request with the requested id
+func (env *Env) RefuseBorrowRequestHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err     error
+		aerr    *helpers.AppError
+		manager bool
+		br      models.BorrowRequest
+	)
+
+	if br, manager, aerr = env.getBorrowRequest(r); aerr != nil {
+		return aerr
+	}
+	if !manager {
+		return &helpers.AppError{
+			Message: "only the entity managers can accept or refuse a borrow request",
+			Code:    http.StatusForbidden}
+	}
+
+	// parsing request form
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	message := r.PostForm.Get("borrowrequestmessage_text")
+
+	c := helpers.ContainerFromRequestContext(r)
+	if err = env.DB.DecideBorrowRequest(br, c.PersonID, "refused"); err != nil {
+		return borrowRequestError(err, "refuse borrow request error")
+	}
+	if message != "" {
+		if _, err = env.DB.CreateBorrowRequestMessage(models.BorrowRequestMessage{
+			BorrowRequestMessageText: message,
+			BorrowRequestID:          br.BorrowRequestID,
+			PersonID:                 c.PersonID}); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "create borrow request message error",
+				Code:    http.StatusInternalServerError}
+		}
+	}
+	if br, err = env.DB.GetBorrowRequest(br.BorrowRequestID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the borrow request",
+			Code:    http.StatusInternalServerError}
+	}
+
+	go env.sendBorrowRequestMail(br, c.PersonID, message)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(br)
+	return nil
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+/*
+	REST handlers
+*/
+
+// CreateStorageConsumptionHandler withdraws a quantity from the storage with id passed in the request vars
+// for the logged user.
+func (env *Env) CreateStorageConsumptionHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err error
+		id  int
+		c   models.Consumption
+	)
+	vars := mux.Vars(r)
+
+	// parsing request form
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	// decoding request form
+	if err = global.Decoder.Decode(&c, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	// getting the storage id
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	c.StorageID = id
+
+	// retrieving the logged user id from request context
+	container := helpers.ContainerFromRequestContext(r)
+	c.PersonID = container.PersonID
+	log.WithFields(log.Fields{"c": c}).Debug("CreateStorageConsumptionHandler")
+
+	if c.ConsumptionQuantity <= 0 {
+		return &helpers.AppError{
+			Error:   errors.New("wrong consumption quantity"),
+			Message: "the consumption quantity must be positive",
+			Code:    http.StatusBadRequest}
+	}
+
+	if c.ConsumptionID, err = env.DB.CreateConsumption(c); err != nil {
+		if err == models.ErrConsumptionUnit || err == models.ErrConsumptionQuantity {
+			return &helpers.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
+		return &helpers.AppError{
+			Error:   err,
+			Message: "create consumption error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// checking the product stock thresholds
+	if s, err := env.DB.GetStorage(id); err == nil {
+		go env.notifyLowStocks(s.ProductID, s.EntityID)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(c)
+	return nil
+}
+
+// GetProductConsumptionsHandler returns a json report of the consumptions of the product with the requested id
+func (env *Env) GetProductConsumptionsHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		cr  models.ConsumptionReport
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if cr, err = env.DB.GetProductConsumptions(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the product consumptions",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(cr)
+	return nil
+}
+
+// GetPersonConsumptionsHandler returns a json report of the consumptions of the person with the requested id
+func (env *Env) GetPersonConsumptionsHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		cr  models.ConsumptionReport
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if cr, err = env.DB.GetPersonConsumptions(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the person consumptions",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(cr)
+	return nil
+}
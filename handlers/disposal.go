@@ -0,0 +1,500 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// disposalForm is the form sent to create a disposal batch or add storages to it
+type disposalForm struct {
+	EntityID        int            `schema:"entity_id"`
+	DisposalComment sql.NullString `schema:"disposal_comment"`
+	StorageIDs      []int          `schema:"storage_ids"`
+}
+
+// disposalCategoryForm is the form sent to change the waste category of a storage
+type disposalCategoryForm struct {
+	DisposalStorageCategory string `schema:"disposalstorage_category"`
+}
+
+// disposalError returns the AppError of the disposal model error err
+func disposalError(err error, message string) *helpers.AppError {
+	switch err {
+	case models.ErrDisposalStorage, models.ErrDisposalCategory:
+		return &helpers.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusBadRequest}
+	case models.ErrDisposalNotOpen:
+		return &helpers.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusConflict}
+	}
+	return &helpers.AppError{
+		Error:   err,
+		Message: message,
+		Code:    http.StatusInternalServerError}
+}
+
+// decodeDisposalForm returns the disposal form of the request
+func decodeDisposalForm(r *http.Request) (disposalForm, *helpers.AppError) {
+	var (
+		f   disposalForm
+		err error
+	)
+
+	if err = r.ParseForm(); err != nil {
+		return disposalForm{}, &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	if err = global.Decoder.Decode(&f, r.PostForm); err != nil {
+		return disposalForm{}, &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+
+	return f, nil
+}
+
+// getDisposal returns the disposal batch with id passed in the request vars
+// if the logged user is a member of its entity, or a manager if manager is true
+func (env *Env) getDisposal(r *http.Request, manager bool) (models.Disposal, *helpers.AppError) {
+	var (
+		err error
+		id  int
+		d   models.Disposal
+		ok  bool
+	)
+	vars := mux.Vars(r)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return models.Disposal{}, &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	if d, err = env.DB.GetDisposal(id); err != nil {
+		return models.Disposal{}, &helpers.AppError{
+			Error:   err,
+			Message: "error getting the disposal batch",
+			Code:    http.StatusNotFound}
+	}
+
+	c := helpers.ContainerFromRequestContext(r)
+	if manager {
+		ok, err = env.isEntityManager(c.PersonID, d.EntityID)
+	} else {
+		ok, err = env.isEntityMember(c.PersonID, d.EntityID)
+	}
+	if err != nil {
+		return models.Disposal{}, &helpers.AppError{
+			Error:   err,
+			Message: "error getting the person entities",
+			Code:    http.StatusInternalServerError}
+	}
+	if !ok {
+		return models.Disposal{}, &helpers.AppError{
+			Message: "the disposal batches are managed by the entity managers",
+			Code:    http.StatusForbidden}
+	}
+
+	return d, nil
+}
+
+// writeDisposal writes the json of the disposal batch with id "id"
+func (env *Env) writeDisposal(w http.ResponseWriter, id int) *helpers.AppError {
+	var (
+		d   models.Disposal
+		err error
+	)
+
+	if d, err = env.DB.GetDisposal(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the disposal batch",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(d)
+	return nil
+}
+
+// disposalQuantity returns the quantity q with its unit u as text
+func disposalQuantity(q sql.NullFloat64, u sql.NullString) string {
+	if !q.Valid {
+		return ""
+	}
+	return fmt.Sprintf("%g %s", q.Float64, u.String)
+}
+
+// disposalManifestCSV writes the manifest of the disposal batch d in CSV:
+// the quantities per waste category followed by the storages
+func disposalManifestCSV(w io.Writer, d models.Disposal) error {
+	t := func(id string) string {
+		return global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: id, PluralCount: 1})
+	}
+
+	csvwr := csv.NewWriter(w)
+	csvwr.Write([]string{t("disposal_category_title"), t("disposal_count_title"), t("storage_quantity_title"), t("unit_label_title")})
+	for _, c := range d.Categories {
+		csvwr.Write([]string{c.DisposalStorageCategory, strconv.Itoa(c.Count), strconv.FormatFloat(c.Quantity.Float64, 'g', -1, 64), c.UnitLabel.String})
+	}
+	csvwr.Write([]string{})
+	csvwr.Write([]string{t("disposal_category_title"), t("storage_barecode_title"), t("name_label_title"), t("casnumber_label_title"), t("storage_quantity_title"), t("unit_label_title")})
+	for _, s := range d.Storages {
+		q := ""
+		if s.StorageQuantity.Valid {
+			q = strconv.FormatFloat(s.StorageQuantity.Float64, 'g', -1, 64)
+		}
+		csvwr.Write([]string{s.DisposalStorageCategory, s.StorageBarecode.String, s.NameLabel, s.CasNumberLabel.String, q, s.UnitLabel.String})
+	}
+
+	csvwr.Flush()
+	return csvwr.Error()
+}
+
+// disposalManifestPDF returns the printable manifest of the disposal batch d
+func disposalManifestPDF(d models.Disposal) []byte {
+	t := func(id string) string {
+		return global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: id, PluralCount: 1})
+	}
+
+	pdf := helpers.NewPDF()
+	y := 50.0
+	// newline moves to the next line, starting a new page at the bottom
+	newline := func(h float64) {
+		y += h
+		if y > helpers.PDFPageHeight-40 {
+			pdf.AddPage()
+			y = 50
+		}
+	}
+
+	pdf.Text(40, y, 16, true, fmt.Sprintf("%s #%d", t("disposal_manifest_title"), d.DisposalID))
+	newline(24)
+	pdf.Text(40, y, 11, false, d.EntityName+" - "+d.PersonEmail)
+	newline(16)
+	pdf.Text(40, y, 11, false, t("created")+": "+d.DisposalCreationDate.Format("2006-01-02"))
+	if d.DisposalCollectionDate.Valid {
+		pdf.Text(300, y, 11, false, t("disposal_collectiondate_title")+": "+d.DisposalCollectionDate.Time.Format("2006-01-02"))
+	}
+	if d.DisposalComment.Valid && d.DisposalComment.String != "" {
+		newline(16)
+		pdf.Text(40, y, 11, false, t("storage_comment_title")+": "+d.DisposalComment.String)
+	}
+
+	// quantities per category
+	newline(30)
+	pdf.Text(40, y, 11, true, t("disposal_category_title"))
+	pdf.Text(250, y, 11, true, t("disposal_count_title"))
+	pdf.Text(350, y, 11, true, t("storage_quantity_title"))
+	newline(6)
+	pdf.Line(40, y, helpers.PDFPageWidth-40, y)
+	for _, c := range d.Categories {
+		newline(16)
+		pdf.Text(40, y, 11, false, c.DisposalStorageCategory)
+		pdf.Text(250, y, 11, false, strconv.Itoa(c.Count))
+		pdf.Text(350, y, 11, false, disposalQuantity(c.Quantity, c.UnitLabel))
+	}
+
+	// storages
+	newline(30)
+	pdf.Text(40, y, 10, true, t("disposal_category_title"))
+	pdf.Text(130, y, 10, true, t("storage_barecode_title"))
+	pdf.Text(220, y, 10, true, t("name_label_title"))
+	pdf.Text(420, y, 10, true, t("casnumber_label_title"))
+	pdf.Text(490, y, 10, true, t("storage_quantity_title"))
+	newline(6)
+	pdf.Line(40, y, helpers.PDFPageWidth-40, y)
+	for _, s := range d.Storages {
+		newline(14)
+		name := []rune(s.NameLabel)
+		if len(name) > 38 {
+			name = append(name[:37], '.')
+		}
+		pdf.Text(40, y, 9, false, s.DisposalStorageCategory)
+		pdf.Text(130, y, 9, false, s.StorageBarecode.String)
+		pdf.Text(220, y, 9, false, string(name))
+		pdf.Text(420, y, 9, false, s.CasNumberLabel.String)
+		pdf.Text(490, y, 9, false, disposalQuantity(s.StorageQuantity, s.UnitLabel))
+	}
+
+	// signatures
+	newline(40)
+	pdf.Text(40, y, 11, false, t("disposal_signature_title"))
+
+	return pdf.Bytes()
+}
+
+// CreateDisposalHandler creates a disposal batch of the storages to destroy
+// "storage_ids" of the entity "entity_id"
+func (env *Env) CreateDisposalHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		f       disposalForm
+		id      int
+		manager bool
+		err     error
+		aerr    *helpers.AppError
+	)
+
+	if f, aerr = decodeDisposalForm(r); aerr != nil {
+		return aerr
+	}
+	c := helpers.ContainerFromRequestContext(r)
+	d := models.Disposal{EntityID: f.EntityID, PersonID: c.PersonID, DisposalComment: f.DisposalComment}
+	log.WithFields(log.Fields{"d": d, "f": f}).Debug("CreateDisposalHandler")
+
+	if manager, err = env.isEntityManager(c.PersonID, f.EntityID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the entity managers",
+			Code:    http.StatusInternalServerError}
+	}
+	if !manager {
+		return &helpers.AppError{
+			Message: "the disposal batches are managed by the entity managers",
+			Code:    http.StatusForbidden}
+	}
+
+	if id, err = env.DB.CreateDisposal(d, f.StorageIDs); err != nil {
+		return disposalError(err, "create disposal batch error")
+	}
+
+	return env.writeDisposal(w, id)
+}
+
+// GetDisposalHandler returns a json of the disposal batch with the requested id
+func (env *Env) GetDisposalHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		d    models.Disposal
+		aerr *helpers.AppError
+	)
+
+	if d, aerr = env.getDisposal(r, false); aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(d)
+	return nil
+}
+
+// GetEntityDisposalsHandler returns a json list of the disposal batches of the entity with the requested id
+func (env *Env) GetEntityDisposalsHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		ds  []models.Disposal
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if ds, err = env.DB.GetEntityDisposals(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the entity disposal batches",
+			Code:    http.StatusInternalServerError}
+	}
+
+	type resp struct {
+		Rows  []models.Disposal `json:"rows"`
+		Total int               `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: ds, Total: len(ds)})
+	return nil
+}
+
+// AddDisposalStoragesHandler adds the storages to destroy "storage_ids"
+// to the disposal batch with the requested id
+func (env *Env) AddDisposalStoragesHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		d    models.Disposal
+		f    disposalForm
+		err  error
+		aerr *helpers.AppError
+	)
+
+	if d, aerr = env.getDisposal(r, true); aerr != nil {
+		return aerr
+	}
+	if f, aerr = decodeDisposalForm(r); aerr != nil {
+		return aerr
+	}
+
+	if err = env.DB.AddDisposalStorages(d.DisposalID, f.StorageIDs); err != nil {
+		return disposalError(err, "add disposal storages error")
+	}
+
+	return env.writeDisposal(w, d.DisposalID)
+}
+
+// RemoveDisposalStorageHandler removes the storage "storageid" from the disposal batch with the requested id
+func (env *Env) RemoveDisposalStorageHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		d         models.Disposal
+		storageid int
+		err       error
+		aerr      *helpers.AppError
+	)
+
+	if d, aerr = env.getDisposal(r, true); aerr != nil {
+		return aerr
+	}
+	if storageid, err = strconv.Atoi(vars["storageid"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "storageid atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if err = env.DB.RemoveDisposalStorage(d.DisposalID, storageid); err != nil {
+		return disposalError(err, "remove disposal storage error")
+	}
+
+	return env.writeDisposal(w, d.DisposalID)
+}
+
+// UpdateDisposalStorageHandler changes the waste category of the storage "storageid"
+// in the disposal batch with the requested id
+func (env *Env) UpdateDisposalStorageHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		d         models.Disposal
+		f         disposalCategoryForm
+		storageid int
+		err       error
+		aerr      *helpers.AppError
+	)
+
+	if d, aerr = env.getDisposal(r, true); aerr != nil {
+		return aerr
+	}
+	if storageid, err = strconv.Atoi(vars["storageid"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "storageid atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	if err = global.Decoder.Decode(&f, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+
+	if err = env.DB.UpdateDisposalStorageCategory(d.DisposalID, storageid, f.DisposalStorageCategory); err != nil {
+		return disposalError(err, "update disposal storage error")
+	}
+
+	return env.writeDisposal(w, d.DisposalID)
+}
+
+// GetDisposalManifestHandler returns the manifest of the disposal batch with the requested id
+// as PDF, or CSV with the "format=csv" query parameter
+func (env *Env) GetDisposalManifestHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		d    models.Disposal
+		err  error
+		aerr *helpers.AppError
+	)
+
+	if d, aerr = env.getDisposal(r, false); aerr != nil {
+		return aerr
+	}
+
+	filename := fmt.Sprintf("chimitheque-disposal-%d", d.DisposalID)
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment;filename="+filename+".csv")
+		if err = disposalManifestCSV(w, d); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "error writing the manifest",
+				Code:    http.StatusInternalServerError}
+		}
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "attachment;filename="+filename+".pdf")
+	if _, err = w.Write(disposalManifestPDF(d)); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error writing the manifest",
+			Code:    http.StatusInternalServerError}
+	}
+	return nil
+}
+
+// CollectDisposalHandler marks the disposal batch with the requested id as collected
+// by the waste company, archiving its storages
+func (env *Env) CollectDisposalHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		d    models.Disposal
+		err  error
+		aerr *helpers.AppError
+	)
+
+	if d, aerr = env.getDisposal(r, true); aerr != nil {
+		return aerr
+	}
+
+	if err = env.DB.CollectDisposal(d.DisposalID); err != nil {
+		return disposalError(err, "collect disposal batch error")
+	}
+
+	return env.writeDisposal(w, d.DisposalID)
+}
+
+// DeleteDisposalHandler deletes the open disposal batch with the requested id
+func (env *Env) DeleteDisposalHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		d    models.Disposal
+		err  error
+		aerr *helpers.AppError
+	)
+
+	if d, aerr = env.getDisposal(r, true); aerr != nil {
+		return aerr
+	}
+
+	if err = env.DB.DeleteDisposal(d.DisposalID); err != nil {
+		return disposalError(err, "delete disposal batch error")
+	}
+	return nil
+}
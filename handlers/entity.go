@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/tbellembois/gochimitheque/jade"
 
@@ -12,8 +16,51 @@ import (
 	"github.com/tbellembois/gochimitheque/global"
 	"github.com/tbellembois/gochimitheque/helpers"
 	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/utils"
 )
 
+// checkEntityBarecode checks the barecode code and template of the entity e,
+// empty values being stored as NULL
+func checkEntityBarecode(e *models.Entity) *helpers.AppError {
+	if e.EntityCode.String == "" {
+		e.EntityCode = sql.NullString{}
+	} else if !utils.IsBarecodeCode(e.EntityCode.String) {
+		return &helpers.AppError{
+			Error:   errors.New("wrong entity code"),
+			Message: "the entity code must contain letters, digits, - or _ only",
+			Code:    http.StatusBadRequest}
+	}
+	if e.EntityBarecodeTemplate.String == "" {
+		e.EntityBarecodeTemplate = sql.NullString{}
+	} else if err := utils.ValidateBarecodeTemplate(e.EntityBarecodeTemplate.String); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusBadRequest}
+	}
+
+	return nil
+}
+
+// checkEntityLabelPrinter checks the labels printer address of the entity e,
+// an empty value being stored as NULL
+func checkEntityLabelPrinter(e *models.Entity) *helpers.AppError {
+	e.EntityLabelPrinter.String = strings.TrimSpace(e.EntityLabelPrinter.String)
+	if e.EntityLabelPrinter.String == "" {
+		e.EntityLabelPrinter = sql.NullString{}
+		return nil
+	}
+	host, port, err := net.SplitHostPort(helpers.LabelPrinterAddress(e.EntityLabelPrinter.String))
+	if p, perr := strconv.Atoi(port); err != nil || perr != nil || host == "" || strings.ContainsAny(host, " /") || p < 1 || p > 65535 {
+		return &helpers.AppError{
+			Error:   errors.New("wrong labels printer"),
+			Message: "the labels printer must be a host or host:port address",
+			Code:    http.StatusBadRequest}
+	}
+
+	return nil
+}
+
 /*
 	views handlers
 */
@@ -197,6 +244,13 @@ func (env *Env) CreateEntityHandler(w http.ResponseWriter, r *http.Request) *hel
 	}
 	log.WithFields(log.Fields{"e": e}).Debug("CreateEntityHandler")
 
+	if aerr := checkEntityBarecode(&e); aerr != nil {
+		return aerr
+	}
+	if aerr := checkEntityLabelPrinter(&e); aerr != nil {
+		return aerr
+	}
+
 	if _, err := env.DB.CreateEntity(e); err != nil {
 		return &helpers.AppError{
 			Error:   err,
@@ -232,6 +286,13 @@ func (env *Env) UpdateEntityHandler(w http.ResponseWriter, r *http.Request) *hel
 	}
 	log.WithFields(log.Fields{"e": e}).Debug("UpdateEntityHandler")
 
+	if aerr := checkEntityBarecode(&e); aerr != nil {
+		return aerr
+	}
+	if aerr := checkEntityLabelPrinter(&e); aerr != nil {
+		return aerr
+	}
+
 	if id, err = strconv.Atoi(vars["id"]); err != nil {
 		return &helpers.AppError{
 			Error:   err,
@@ -247,6 +308,10 @@ func (env *Env) UpdateEntityHandler(w http.ResponseWriter, r *http.Request) *hel
 	}
 	updatede.EntityName = e.EntityName
 	updatede.EntityDescription = e.EntityDescription
+	updatede.EntityShareStocks = e.EntityShareStocks
+	updatede.EntityCode = e.EntityCode
+	updatede.EntityBarecodeTemplate = e.EntityBarecodeTemplate
+	updatede.EntityLabelPrinter = e.EntityLabelPrinter
 	updatede.Managers = e.Managers
 	log.WithFields(log.Fields{"updatede": updatede}).Debug("UpdateEntityHandler")
 
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// checkIncompatibility validates the incompatibility rule i
+func checkIncompatibility(i models.Incompatibility) error {
+	for _, k := range []string{i.IncompatibilityKind1, i.IncompatibilityKind2} {
+		switch k {
+		case "symbol", "hazardstatement", "classofcompound":
+		default:
+			return errors.New("wrong incompatibility kind: " + k)
+		}
+	}
+	if i.IncompatibilityKey1 == "" || i.IncompatibilityKey2 == "" {
+		return errors.New("empty incompatibility key")
+	}
+	switch i.IncompatibilityLevel {
+	case "warn", "block":
+	default:
+		return errors.New("wrong incompatibility level: " + i.IncompatibilityLevel)
+	}
+	return nil
+}
+
+// checkStorageIncompatibilities sets the incompatibilities of the storage s
+// with the other storages of its store location
+// and returns an error if one of them is blocking
+func (env *Env) checkStorageIncompatibilities(s *models.Storage) *helpers.AppError {
+	var (
+		err     error
+		blocked []string
+	)
+
+	if s.Incompatibilities, err = env.DB.GetStorageIncompatibilities(*s); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error checking the storage incompatibilities",
+			Code:    http.StatusInternalServerError}
+	}
+	for _, i := range s.Incompatibilities {
+		if i.IncompatibilityLevel == "block" {
+			blocked = append(blocked, i.String())
+		}
+	}
+	if len(blocked) != 0 {
+		return &helpers.AppError{
+			Message: "incompatible storage: " + strings.Join(blocked, ", "),
+			Code:    http.StatusConflict}
+	}
+
+	return nil
+}
+
+/*
+	REST handlers
+*/
+
+// GetIncompatibilitiesHandler returns a json list of the incompatibility rules matching the search criteria
+func (env *Env) GetIncompatibilitiesHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	log.Debug("GetIncompatibilitiesHandler")
+
+	var (
+		err  error
+		aerr *helpers.AppError
+		dsp  helpers.Dbselectparam
+	)
+
+	// init db request parameters
+	if dsp, aerr = helpers.Newdbselectparam(r, nil); aerr != nil {
+		return aerr
+	}
+
+	incompatibilities, count, err := env.DB.GetIncompatibilities(dsp)
+	if err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the incompatibilities",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.Incompatibility `json:"rows"`
+		Total int                      `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: incompatibilities, Total: count})
+	return nil
+}
+
+// GetIncompatibilityHandler returns a json of the incompatibility rule with the requested id
+func (env *Env) GetIncompatibilityHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	incompatibility, err := env.DB.GetIncompatibility(id)
+	if err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the incompatibility",
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(incompatibility)
+	return nil
+}
+
+// CreateIncompatibilityHandler creates the incompatibility rule from the request form
+func (env *Env) CreateIncompatibilityHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		i   models.Incompatibility
+		err error
+	)
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+
+	if err = global.Decoder.Decode(&i, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	log.WithFields(log.Fields{"i": i}).Debug("CreateIncompatibilityHandler")
+
+	if err = checkIncompatibility(i); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusBadRequest}
+	}
+
+	if i.IncompatibilityID, err = env.DB.CreateIncompatibility(i); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "create incompatibility error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(i)
+	return nil
+}
+
+// UpdateIncompatibilityHandler updates the incompatibility rule from the request form
+func (env *Env) UpdateIncompatibilityHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		i   models.Incompatibility
+	)
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	if err = global.Decoder.Decode(&i, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	i.IncompatibilityID = id
+	log.WithFields(log.Fields{"i": i}).Debug("UpdateIncompatibilityHandler")
+
+	if err = checkIncompatibility(i); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusBadRequest}
+	}
+
+	if err = env.DB.UpdateIncompatibility(i); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "update incompatibility error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(i)
+	return nil
+}
+
+// DeleteIncompatibilityHandler deletes the incompatibility rule with the requested id
+func (env *Env) DeleteIncompatibilityHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if err = env.DB.DeleteIncompatibility(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "delete incompatibility error",
+			Code:    http.StatusInternalServerError}
+	}
+	return nil
+}
+
+// GetEntityIncompatibilitiesHandler returns the incompatibilities found
+// in the store locations of the entity with the requested id
+func (env *Env) GetEntityIncompatibilitiesHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id         int
+		err        error
+		violations []models.IncompatibilityViolation
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if violations, err = env.DB.GetEntityIncompatibilities(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the entity incompatibilities",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.IncompatibilityViolation `json:"rows"`
+		Total int                               `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: violations, Total: len(violations)})
+	return nil
+}
@@ -0,0 +1,483 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// inventoryUnknown is the form sent by a manager to create storages for unknown scanned items
+type inventoryUnknown struct {
+	InventoryScanIDs []int           `schema:"inventoryscan_ids"`
+	ProductID        int             `schema:"product_id"`
+	StorageQuantity  sql.NullFloat64 `schema:"storage_quantity"`
+	UnitID           sql.NullInt64   `schema:"unit_id"`
+}
+
+// inventoryError returns the AppError of the inventory model error err
+func inventoryError(err error, message string) *helpers.AppError {
+	switch err {
+	case models.ErrInventoryStoreLocation:
+		return &helpers.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusBadRequest}
+	case models.ErrInventoryOpen, models.ErrInventoryNotOpen:
+		return &helpers.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusConflict}
+	}
+	return &helpers.AppError{
+		Error:   err,
+		Message: message,
+		Code:    http.StatusInternalServerError}
+}
+
+// getInventory returns the inventory campaign with id passed in the request vars
+// if the logged user is a member of its entity, or a manager if manager is true
+func (env *Env) getInventory(r *http.Request, manager bool) (models.Inventory, *helpers.AppError) {
+	var (
+		err error
+		id  int
+		i   models.Inventory
+		ok  bool
+	)
+	vars := mux.Vars(r)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return models.Inventory{}, &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	if i, err = env.DB.GetInventory(id); err != nil {
+		return models.Inventory{}, &helpers.AppError{
+			Error:   err,
+			Message: "error getting the inventory campaign",
+			Code:    http.StatusNotFound}
+	}
+
+	c := helpers.ContainerFromRequestContext(r)
+	if manager {
+		ok, err = env.isEntityManager(c.PersonID, i.EntityID)
+	} else {
+		ok, err = env.isEntityMember(c.PersonID, i.EntityID)
+	}
+	if err != nil {
+		return models.Inventory{}, &helpers.AppError{
+			Error:   err,
+			Message: "error getting the person entities",
+			Code:    http.StatusInternalServerError}
+	}
+	if !ok {
+		return models.Inventory{}, &helpers.AppError{
+			Message: "the inventory campaigns are open to the entity members and managed by its managers",
+			Code:    http.StatusForbidden}
+	}
+
+	return i, nil
+}
+
+// CreateInventoryHandler opens an inventory campaign in the entity "entity_id"
+func (env *Env) CreateInventoryHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		i       models.Inventory
+		id      int
+		manager bool
+		err     error
+	)
+
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	if err = global.Decoder.Decode(&i, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	c := helpers.ContainerFromRequestContext(r)
+	i.PersonID = c.PersonID
+	log.WithFields(log.Fields{"i": i}).Debug("CreateInventoryHandler")
+
+	if manager, err = env.isEntityManager(c.PersonID, i.EntityID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the entity managers",
+			Code:    http.StatusInternalServerError}
+	}
+	if !manager {
+		return &helpers.AppError{
+			Message: "only the entity managers can open an inventory campaign",
+			Code:    http.StatusForbidden}
+	}
+
+	if id, err = env.DB.CreateInventory(i); err != nil {
+		return inventoryError(err, "create inventory campaign error")
+	}
+	if i, err = env.DB.GetInventory(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the inventory campaign",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(i)
+	return nil
+}
+
+// GetInventoryHandler returns a json of the inventory campaign with the requested id
+func (env *Env) GetInventoryHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		i    models.Inventory
+		aerr *helpers.AppError
+	)
+
+	if i, aerr = env.getInventory(r, false); aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(i)
+	return nil
+}
+
+// GetEntityInventoriesHandler returns a json list of the inventory campaigns of the entity with the requested id
+func (env *Env) GetEntityInventoriesHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		is  []models.Inventory
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if is, err = env.DB.GetEntityInventories(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the entity inventory campaigns",
+			Code:    http.StatusInternalServerError}
+	}
+
+	type resp struct {
+		Rows  []models.Inventory `json:"rows"`
+		Total int                `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: is, Total: len(is)})
+	return nil
+}
+
+// CloseInventoryHandler closes the inventory campaign with the requested id
+func (env *Env) CloseInventoryHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		i    models.Inventory
+		err  error
+		aerr *helpers.AppError
+	)
+
+	if i, aerr = env.getInventory(r, true); aerr != nil {
+		return aerr
+	}
+
+	if err = env.DB.CloseInventory(i.InventoryID); err != nil {
+		return inventoryError(err, "close inventory campaign error")
+	}
+	if i, err = env.DB.GetInventory(i.InventoryID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the inventory campaign",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(i)
+	return nil
+}
+
+// CreateInventoryScanHandler records the barecode or QR code "inventoryscan_code"
+// scanned in the store location "storelocation_id" for the inventory campaign with the requested id
+func (env *Env) CreateInventoryScanHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		i    models.Inventory
+		s    models.InventoryScan
+		err  error
+		aerr *helpers.AppError
+	)
+
+	if i, aerr = env.getInventory(r, false); aerr != nil {
+		return aerr
+	}
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	if err = global.Decoder.Decode(&s, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	if s.InventoryScanCode == "" {
+		return &helpers.AppError{
+			Error:   errors.New("empty code"),
+			Message: "the scanned code is required",
+			Code:    http.StatusBadRequest}
+	}
+	c := helpers.ContainerFromRequestContext(r)
+	s.InventoryID = i.InventoryID
+	s.PersonID = c.PersonID
+	log.WithFields(log.Fields{"s": s}).Debug("CreateInventoryScanHandler")
+
+	if s, err = env.DB.CreateInventoryScan(s); err != nil {
+		return inventoryError(err, "create inventory scan error")
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s)
+	return nil
+}
+
+// GetInventoryReportHandler returns a json of the found, missing, misplaced and unknown items
+// of the inventory campaign with the requested id
+func (env *Env) GetInventoryReportHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		i      models.Inventory
+		report models.InventoryReport
+		err    error
+		aerr   *helpers.AppError
+	)
+
+	if i, aerr = env.getInventory(r, false); aerr != nil {
+		return aerr
+	}
+
+	if report, err = env.DB.GetInventoryReport(i.InventoryID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the inventory report",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+	return nil
+}
+
+// ArchiveInventoryMissingHandler archives the storages not scanned during the inventory campaign
+// with the requested id
+func (env *Env) ArchiveInventoryMissingHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		i    models.Inventory
+		n    int
+		err  error
+		aerr *helpers.AppError
+	)
+
+	if i, aerr = env.getInventory(r, true); aerr != nil {
+		return aerr
+	}
+
+	if n, err = env.DB.ArchiveInventoryMissing(i.InventoryID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "archive missing storages error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(n)
+	return nil
+}
+
+// MoveInventoryMisplacedHandler moves the storages scanned in another store location
+// during the inventory campaign with the requested id to this store location.
+// The storages are moved only if all of them pass the checks of a bulk move,
+// the returned report giving the error of each rejected storage.
+func (env *Env) MoveInventoryMisplacedHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		i        models.Inventory
+		report   models.InventoryReport
+		bulk     storageBulkReport
+		ids      []int
+		rejected bool
+		err      error
+		aerr     *helpers.AppError
+	)
+
+	if i, aerr = env.getInventory(r, true); aerr != nil {
+		return aerr
+	}
+	if report, err = env.DB.GetInventoryReport(i.InventoryID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the inventory report",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// checking all the storages first
+	c := helpers.ContainerFromRequestContext(r)
+	bulk.Operation = "move"
+	bulk.Items = []storageBulkItem{}
+	for _, m := range report.Misplaced {
+		id := int(m.StorageID.Int64)
+		item := storageBulkItem{StorageID: id}
+		op := models.StorageBulkOperation{Operation: "move", StoreLocationID: int(m.ScannedStoreLocationID.Int64)}
+		if s, err := env.DB.GetStorage(id); err != nil {
+			item.Error = "storage not found"
+		} else if aerr = env.checkStorageBulkItem(op, c.PersonID, s); aerr != nil {
+			if aerr.Code == http.StatusInternalServerError {
+				return aerr
+			}
+			item.Error = aerr.Message
+		} else {
+			ids = append(ids, id)
+		}
+		rejected = rejected || item.Error != ""
+		bulk.Items = append(bulk.Items, item)
+	}
+
+	if !rejected && len(ids) != 0 {
+		if _, err = env.DB.MoveInventoryMisplaced(i.InventoryID, c.PersonID, ids); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "move misplaced storages error",
+				Code:    http.StatusInternalServerError}
+		}
+		bulk.Applied = true
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(bulk)
+	return nil
+}
+
+// CreateInventoryUnknownHandler creates a storage of the product "product_id" for each unknown scan
+// "inventoryscan_ids" of the inventory campaign with the requested id, in its scanned store location
+func (env *Env) CreateInventoryUnknownHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		i      models.Inventory
+		f      inventoryUnknown
+		report models.InventoryReport
+		id     int
+		ids    []int
+		err    error
+		aerr   *helpers.AppError
+	)
+
+	if i, aerr = env.getInventory(r, true); aerr != nil {
+		return aerr
+	}
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	if err = global.Decoder.Decode(&f, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	log.WithFields(log.Fields{"f": f}).Debug("CreateInventoryUnknownHandler")
+
+	if _, err = env.DB.GetProduct(f.ProductID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the product",
+			Code:    http.StatusBadRequest}
+	}
+	if report, err = env.DB.GetInventoryReport(i.InventoryID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the inventory report",
+			Code:    http.StatusInternalServerError}
+	}
+	unknown := make(map[int64]models.InventoryItem)
+	for _, u := range report.Unknown {
+		unknown[u.InventoryScanID.Int64] = u
+	}
+
+	c := helpers.ContainerFromRequestContext(r)
+	for _, scanid := range f.InventoryScanIDs {
+		u, ok := unknown[int64(scanid)]
+		if !ok {
+			return &helpers.AppError{
+				Error:   errors.New("wrong scan"),
+				Message: "the storages can only be created for unknown scans",
+				Code:    http.StatusBadRequest}
+		}
+
+		var s models.Storage
+		if s.StoreLocation, err = env.DB.GetStoreLocation(int(u.ScannedStoreLocationID.Int64)); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "error retrieving the storage store location",
+				Code:    http.StatusInternalServerError}
+		}
+		s.StorageCreationDate = time.Now()
+		s.StorageModificationDate = s.StorageCreationDate
+		s.StorageEntryDate = global.NullTime{Valid: true, Time: s.StorageCreationDate}
+		s.StorageQuantity = f.StorageQuantity
+		s.StorageComment = sql.NullString{Valid: true, String: "inventory: " + u.InventoryScanCode.String}
+		s.StorageBarecode = sql.NullString{Valid: true, String: ""}
+		s.UnitID = f.UnitID
+		s.ProductID = f.ProductID
+		s.PersonID = c.PersonID
+
+		if id, err = env.DB.CreateStorage(s); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "create storage error",
+				Code:    http.StatusInternalServerError}
+		}
+		if err = env.DB.UpdateInventoryScanStorage(scanid, id); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "update inventory scan error",
+				Code:    http.StatusInternalServerError}
+		}
+		ids = append(ids, id)
+	}
+
+	type resp struct {
+		StorageIDs []int `json:"storage_ids"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{StorageIDs: ids})
+	return nil
+}
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/utils"
+)
+
+// storageLabel is the printed data of a storage label
+type storageLabel struct {
+	Name          string
+	CasNumber     string
+	SignalWord    string
+	Barecode      string
+	QRCode        []byte   // PNG image
+	QRData        string   // QR code content
+	Symbols       [][]byte // PNG images
+	StoreLocation string
+	Expiration    string
+}
+
+// symbolImage returns the PNG image of the "image/png;base64,..." symbol image s
+func symbolImage(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(s[strings.Index(s, ",")+1:])
+}
+
+// drawStorageLabel draws the label l in the w x h points box
+// with its top left corner at x, y:
+// the texts on the left, the QR code on the right, the pictograms below the texts
+// and the Code128 barecode at the bottom
+func drawStorageLabel(pdf *helpers.PDF, x, y, w, h float64, l storageLabel) error {
+	pad := math.Max(math.Min(w, h)*0.05, 3)
+	x, y, w, h = x+pad, y+pad, w-2*pad, h-2*pad
+
+	// font size and line height
+	fs := math.Max(math.Min(h/11, 10), 4)
+	lh := fs * 1.25
+
+	// barecode block at the bottom
+	bh := 0.0
+	if l.Barecode != "" {
+		bh = h*0.18 + lh
+	}
+
+	// QR code on the right
+	qs := 0.0
+	if len(l.QRCode) > 0 {
+		qs = math.Min(math.Min(h*0.5, w*0.3), h-bh-pad)
+		if err := pdf.Image(x+w-qs, y, qs, qs, l.QRCode); err != nil {
+			return err
+		}
+	}
+	tw := w - qs - pad
+
+	// texts
+	ty := y + fs
+	pdf.Text(x, ty, fs*1.15, true, helpers.FitText(fs*1.15, true, tw, l.Name))
+	ty += lh
+	line := l.CasNumber
+	if line != "" {
+		pdf.Text(x, ty, fs, false, helpers.FitText(fs, false, tw, line))
+		line += "  "
+	}
+	if l.SignalWord != "" {
+		sx := x + helpers.TextWidth(fs, false, line)
+		pdf.Text(sx, ty, fs, true, helpers.FitText(fs, true, x+tw-sx, strings.ToUpper(l.SignalWord)))
+	}
+	if line != "" || l.SignalWord != "" {
+		ty += lh
+	}
+	if l.StoreLocation != "" {
+		pdf.Text(x, ty, fs*0.9, false, helpers.FitText(fs*0.9, false, tw, l.StoreLocation))
+		ty += lh
+	}
+	if l.Expiration != "" {
+		pdf.Text(x, ty, fs*0.9, false, helpers.FitText(fs*0.9, false, tw, l.Expiration))
+		ty += lh
+	}
+
+	// pictograms in the space left between the texts and the barecode
+	if n := len(l.Symbols); n > 0 {
+		top := ty - fs + pad/2
+		ps := math.Min(y+h-bh-top-pad/2, tw/float64(n))
+		if ps > fs {
+			for i, s := range l.Symbols {
+				if err := pdf.Image(x+float64(i)*ps, top, ps, ps, s); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Code128 barecode with its text below
+	if l.Barecode != "" {
+		widths, err := utils.Code128(l.Barecode)
+		if err != nil {
+			return err
+		}
+		modules := 0
+		for _, m := range widths {
+			modules += m
+		}
+		// 10 modules quiet zones around the bars, 1 point modules at most
+		mw := math.Min(w/float64(modules+20), 1)
+		bx, by := x+10*mw, y+h-bh
+		for i, m := range widths {
+			if i%2 == 0 {
+				pdf.Rect(bx, by, float64(m)*mw, h*0.18)
+			}
+			bx += float64(m) * mw
+		}
+		pdf.Text(x+10*mw, y+h-fs*0.2, fs*0.9, false, l.Barecode)
+	}
+
+	return nil
+}
+
+// storageLabelsPDF returns the labels sheets of the template t,
+// the first skip labels of the first sheet being left blank
+func storageLabelsPDF(t helpers.LabelTemplate, skip int, labels []storageLabel) ([]byte, error) {
+	pdf := helpers.NewPDFSize(t.PageWidth, t.PageHeight)
+	for i, l := range labels {
+		n := (i + skip) % t.PerPage()
+		if n == 0 || i == 0 {
+			pdf.AddPage()
+		}
+		x, y := t.Position(n)
+		if err := drawStorageLabel(pdf, x, y, t.LabelWidth, t.LabelHeight, l); err != nil {
+			return nil, err
+		}
+	}
+	return pdf.Bytes(), nil
+}
+
+// storageLabels returns the labels of the storages s,
+// fetching the products CAS numbers, signal words and symbols
+func (env *Env) storageLabels(storages []models.Storage) ([]storageLabel, error) {
+	var (
+		labels   []storageLabel
+		products = make(map[int]models.Product)
+	)
+
+	for _, s := range storages {
+		p, ok := products[s.ProductID]
+		if !ok {
+			var err error
+			if p, err = env.DB.GetProduct(s.ProductID); err != nil {
+				return nil, err
+			}
+			products[s.ProductID] = p
+		}
+
+		l := storageLabel{
+			Name:          p.NameLabel,
+			CasNumber:     p.CasNumberLabel,
+			SignalWord:    p.SignalWordLabel.String,
+			Barecode:      s.StorageBarecode.String,
+			QRCode:        s.StorageQRCode,
+			QRData:        models.StorageQRCodeURL(s.StorageID.Int64),
+			StoreLocation: s.StoreLocationFullPath,
+		}
+		if s.StorageExpirationDate.Valid {
+			l.Expiration = global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "storage_expirationdate_title", PluralCount: 1}) +
+				": " + s.StorageExpirationDate.Time.Format("2006-01-02")
+		}
+		for _, sy := range p.Symbols {
+			img, err := symbolImage(sy.SymbolImage)
+			if err != nil {
+				return nil, err
+			}
+			l.Symbols = append(l.Symbols, img)
+		}
+		labels = append(labels, l)
+	}
+
+	return labels, nil
+}
+
+// labelTemplate returns the labels template of the request query q:
+// the name of a labels template in the "template" parameter, or "custom"
+// with the "width" and "height" parameters in millimeters for single labels
+func labelTemplate(q url.Values) (helpers.LabelTemplate, *helpers.AppError) {
+	switch name := q.Get("template"); name {
+	case "":
+		return helpers.LabelTemplates["avery-l7160"], nil
+	case "custom":
+		width, err := strconv.ParseFloat(q.Get("width"), 64)
+		height, herr := strconv.ParseFloat(q.Get("height"), 64)
+		if err != nil || herr != nil || width <= 0 || height <= 0 {
+			return helpers.LabelTemplate{}, &helpers.AppError{
+				Error:   errors.New("wrong label size"),
+				Message: "wrong label size",
+				Code:    http.StatusBadRequest}
+		}
+		return helpers.SingleLabelTemplate(name, width, height), nil
+	default:
+		t, ok := helpers.LabelTemplates[name]
+		if !ok {
+			return helpers.LabelTemplate{}, &helpers.AppError{
+				Error:   errors.New("unknown template " + name),
+				Message: "unknown template, available: custom, " + strings.Join(helpers.LabelTemplateNames(), ", "),
+				Code:    http.StatusBadRequest}
+		}
+		return t, nil
+	}
+}
+
+// labelStorages returns the storages with the ids "storage" of the request,
+// or else matching the storages list filter
+func (env *Env) labelStorages(r *http.Request) ([]models.Storage, *helpers.AppError) {
+	var (
+		err      error
+		aerr     *helpers.AppError
+		ok       bool
+		storages []models.Storage
+	)
+
+	ids, byid := r.URL.Query()["storage"]
+	if !byid {
+		var dsps helpers.DbselectparamStorage
+		if dsps, aerr = helpers.NewdbselectparamStorage(r, nil); aerr != nil {
+			return nil, aerr
+		}
+		if storages, _, err = env.DB.GetStorages(dsps); err != nil {
+			return nil, &helpers.AppError{
+				Error:   err,
+				Message: "error getting the storages",
+				Code:    http.StatusInternalServerError}
+		}
+		return storages, nil
+	}
+
+	c := helpers.ContainerFromRequestContext(r)
+	for _, sid := range ids {
+		var (
+			id int
+			s  models.Storage
+		)
+		if id, err = strconv.Atoi(sid); err != nil {
+			return nil, &helpers.AppError{
+				Error:   err,
+				Message: "id atoi conversion",
+				Code:    http.StatusBadRequest}
+		}
+		if s, err = env.DB.GetStorage(id); err != nil {
+			return nil, &helpers.AppError{
+				Error:   err,
+				Message: "error getting the storage",
+				Code:    http.StatusInternalServerError}
+		}
+		if ok, err = env.DB.HasPersonPermission(c.PersonID, "r", "storages", s.EntityID); err != nil {
+			return nil, &helpers.AppError{
+				Error:   err,
+				Message: "error getting the permissions",
+				Code:    http.StatusInternalServerError}
+		}
+		if !ok {
+			return nil, &helpers.AppError{
+				Error:   errors.New("unauthorized"),
+				Message: "unauthorized",
+				Code:    http.StatusForbidden}
+		}
+		storages = append(storages, s)
+	}
+	return storages, nil
+}
+
+// GetStoragesLabelsHandler returns the PDF labels sheets of the storages
+// with the ids "storage", or else matching the storages list filter,
+// see labelTemplate for the template parameters.
+// The "skip" parameter is the number of already used labels of the first sheet.
+func (env *Env) GetStoragesLabelsHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err      error
+		aerr     *helpers.AppError
+		t        helpers.LabelTemplate
+		skip     int
+		storages []models.Storage
+		labels   []storageLabel
+		pdf      []byte
+	)
+
+	if t, aerr = labelTemplate(r.URL.Query()); aerr != nil {
+		return aerr
+	}
+	if s := r.URL.Query().Get("skip"); s != "" {
+		if skip, err = strconv.Atoi(s); err != nil || skip < 0 {
+			return &helpers.AppError{
+				Error:   errors.New("wrong skip"),
+				Message: "wrong skip",
+				Code:    http.StatusBadRequest}
+		}
+		skip %= t.PerPage()
+	}
+	if storages, aerr = env.labelStorages(r); aerr != nil {
+		return aerr
+	}
+	log.WithFields(log.Fields{"template": t.Name, "skip": skip, "len(storages)": len(storages)}).Debug("GetStoragesLabelsHandler")
+
+	if labels, err = env.storageLabels(storages); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the labels",
+			Code:    http.StatusInternalServerError}
+	}
+	if pdf, err = storageLabelsPDF(t, skip, labels); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error drawing the labels",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "attachment;filename=labels.pdf")
+	if _, err = w.Write(pdf); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error writing the labels",
+			Code:    http.StatusInternalServerError}
+	}
+	return nil
+}
@@ -197,18 +197,41 @@ func (env *Env) AuthorizeMiddleware(h http.Handler) http.Handler {
 		// id and item translations and setup for the HasPersonPermission method, and some bypasses
 		//
 		switch item {
-		case "peoplepass", "peoplep", "bookmarks", "delete-token", "borrowings", "download":
+		case "peoplepass", "peoplep", "bookmarks", "delete-token", "borrowings", "download", "transfers", "borrowrequests", "purchases", "disposals", "inventories":
 			// everybody can change his password
 			// everybody can bookmark a product
 			// everybody can borrow a storage
 			// everybody can logout
 			// everybody can download an export
+			// transfers decisions are checked against the target entity managers
+			// borrow requests are checked against the requester and the holding entity managers
+			// purchases are checked against the entity members and managers
+			// disposal batches are checked against the entity members and managers
+			// inventory campaigns are checked against the entity members and managers
 			h.ServeHTTP(w, r)
 			return
-		case "welcomeannounce":
+		case "welcomeannounce", "incompatibilities":
 			// welcome announcements are editable by admins only
+			// incompatibility rules are managed by admins only
 			item = "entities"
 			id = "-1"
+		case "suppliers", "supplierrefs":
+			// the supplier catalogue is readable by the people who can see the products
+			// and managed by admins only
+			if r.Method == "GET" {
+				item = "products"
+				id = "-2"
+			} else {
+				item = "entities"
+				id = "-1"
+			}
+		case "products":
+			// merging products deletes the from product and moves the storages
+			// of all the entities, by admins only
+			if _, ok := vars["from"]; ok {
+				item = "entities"
+				id = "-1"
+			}
 		case "stocks":
 			// to access stocks, one needs permission on at least one storage
 			item = "storages"
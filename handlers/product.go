@@ -120,6 +120,322 @@ func (env *Env) MagicHandler(w http.ResponseWriter, r *http.Request) *helpers.Ap
 	return nil
 }
 
+// GetProductsClpClassificationHandler returns the symbols and signal word
+// inferred from the hazard statements of the request form
+func (env *Env) GetProductsClpClassificationHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	log.Debug("GetProductsClpClassificationHandler")
+
+	// form receiver
+	type clp struct {
+		HazardStatements []models.HazardStatement `schema:"hazardstatements"`
+	}
+
+	var (
+		err        error
+		c          clp
+		hs         models.HazardStatement
+		references []string
+		resp       models.ClpClassification
+	)
+
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	if err = global.Decoder.Decode(&c, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+
+	// the product form only sends the statements ids
+	for _, h := range c.HazardStatements {
+		if h.HazardStatementReference == "" {
+			if hs, err = env.DB.GetProductsHazardStatement(h.HazardStatementID); err != nil {
+				return &helpers.AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "error getting hazard statement",
+				}
+			}
+			h.HazardStatementReference = hs.HazardStatementReference
+		}
+		references = append(references, h.HazardStatementReference)
+	}
+
+	if resp, err = env.DB.GetProductsClpClassification(references); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the classification",
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+	return nil
+}
+
+// UpdateProductClpClassificationHandler sets the symbols and signal word
+// of the product with the requested id from its hazard statements
+func (env *Env) UpdateProductClpClassificationHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id         int
+		err        error
+		p          models.Product
+		c          models.ClpClassification
+		references []string
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if p, err = env.DB.GetProduct(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the product",
+		}
+	}
+	for _, h := range p.HazardStatements {
+		references = append(references, h.HazardStatementReference)
+	}
+
+	if c, err = env.DB.GetProductsClpClassification(references); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the classification",
+		}
+	}
+	p.Symbols = c.Symbols
+	// keeping the current signal word if it depends on the hazard category
+	if c.SignalWord.SignalWordID.Valid {
+		p.SignalWord = c.SignalWord
+	}
+	log.WithFields(log.Fields{"p": p}).Debug("UpdateProductClpClassificationHandler")
+
+	if err = env.DB.UpdateProduct(p); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "update product error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(p)
+	return nil
+}
+
+// GetProductsClpInconsistenciesHandler returns a json list of the products
+// whose symbols or signal word disagree with their hazard statements
+func (env *Env) GetProductsClpInconsistenciesHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	log.Debug("GetProductsClpInconsistenciesHandler")
+
+	var (
+		err             error
+		inconsistencies []models.ClpInconsistency
+	)
+
+	if inconsistencies, err = env.DB.GetProductsClpInconsistencies(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the classification inconsistencies",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.ClpInconsistency `json:"rows"`
+		Total int                       `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: inconsistencies, Total: len(inconsistencies)})
+	return nil
+}
+
+// GetProductsDuplicatesHandler returns a json list of the groups of products suspected to be duplicates
+func (env *Env) GetProductsDuplicatesHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	log.Debug("GetProductsDuplicatesHandler")
+
+	var (
+		err        error
+		duplicates []models.ProductDuplicate
+	)
+
+	if duplicates, err = env.DB.GetProductsDuplicates(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the duplicates",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.ProductDuplicate `json:"rows"`
+		Total int                       `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: duplicates, Total: len(duplicates)})
+	return nil
+}
+
+// GetProductsMergesHandler returns a json list of the product merges
+func (env *Env) GetProductsMergesHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	log.Debug("GetProductsMergesHandler")
+
+	var (
+		err    error
+		merges []models.ProductMerge
+	)
+
+	if merges, err = env.DB.GetProductsMerges(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the merges",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.ProductMerge `json:"rows"`
+		Total int                   `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: merges, Total: len(merges)})
+	return nil
+}
+
+// MergeProductHandler merges the product with the from id passed in the request vars
+// into the product with the id passed in the request vars, admins only
+func (env *Env) MergeProductHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id   int
+		from int
+		err  error
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	if from, err = strconv.Atoi(vars["from"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "from atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	if id == from {
+		return &helpers.AppError{
+			Message: "can not merge a product into itself",
+			Code:    http.StatusBadRequest}
+	}
+
+	// retrieving the logged user id from request context
+	c := helpers.ContainerFromRequestContext(r)
+
+	if err = env.DB.MergeProduct(from, id, c.PersonID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "merge product error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	p, err := env.DB.GetProduct(id)
+	if err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "get product error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(p)
+	return nil
+}
+
+// GetProductReferenceHandler returns a json product prefilled from the reference datasets
+// matching the casnumber, name or inchikey request parameters
+func (env *Env) GetProductReferenceHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err error
+		pr  models.ProductReference
+	)
+
+	q := r.URL.Query()
+	if q.Get("casnumber") == "" && q.Get("name") == "" && q.Get("inchikey") == "" {
+		return &helpers.AppError{
+			Message: "casnumber, name or inchikey required",
+			Code:    http.StatusBadRequest}
+	}
+	log.WithFields(log.Fields{"q": q}).Debug("GetProductReferenceHandler")
+
+	if pr, err = env.DB.GetProductReference(q.Get("casnumber"), q.Get("name"), q.Get("inchikey")); err != nil {
+		if err == sql.ErrNoRows {
+			return &helpers.AppError{
+				Message: "no reference compound found",
+				Code:    http.StatusNotFound}
+		}
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the reference compound",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(pr)
+	return nil
+}
+
+// GetReferenceDatasetsHandler returns a json list of the imported reference datasets
+func (env *Env) GetReferenceDatasetsHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	log.Debug("GetReferenceDatasetsHandler")
+
+	var (
+		err      error
+		datasets []models.ReferenceDataset
+	)
+
+	if datasets, err = env.DB.GetReferenceDatasets(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the reference datasets",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.ReferenceDataset `json:"rows"`
+		Total int                       `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: datasets, Total: len(datasets)})
+	return nil
+}
+
 // ToogleProductBookmarkHandler (un)bookmarks the product with id passed in the request vars
 // for the logged user.
 func (env *Env) ToogleProductBookmarkHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
@@ -911,6 +1227,44 @@ func (env *Env) GetProductHandler(w http.ResponseWriter, r *http.Request) *helpe
 	return nil
 }
 
+// checkProductSmiles checks that the SMILES of the product p is valid
+// and matches its empirical formula
+func (env *Env) checkProductSmiles(p models.Product) *helpers.AppError {
+	var (
+		err error
+		ef  string
+		pef models.EmpiricalFormula
+	)
+
+	if !p.ProductSmiles.Valid || p.ProductSmiles.String == "" {
+		return nil
+	}
+	if ef, err = utils.SmilesToEmpiricalFormula(p.ProductSmiles.String); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "invalid SMILES: " + err.Error(),
+			Code:    http.StatusBadRequest}
+	}
+
+	// new empirical formula
+	pef = p.EmpiricalFormula
+	if pef.EmpiricalFormulaID != -1 {
+		if pef, err = env.DB.GetProductsEmpiricalFormula(pef.EmpiricalFormulaID); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "get empirical formula error",
+				Code:    http.StatusInternalServerError}
+		}
+	}
+	if pef.EmpiricalFormulaLabel != "XXXX" && !utils.SameEmpiricalFormula(ef, pef.EmpiricalFormulaLabel) {
+		return &helpers.AppError{
+			Message: "the SMILES formula " + ef + " does not match the empirical formula " + pef.EmpiricalFormulaLabel,
+			Code:    http.StatusBadRequest}
+	}
+
+	return nil
+}
+
 // CreateProductHandler creates the product from the request form
 func (env *Env) CreateProductHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
 	log.Debug("CreateProductHandler")
@@ -938,7 +1292,17 @@ func (env *Env) CreateProductHandler(w http.ResponseWriter, r *http.Request) *he
 	p.PersonID = c.PersonID
 	log.WithFields(log.Fields{"p": p}).Debug("CreateProductHandler")
 
+	if aerr := env.checkProductSmiles(p); aerr != nil {
+		return aerr
+	}
+
 	if p.ProductID, err = env.DB.CreateProduct(p); err != nil {
+		if err == models.ErrProductComponent {
+			return &helpers.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
 		return &helpers.AppError{
 			Error:   err,
 			Message: "create product error",
@@ -1002,16 +1366,28 @@ func (env *Env) UpdateProductHandler(w http.ResponseWriter, r *http.Request) *he
 	updatedp.LinearFormula = p.LinearFormula
 	updatedp.ProductThreeDFormula = p.ProductThreeDFormula
 	updatedp.ProductMolFormula = p.ProductMolFormula
+	updatedp.ProductSmiles = p.ProductSmiles
+	updatedp.ProductInchi = p.ProductInchi
+	updatedp.ProductInchiKey = p.ProductInchiKey
 	updatedp.ProductDisposalComment = p.ProductDisposalComment
 	updatedp.ProductRemark = p.ProductRemark
+	updatedp.ProductShelfLifeReception = p.ProductShelfLifeReception
+	updatedp.ProductShelfLifeOpening = p.ProductShelfLifeOpening
 	updatedp.PhysicalState = p.PhysicalState
 	updatedp.SignalWord = p.SignalWord
 	updatedp.ClassOfCompound = p.ClassOfCompound
 	updatedp.HazardStatements = p.HazardStatements
 	updatedp.PrecautionaryStatements = p.PrecautionaryStatements
+	updatedp.Components = p.Components
 	log.WithFields(log.Fields{"updatedp": updatedp}).Debug("UpdateProductHandler")
 
 	if err := env.DB.UpdateProduct(updatedp); err != nil {
+		if err == models.ErrProductComponent {
+			return &helpers.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
 		return &helpers.AppError{
 			Error:   err,
 			Message: "update product error",
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// GetProductClassificationHandler returns a json of the classification suggested
+// for the mixture product with the requested id from its components
+func (env *Env) GetProductClassificationHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		c   models.ProductClassification
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if c, err = env.DB.GetProductClassification(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the product classification",
+			Code:    http.StatusInternalServerError}
+	}
+	log.WithFields(log.Fields{"id": id, "c": c}).Debug("GetProductClassificationHandler")
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(c)
+	return nil
+}
+
+// PrepareMixtureHandler creates a storage of a mixture product from the source storages
+// of the request form, the sources fields being named sources.0.storage_id, sources.0.quantity...
+// The sources must be storages of the mixture components in the entity of the store location.
+func (env *Env) PrepareMixtureHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		p   models.MixturePreparation
+		e   models.Entity
+		s   models.Storage
+		ok  bool
+		id  int
+		err error
+	)
+
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	if err = global.Decoder.Decode(&p, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	if p.ProductID <= 0 || p.StorageQuantity <= 0 || p.StoreLocationID <= 0 || len(p.Sources) == 0 {
+		return &helpers.AppError{
+			Error:   errors.New("wrong preparation"),
+			Message: "the preparation requires a product, a positive quantity, a store location and sources",
+			Code:    http.StatusBadRequest}
+	}
+
+	// retrieving the logged user id from request context
+	c := helpers.ContainerFromRequestContext(r)
+	p.PersonID = c.PersonID
+	log.WithFields(log.Fields{"p": p}).Debug("PrepareMixtureHandler")
+
+	if e, err = env.DB.GetStoreLocationEntity(p.StoreLocationID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the store location entity",
+			Code:    http.StatusInternalServerError}
+	}
+	if ok, err = env.DB.HasPersonPermission(p.PersonID, "w", "storages", e.EntityID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the permissions",
+			Code:    http.StatusInternalServerError}
+	}
+	if !ok {
+		return &helpers.AppError{
+			Error:   errors.New("unauthorized"),
+			Message: "unauthorized",
+			Code:    http.StatusForbidden}
+	}
+
+	sources := make([]models.Storage, 0, len(p.Sources))
+	for _, src := range p.Sources {
+		if src.Quantity <= 0 {
+			return &helpers.AppError{
+				Error:   errors.New("wrong source quantity"),
+				Message: "the sources quantities must be positive",
+				Code:    http.StatusBadRequest}
+		}
+		if s, err = env.DB.GetStorage(src.StorageID); err != nil {
+			if err == sql.ErrNoRows {
+				return &helpers.AppError{
+					Error:   err,
+					Message: "source storage not found",
+					Code:    http.StatusNotFound}
+			}
+			return &helpers.AppError{
+				Error:   err,
+				Message: "error getting the source storage",
+				Code:    http.StatusInternalServerError}
+		}
+		if s.EntityID != e.EntityID {
+			return &helpers.AppError{
+				Error:   errors.New("source storage of another entity"),
+				Message: "the source storages must be in the entity of the store location",
+				Code:    http.StatusBadRequest}
+		}
+		sources = append(sources, s)
+	}
+
+	// checking incompatibilities in the store location
+	s = models.Storage{
+		Product:       models.Product{ProductID: p.ProductID},
+		StoreLocation: models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(p.StoreLocationID)}},
+	}
+	if aerr := env.checkStorageIncompatibilities(&s); aerr != nil {
+		return aerr
+	}
+
+	if id, err = env.DB.PrepareMixture(p); err != nil {
+		switch err {
+		case models.ErrMixtureSource, models.ErrConsumptionUnit, models.ErrConsumptionQuantity:
+			return &helpers.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error preparing the mixture",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// checking the components stock thresholds
+	for _, src := range sources {
+		go env.notifyLowStocks(src.ProductID, src.EntityID)
+	}
+
+	if s, err = env.DB.GetStorage(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the storage",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s)
+	return nil
+}
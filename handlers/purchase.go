@@ -0,0 +1,557 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// purchaseReception is the form sent by a manager when a purchase is received
+type purchaseReception struct {
+	StoreLocationID       int             `schema:"storelocation_id"`
+	StorageBatchNumber    sql.NullString  `schema:"storage_batchnumber"`
+	StorageEntryDate      global.NullTime `schema:"storage_entrydate"`
+	StorageExpirationDate global.NullTime `schema:"storage_expirationdate"`
+}
+
+// sendPurchaseMail emails the entity managers of a new purchase request p
+// or its requester when its status changes
+func (env *Env) sendPurchaseMail(p models.Purchase) {
+	var (
+		err      error
+		managers []models.Person
+		to       []string
+	)
+
+	if global.MailServerAddress == "" {
+		return
+	}
+
+	if p.PurchaseStatus == "requested" {
+		if managers, err = env.DB.GetEntityPeople(p.EntityID); err != nil {
+			log.Error("purchase managers - " + err.Error())
+			return
+		}
+		for _, m := range managers {
+			to = append(to, m.PersonEmail)
+		}
+	} else {
+		to = append(to, p.PersonEmail)
+	}
+
+	msgsubject := fmt.Sprintf(global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "purchase_mailsubject", PluralCount: 1}), p.NameLabel, p.PurchaseStatus)
+	msgbody := fmt.Sprintf(global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "purchase_mailbody", PluralCount: 1}),
+		p.PersonEmail, p.PurchaseNbItem, p.NameLabel, p.SupplierLabel.String, p.EntityName, p.PurchaseStatus)
+	for _, t := range to {
+		if err = sendMail(t, msgsubject, msgbody); err != nil {
+			log.Error("purchase mail to " + t + " - " + err.Error())
+		}
+	}
+}
+
+// isEntityManager returns true if the person with id personid is a manager
+// of the entity with id entityid or an admin
+func (env *Env) isEntityManager(personid int, entityid int) (bool, error) {
+	var (
+		err      error
+		admin    bool
+		managers []models.Person
+	)
+
+	if admin, err = env.DB.IsPersonAdmin(personid); err != nil || admin {
+		return admin, err
+	}
+	if managers, err = env.DB.GetEntityPeople(entityid); err != nil {
+		return false, err
+	}
+	for _, m := range managers {
+		if m.PersonID == personid {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// isEntityMember returns true if the person with id personid belongs
+// to the entity with id entityid or is an admin
+func (env *Env) isEntityMember(personid int, entityid int) (bool, error) {
+	var (
+		err      error
+		entities []models.Entity
+	)
+
+	if entities, err = env.DB.GetPersonEntities(personid, personid); err != nil {
+		return false, err
+	}
+	for _, e := range entities {
+		if e.EntityID == entityid {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// getPurchase returns the purchase with id passed in the request vars
+// if the logged user is a member of its entity
+func (env *Env) getPurchase(r *http.Request) (models.Purchase, *helpers.AppError) {
+	var (
+		err    error
+		id     int
+		p      models.Purchase
+		member bool
+	)
+	vars := mux.Vars(r)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return models.Purchase{}, &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	if p, err = env.DB.GetPurchase(id); err != nil {
+		return models.Purchase{}, &helpers.AppError{
+			Error:   err,
+			Message: "error getting the purchase",
+			Code:    http.StatusNotFound}
+	}
+
+	c := helpers.ContainerFromRequestContext(r)
+	if member, err = env.isEntityMember(c.PersonID, p.EntityID); err != nil {
+		return models.Purchase{}, &helpers.AppError{
+			Error:   err,
+			Message: "error getting the person entities",
+			Code:    http.StatusInternalServerError}
+	}
+	if !member {
+		return models.Purchase{}, &helpers.AppError{
+			Message: "only the entity members can access a purchase",
+			Code:    http.StatusForbidden}
+	}
+
+	return p, nil
+}
+
+// updatePurchaseStatus moves the purchase p to the status for the logged user
+// and writes the updated purchase
+func (env *Env) updatePurchaseStatus(w http.ResponseWriter, r *http.Request, p models.Purchase, status string) *helpers.AppError {
+	var err error
+
+	c := helpers.ContainerFromRequestContext(r)
+	if err = env.DB.UpdatePurchaseStatus(p.PurchaseID, c.PersonID, status); err != nil {
+		if err == models.ErrPurchaseStatus {
+			return &helpers.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusConflict}
+		}
+		return &helpers.AppError{
+			Error:   err,
+			Message: "update purchase status error",
+			Code:    http.StatusInternalServerError}
+	}
+	if p, err = env.DB.GetPurchase(p.PurchaseID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the purchase",
+			Code:    http.StatusInternalServerError}
+	}
+
+	go env.sendPurchaseMail(p)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(p)
+	return nil
+}
+
+// managedPurchaseHandler returns a handler moving the purchase with the requested id
+// to the status, for the managers of its entity only
+func (env *Env) managedPurchaseHandler(status string) func(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	return func(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+		var (
+			err     error
+			aerr    *helpers.AppError
+			p       models.Purchase
+			manager bool
+		)
+
+		if p, aerr = env.getPurchase(r); aerr != nil {
+			return aerr
+		}
+		c := helpers.ContainerFromRequestContext(r)
+		if manager, err = env.isEntityManager(c.PersonID, p.EntityID); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "error getting the entity managers",
+				Code:    http.StatusInternalServerError}
+		}
+		if !manager {
+			return &helpers.AppError{
+				Message: "only the entity managers can change the purchase status",
+				Code:    http.StatusForbidden}
+		}
+
+		return env.updatePurchaseStatus(w, r, p, status)
+	}
+}
+
+/*
+	REST handlers
+*/
+
+// CreatePurchaseHandler creates a purchase request for the logged user from the request form
+func (env *Env) CreatePurchaseHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err    error
+		id     int
+		p      models.Purchase
+		member bool
+	)
+
+	// parsing request form
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	// decoding request form
+	if err = global.Decoder.Decode(&p, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	if (p.PurchaseQuantity.Valid && p.PurchaseQuantity.Float64 <= 0) || (p.PurchasePrice.Valid && p.PurchasePrice.Float64 < 0) || p.PurchaseNbItem < 0 {
+		return &helpers.AppError{
+			Error:   errors.New("wrong purchase quantity or price"),
+			Message: "the purchase quantities and price must be positive",
+			Code:    http.StatusBadRequest}
+	}
+
+	c := helpers.ContainerFromRequestContext(r)
+	p.PersonID = c.PersonID
+	log.WithFields(log.Fields{"p": p}).Debug("CreatePurchaseHandler")
+
+	if member, err = env.isEntityMember(c.PersonID, p.EntityID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the person entities",
+			Code:    http.StatusInternalServerError}
+	}
+	if !member {
+		return &helpers.AppError{
+			Message: "purchases can only be requested for your entities",
+			Code:    http.StatusForbidden}
+	}
+
+	if id, err = env.DB.CreatePurchase(p); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "create purchase error",
+			Code:    http.StatusInternalServerError}
+	}
+	if p, err = env.DB.GetPurchase(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the purchase",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// asking the entity managers
+	go env.sendPurchaseMail(p)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(p)
+	return nil
+}
+
+// GetPurchaseHandler returns a json of the purchase with the requested id
+func (env *Env) GetPurchaseHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		aerr *helpers.AppError
+		p    models.Purchase
+	)
+
+	if p, aerr = env.getPurchase(r); aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(p)
+	return nil
+}
+
+// GetEntityPurchasesHandler returns a json list of the purchases of the entity with the requested id.
+// The "open" query parameter restricts the list to the purchases not received yet.
+func (env *Env) GetEntityPurchasesHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		ps  []models.Purchase
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	open, _ := strconv.ParseBool(r.URL.Query().Get("open"))
+	if ps, err = env.DB.GetEntityPurchases(id, open); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the entity purchases",
+			Code:    http.StatusInternalServerError}
+	}
+
+	type resp struct {
+		Rows  []models.Purchase `json:"rows"`
+		Total int               `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: ps, Total: len(ps)})
+	return nil
+}
+
+// GetEntitySpendingsHandler returns a json list of the amounts spent per supplier
+// by the entity with the requested id between the "from" and "to" query parameters dates,
+// the current year by default
+func (env *Env) GetEntitySpendingsHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		ss  []models.SupplierSpending
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	now := time.Now()
+	from := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+	to := from.AddDate(1, 0, 0)
+	if f := r.URL.Query().Get("from"); f != "" {
+		if from, err = time.Parse("2006-01-02", f); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "wrong from date",
+				Code:    http.StatusBadRequest}
+		}
+	}
+	if t := r.URL.Query().Get("to"); t != "" {
+		if to, err = time.Parse("2006-01-02", t); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "wrong to date",
+				Code:    http.StatusBadRequest}
+		}
+		// the to date is included
+		to = to.AddDate(0, 0, 1)
+	}
+
+	if ss, err = env.DB.GetEntitySpendings(id, from, to); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the entity spendings",
+			Code:    http.StatusInternalServerError}
+	}
+
+	type resp struct {
+		Rows  []models.SupplierSpending `json:"rows"`
+		Total float64                   `json:"total"`
+	}
+	var total float64
+	for _, s := range ss {
+		total += s.Total
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: ss, Total: total})
+	return nil
+}
+
+// ApprovePurchaseHandler approves the purchase request with the requested id
+func (env *Env) ApprovePurchaseHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	return env.managedPurchaseHandler("approved")(w, r)
+}
+
+// RefusePurchaseHandler refuses the purchase request with the requested id
+func (env *Env) RefusePurchaseHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	return env.managedPurchaseHandler("refused")(w, r)
+}
+
+// OrderPurchaseHandler sets the approved purchase with the requested id as ordered
+func (env *Env) OrderPurchaseHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	return env.managedPurchaseHandler("ordered")(w, r)
+}
+
+// CancelPurchaseHandler cancels the purchase with the requested id
+// for its requester or the entity managers
+func (env *Env) CancelPurchaseHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err     error
+		aerr    *helpers.AppError
+		p       models.Purchase
+		manager bool
+	)
+
+	if p, aerr = env.getPurchase(r); aerr != nil {
+		return aerr
+	}
+	c := helpers.ContainerFromRequestContext(r)
+	if p.PersonID != c.PersonID {
+		if manager, err = env.isEntityManager(c.PersonID, p.EntityID); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "error getting the entity managers",
+				Code:    http.StatusInternalServerError}
+		}
+		if !manager {
+			return &helpers.AppError{
+				Message: "only the requester and the entity managers can cancel a purchase",
+				Code:    http.StatusForbidden}
+		}
+	}
+
+	return env.updatePurchaseStatus(w, r, p, "cancelled")
+}
+
+// ReceivePurchaseHandler sets the ordered purchase with the requested id as received
+// and creates its storages in the store location of the request form
+func (env *Env) ReceivePurchaseHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err     error
+		aerr    *helpers.AppError
+		p       models.Purchase
+		pr      purchaseReception
+		s       models.Storage
+		manager bool
+		ids     []int
+	)
+
+	if p, aerr = env.getPurchase(r); aerr != nil {
+		return aerr
+	}
+	c := helpers.ContainerFromRequestContext(r)
+	if manager, err = env.isEntityManager(c.PersonID, p.EntityID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the entity managers",
+			Code:    http.StatusInternalServerError}
+	}
+	if !manager {
+		return &helpers.AppError{
+			Message: "only the entity managers can receive a purchase",
+			Code:    http.StatusForbidden}
+	}
+
+	// parsing request form
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	// decoding request form
+	if err = global.Decoder.Decode(&pr, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	log.WithFields(log.Fields{"p": p, "pr": pr}).Debug("ReceivePurchaseHandler")
+
+	// the storages are created in a store location of the purchase entity
+	if s.StoreLocation, err = env.DB.GetStoreLocation(pr.StoreLocationID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error retrieving the storage store location",
+			Code:    http.StatusBadRequest}
+	}
+	if s.EntityID != p.EntityID || !s.StoreLocationCanStore.Bool {
+		return &helpers.AppError{
+			Error:   errors.New("wrong store location"),
+			Message: "the storages must be received in a store location of the purchase entity",
+			Code:    http.StatusBadRequest}
+	}
+
+	s.StorageCreationDate = time.Now()
+	s.StorageModificationDate = s.StorageCreationDate
+	s.StorageEntryDate = pr.StorageEntryDate
+	if !s.StorageEntryDate.Valid {
+		s.StorageEntryDate = global.NullTime{Valid: true, Time: s.StorageCreationDate}
+	}
+	s.StorageExpirationDate = pr.StorageExpirationDate
+	s.StorageBatchNumber = pr.StorageBatchNumber
+	s.StorageReference = p.PurchaseReference
+	s.StorageQuantity = p.PurchaseQuantity
+	s.StorageBarecode = sql.NullString{Valid: true, String: ""}
+	s.UnitID = p.UnitID
+	s.SupplierID = p.SupplierID
+	s.ProductID = p.ProductID
+	s.PersonID = c.PersonID
+
+	// checking incompatibilities in the store location
+	if aerr = env.checkStorageIncompatibilities(&s); aerr != nil {
+		return aerr
+	}
+
+	// the purchase can be received only once
+	if ids, err = env.DB.ReceivePurchase(p, s); err != nil {
+		switch err {
+		case models.ErrPurchaseStatus, models.ErrStorageBarecodeUsed:
+			return &helpers.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusConflict}
+		}
+		return &helpers.AppError{
+			Error:   err,
+			Message: "purchase reception error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if p, err = env.DB.GetPurchase(p.PurchaseID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the purchase",
+			Code:    http.StatusInternalServerError}
+	}
+
+	go env.sendPurchaseMail(p)
+
+	type resp struct {
+		Purchase   models.Purchase `json:"purchase"`
+		StorageIDs []int           `json:"storage_ids"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Purchase: p, StorageIDs: ids})
+	return nil
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/utils"
+)
+
+// scanResult is the result of a barcode scan: an existing storage,
+// or a storage prefilled from a GS1 element string
+type scanResult struct {
+	Kind    string         `json:"kind"` // storage or gs1
+	GS1     *utils.GS1     `json:"gs1,omitempty"`
+	Storage models.Storage `json:"storage"`
+}
+
+// gs1Storage returns a new storage prefilled with the GS1 element string g data
+// and the supplier reference matching its GTIN
+func (env *Env) gs1Storage(g utils.GS1) (models.Storage, error) {
+	var (
+		s    models.Storage
+		u    models.Unit
+		refs []models.SupplierRef
+		err  error
+	)
+
+	if g.Batch != "" {
+		s.StorageBatchNumber = sql.NullString{Valid: true, String: g.Batch}
+	}
+	if !g.Expiry.IsZero() {
+		s.StorageExpirationDate = global.NullTime{Valid: true, Time: g.Expiry}
+	}
+	if g.Quantity != 0 {
+		s.StorageQuantity = sql.NullFloat64{Valid: true, Float64: g.Quantity}
+		if g.QuantityUnit != "" {
+			if u, err = env.DB.GetUnitByLabel(g.QuantityUnit); err != nil && err != sql.ErrNoRows {
+				return models.Storage{}, err
+			}
+			s.Unit = u
+		}
+	}
+
+	if g.GTIN == "" {
+		return s, nil
+	}
+	if refs, err = env.DB.GetSupplierRefs(models.SupplierRefSearch{GTIN: g.GTIN}); err != nil {
+		return models.Storage{}, err
+	}
+	if len(refs) == 0 {
+		return s, nil
+	}
+
+	ref := refs[0]
+	s.ProductID = ref.ProductID
+	s.Product.Name.NameLabel = ref.NameLabel
+	s.SupplierID = sql.NullInt64{Valid: true, Int64: int64(ref.SupplierID)}
+	s.SupplierLabel = sql.NullString{Valid: true, String: ref.SupplierLabel}
+	s.StorageReference = sql.NullString{Valid: true, String: ref.SupplierRefLabel}
+	// the trade measure of the barcode prevails over the catalogue pack size
+	if !s.StorageQuantity.Valid && ref.SupplierRefQuantity.Valid {
+		s.StorageQuantity = ref.SupplierRefQuantity
+		s.UnitID = ref.UnitID
+		s.UnitLabel = ref.UnitLabel
+	}
+
+	return s, nil
+}
+
+// ScanStorageHandler returns a json of the storage matching the scanned code passed in the "code" query parameter:
+// a storage barecode or QR code, or else a storage prefilled from a GS1 element string
+func (env *Env) ScanStorageHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err       error
+		id        int
+		ok        bool
+		entities  []models.Entity
+		entityids []int
+		res       scanResult
+	)
+
+	code := strings.TrimSpace(r.URL.Query().Get("code"))
+	if code == "" {
+		return &helpers.AppError{
+			Error:   errors.New("empty code"),
+			Message: "the code is required",
+			Code:    http.StatusBadRequest}
+	}
+
+	c := helpers.ContainerFromRequestContext(r)
+	if entities, err = env.DB.GetPersonEntities(c.PersonID, c.PersonID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the person entities",
+			Code:    http.StatusInternalServerError}
+	}
+	for _, e := range entities {
+		entityids = append(entityids, e.EntityID)
+	}
+
+	id, err = env.DB.GetStorageIDByCode(code, entityids)
+	switch {
+	case err == nil:
+		if res.Storage, err = env.DB.GetStorage(id); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "error getting the storage",
+				Code:    http.StatusInternalServerError}
+		}
+		if ok, err = env.DB.HasPersonPermission(c.PersonID, "r", "storages", res.Storage.EntityID); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "error getting the permissions",
+				Code:    http.StatusInternalServerError}
+		}
+		if !ok {
+			return &helpers.AppError{
+				Error:   errors.New("unauthorized"),
+				Message: "unauthorized",
+				Code:    http.StatusForbidden}
+		}
+		res.Kind = "storage"
+	case err != sql.ErrNoRows:
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the storage",
+			Code:    http.StatusInternalServerError}
+	case utils.IsGS1(code):
+		var g utils.GS1
+		if g, err = utils.ParseGS1(code); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
+		if res.Storage, err = env.gs1Storage(g); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "error prefilling the storage",
+				Code:    http.StatusInternalServerError}
+		}
+		res.Kind = "gs1"
+		res.GS1 = &g
+	default:
+		return &helpers.AppError{
+			Error:   errors.New("unknown code"),
+			Message: "unknown code",
+			Code:    http.StatusNotFound}
+	}
+	log.WithFields(log.Fields{"code": code, "res": res}).Debug("ScanStorageHandler")
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+	return nil
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// notifyLowStocks emails the managers of the entity with id entityid
+// when the stock of the product with id productid drops under one of its thresholds
+func (env *Env) notifyLowStocks(productid int, entityid int) {
+	var (
+		err      error
+		low      []models.StockThreshold
+		managers []models.Person
+		body     strings.Builder
+	)
+
+	if low, err = env.DB.CheckStockThresholds(productid, entityid); err != nil {
+		log.Error("low stocks - " + err.Error())
+		return
+	}
+	if len(low) == 0 || global.MailServerAddress == "" {
+		return
+	}
+	if managers, err = env.DB.GetEntityPeople(entityid); err != nil {
+		log.Error("low stocks managers - " + err.Error())
+		return
+	}
+
+	for _, t := range low {
+		body.WriteString(fmt.Sprintf(global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "lowstock_mailbody", PluralCount: 1}),
+			t.NameLabel, t.StockThresholdCurrent, t.UnitLabel, t.StockThresholdQuantity, t.UnitLabel))
+		body.WriteString("\r\n")
+	}
+	msgsubject := fmt.Sprintf(global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "lowstock_mailsubject", PluralCount: 1}), low[0].EntityName)
+	for _, m := range managers {
+		if err = sendMail(m.PersonEmail, msgsubject, body.String()); err != nil {
+			log.Error("low stocks mail to " + m.PersonEmail + " - " + err.Error())
+		}
+	}
+}
+
+/*
+	REST handlers
+*/
+
+// GetEntityStockThresholdsHandler returns a json list of the stock thresholds of the entity with the requested id
+func (env *Env) GetEntityStockThresholdsHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		ts  []models.StockThreshold
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if ts, err = env.DB.GetStockThresholds(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the stock thresholds",
+			Code:    http.StatusInternalServerError}
+	}
+
+	type resp struct {
+		Rows  []models.StockThreshold `json:"rows"`
+		Total int                     `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: ts, Total: len(ts)})
+	return nil
+}
+
+// GetEntityLowStocksHandler returns a json list of the stock thresholds of the entity with the requested id
+// whose current stock is under the threshold
+func (env *Env) GetEntityLowStocksHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		ts  []models.StockThreshold
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if ts, err = env.DB.GetLowStocks(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the low stocks",
+			Code:    http.StatusInternalServerError}
+	}
+
+	type resp struct {
+		Rows  []models.StockThreshold `json:"rows"`
+		Total int                     `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: ts, Total: len(ts)})
+	return nil
+}
+
+// UpdateEntityStockThresholdHandler sets a stock threshold of the entity with the requested id.
+// A zero quantity removes the threshold.
+func (env *Env) UpdateEntityStockThresholdHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		t   models.StockThreshold
+	)
+
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	if err = global.Decoder.Decode(&t, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	t.EntityID = id
+	log.WithFields(log.Fields{"t": t}).Debug("UpdateEntityStockThresholdHandler")
+
+	if err = env.DB.UpdateStockThreshold(t); err != nil {
+		if err == models.ErrStockThresholdUnit {
+			return &helpers.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
+		return &helpers.AppError{
+			Error:   err,
+			Message: "update stock threshold error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// the stock may already be under the new threshold
+	go env.notifyLowStocks(t.ProductID, t.EntityID)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(t)
+	return nil
+}
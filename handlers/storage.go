@@ -97,7 +97,7 @@ func (env *Env) ToogleStorageBorrowingHandler(w http.ResponseWriter, r *http.Req
 
 	// toggling the borrowing
 	if isborrowing {
-		err = env.DB.DeleteStorageBorrowing(b)
+		err = env.DB.ReturnStorageBorrowing(b)
 	} else {
 		err = env.DB.CreateStorageBorrowing(b)
 	}
@@ -334,6 +334,13 @@ func (env *Env) UpdateStorageHandler(w http.ResponseWriter, r *http.Request) *he
 			Code:    http.StatusInternalServerError}
 	}
 	updateds, _ := env.DB.GetStorage(id)
+	productid, entityid := updateds.ProductID, updateds.EntityID
+
+	// moving a storage to another entity requires a transfer
+	if aerr := env.checkStorageStoreLocationEntity(updateds, s); aerr != nil {
+		return aerr
+	}
+
 	updateds.StorageModificationDate = time.Now()
 	updateds.StorageBarecode = s.StorageBarecode
 	updateds.StorageQuantity = s.StorageQuantity
@@ -341,7 +348,7 @@ func (env *Env) UpdateStorageHandler(w http.ResponseWriter, r *http.Request) *he
 	updateds.Unit = s.Unit
 	updateds.StorageComment = s.StorageComment
 	updateds.StoreLocation = s.StoreLocation
-	updateds.PersonID = c.PersonID
+	updateds.StorageModifiedBy = sql.NullInt64{Valid: true, Int64: int64(c.PersonID)}
 	updateds.StorageEntryDate = s.StorageEntryDate
 	updateds.StorageExitDate = s.StorageExitDate
 	updateds.StorageOpeningDate = s.StorageOpeningDate
@@ -349,15 +356,32 @@ func (env *Env) UpdateStorageHandler(w http.ResponseWriter, r *http.Request) *he
 	updateds.StorageReference = s.StorageReference
 	updateds.StorageBatchNumber = s.StorageBatchNumber
 	updateds.StorageToDestroy = s.StorageToDestroy
+	updateds.StorageShelfLifeReception = s.StorageShelfLifeReception
+	updateds.StorageShelfLifeOpening = s.StorageShelfLifeOpening
+	updateds.StorageExpirationComputed = s.StorageExpirationComputed
 	log.WithFields(log.Fields{"updateds": updateds}).Debug("UpdateStorageHandler")
 
+	// checking incompatibilities in the (new) store location
+	if aerr := env.checkStorageIncompatibilities(&updateds); aerr != nil {
+		return aerr
+	}
+
 	if err := env.DB.UpdateStorage(updateds); err != nil {
+		if err == models.ErrStorageBarecodeUsed {
+			return &helpers.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusConflict}
+		}
 		return &helpers.AppError{
 			Error:   err,
 			Message: "update storage error",
 			Code:    http.StatusInternalServerError}
 	}
 
+	// checking the product stock thresholds
+	go env.notifyLowStocks(productid, entityid)
+
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(updateds)
@@ -370,6 +394,7 @@ func (env *Env) DeleteStorageHandler(w http.ResponseWriter, r *http.Request) *he
 	var (
 		id  int
 		err error
+		s   models.Storage
 	)
 
 	if id, err = strconv.Atoi(vars["id"]); err != nil {
@@ -379,7 +404,21 @@ func (env *Env) DeleteStorageHandler(w http.ResponseWriter, r *http.Request) *he
 			Code:    http.StatusInternalServerError}
 	}
 
-	env.DB.DeleteStorage(id)
+	if s, err = env.DB.GetStorage(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the storage",
+			Code:    http.StatusInternalServerError}
+	}
+	if err = env.DB.DeleteStorage(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error deleting the storage",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// checking the product stock thresholds
+	go env.notifyLowStocks(s.ProductID, s.EntityID)
 	return nil
 }
 
@@ -389,6 +428,7 @@ func (env *Env) ArchiveStorageHandler(w http.ResponseWriter, r *http.Request) *h
 	var (
 		id  int
 		err error
+		s   models.Storage
 	)
 
 	if id, err = strconv.Atoi(vars["id"]); err != nil {
@@ -398,7 +438,21 @@ func (env *Env) ArchiveStorageHandler(w http.ResponseWriter, r *http.Request) *h
 			Code:    http.StatusInternalServerError}
 	}
 
-	env.DB.ArchiveStorage(id)
+	if s, err = env.DB.GetStorage(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the storage",
+			Code:    http.StatusInternalServerError}
+	}
+	if err = env.DB.ArchiveStorage(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error archiving the storage",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// checking the product stock thresholds
+	go env.notifyLowStocks(s.ProductID, s.EntityID)
 	return nil
 }
 
@@ -417,7 +471,12 @@ func (env *Env) RestoreStorageHandler(w http.ResponseWriter, r *http.Request) *h
 			Code:    http.StatusInternalServerError}
 	}
 
-	env.DB.RestoreStorage(id)
+	if err = env.DB.RestoreStorage(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error restoring the storage",
+			Code:    http.StatusInternalServerError}
+	}
 	return nil
 }
 
@@ -460,23 +519,25 @@ func (env *Env) CreateStorageHandler(w http.ResponseWriter, r *http.Request) *he
 	s.PersonID = c.PersonID
 	log.WithFields(log.Fields{"s": s}).Debug("CreateStorageHandler")
 
+	// checking incompatibilities in the store location
+	if aerr := env.checkStorageIncompatibilities(&s); aerr != nil {
+		return aerr
+	}
+
+	// the barecodes not specified are generated by CreateStorage
 	for i := 1; i <= s.StorageNbItem; i++ {
 		if id, err = env.DB.CreateStorage(s); err != nil {
+			if err == models.ErrStorageBarecodeUsed {
+				return &helpers.AppError{
+					Error:   err,
+					Message: err.Error(),
+					Code:    http.StatusConflict}
+			}
 			return &helpers.AppError{
 				Error:   err,
 				Message: "create storage error",
 				Code:    http.StatusInternalServerError}
 		}
-		// generating barecode if not specified
-		if (s.StorageBarecode.String == ""){
-			s.StorageID = sql.NullInt64{Valid: true, Int64: int64(id)}
-			if err = env.DB.GenerateAndUpdateStorageBarecode(&s); err != nil {
-				return &helpers.AppError{
-					Error:   err,
-					Message: "generate storage barecode error",
-					Code:    http.StatusInternalServerError}
-			}
-		}
 	}
 	s.StorageID = sql.NullInt64{Valid: true, Int64: int64(id)}
 
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// storageSplitForm is the form sent to split a storage,
+// the aliquots fields being named aliquots.0.storage_quantity, aliquots.0.storelocation_id...
+type storageSplitForm struct {
+	Aliquots []models.StorageAliquot `schema:"aliquots"`
+}
+
+// SplitStorageHandler splits the storage with the requested id into the aliquots of the request form
+// and returns the split storage with the ids of its aliquots
+func (env *Env) SplitStorageHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id      int
+		err     error
+		f       storageSplitForm
+		current models.Storage
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	if err = global.Decoder.Decode(&f, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	if len(f.Aliquots) == 0 {
+		return &helpers.AppError{
+			Error:   errors.New("no aliquot"),
+			Message: "at least one aliquot is required",
+			Code:    http.StatusBadRequest}
+	}
+
+	// retrieving the logged user id from request context
+	c := helpers.ContainerFromRequestContext(r)
+
+	if current, err = env.DB.GetStorage(id); err != nil {
+		if err == sql.ErrNoRows {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "storage not found",
+				Code:    http.StatusNotFound}
+		}
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the storage",
+			Code:    http.StatusInternalServerError}
+	}
+	log.WithFields(log.Fields{"id": id, "aliquots": f.Aliquots}).Debug("SplitStorageHandler")
+
+	for _, a := range f.Aliquots {
+		if a.StorageQuantity <= 0 || a.StoreLocationID <= 0 {
+			return &helpers.AppError{
+				Error:   errors.New("wrong aliquot"),
+				Message: "the aliquots require a positive quantity and a store location",
+				Code:    http.StatusBadRequest}
+		}
+
+		child := current
+		child.StorageID = sql.NullInt64{}
+		child.StorageQuantity = sql.NullFloat64{Valid: true, Float64: a.StorageQuantity}
+		child.StoreLocation = models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(a.StoreLocationID)}}
+
+		// moving an aliquot to another entity requires a transfer
+		if aerr := env.checkStorageStoreLocationEntity(current, child); aerr != nil {
+			return aerr
+		}
+		// checking incompatibilities in the aliquot store location
+		if aerr := env.checkStorageIncompatibilities(&child); aerr != nil {
+			return aerr
+		}
+	}
+
+	if _, err = env.DB.SplitStorage(id, f.Aliquots, c.PersonID); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return &helpers.AppError{
+				Error:   err,
+				Message: "storage not found",
+				Code:    http.StatusNotFound}
+		case models.ErrStorageSplitQuantity:
+			return &helpers.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		case models.ErrStorageSplitArchive, models.ErrStorageBarecodeUsed:
+			return &helpers.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusConflict}
+		}
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error splitting the storage",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if current, err = env.DB.GetStorage(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the storage",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(current)
+	return nil
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// storageBulkItem is the checks result of a storage of a bulk operation
+type storageBulkItem struct {
+	StorageID int    `json:"storage_id"`
+	Error     string `json:"error,omitempty"`
+}
+
+// storageBulkReport is the result of a bulk operation,
+// applied only if all its storages passed their checks
+type storageBulkReport struct {
+	Operation string            `json:"operation"`
+	Applied   bool              `json:"applied"`
+	Items     []storageBulkItem `json:"items"`
+}
+
+// storageBulkIDs returns the ids of the storages of the bulk operation op,
+// or else of the storages matching the storages list filter of the request query
+func (env *Env) storageBulkIDs(r *http.Request, op models.StorageBulkOperation) ([]int, *helpers.AppError) {
+	var (
+		err      error
+		aerr     *helpers.AppError
+		dsps     helpers.DbselectparamStorage
+		storages []models.Storage
+		ids      []int
+	)
+
+	if len(op.StorageIDs) != 0 {
+		return op.StorageIDs, nil
+	}
+
+	if dsps, aerr = helpers.NewdbselectparamStorage(r, nil); aerr != nil {
+		return nil, aerr
+	}
+	if storages, _, err = env.DB.GetStorages(dsps); err != nil {
+		return nil, &helpers.AppError{
+			Error:   err,
+			Message: "error getting the storages",
+			Code:    http.StatusInternalServerError}
+	}
+	for _, s := range storages {
+		ids = append(ids, int(s.StorageID.Int64))
+	}
+	return ids, nil
+}
+
+// checkStorageBulkItem checks that the person "personid" can apply the bulk operation op
+// to the storage s, with the permissions checked by AuthorizeMiddleware for a single storage
+func (env *Env) checkStorageBulkItem(op models.StorageBulkOperation, personid int, s models.Storage) *helpers.AppError {
+	var (
+		err error
+		ok  bool
+	)
+
+	if s.Storage != nil && s.Storage.StorageID.Valid {
+		return &helpers.AppError{
+			Error:   errors.New("history storage"),
+			Message: "the storage is a history version",
+			Code:    http.StatusBadRequest}
+	}
+	if ok, err = env.DB.HasPersonPermission(personid, "w", "storages", s.EntityID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the permissions",
+			Code:    http.StatusInternalServerError}
+	}
+	if !ok {
+		return &helpers.AppError{
+			Error:   errors.New("unauthorized"),
+			Message: "unauthorized",
+			Code:    http.StatusForbidden}
+	}
+
+	if op.Operation == "move" {
+		moved := s
+		moved.StoreLocation = models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(op.StoreLocationID)}}
+
+		// moving a storage to another entity requires a transfer
+		if aerr := env.checkStorageStoreLocationEntity(s, moved); aerr != nil {
+			return aerr
+		}
+		// checking incompatibilities in the new store location
+		if aerr := env.checkStorageIncompatibilities(&moved); aerr != nil {
+			return aerr
+		}
+	}
+
+	return nil
+}
+
+// BulkStoragesHandler applies the operation of the request form to the storages "storage_ids",
+// or else to the storages matching the storages list filter of the request query.
+// The operation is applied atomically if all the storages pass their checks,
+// the returned report giving the error of each rejected storage.
+func (env *Env) BulkStoragesHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		op     models.StorageBulkOperation
+		ids    []int
+		report storageBulkReport
+		err    error
+		aerr   *helpers.AppError
+	)
+
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	if err = global.Decoder.Decode(&op, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	if !models.IsStorageBulkOperation(op.Operation) {
+		return &helpers.AppError{
+			Error:   models.ErrStorageBulkOperation,
+			Message: models.ErrStorageBulkOperation.Error(),
+			Code:    http.StatusBadRequest}
+	}
+	if op.Operation == "move" && op.StoreLocationID <= 0 {
+		return &helpers.AppError{
+			Error:   errors.New("no store location"),
+			Message: "a store location is required to move the storages",
+			Code:    http.StatusBadRequest}
+	}
+
+	// retrieving the logged user id from request context
+	c := helpers.ContainerFromRequestContext(r)
+	op.PersonID = c.PersonID
+
+	if ids, aerr = env.storageBulkIDs(r, op); aerr != nil {
+		return aerr
+	}
+	log.WithFields(log.Fields{"operation": op.Operation, "len(ids)": len(ids)}).Debug("BulkStoragesHandler")
+
+	// checking all the storages first
+	var (
+		storages []models.Storage
+		rejected bool
+	)
+	report.Operation = op.Operation
+	report.Items = []storageBulkItem{}
+	for _, id := range ids {
+		item := storageBulkItem{StorageID: id}
+		if s, err := env.DB.GetStorage(id); err != nil {
+			item.Error = "storage not found"
+		} else if aerr = env.checkStorageBulkItem(op, c.PersonID, s); aerr != nil {
+			if aerr.Code == http.StatusInternalServerError {
+				return aerr
+			}
+			item.Error = aerr.Message
+		} else {
+			storages = append(storages, s)
+		}
+		rejected = rejected || item.Error != ""
+		report.Items = append(report.Items, item)
+	}
+
+	if !rejected && len(ids) != 0 {
+		op.StorageIDs = ids
+		if err = env.DB.ApplyStorageBulkOperation(op); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "error applying the bulk operation",
+				Code:    http.StatusInternalServerError}
+		}
+		report.Applied = true
+
+		// checking the products stock thresholds
+		if op.Operation == "archive" || op.Operation == "delete" {
+			type stock struct{ product, entity int }
+			notified := make(map[stock]bool)
+			for _, s := range storages {
+				if k := (stock{s.ProductID, s.EntityID}); !notified[k] {
+					notified[k] = true
+					go env.notifyLowStocks(s.ProductID, s.EntityID)
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+	return nil
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// GetStorageHistoryHandler returns a json of the versions of the storage with the requested id
+// with the fields changed by each version and their authors
+func (env *Env) GetStorageHistoryHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err      error
+		id       int
+		versions []models.StorageVersion
+	)
+
+	vars := mux.Vars(r)
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if versions, err = env.DB.GetStorageHistory(id); err != nil {
+		if err == sql.ErrNoRows {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "storage not found",
+				Code:    http.StatusNotFound}
+		}
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the storage history",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(versions)
+	return nil
+}
+
+// RestoreStorageVersionHandler reapplies the requested history version of the storage
+// with the requested id as a new update
+func (env *Env) RestoreStorageVersionHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err              error
+		id, version      int
+		current, restore models.Storage
+	)
+
+	vars := mux.Vars(r)
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	if version, err = strconv.Atoi(vars["version"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "version atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	c := helpers.ContainerFromRequestContext(r)
+
+	if current, err = env.DB.GetStorage(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the storage",
+			Code:    http.StatusInternalServerError}
+	}
+	if restore, err = env.DB.GetStorage(version); err != nil {
+		if err == sql.ErrNoRows {
+			return &helpers.AppError{
+				Error:   models.ErrStorageVersionNotFound,
+				Message: models.ErrStorageVersionNotFound.Error(),
+				Code:    http.StatusNotFound}
+		}
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the storage version",
+			Code:    http.StatusInternalServerError}
+	}
+	log.WithFields(log.Fields{"id": id, "version": version}).Debug("RestoreStorageVersionHandler")
+
+	// moving a storage to another entity requires a transfer
+	if aerr := env.checkStorageStoreLocationEntity(current, restore); aerr != nil {
+		return aerr
+	}
+
+	// checking incompatibilities in the restored store location
+	restored := current
+	restored.StoreLocation = restore.StoreLocation
+	restored.StorageQuantity = restore.StorageQuantity
+	restored.Unit = restore.Unit
+	if aerr := env.checkStorageIncompatibilities(&restored); aerr != nil {
+		return aerr
+	}
+
+	if err = env.DB.RestoreStorageVersion(id, version, c.PersonID); err != nil {
+		switch err {
+		case models.ErrStorageVersionNotFound:
+			return &helpers.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusNotFound}
+		case models.ErrStorageBarecodeUsed:
+			return &helpers.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusConflict}
+		}
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error restoring the storage version",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// checking the product stock thresholds
+	go env.notifyLowStocks(current.ProductID, current.EntityID)
+
+	if restored, err = env.DB.GetStorage(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the storage",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(restored)
+	return nil
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// OpenStorageHandler sets the opening date of the storage with the requested id to now
+// and returns the storage with its computed expiration date
+func (env *Env) OpenStorageHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		s   models.Storage
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	c := helpers.ContainerFromRequestContext(r)
+	log.WithFields(log.Fields{"id": id}).Debug("OpenStorageHandler")
+
+	if err = env.DB.OpenStorage(id, c.PersonID); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return &helpers.AppError{
+				Error:   err,
+				Message: "storage not found",
+				Code:    http.StatusNotFound}
+		case models.ErrStorageOpened:
+			return &helpers.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusConflict}
+		}
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error opening the storage",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if s, err = env.DB.GetStorage(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the storage",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s)
+	return nil
+}
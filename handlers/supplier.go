@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// decodeSupplier returns the supplier of the request form
+func decodeSupplier(r *http.Request) (models.Supplier, *helpers.AppError) {
+	var (
+		s   models.Supplier
+		err error
+	)
+
+	if err = r.ParseForm(); err != nil {
+		return models.Supplier{}, &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	if err = global.Decoder.Decode(&s, r.PostForm); err != nil {
+		return models.Supplier{}, &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	if !s.SupplierLabel.Valid || s.SupplierLabel.String == "" {
+		return models.Supplier{}, &helpers.AppError{
+			Error:   errors.New("empty supplier label"),
+			Message: "the supplier label is required",
+			Code:    http.StatusBadRequest}
+	}
+
+	return s, nil
+}
+
+// decodeSupplierRef returns the supplier reference of the request form
+func decodeSupplierRef(r *http.Request) (models.SupplierRef, *helpers.AppError) {
+	var (
+		sr  models.SupplierRef
+		err error
+	)
+
+	if err = r.ParseForm(); err != nil {
+		return models.SupplierRef{}, &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	if err = global.Decoder.Decode(&sr, r.PostForm); err != nil {
+		return models.SupplierRef{}, &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	if sr.SupplierRefLabel == "" || sr.SupplierID == 0 || sr.ProductID == 0 {
+		return models.SupplierRef{}, &helpers.AppError{
+			Error:   errors.New("incomplete supplier reference"),
+			Message: "the reference, supplier and product are required",
+			Code:    http.StatusBadRequest}
+	}
+	if (sr.SupplierRefQuantity.Valid && sr.SupplierRefQuantity.Float64 < 0) || (sr.SupplierRefPrice.Valid && sr.SupplierRefPrice.Float64 < 0) {
+		return models.SupplierRef{}, &helpers.AppError{
+			Error:   errors.New("wrong supplier reference quantity or price"),
+			Message: "the supplier reference quantity and price must be positive",
+			Code:    http.StatusBadRequest}
+	}
+
+	return sr, nil
+}
+
+// GetSupplierHandler returns a json of the supplier with the requested id
+func (env *Env) GetSupplierHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		s   models.Supplier
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if s, err = env.DB.GetSupplier(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the supplier",
+			Code:    http.StatusNotFound}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s)
+	return nil
+}
+
+// CreateSupplierHandler creates the supplier from the request form
+func (env *Env) CreateSupplierHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		s    models.Supplier
+		id   int
+		err  error
+		aerr *helpers.AppError
+	)
+
+	if s, aerr = decodeSupplier(r); aerr != nil {
+		return aerr
+	}
+	log.WithFields(log.Fields{"s": s}).Debug("CreateSupplierHandler")
+
+	if id, err = env.DB.CreateSupplier(s); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "create supplier error",
+			Code:    http.StatusInternalServerError}
+	}
+	s.SupplierID.Valid = true
+	s.SupplierID.Int64 = int64(id)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s)
+	return nil
+}
+
+// UpdateSupplierHandler updates the supplier with the requested id from the request form
+func (env *Env) UpdateSupplierHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		s    models.Supplier
+		id   int
+		err  error
+		aerr *helpers.AppError
+	)
+
+	if s, aerr = decodeSupplier(r); aerr != nil {
+		return aerr
+	}
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	s.SupplierID.Valid = true
+	s.SupplierID.Int64 = int64(id)
+	log.WithFields(log.Fields{"s": s}).Debug("UpdateSupplierHandler")
+
+	if err = env.DB.UpdateSupplier(s); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "update supplier error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s)
+	return nil
+}
+
+// DeleteSupplierHandler deletes the supplier with the requested id
+func (env *Env) DeleteSupplierHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if err = env.DB.DeleteSupplier(id); err != nil {
+		if err == models.ErrSupplierUsed {
+			return &helpers.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusConflict}
+		}
+		return &helpers.AppError{
+			Error:   err,
+			Message: "delete supplier error",
+			Code:    http.StatusInternalServerError}
+	}
+	return nil
+}
+
+// MergeSupplierHandler merges the duplicate supplier "from" into the supplier with the requested id
+func (env *Env) MergeSupplierHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id   int
+		from int
+		err  error
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	if from, err = strconv.Atoi(vars["from"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "from atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	if id == from {
+		return &helpers.AppError{
+			Error:   errors.New("same suppliers"),
+			Message: "a supplier can not be merged into itself",
+			Code:    http.StatusBadRequest}
+	}
+	if _, err = env.DB.GetSupplier(from); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the merged supplier",
+			Code:    http.StatusNotFound}
+	}
+
+	if err = env.DB.MergeSupplier(from, id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "merge supplier error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	s, err := env.DB.GetSupplier(id)
+	if err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the supplier",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s)
+	return nil
+}
+
+// GetSupplierRefsHandler returns a json list of the supplier references matching
+// the "supplier", "product", "casnumber", "quantity" and "unit" query parameters,
+// answering for example which supplier sells a CAS number in 1 L
+func (env *Env) GetSupplierRefsHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		s   models.SupplierRefSearch
+		srs []models.SupplierRef
+		err error
+	)
+
+	q := r.URL.Query()
+	for k, v := range map[string]*int{"supplier": &s.SupplierID, "product": &s.ProductID, "unit": &s.UnitID} {
+		if q.Get(k) == "" {
+			continue
+		}
+		if *v, err = strconv.Atoi(q.Get(k)); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: k + " atoi conversion",
+				Code:    http.StatusBadRequest}
+		}
+	}
+	if q.Get("quantity") != "" {
+		if s.Quantity, err = strconv.ParseFloat(q.Get("quantity"), 64); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "quantity float conversion",
+				Code:    http.StatusBadRequest}
+		}
+	}
+	s.CasNumber = q.Get("casnumber")
+
+	if srs, err = env.DB.GetSupplierRefs(s); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the supplier references",
+			Code:    http.StatusInternalServerError}
+	}
+
+	type resp struct {
+		Rows  []models.SupplierRef `json:"rows"`
+		Total int                  `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: srs, Total: len(srs)})
+	return nil
+}
+
+// GetSupplierRefHandler returns a json of the supplier reference with the requested id
+func (env *Env) GetSupplierRefHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		sr  models.SupplierRef
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if sr, err = env.DB.GetSupplierRef(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the supplier reference",
+			Code:    http.StatusNotFound}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sr)
+	return nil
+}
+
+// CreateSupplierRefHandler creates the supplier reference from the request form
+func (env *Env) CreateSupplierRefHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		sr   models.SupplierRef
+		id   int
+		err  error
+		aerr *helpers.AppError
+	)
+
+	if sr, aerr = decodeSupplierRef(r); aerr != nil {
+		return aerr
+	}
+	log.WithFields(log.Fields{"sr": sr}).Debug("CreateSupplierRefHandler")
+
+	if id, err = env.DB.CreateSupplierRef(sr); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "create supplier reference error",
+			Code:    http.StatusInternalServerError}
+	}
+	if sr, err = env.DB.GetSupplierRef(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the supplier reference",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sr)
+	return nil
+}
+
+// UpdateSupplierRefHandler updates the supplier reference with the requested id from the request form
+func (env *Env) UpdateSupplierRefHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		sr   models.SupplierRef
+		err  error
+		aerr *helpers.AppError
+	)
+
+	if sr, aerr = decodeSupplierRef(r); aerr != nil {
+		return aerr
+	}
+	if sr.SupplierRefID, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	log.WithFields(log.Fields{"sr": sr}).Debug("UpdateSupplierRefHandler")
+
+	if err = env.DB.UpdateSupplierRef(sr); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "update supplier reference error",
+			Code:    http.StatusInternalServerError}
+	}
+	if sr, err = env.DB.GetSupplierRef(sr.SupplierRefID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the supplier reference",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sr)
+	return nil
+}
+
+// DeleteSupplierRefHandler deletes the supplier reference with the requested id
+func (env *Env) DeleteSupplierRefHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if err = env.DB.DeleteSupplierRef(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "delete supplier reference error",
+			Code:    http.StatusInternalServerError}
+	}
+	return nil
+}
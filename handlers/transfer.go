@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// sendTransferRequest emails the target entity managers of the transfer t
+// asking them to accept or refuse it
+func (env *Env) sendTransferRequest(t models.Transfer) {
+	var (
+		err      error
+		managers []models.Person
+	)
+
+	if global.MailServerAddress == "" {
+		return
+	}
+	if managers, err = env.DB.GetEntityPeople(t.TargetEntityID); err != nil {
+		log.Error("transfer request managers - " + err.Error())
+		return
+	}
+
+	msgsubject := fmt.Sprintf(global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "transfer_mailsubject", PluralCount: 1}), t.TargetEntityName)
+	msgbody := fmt.Sprintf(global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "transfer_mailbody", PluralCount: 1}),
+		t.PersonEmail, t.NameLabel, t.StorageBarecode.String, t.SourceStoreLocationFullPath, t.TargetStoreLocationFullPath)
+	for _, m := range managers {
+		if err = sendMail(m.PersonEmail, msgsubject, msgbody); err != nil {
+			log.Error("transfer request mail to " + m.PersonEmail + " - " + err.Error())
+		}
+	}
+}
+
+// getDecidableTransfer returns the transfer with id passed in the request vars
+// if the logged user is a manager of its target entity or an admin
+func (env *Env) getDecidableTransfer(r *http.Request) (models.Transfer, *helpers.AppError) {
+	var (
+		err      error
+		id       int
+		t        models.Transfer
+		admin    bool
+		managers []models.Person
+	)
+	vars := mux.Vars(r)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return models.Transfer{}, &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	if t, err = env.DB.GetTransfer(id); err != nil {
+		return models.Transfer{}, &helpers.AppError{
+			Error:   err,
+			Message: "error getting the transfer",
+			Code:    http.StatusNotFound}
+	}
+
+	// retrieving the logged user id from request context
+	c := helpers.ContainerFromRequestContext(r)
+
+	if admin, err = env.DB.IsPersonAdmin(c.PersonID); err != nil {
+		return models.Transfer{}, &helpers.AppError{
+			Error:   err,
+			Message: "error getting admin status",
+			Code:    http.StatusInternalServerError}
+	}
+	if admin {
+		return t, nil
+	}
+	if managers, err = env.DB.GetEntityPeople(t.TargetEntityID); err != nil {
+		return models.Transfer{}, &helpers.AppError{
+			Error:   err,
+			Message: "error getting the entity managers",
+			Code:    http.StatusInternalServerError}
+	}
+	for _, m := range managers {
+		if m.PersonID == c.PersonID {
+			return t, nil
+		}
+	}
+
+	return models.Transfer{}, &helpers.AppError{
+		Message: "only the target entity managers can accept or refuse a transfer",
+		Code:    http.StatusForbidden}
+}
+
+// transferError returns the application error of the transfer error err
+func transferError(err error, message string) *helpers.AppError {
+	switch err {
+	case models.ErrTransferTarget:
+		return &helpers.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusBadRequest}
+	case models.ErrTransferPending, models.ErrTransferNotPending:
+		return &helpers.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusConflict}
+	}
+	return &helpers.AppError{
+		Error:   err,
+		Message: message,
+		Code:    http.StatusInternalServerError}
+}
+
+/*
+	REST handlers
+*/
+
+// CreateStorageTransferHandler requests the transfer of the storage with id passed in the request vars
+// to another store location for the logged user.
+func (env *Env) CreateStorageTransferHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err error
+		id  int
+		t   models.Transfer
+	)
+	vars := mux.Vars(r)
+
+	// parsing request form
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing error",
+			Code:    http.StatusBadRequest}
+	}
+	// decoding request form
+	if err = global.Decoder.Decode(&t, r.PostForm); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	// getting the storage id
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	t.StorageID = id
+
+	// retrieving the logged user id from request context
+	c := helpers.ContainerFromRequestContext(r)
+	t.PersonID = c.PersonID
+	log.WithFields(log.Fields{"t": t}).Debug("CreateStorageTransferHandler")
+
+	if id, err = env.DB.CreateTransfer(t); err != nil {
+		return transferError(err, "create transfer error")
+	}
+	if t, err = env.DB.GetTransfer(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the transfer",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// asking the target entity managers
+	go env.sendTransferRequest(t)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(t)
+	return nil
+}
+
+// GetStorageTransfersHandler returns a json list of the transfers of the storage with the requested id
+func (env *Env) GetStorageTransfersHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		ts  []models.Transfer
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if ts, err = env.DB.GetStorageTransfers(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the storage transfers",
+			Code:    http.StatusInternalServerError}
+	}
+
+	type resp struct {
+		Rows  []models.Transfer `json:"rows"`
+		Total int               `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: ts, Total: len(ts)})
+	return nil
+}
+
+// GetEntityTransfersHandler returns a json list of the transfers from or to the entity with the requested id
+func (env *Env) GetEntityTransfersHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		ts  []models.Transfer
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if ts, err = env.DB.GetEntityTransfers(id); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the entity transfers",
+			Code:    http.StatusInternalServerError}
+	}
+
+	type resp struct {
+		Rows  []models.Transfer `json:"rows"`
+		Total int               `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp{Rows: ts, Total: len(ts)})
+	return nil
+}
+
+// AcceptTransferHandler accepts the transfer with the requested id
+// and moves the storage to the target store location
+func (env *Env) AcceptTransferHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err  error
+		aerr *helpers.AppError
+		t    models.Transfer
+		s    models.Storage
+	)
+
+	if t, aerr = env.getDecidableTransfer(r); aerr != nil {
+		return aerr
+	}
+	if t.TransferStatus != "pending" {
+		return transferError(models.ErrTransferNotPending, "")
+	}
+
+	// checking incompatibilities in the target store location
+	if s, err = env.DB.GetStorage(t.StorageID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the storage",
+			Code:    http.StatusInternalServerError}
+	}
+	if s.StoreLocation, err = env.DB.GetStoreLocation(t.TargetStoreLocationID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the target store location",
+			Code:    http.StatusInternalServerError}
+	}
+	if aerr = env.checkStorageIncompatibilities(&s); aerr != nil {
+		return aerr
+	}
+
+	c := helpers.ContainerFromRequestContext(r)
+	if err = env.DB.AcceptTransfer(t.TransferID, c.PersonID); err != nil {
+		return transferError(err, "accept transfer error")
+	}
+	if t, err = env.DB.GetTransfer(t.TransferID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the transfer",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(t)
+	return nil
+}
+
+// RefuseTransferHandler refuses the transfer with the requested id
+func (env *Env) RefuseTransferHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err  error
+		aerr *helpers.AppError
+		t    models.Transfer
+	)
+
+	if t, aerr = env.getDecidableTransfer(r); aerr != nil {
+		return aerr
+	}
+
+	c := helpers.ContainerFromRequestContext(r)
+	if err = env.DB.RefuseTransfer(t.TransferID, c.PersonID); err != nil {
+		return transferError(err, "refuse transfer error")
+	}
+	if t, err = env.DB.GetTransfer(t.TransferID); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the transfer",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(t)
+	return nil
+}
+
+// checkStorageStoreLocationEntity returns an error if the store location
+// of the storage s is moved to another entity than its current one
+func (env *Env) checkStorageStoreLocationEntity(current models.Storage, s models.Storage) *helpers.AppError {
+	var (
+		err error
+		e   models.Entity
+	)
+
+	if !s.StoreLocationID.Valid || s.StoreLocationID == current.StoreLocationID {
+		return nil
+	}
+	if e, err = env.DB.GetStoreLocationEntity(int(s.StoreLocationID.Int64)); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "error getting the store location entity",
+			Code:    http.StatusInternalServerError}
+	}
+	if e.EntityID != current.EntityID {
+		return &helpers.AppError{
+			Error:   errors.New("store location of another entity"),
+			Message: "moving a storage to another entity requires a transfer",
+			Code:    http.StatusBadRequest}
+	}
+
+	return nil
+}
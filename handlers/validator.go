@@ -173,6 +173,37 @@ func (env *Env) ValidateEntityNameHandler(w http.ResponseWriter, r *http.Request
 	return nil
 }
 
+// ValidateEntityBarecodeTemplateHandler checks that the entity barecode template is valid
+func (env *Env) ValidateEntityBarecodeTemplateHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err  error
+		resp string
+	)
+
+	// getting the template
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing",
+			Code:    http.StatusInternalServerError}
+	}
+	// validating it, an empty template being the default one
+	if t := r.Form.Get("entity_barecodetemplate"); t != "" {
+		err = utils.ValidateBarecodeTemplate(t)
+	}
+
+	if err != nil {
+		resp = global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "entity_barecodetemplate_validate", PluralCount: 1}) + ": " + err.Error()
+	} else {
+		resp = "true"
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+	return nil
+}
+
 // ValidateProductNameHandler checks that the product name is valid
 // FIXME: not used yet
 func (env *Env) ValidateProductNameHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
@@ -240,6 +271,63 @@ func (env *Env) FormatProductEmpiricalFormulaHandler(w http.ResponseWriter, r *h
 	return nil
 }
 
+// ValidateProductSmilesHandler checks that the product SMILES is valid
+func (env *Env) ValidateProductSmilesHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err  error
+		resp string
+	)
+
+	// getting the SMILES
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing",
+			Code:    http.StatusInternalServerError}
+	}
+	// validating it
+	_, err = utils.SmilesToEmpiricalFormula(r.Form.Get("smiles"))
+
+	if err != nil {
+		resp = global.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "smiles_validate", PluralCount: 1})
+	} else {
+		resp = "true"
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+	return nil
+}
+
+// FormatProductSmilesHandler returns the empirical formula of the SMILES
+func (env *Env) FormatProductSmilesHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err  error
+		resp string
+	)
+
+	// getting the SMILES
+	if err = r.ParseForm(); err != nil {
+		return &helpers.AppError{
+			Error:   err,
+			Message: "form parsing",
+			Code:    http.StatusInternalServerError}
+	}
+	// converting it
+	resp, err = utils.SmilesToEmpiricalFormula(r.Form.Get("smiles"))
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(resp)
+	return nil
+}
+
 // ValidateProductCasNumberHandler checks that:
 // - the cas number is valid
 // - a product with the cas number and specificity does not already exist
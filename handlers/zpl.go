@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/utils"
+)
+
+// labelPrinterTimeout is the labels printers connection and sending timeout
+const labelPrinterTimeout = 10 * time.Second
+
+// zplDotsPerMM returns the dots per millimeter of the "dpi" parameter
+// of the request query, 203 dpi by default
+func zplDotsPerMM(r *http.Request) (int, *helpers.AppError) {
+	switch r.URL.Query().Get("dpi") {
+	case "", "203":
+		return 8, nil
+	case "300":
+		return 12, nil
+	case "600":
+		return 24, nil
+	default:
+		return 0, &helpers.AppError{
+			Error:   errors.New("wrong dpi"),
+			Message: "wrong dpi, available: 203, 300, 600",
+			Code:    http.StatusBadRequest}
+	}
+}
+
+// drawStorageLabelZPL draws the label l in a w x h dots label
+// with the layout of drawStorageLabel
+func drawStorageLabelZPL(z *helpers.ZPL, w, h int, l storageLabel) error {
+	min := func(a, b int) int {
+		if a < b {
+			return a
+		}
+		return b
+	}
+	max := func(a, b int) int {
+		if a > b {
+			return a
+		}
+		return b
+	}
+
+	z.StartLabel(w, h)
+	defer z.EndLabel()
+
+	pad := max(min(w, h)/20, 8)
+	x, y := pad, pad
+	w, h = w-2*pad, h-2*pad
+
+	// font height and line height
+	fs := max(min(h/9, 40), 14)
+	lh := fs * 5 / 4
+
+	// barecode block at the bottom
+	bh := 0
+	if l.Barecode != "" {
+		bh = h*18/100 + lh
+	}
+
+	// QR code on the right
+	qs := 0
+	if l.QRData != "" {
+		modules, err := helpers.QRCodeModules(l.QRData)
+		if err != nil {
+			return err
+		}
+		// the printers magnification factors are 1 to 10
+		mag := max(min(min(min(h/2, w*3/10), h-bh-pad)/modules, 10), 1)
+		qs = modules * mag
+		z.QRCode(x+w-qs, y, mag, l.QRData)
+	}
+	tw := w - qs - pad
+
+	// texts
+	ty := y
+	z.Text(x, ty, fs*23/20, tw, l.Name)
+	ty += lh
+	line := strings.TrimSpace(l.CasNumber + "  " + strings.ToUpper(l.SignalWord))
+	if line != "" {
+		z.Text(x, ty, fs, tw, line)
+		ty += lh
+	}
+	if l.StoreLocation != "" {
+		z.Text(x, ty, fs*9/10, tw, l.StoreLocation)
+		ty += lh
+	}
+	if l.Expiration != "" {
+		z.Text(x, ty, fs*9/10, tw, l.Expiration)
+		ty += lh
+	}
+
+	// pictograms in the space left between the texts and the barecode
+	if n := len(l.Symbols); n > 0 {
+		ps := min(y+h-bh-ty-pad/2, tw/n)
+		if ps > fs {
+			for i, s := range l.Symbols {
+				if err := z.Image(x+i*ps, ty, ps, ps, s); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Code128 barecode with its text below
+	if l.Barecode != "" {
+		widths, err := utils.Code128(l.Barecode)
+		if err != nil {
+			return err
+		}
+		modules := 0
+		for _, m := range widths {
+			modules += m
+		}
+		// 10 modules quiet zones around the bars, 1 to 3 dots modules
+		mw := max(min(w/(modules+20), 3), 1)
+		z.Code128(x+10*mw, y+h-bh, mw, h*18/100, l.Barecode)
+		z.Text(x+10*mw, y+h-lh+fs/10, fs*9/10, w-10*mw, l.Barecode)
+	}
+
+	return nil
+}
+
+// storageLabelZPL returns the ZPL of the label l with the size of the labels of the template t
+// for a printer of dpmm dots per millimeter
+func storageLabelZPL(t helpers.LabelTemplate, dpmm int, l storageLabel) ([]byte, error) {
+	// points to dots
+	dots := func(pt float64) int {
+		return int(pt * 25.4 / 72 * float64(dpmm))
+	}
+
+	z := helpers.NewZPL()
+	if err := drawStorageLabelZPL(z, dots(t.LabelWidth), dots(t.LabelHeight), l); err != nil {
+		return nil, err
+	}
+	return z.Bytes(), nil
+}
+
+// storagesZPL returns the storages of the request and the ZPL of their labels,
+// see labelTemplate and zplDotsPerMM for the parameters
+func (env *Env) storagesZPL(r *http.Request) ([]models.Storage, [][]byte, *helpers.AppError) {
+	var (
+		err      error
+		aerr     *helpers.AppError
+		t        helpers.LabelTemplate
+		dpmm     int
+		storages []models.Storage
+		labels   []storageLabel
+		zpl      [][]byte
+	)
+
+	if t, aerr = labelTemplate(r.URL.Query()); aerr != nil {
+		return nil, nil, aerr
+	}
+	if dpmm, aerr = zplDotsPerMM(r); aerr != nil {
+		return nil, nil, aerr
+	}
+	if storages, aerr = env.labelStorages(r); aerr != nil {
+		return nil, nil, aerr
+	}
+	log.WithFields(log.Fields{"template": t.Name, "dpmm": dpmm, "len(storages)": len(storages)}).Debug("storagesZPL")
+
+	if labels, err = env.storageLabels(storages); err != nil {
+		return nil, nil, &helpers.AppError{
+			Error:   err,
+			Message: "error getting the labels",
+			Code:    http.StatusInternalServerError}
+	}
+	for _, l := range labels {
+		var b []byte
+		if b, err = storageLabelZPL(t, dpmm, l); err != nil {
+			return nil, nil, &helpers.AppError{
+				Error:   err,
+				Message: "error drawing the labels",
+				Code:    http.StatusInternalServerError}
+		}
+		zpl = append(zpl, b)
+	}
+
+	return storages, zpl, nil
+}
+
+// GetStoragesZPLHandler returns the ZPL II labels of the storages
+// with the ids "storage", or else matching the storages list filter,
+// see labelTemplate and zplDotsPerMM for the parameters
+func (env *Env) GetStoragesZPLHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	_, zpl, aerr := env.storagesZPL(r)
+	if aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.Header().Set("Content-Disposition", "attachment;filename=labels.zpl")
+	for _, l := range zpl {
+		if _, err := w.Write(l); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "error writing the labels",
+				Code:    http.StatusInternalServerError}
+		}
+	}
+	return nil
+}
+
+// PrintStoragesZPLHandler sends the ZPL II labels of the storages of GetStoragesZPLHandler
+// to the labels printers of their entities
+func (env *Env) PrintStoragesZPLHandler(w http.ResponseWriter, r *http.Request) *helpers.AppError {
+	var (
+		err      error
+		printers = make(map[int]string)
+		entities []int
+		byentity = make(map[int][]byte)
+	)
+
+	storages, zpl, aerr := env.storagesZPL(r)
+	if aerr != nil {
+		return aerr
+	}
+
+	// the labels are grouped by entity, all the printers being checked first
+	for i, s := range storages {
+		if _, ok := printers[s.EntityID]; !ok {
+			var e models.Entity
+			if e, err = env.DB.GetEntity(s.EntityID); err != nil {
+				return &helpers.AppError{
+					Error:   err,
+					Message: "error getting the entity",
+					Code:    http.StatusInternalServerError}
+			}
+			if !e.EntityLabelPrinter.Valid || e.EntityLabelPrinter.String == "" {
+				return &helpers.AppError{
+					Error:   errors.New("no labels printer"),
+					Message: "the entity " + e.EntityName + " has no labels printer",
+					Code:    http.StatusBadRequest}
+			}
+			printers[s.EntityID] = e.EntityLabelPrinter.String
+			entities = append(entities, s.EntityID)
+		}
+		byentity[s.EntityID] = append(byentity[s.EntityID], zpl[i]...)
+	}
+
+	for _, id := range entities {
+		log.WithFields(log.Fields{"printer": printers[id], "len(zpl)": len(byentity[id])}).Debug("PrintStoragesZPLHandler")
+		if err = helpers.SendZPL(printers[id], byentity[id], labelPrinterTimeout); err != nil {
+			return &helpers.AppError{
+				Error:   err,
+				Message: "error sending the labels to the printer " + printers[id],
+				Code:    http.StatusBadGateway}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(len(zpl))
+	return nil
+}
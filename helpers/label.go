@@ -0,0 +1,88 @@
+package helpers
+
+import "sort"
+
+// MM returns mm millimeters in points
+func MM(mm float64) float64 {
+	return mm * 72 / 25.4
+}
+
+// LabelTemplate is the layout of the labels of a page,
+// all sizes being in points
+type LabelTemplate struct {
+	Name        string  `json:"name"`
+	PageWidth   float64 `json:"pagewidth"`
+	PageHeight  float64 `json:"pageheight"`
+	Columns     int     `json:"columns"`
+	Rows        int     `json:"rows"`
+	LabelWidth  float64 `json:"labelwidth"`
+	LabelHeight float64 `json:"labelheight"`
+	MarginLeft  float64 `json:"marginleft"` // left border of the first column
+	MarginTop   float64 `json:"margintop"`  // top border of the first row
+	PitchX      float64 `json:"pitchx"`     // distance between the left borders of two columns
+	PitchY      float64 `json:"pitchy"`     // distance between the top borders of two rows
+}
+
+// SingleLabelTemplate returns the template of the width x height millimeters
+// single label pages of label printers
+func SingleLabelTemplate(name string, width, height float64) LabelTemplate {
+	return LabelTemplate{
+		Name:        name,
+		PageWidth:   MM(width),
+		PageHeight:  MM(height),
+		Columns:     1,
+		Rows:        1,
+		LabelWidth:  MM(width),
+		LabelHeight: MM(height),
+	}
+}
+
+// avery returns the template of an A4 sheet of columns x rows labels
+// of width x height millimeters with the given margins and pitches in millimeters
+func avery(name string, columns, rows int, width, height, left, top, pitchx, pitchy float64) LabelTemplate {
+	return LabelTemplate{
+		Name:        name,
+		PageWidth:   PDFPageWidth,
+		PageHeight:  PDFPageHeight,
+		Columns:     columns,
+		Rows:        rows,
+		LabelWidth:  MM(width),
+		LabelHeight: MM(height),
+		MarginLeft:  MM(left),
+		MarginTop:   MM(top),
+		PitchX:      MM(pitchx),
+		PitchY:      MM(pitchy),
+	}
+}
+
+// LabelTemplates are the available labels templates by name
+var LabelTemplates = map[string]LabelTemplate{
+	"avery-l7160":   avery("avery-l7160", 3, 7, 63.5, 38.1, 7.2, 15.15, 66.04, 38.1),
+	"avery-l7163":   avery("avery-l7163", 2, 7, 99.1, 38.1, 4.65, 15.15, 101.6, 38.1),
+	"avery-l7165":   avery("avery-l7165", 2, 4, 99.1, 67.7, 4.65, 13.1, 101.6, 67.7),
+	"avery-l7173":   avery("avery-l7173", 2, 5, 99.1, 57, 4.65, 6, 101.6, 57),
+	"single-100x50": SingleLabelTemplate("single-100x50", 100, 50),
+	"single-62x29":  SingleLabelTemplate("single-62x29", 62, 29),
+	"single-57x32":  SingleLabelTemplate("single-57x32", 57, 32),
+}
+
+// LabelTemplateNames returns the sorted names of the labels templates
+func LabelTemplateNames() []string {
+	var names []string
+	for n := range LabelTemplates {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PerPage returns the number of labels of a page of the template
+func (t LabelTemplate) PerPage() int {
+	return t.Columns * t.Rows
+}
+
+// Position returns the top left corner of the i-th label of a page
+// filled row by row
+func (t LabelTemplate) Position(i int) (x, y float64) {
+	return t.MarginLeft + float64(i%t.Columns)*t.PitchX, t.MarginTop + float64(i/t.Columns)*t.PitchY
+}
@@ -0,0 +1,230 @@
+package helpers
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png" // PNG images decoding
+)
+
+// A4 page size in points
+const (
+	PDFPageWidth  = 595.28
+	PDFPageHeight = 841.89
+)
+
+// PDF is a minimal PDF document writer
+// with Helvetica texts, lines, rectangles and images
+type PDF struct {
+	width  float64
+	height float64
+	pages  []*bytes.Buffer
+	images []string          // images XObjects
+	names  map[string]string // images XObjects names by source image
+}
+
+// NewPDF returns an empty PDF document of A4 pages
+func NewPDF() *PDF {
+	return NewPDFSize(PDFPageWidth, PDFPageHeight)
+}
+
+// NewPDFSize returns an empty PDF document of width x height points pages
+func NewPDFSize(width, height float64) *PDF {
+	return &PDF{width: width, height: height, names: make(map[string]string)}
+}
+
+// AddPage starts a new page
+func (p *PDF) AddPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+}
+
+// page returns the current page content, starting the first page if needed
+func (p *PDF) page() *bytes.Buffer {
+	if len(p.pages) == 0 {
+		p.AddPage()
+	}
+	return p.pages[len(p.pages)-1]
+}
+
+// Text writes s on the current page with its baseline at x, y points
+// from the top left corner, in bold if bold is true
+func (p *PDF) Text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(p.page(), "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, p.height-y, pdfEscape(s))
+}
+
+// Line draws a line on the current page from x1, y1 to x2, y2 points
+// from the top left corner
+func (p *PDF) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(p.page(), "%.2f %.2f m %.2f %.2f l S\n", x1, p.height-y1, x2, p.height-y2)
+}
+
+// Rect draws a filled black rectangle of w x h points on the current page
+// with its top left corner at x, y points from the top left corner
+func (p *PDF) Rect(x, y, w, h float64) {
+	fmt.Fprintf(p.page(), "%.2f %.2f %.2f %.2f re f\n", x, p.height-y-h, w, h)
+}
+
+// Image draws the PNG image img on the current page in a w x h points box
+// with its top left corner at x, y points from the top left corner,
+// the transparent parts of the image are drawn white
+func (p *PDF) Image(x, y, w, h float64, img []byte) error {
+	name, ok := p.names[string(img)]
+	if !ok {
+		i, _, err := image.Decode(bytes.NewReader(img))
+		if err != nil {
+			return err
+		}
+		bounds := i.Bounds()
+
+		var raw, z bytes.Buffer
+		for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+			for px := bounds.Min.X; px < bounds.Max.X; px++ {
+				// compositing on a white background
+				c := color.NRGBAModel.Convert(i.At(px, py)).(color.NRGBA)
+				a := int(c.A)
+				raw.WriteByte(byte((int(c.R)*a + 255*(255-a)) / 255))
+				raw.WriteByte(byte((int(c.G)*a + 255*(255-a)) / 255))
+				raw.WriteByte(byte((int(c.B)*a + 255*(255-a)) / 255))
+			}
+		}
+		zw := zlib.NewWriter(&z)
+		zw.Write(raw.Bytes())
+		zw.Close()
+
+		name = fmt.Sprintf("Im%d", len(p.images))
+		p.images = append(p.images, fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream",
+			bounds.Dx(), bounds.Dy(), z.Len(), z.String()))
+		p.names[string(img)] = name
+	}
+	fmt.Fprintf(p.page(), "q %.2f 0 0 %.2f %.2f %.2f cm /%s Do Q\n", w, h, x, p.height-y-h, name)
+	return nil
+}
+
+// helveticaWidths are the Helvetica and Helvetica-Bold widths
+// in thousandths of the font size of the ASCII characters from the space
+var helveticaWidths = [2][95]int{
+	{278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584},
+	{278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584},
+}
+
+// TextWidth returns the width in points of s written with the font size,
+// in bold if bold is true, the non ASCII characters being given the width of a digit
+func TextWidth(size float64, bold bool, s string) float64 {
+	var (
+		w    int
+		font int
+	)
+
+	if bold {
+		font = 1
+	}
+	for _, r := range s {
+		if r >= ' ' && r <= '~' {
+			w += helveticaWidths[font][r-' ']
+		} else {
+			w += 556
+		}
+	}
+	return float64(w) * size / 1000
+}
+
+// FitText returns s truncated with "..." to be at most width points wide
+// when written with the font size, in bold if bold is true
+func FitText(size float64, bold bool, width float64, s string) string {
+	if TextWidth(size, bold, s) <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && TextWidth(size, bold, string(r)+"...") > width {
+		r = r[:len(r)-1]
+	}
+	if len(r) == 0 {
+		return ""
+	}
+	return string(r) + "..."
+}
+
+// pdfEscape returns s as a PDF string literal content in the WinAnsi encoding,
+// the characters out of Latin-1 are replaced by "?"
+func pdfEscape(s string) string {
+	var b bytes.Buffer
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// Bytes returns the PDF document
+func (p *PDF) Bytes() []byte {
+	var (
+		b        bytes.Buffer
+		offsets  []int
+		kids     bytes.Buffer
+		xobjects bytes.Buffer
+	)
+
+	p.page()
+	obj := func(content string) {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", len(offsets), content)
+	}
+
+	// objects 1 to 4 are the catalog, the pages tree and the fonts,
+	// followed by the images and each page and its content stream
+	first := 5 + len(p.images)
+	for i := range p.pages {
+		fmt.Fprintf(&kids, "%d 0 R ", first+2*i)
+	}
+	for i := range p.images {
+		fmt.Fprintf(&xobjects, "/Im%d %d 0 R ", i, 5+i)
+	}
+
+	b.WriteString("%PDF-1.4\n")
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids.String(), len(p.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for _, i := range p.images {
+		obj(i)
+	}
+	for i, c := range p.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> /XObject << %s>> >> /Contents %d 0 R >>",
+			p.width, p.height, xobjects.String(), first+1+2*i))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", c.Len(), c.String()))
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return b.Bytes()
+}
@@ -41,6 +41,9 @@ type DbselectparamProduct interface {
 	SetStorelocation(int)
 	SetBookmark(bool)
 	SetProductSpecificity(string)
+	SetProductSmiles(string)
+	SetProductInchi(string)
+	SetProductInchiKey(string)
 
 	SetCustomNamePartOf(string)
 	SetName(int)
@@ -58,6 +61,9 @@ type DbselectparamProduct interface {
 	GetStorelocation() int
 	GetBookmark() bool
 	GetProductSpecificity() string
+	GetProductSmiles() string
+	GetProductInchi() string
+	GetProductInchiKey() string
 
 	GetCustomNamePartOf() string
 	GetName() int
@@ -88,6 +94,9 @@ type dbselectparamProduct struct {
 	SignalWord              int   // id
 	CasNumberCmr            bool
 	ProductSpecificity string
+	ProductSmiles      string
+	ProductInchi       string
+	ProductInchiKey    string
 }
 
 // DbselectparamStorage contains the parameters of the GetStorages function
@@ -398,6 +407,30 @@ func (d *dbselectparamProduct) GetProductSpecificity() string {
 	return d.ProductSpecificity
 }
 
+func (d *dbselectparamProduct) SetProductSmiles(s string) {
+	d.ProductSmiles = s
+}
+
+func (d *dbselectparamProduct) GetProductSmiles() string {
+	return d.ProductSmiles
+}
+
+func (d *dbselectparamProduct) SetProductInchi(s string) {
+	d.ProductInchi = s
+}
+
+func (d *dbselectparamProduct) GetProductInchi() string {
+	return d.ProductInchi
+}
+
+func (d *dbselectparamProduct) SetProductInchiKey(s string) {
+	d.ProductInchiKey = s
+}
+
+func (d *dbselectparamProduct) GetProductInchiKey() string {
+	return d.ProductInchiKey
+}
+
 //
 // dbselectparamStorage functions
 //
@@ -637,6 +670,9 @@ func NewdbselectparamProduct(r *http.Request, f func(string) (string, error)) (*
 	dspp.SignalWord = -1
 	dspp.CasNumberCmr = false
 	dspp.ProductSpecificity = ""
+	dspp.ProductSmiles = ""
+	dspp.ProductInchi = ""
+	dspp.ProductInchiKey = ""
 	if dsp, aerr = Newdbselectparam(r, f); aerr != nil {
 		return nil, aerr
 	}
@@ -768,6 +804,15 @@ func NewdbselectparamProduct(r *http.Request, f func(string) (string, error)) (*
 		if product_specificity, ok := r.URL.Query()["product_specificity"]; ok {
 			dspp.ProductSpecificity = product_specificity[0]
 		}
+		if product_smiles, ok := r.URL.Query()["product_smiles"]; ok {
+			dspp.ProductSmiles = product_smiles[0]
+		}
+		if product_inchi, ok := r.URL.Query()["product_inchi"]; ok {
+			dspp.ProductInchi = product_inchi[0]
+		}
+		if product_inchikey, ok := r.URL.Query()["product_inchikey"]; ok {
+			dspp.ProductInchiKey = product_inchikey[0]
+		}
 		if casnumber_cmr, ok := r.URL.Query()["casnumber_cmr"]; ok {
 			if dspp.CasNumberCmr, err = strconv.ParseBool(casnumber_cmr[0]); err != nil {
 				return nil, &AppError{
@@ -0,0 +1,135 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"net"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// LabelPrinterPort is the default raw printing port of the labels printers
+const LabelPrinterPort = "9100"
+
+// ZPL is a minimal ZPL II writer of labels
+// with texts, Code128 barcodes, QR codes and images,
+// all positions and sizes being in dots
+type ZPL struct {
+	b bytes.Buffer
+}
+
+// NewZPL returns an empty ZPL document
+func NewZPL() *ZPL {
+	return &ZPL{}
+}
+
+// zplEscape returns s as a ^FH field data with the "_" hexadecimal indicator,
+// the ZPL commands prefixes being escaped
+func zplEscape(s string) string {
+	return strings.NewReplacer("_", "_5F", "^", "_5E", "~", "_7E", "\n", " ", "\r", " ").Replace(s)
+}
+
+// StartLabel starts a width x height dots UTF-8 label
+func (z *ZPL) StartLabel(width, height int) {
+	fmt.Fprintf(&z.b, "^XA^CI28^PW%d^LL%d^LH0,0\n", width, height)
+}
+
+// EndLabel ends the current label
+func (z *ZPL) EndLabel() {
+	z.b.WriteString("^XZ\n")
+}
+
+// Text writes s with its top left corner at x, y with the scalable font of height h,
+// truncated to width dots
+func (z *ZPL) Text(x, y, h, width int, s string) {
+	fmt.Fprintf(&z.b, "^FO%d,%d^A0N,%d,%d^FB%d,1,0,L,0^FH^FD%s^FS\n", x, y, h, h, width, zplEscape(s))
+}
+
+// Code128 draws the Code128 barcode of s with its top left corner at x, y,
+// of module dots wide bars and h dots high, without its interpretation line
+func (z *ZPL) Code128(x, y, module, h int, s string) {
+	fmt.Fprintf(&z.b, "^BY%d^FO%d,%d^BCN,%d,N,N,N,A^FH^FD%s^FS\n", module, x, y, h, zplEscape(s))
+}
+
+// QRCodeModules returns the width in modules of the QR code of s
+// with the medium error correction level, without its quiet zone
+func QRCodeModules(s string) (int, error) {
+	q, err := qrcode.New(s, qrcode.Medium)
+	if err != nil {
+		return 0, err
+	}
+	q.DisableBorder = true
+	return len(q.Bitmap()), nil
+}
+
+// QRCode draws the QR code of s with the medium error correction level
+// with its top left corner at x, y and mag dots wide modules, from 1 to 10
+func (z *ZPL) QRCode(x, y, mag int, s string) {
+	// the ^BQ field origin includes a 10 dots top margin
+	if y -= 10; y < 0 {
+		y = 0
+	}
+	fmt.Fprintf(&z.b, "^FO%d,%d^BQN,2,%d^FDMA,%s^FS\n", x, y, mag, s)
+}
+
+// Image draws the PNG image img as a graphic field of w x h dots
+// with its top left corner at x, y, the pixels darker than half grey
+// once composited on a white background being printed
+func (z *ZPL) Image(x, y, w, h int, img []byte) error {
+	i, _, err := image.Decode(bytes.NewReader(img))
+	if err != nil {
+		return err
+	}
+	bounds := i.Bounds()
+
+	var hex strings.Builder
+	rowbytes := (w + 7) / 8
+	for py := 0; py < h; py++ {
+		row := make([]byte, rowbytes)
+		for px := 0; px < w; px++ {
+			// nearest neighbour scaling
+			c := color.NRGBAModel.Convert(i.At(bounds.Min.X+px*bounds.Dx()/w, bounds.Min.Y+py*bounds.Dy()/h)).(color.NRGBA)
+			a := int(c.A)
+			lum := ((299*int(c.R)+587*int(c.G)+114*int(c.B))/1000*a + 255*(255-a)) / 255
+			if lum < 128 {
+				row[px/8] |= 0x80 >> uint(px%8)
+			}
+		}
+		fmt.Fprintf(&hex, "%X", row)
+	}
+	fmt.Fprintf(&z.b, "^FO%d,%d^GFA,%d,%d,%d,%s^FS\n", x, y, rowbytes*h, rowbytes*h, rowbytes, hex.String())
+	return nil
+}
+
+// Bytes returns the ZPL document
+func (z *ZPL) Bytes() []byte {
+	return z.b.Bytes()
+}
+
+// LabelPrinterAddress returns the host:port address of the labels printer p,
+// adding the default port if needed
+func LabelPrinterAddress(p string) string {
+	if _, _, err := net.SplitHostPort(p); err == nil {
+		return p
+	}
+	return net.JoinHostPort(strings.Trim(p, "[]"), LabelPrinterPort)
+}
+
+// SendZPL sends the ZPL document zpl to the raw printing port of the labels printer p
+func SendZPL(p string, zpl []byte, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", LabelPrinterAddress(p), timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	_, err = conn.Write(zpl)
+	return err
+}
@@ -87,6 +87,62 @@ var LOCALES_EN = []byte(`
 
 	You can change it in the application.
 	'''
+[transfer_mailsubject]
+	one = "Chimithèque storage transfer request to %s"
+[transfer_mailbody]
+	one = "%s asks to transfer %s (%s) from %s to %s. Please accept or refuse it in Chimithèque."
+[disposal_manifest_title]
+	one = "chemical waste disposal manifest"
+[disposal_category_title]
+	one = "waste category"
+[disposal_count_title]
+	one = "containers"
+[disposal_collectiondate_title]
+	one = "collected"
+[disposal_signature_title]
+	one = "waste company signature:"
+[purchase_mailsubject]
+	one = "Chimithèque purchase of %s %s"
+[purchase_mailbody]
+	one = "%s purchase request of %d x %s from %s for %s is %s."
+[borrowrequest_mailsubject]
+	one = "Chimithèque borrow request of %s from %s"
+[borrowrequest_mailbody]
+	one = "%s borrow request of %s held by %s (%s):\r\n\r\n%s\r\n\r\nPlease answer it in Chimithèque."
+[borrowrequest_title]
+	one = "borrow request"
+[borrowrequest_quantity_title]
+	one = "requested quantity"
+[borrowrequest_date_title]
+	one = "wished date"
+[borrowrequest_sent_message]
+	one = "borrow request sent"
+[entity_code_title]
+	one = "barecodes code of the entity, used by the {entity} token"
+[entity_barecodetemplate_title]
+	one = "barecodes template, tokens: {entity} {storelocation} {product} {seq} {year} {yy} {check}, ex: {entity}-{yy}-{seq:5}{check} - empty for {storelocation}{product}.{seq}"
+[entity_barecodetemplate_validate]
+	one = "wrong barecode template"
+[entity_labelprinter_title]
+	one = "ZPL labels printer address, host or host:port (port 9100 by default)"
+[entity_sharestocks_title]
+	one = "show the stocks quantities to other entities"
+[borrowing_mailsubject]
+	one = "Chimithèque overdue borrowing"
+[borrowing_mailbody]
+	one = "%s (%s) borrowed on %s was due on %s. Please return it to %s."
+[alert_mailsubject]
+	one = "Chimithèque storage alerts for %s"
+[alert_expired]
+	one = "expired"
+[alert_expiring]
+	one = "expiring soon"
+[lowstock_mailsubject]
+	one = "Chimithèque low stock in %s"
+[lowstock_mailbody]
+	one = "%s: %g %s left, minimum %g %s"
+[alert_opened]
+	one = "opened for a long time"
 [resetpassword_mailsubject1]
 	one = "Chimithèque new temporary password\r\n"
 [resetpassword_mailbody2]
@@ -178,6 +234,34 @@ var LOCALES_EN = []byte(`
 	one = "switch to storage view"
 [export_text]
 	one = "export"
+[labels_text]
+	one = "labels"
+[labels_dpi_title]
+	one = "printer resolution"
+[labels_zpl_text]
+	one = "ZPL"
+[labels_send_text]
+	one = "send to the labels printer"
+[labels_skip_title]
+	one = "used labels of the first sheet"
+[labels_template_title]
+	one = "labels template"
+[bulk_text]
+	one = "bulk edit"
+[bulk_operation_title]
+	one = "operation on all the listed storages"
+[bulk_apply_text]
+	one = "apply"
+[bulk_move]
+	one = "move to a store location"
+[bulk_archive]
+	one = "archive"
+[bulk_delete]
+	one = "delete permanently"
+[bulk_applied_text]
+	one = "storages updated"
+[bulk_rejected_text]
+	one = "nothing changed, rejected storages"
 [showdeleted_text]
 	one = "show deleted"
 [hidedeleted_text]
@@ -191,6 +275,8 @@ var LOCALES_EN = []byte(`
 	one = "unit"
 [supplier_label_title]
 	one = "supplier"
+[supplierref_title]
+	one = "catalogue reference"
 
 [storage_create_title]
 	one = "create storage"
@@ -204,6 +290,32 @@ var LOCALES_EN = []byte(`
 	one = "unborrow"
 [storage_restore]
 	one = "restore"
+[storage_split]
+	one = "split into aliquots"
+[storage_split_add]
+	one = "add an aliquot"
+[storage_split_done]
+	one = "storage split"
+[storage_parent_title]
+	one = "aliquot of"
+[storage_children_title]
+	one = "aliquots"
+[storage_open]
+	one = "open"
+[storage_open_done]
+	one = "storage opened"
+[storage_shelflifereception_title]
+	one = "shelf-life after entry (months)"
+[storage_shelflifeopening_title]
+	one = "shelf-life after opening (months)"
+[storage_expirationcomputed_title]
+	one = "compute the expiration date from the shelf-lives"
+[storage_expirationcomputed_comment]
+	one = "an empty expiration date is also computed, the storage shelf-lives overriding the product ones"
+[storage_expirationdate_computed]
+	one = "computed"
+[storage_expirationdate_manual]
+	one = "manual"
 [storage_showhistory]
 	one = "show history"
 [storage_history]
@@ -227,6 +339,8 @@ var LOCALES_EN = []byte(`
 	one = "opening date"
 [storage_expirationdate_title]
 	one = "expiration date"
+[storage_borrowing_duedate_title]
+	one = "due date"
 [storage_borrower_title]
 	one = "borrower"
 [storage_comment_title]
@@ -284,16 +398,40 @@ var LOCALES_EN = []byte(`
 	one = "3D formula"
 [product_threedformula_mol_title]
 	one = "3D formula MOL file"
+[product_smiles_title]
+	one = "SMILES"
+[product_inchi_title]
+	one = "InChI"
+[product_inchikey_title]
+	one = "InChIKey"
 [product_msds_title]
 	one = "MSDS"
 [product_disposalcomment_title]
 	one = "disposal comment"
 [product_remark_title]
 	one = "remark"
+[product_shelflifereception_title]
+	one = "shelf-life after entry (months)"
+[product_shelflifeopening_title]
+	one = "shelf-life after opening (months)"
 [product_specificity_title]
 	one = "specificity"
 [product_radioactive_title]
 	one = "radioactive"
+[product_components_title]
+	one = "components"
+[product_component_add]
+	one = "add a component"
+[product_component_solvent]
+	one = "solvent"
+[product_classification_suggest]
+	one = "suggest the classification from the components"
+[product_prepare]
+	one = "prepare"
+[product_prepare_sources]
+	one = "source storages"
+[product_prepare_done]
+	one = "mixture prepared"
 [product_restricted_title]
 	one = "restricted access"
 [product_name_table_header]
@@ -396,6 +534,8 @@ var LOCALES_EN = []byte(`
 	one = "person with this email already present" 
 [empiricalformula_validate]
 	one = "invalid empirical formula"
+[smiles_validate]
+	one = "invalid SMILES"
 [casnumber_validate_wrongcas]
 	one = "invalid CAS number"
 [casnumber_validate_casspecificity]
@@ -87,6 +87,62 @@ var LOCALES_FR = []byte(`
 
 	Vous pouvez le changer dans l'application.
 	'''
+[transfer_mailsubject]
+	one = "Chimithèque demande de transfert de stockage vers %s"
+[transfer_mailbody]
+	one = "%s demande le transfert de %s (%s) de %s vers %s. Merci de l'accepter ou de le refuser dans Chimithèque."
+[disposal_manifest_title]
+	one = "bordereau d'élimination des déchets chimiques"
+[disposal_category_title]
+	one = "catégorie de déchet"
+[disposal_count_title]
+	one = "contenants"
+[disposal_collectiondate_title]
+	one = "collecté"
+[disposal_signature_title]
+	one = "signature du collecteur :"
+[purchase_mailsubject]
+	one = "Chimithèque achat de %s : %s"
+[purchase_mailbody]
+	one = "La demande d'achat de %s de %d x %s chez %s pour %s est : %s."
+[borrowrequest_mailsubject]
+	one = "Chimithèque demande d'emprunt de %s auprès de %s"
+[borrowrequest_mailbody]
+	one = "Demande d'emprunt de %s pour %s détenu par %s (%s) :\r\n\r\n%s\r\n\r\nMerci d'y répondre dans Chimithèque."
+[borrowrequest_title]
+	one = "demande d'emprunt"
+[borrowrequest_quantity_title]
+	one = "quantité demandée"
+[borrowrequest_date_title]
+	one = "date souhaitée"
+[borrowrequest_sent_message]
+	one = "demande d'emprunt envoyée"
+[entity_code_title]
+	one = "code de l'entité dans les codes barres, utilisé par le jeton {entity}"
+[entity_barecodetemplate_title]
+	one = "modèle des codes barres, jetons : {entity} {storelocation} {product} {seq} {year} {yy} {check}, ex : {entity}-{yy}-{seq:5}{check} - vide pour {storelocation}{product}.{seq}"
+[entity_barecodetemplate_validate]
+	one = "modèle de codes barres invalide"
+[entity_labelprinter_title]
+	one = "adresse de l'imprimante d'étiquettes ZPL, hôte ou hôte:port (port 9100 par défaut)"
+[entity_sharestocks_title]
+	one = "montrer les quantités en stock aux autres entités"
+[borrowing_mailsubject]
+	one = "Chimithèque emprunt en retard"
+[borrowing_mailbody]
+	one = "%s (%s) emprunté le %s devait être rendu le %s. Merci de le remettre dans %s."
+[alert_mailsubject]
+	one = "Chimithèque alertes de stockage pour %s"
+[alert_expired]
+	one = "périmé"
+[alert_expiring]
+	one = "bientôt périmé"
+[lowstock_mailsubject]
+	one = "Chimithèque stock bas dans %s"
+[lowstock_mailbody]
+	one = "%s : %g %s restant(s), minimum %g %s"
+[alert_opened]
+	one = "ouvert depuis longtemps"
 [resetpassword_mailsubject1]
 	one = "Chimithèque nouveau mot de passe temporaire\r\n"
 [resetpassword_mailbody2]
@@ -178,6 +234,34 @@ var LOCALES_FR = []byte(`
 	one = "vue par stockages"
 [export_text]
 	one = "exporter"
+[labels_text]
+	one = "étiquettes"
+[labels_dpi_title]
+	one = "résolution de l'imprimante"
+[labels_zpl_text]
+	one = "ZPL"
+[labels_send_text]
+	one = "envoyer à l'imprimante d'étiquettes"
+[labels_skip_title]
+	one = "étiquettes déjà utilisées de la première feuille"
+[labels_template_title]
+	one = "modèle d'étiquettes"
+[bulk_text]
+	one = "modification groupée"
+[bulk_operation_title]
+	one = "opération sur tous les stockages listés"
+[bulk_apply_text]
+	one = "appliquer"
+[bulk_move]
+	one = "déplacer vers un lieu de stockage"
+[bulk_archive]
+	one = "archiver"
+[bulk_delete]
+	one = "supprimer définitivement"
+[bulk_applied_text]
+	one = "stockages modifiés"
+[bulk_rejected_text]
+	one = "aucune modification, stockages refusés"
 [showdeleted_text]
 	one = "voir supprimés"
 [hidedeleted_text]
@@ -191,6 +275,8 @@ var LOCALES_FR = []byte(`
 	one = "unité"
 [supplier_label_title]
 	one = "fournisseur"
+[supplierref_title]
+	one = "référence catalogue"
 
 [storage_create_title]
 	one = "créer stockage"
@@ -204,6 +290,32 @@ var LOCALES_FR = []byte(`
 	one = "restituer"
 [storage_restore]
 	one = "restaurer"
+[storage_split]
+	one = "fractionner en aliquotes"
+[storage_split_add]
+	one = "ajouter une aliquote"
+[storage_split_done]
+	one = "stockage fractionné"
+[storage_parent_title]
+	one = "aliquote de"
+[storage_children_title]
+	one = "aliquotes"
+[storage_open]
+	one = "ouvrir"
+[storage_open_done]
+	one = "stockage ouvert"
+[storage_shelflifereception_title]
+	one = "durée de conservation après réception (mois)"
+[storage_shelflifeopening_title]
+	one = "durée de conservation après ouverture (mois)"
+[storage_expirationcomputed_title]
+	one = "calculer la date de péremption à partir des durées de conservation"
+[storage_expirationcomputed_comment]
+	one = "une date de péremption vide est aussi calculée, les durées de conservation du stockage remplaçant celles du produit"
+[storage_expirationdate_computed]
+	one = "calculée"
+[storage_expirationdate_manual]
+	one = "manuelle"
 [storage_showhistory]
 	one = "voir historique"
 [storage_history]
@@ -227,6 +339,8 @@ var LOCALES_FR = []byte(`
 	one = "date d'ouverture"
 [storage_expirationdate_title]
 	one = "date d'expiration"
+[storage_borrowing_duedate_title]
+	one = "date de retour prévue"
 [storage_borrower_title]
 	one = "emprunteur"
 [storage_comment_title]
@@ -284,16 +398,40 @@ var LOCALES_FR = []byte(`
 	one = "formule 3D"
 [product_threedformula_mol_title]
 	one = "fichier MOL formule 3D"
+[product_smiles_title]
+	one = "SMILES"
+[product_inchi_title]
+	one = "InChI"
+[product_inchikey_title]
+	one = "InChIKey"
 [product_msds_title]
 	one = "FDS"
 [product_disposalcomment_title]
 	one = "commentaire de destruction"
 [product_remark_title]
 	one = "remarque"
+[product_shelflifereception_title]
+	one = "durée de conservation après réception (mois)"
+[product_shelflifeopening_title]
+	one = "durée de conservation après ouverture (mois)"
 [product_specificity_title]
 	one = "spécificité"
 [product_radioactive_title]
 	one = "radioactif"
+[product_components_title]
+	one = "composants"
+[product_component_add]
+	one = "ajouter un composant"
+[product_component_solvent]
+	one = "solvant"
+[product_classification_suggest]
+	one = "suggérer la classification depuis les composants"
+[product_prepare]
+	one = "préparer"
+[product_prepare_sources]
+	one = "stockages sources"
+[product_prepare_done]
+	one = "mélange préparé"
 [product_restricted_title]
 	one = "accès restreint"
 [product_name_table_header]
@@ -396,6 +534,8 @@ var LOCALES_FR = []byte(`
 	one = "une personne avec cet email existe déjà"
 [empiricalformula_validate]
 	one = "formule brute invalide"
+[smiles_validate]
+	one = "SMILES invalide"
 [casnumber_validate_wrongcas]
 	one = "numéro CAS invalide"
 [casnumber_validate_casspecificity]
@@ -12,6 +12,7 @@ import (
 	"net/http/pprof"
 	"os"
 	"strings"
+	"time"
 
 	rice "github.com/GeertJohan/go.rice"
 	"github.com/gorilla/mux"
@@ -44,6 +45,10 @@ func main() {
 	logfile := flag.String("logfile", "", "log to the given file")
 	debug := flag.Bool("debug", false, "debug (verbose log), default is error")
 	importfrom := flag.String("importfrom", "", "full path of the directory containing the CSV to import")
+	alertinterval := flag.Int("alertinterval", 24, "the storage alerts check interval in hours, 0 to disable")
+	importreference := flag.String("importreference", "", "full path of the directory containing the reference dataset bundle to import")
+	renumberentity := flag.Int("renumberentity", 0, "id of the entity which storages barecodes must be regenerated after a barecode template change")
+	computeexpirations := flag.Bool("computeexpirations", false, "recompute the storages expiration dates from the products shelf-lives")
 	flag.Parse()
 
 	// setting the log level
@@ -89,6 +94,32 @@ func main() {
 		}
 		os.Exit(0)
 	}
+	if *importreference != "" {
+		log.Info("- import reference dataset into database")
+		err := datastore.ImportReferenceDataset(*importreference)
+		if err != nil {
+			log.Error("an error occured: " + err.Error())
+		}
+		os.Exit(0)
+	}
+	if *renumberentity != 0 {
+		log.Info("- renumbering the entity storages barecodes")
+		n, err := datastore.RenumberEntityStorages(*renumberentity)
+		if err != nil {
+			log.Error("an error occured: " + err.Error())
+		}
+		log.WithFields(log.Fields{"storages": n}).Info("  storages renumbered")
+		os.Exit(0)
+	}
+	if *computeexpirations {
+		log.Info("- computing the storages expiration dates")
+		n, err := datastore.ComputeStoragesExpirationDates()
+		if err != nil {
+			log.Error("an error occured: " + err.Error())
+		}
+		log.WithFields(log.Fields{"storages": n}).Info("  expiration dates changed")
+		os.Exit(0)
+	}
 
 	// adding additional admins
 	var (
@@ -140,6 +171,12 @@ func main() {
 		DB: datastore,
 	}
 
+	// storage alerts scheduler
+	if *alertinterval > 0 && global.MailServerAddress != "" {
+		log.Info("- starting storage alerts scheduler")
+		go env.RunAlertScheduler(time.Duration(*alertinterval) * time.Hour)
+	}
+
 	// router definition
 	r := mux.NewRouter()
 
@@ -184,6 +221,18 @@ func main() {
 	r.Handle("/{item:entities}/{id}", securechain.Then(env.AppMiddleware(env.UpdateEntityHandler))).Methods("PUT")
 	r.Handle("/{item:entities}/{id}", securechain.Then(env.AppMiddleware(env.DeleteEntityHandler))).Methods("DELETE")
 	r.Handle("/{item:stocks}/{id}", securechain.Then(env.AppMiddleware(env.GetEntityStockHandler))).Methods("GET")
+	r.Handle("/{item:entities}/{id}/incompatibilities", securechain.Then(env.AppMiddleware(env.GetEntityIncompatibilitiesHandler))).Methods("GET")
+	r.Handle("/{item:entities}/{id}/alertsetting", securechain.Then(env.AppMiddleware(env.GetEntityAlertSettingHandler))).Methods("GET")
+	r.Handle("/{item:entities}/{id}/alertsetting", securechain.Then(env.AppMiddleware(env.UpdateEntityAlertSettingHandler))).Methods("PUT")
+	r.Handle("/{item:entities}/{id}/transfers", securechain.Then(env.AppMiddleware(env.GetEntityTransfersHandler))).Methods("GET")
+	r.Handle("/{item:entities}/{id}/borrowings", securechain.Then(env.AppMiddleware(env.GetEntityBorrowingsHandler))).Methods("GET")
+	r.Handle("/{item:entities}/{id}/stockthresholds", securechain.Then(env.AppMiddleware(env.GetEntityStockThresholdsHandler))).Methods("GET")
+	r.Handle("/{item:entities}/{id}/stockthresholds", securechain.Then(env.AppMiddleware(env.UpdateEntityStockThresholdHandler))).Methods("PUT")
+	r.Handle("/{item:entities}/{id}/lowstocks", securechain.Then(env.AppMiddleware(env.GetEntityLowStocksHandler))).Methods("GET")
+	r.Handle("/{item:entities}/{id}/inventories", securechain.Then(env.AppMiddleware(env.GetEntityInventoriesHandler))).Methods("GET")
+	r.Handle("/{item:entities}/{id}/disposals", securechain.Then(env.AppMiddleware(env.GetEntityDisposalsHandler))).Methods("GET")
+	r.Handle("/{item:entities}/{id}/purchases", securechain.Then(env.AppMiddleware(env.GetEntityPurchasesHandler))).Methods("GET")
+	r.Handle("/{item:entities}/{id}/spendings", securechain.Then(env.AppMiddleware(env.GetEntitySpendingsHandler))).Methods("GET")
 
 	r.Handle("/f/{view:v}/{item:entities}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
 	r.Handle("/f/{view:vc}/{item:entities}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
@@ -203,6 +252,8 @@ func main() {
 	r.Handle("/{item:people}/{id}/entities", securechain.Then(env.AppMiddleware(env.GetPersonEntitiesHandler))).Methods("GET")
 	r.Handle("/{item:people}/{id}/manageentities", securechain.Then(env.AppMiddleware(env.GetPersonManageEntitiesHandler))).Methods("GET")
 	r.Handle("/{item:people}/{id}/permissions", securechain.Then(env.AppMiddleware(env.GetPersonPermissionsHandler))).Methods("GET")
+	r.Handle("/{item:people}/{id}/consumptions", securechain.Then(env.AppMiddleware(env.GetPersonConsumptionsHandler))).Methods("GET")
+	r.Handle("/{item:people}/{id}/borrowings", securechain.Then(env.AppMiddleware(env.GetPersonBorrowingsHandler))).Methods("GET")
 	r.Handle("/{item:people}/{id}", securechain.Then(env.AppMiddleware(env.UpdatePersonHandler))).Methods("PUT")
 	r.Handle("/{item:people}", securechain.Then(env.AppMiddleware(env.CreatePersonHandler))).Methods("POST")
 	r.Handle("/{item:people}/{id}", securechain.Then(env.AppMiddleware(env.DeletePersonHandler))).Methods("DELETE")
@@ -245,6 +296,16 @@ func main() {
 	r.Handle("/{item:products}/{id}", securechain.Then(env.AppMiddleware(env.DeleteProductHandler))).Methods("DELETE")
 	r.Handle("/{item:bookmarks}/{id}", securechain.Then(env.AppMiddleware(env.ToogleProductBookmarkHandler))).Methods("PUT")
 	r.Handle("/{item:products}/magic", securechain.Then(env.AppMiddleware(env.MagicHandler))).Methods("POST")
+	r.Handle("/{item:products}/clp", securechain.Then(env.AppMiddleware(env.GetProductsClpClassificationHandler))).Methods("POST")
+	r.Handle("/{item:products}/clp/inconsistencies", securechain.Then(env.AppMiddleware(env.GetProductsClpInconsistenciesHandler))).Methods("GET")
+	r.Handle("/{item:products}/{id}/clp", securechain.Then(env.AppMiddleware(env.UpdateProductClpClassificationHandler))).Methods("PUT")
+	r.Handle("/{item:products}/duplicates/", securechain.Then(env.AppMiddleware(env.GetProductsDuplicatesHandler))).Methods("GET")
+	r.Handle("/{item:products}/merges/", securechain.Then(env.AppMiddleware(env.GetProductsMergesHandler))).Methods("GET")
+	r.Handle("/{item:products}/{id}/merge/{from}", securechain.Then(env.AppMiddleware(env.MergeProductHandler))).Methods("PUT")
+	r.Handle("/{item:products}/{id}/consumptions", securechain.Then(env.AppMiddleware(env.GetProductConsumptionsHandler))).Methods("GET")
+	r.Handle("/{item:products}/{id}/classification", securechain.Then(env.AppMiddleware(env.GetProductClassificationHandler))).Methods("GET")
+	r.Handle("/{item:products}/reference/", securechain.Then(env.AppMiddleware(env.GetProductReferenceHandler))).Methods("GET")
+	r.Handle("/{item:products}/referencedatasets/", securechain.Then(env.AppMiddleware(env.GetReferenceDatasetsHandler))).Methods("GET")
 
 	r.Handle("/{item:products}/casnumbers/", securechain.Then(env.AppMiddleware(env.GetProductsCasNumbersHandler))).Methods("GET")
 	r.Handle("/{item:products}/casnumbers/{id}", securechain.Then(env.AppMiddleware(env.GetProductsCasNumberHandler))).Methods("GET")
@@ -291,29 +352,100 @@ func main() {
 	r.Handle("/{item:storages}/others", securechain.Then(env.AppMiddleware(env.GetOtherStoragesHandler))).Methods("GET")
 	r.Handle("/{item:storages}/suppliers", securechain.Then(env.AppMiddleware(env.GetStoragesSuppliersHandler))).Methods("GET")
 	r.Handle("/{item:storages}/units", securechain.Then(env.AppMiddleware(env.GetStoragesUnitsHandler))).Methods("GET")
+	r.Handle("/{item:storages}/scan", securechain.Then(env.AppMiddleware(env.ScanStorageHandler))).Methods("GET")
+	r.Handle("/{item:storages}/labels", securechain.Then(env.AppMiddleware(env.GetStoragesLabelsHandler))).Methods("GET")
+	r.Handle("/{item:storages}/zpl", securechain.Then(env.AppMiddleware(env.GetStoragesZPLHandler))).Methods("GET")
+	r.Handle("/{item:storages}/zpl", securechain.Then(env.AppMiddleware(env.PrintStoragesZPLHandler))).Methods("POST")
+	r.Handle("/{item:storages}/bulk", securechain.Then(env.AppMiddleware(env.BulkStoragesHandler))).Methods("POST")
+	r.Handle("/{item:storages}/prepare", securechain.Then(env.AppMiddleware(env.PrepareMixtureHandler))).Methods("POST")
 	r.Handle("/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.GetStorageHandler))).Methods("GET")
 	r.Handle("/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.UpdateStorageHandler))).Methods("PUT")
 	r.Handle("/{item:storages}", securechain.Then(env.AppMiddleware(env.CreateStorageHandler))).Methods("POST")
 	r.Handle("/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.DeleteStorageHandler))).Methods("DELETE")
 	r.Handle("/{item:storages}/{id}/a", securechain.Then(env.AppMiddleware(env.ArchiveStorageHandler))).Methods("DELETE")
 	r.Handle("/{item:storages}/{id}/r", securechain.Then(env.AppMiddleware(env.RestoreStorageHandler))).Methods("PUT")
+	r.Handle("/{item:storages}/{id}/history", securechain.Then(env.AppMiddleware(env.GetStorageHistoryHandler))).Methods("GET")
+	r.Handle("/{item:storages}/{id}/history/{version}", securechain.Then(env.AppMiddleware(env.RestoreStorageVersionHandler))).Methods("PUT")
+	r.Handle("/{item:storages}/{id}/split", securechain.Then(env.AppMiddleware(env.SplitStorageHandler))).Methods("PUT")
+	r.Handle("/{item:storages}/{id}/open", securechain.Then(env.AppMiddleware(env.OpenStorageHandler))).Methods("PUT")
+	r.Handle("/{item:storages}/{id}/consume", securechain.Then(env.AppMiddleware(env.CreateStorageConsumptionHandler))).Methods("PUT")
+	r.Handle("/{item:storages}/{id}/transfers", securechain.Then(env.AppMiddleware(env.GetStorageTransfersHandler))).Methods("GET")
+	r.Handle("/{item:storages}/{id}/transfer", securechain.Then(env.AppMiddleware(env.CreateStorageTransferHandler))).Methods("PUT")
+	r.Handle("/{item:transfers}/{id}/accept", securechain.Then(env.AppMiddleware(env.AcceptTransferHandler))).Methods("PUT")
+	r.Handle("/{item:transfers}/{id}/refuse", securechain.Then(env.AppMiddleware(env.RefuseTransferHandler))).Methods("PUT")
 	r.Handle("/{item:borrowings}/{id}", securechain.Then(env.AppMiddleware(env.ToogleStorageBorrowingHandler))).Methods("PUT")
+	// purchases
+	r.Handle("/{item:purchases}", securechain.Then(env.AppMiddleware(env.CreatePurchaseHandler))).Methods("POST")
+	r.Handle("/{item:purchases}/{id}", securechain.Then(env.AppMiddleware(env.GetPurchaseHandler))).Methods("GET")
+	r.Handle("/{item:purchases}/{id}/approve", securechain.Then(env.AppMiddleware(env.ApprovePurchaseHandler))).Methods("PUT")
+	r.Handle("/{item:purchases}/{id}/refuse", securechain.Then(env.AppMiddleware(env.RefusePurchaseHandler))).Methods("PUT")
+	r.Handle("/{item:purchases}/{id}/order", securechain.Then(env.AppMiddleware(env.OrderPurchaseHandler))).Methods("PUT")
+	r.Handle("/{item:purchases}/{id}/receive", securechain.Then(env.AppMiddleware(env.ReceivePurchaseHandler))).Methods("PUT")
+	r.Handle("/{item:purchases}/{id}/cancel", securechain.Then(env.AppMiddleware(env.CancelPurchaseHandler))).Methods("PUT")
+
+	// disposals
+	r.Handle("/{item:disposals}", securechain.Then(env.AppMiddleware(env.CreateDisposalHandler))).Methods("POST")
+	r.Handle("/{item:disposals}/{id}", securechain.Then(env.AppMiddleware(env.GetDisposalHandler))).Methods("GET")
+	r.Handle("/{item:disposals}/{id}", securechain.Then(env.AppMiddleware(env.DeleteDisposalHandler))).Methods("DELETE")
+	r.Handle("/{item:disposals}/{id}/manifest", securechain.Then(env.AppMiddleware(env.GetDisposalManifestHandler))).Methods("GET")
+	r.Handle("/{item:disposals}/{id}/collect", securechain.Then(env.AppMiddleware(env.CollectDisposalHandler))).Methods("PUT")
+	r.Handle("/{item:disposals}/{id}/storages", securechain.Then(env.AppMiddleware(env.AddDisposalStoragesHandler))).Methods("PUT")
+	r.Handle("/{item:disposals}/{id}/storages/{storageid}", securechain.Then(env.AppMiddleware(env.UpdateDisposalStorageHandler))).Methods("PUT")
+	r.Handle("/{item:disposals}/{id}/storages/{storageid}", securechain.Then(env.AppMiddleware(env.RemoveDisposalStorageHandler))).Methods("DELETE")
+
+	// inventory campaigns
+	r.Handle("/{item:inventories}", securechain.Then(env.AppMiddleware(env.CreateInventoryHandler))).Methods("POST")
+	r.Handle("/{item:inventories}/{id}", securechain.Then(env.AppMiddleware(env.GetInventoryHandler))).Methods("GET")
+	r.Handle("/{item:inventories}/{id}/close", securechain.Then(env.AppMiddleware(env.CloseInventoryHandler))).Methods("PUT")
+	r.Handle("/{item:inventories}/{id}/scans", securechain.Then(env.AppMiddleware(env.CreateInventoryScanHandler))).Methods("POST")
+	r.Handle("/{item:inventories}/{id}/report", securechain.Then(env.AppMiddleware(env.GetInventoryReportHandler))).Methods("GET")
+	r.Handle("/{item:inventories}/{id}/missing/archive", securechain.Then(env.AppMiddleware(env.ArchiveInventoryMissingHandler))).Methods("PUT")
+	r.Handle("/{item:inventories}/{id}/misplaced/move", securechain.Then(env.AppMiddleware(env.MoveInventoryMisplacedHandler))).Methods("PUT")
+	r.Handle("/{item:inventories}/{id}/unknown/storages", securechain.Then(env.AppMiddleware(env.CreateInventoryUnknownHandler))).Methods("POST")
+
+	// suppliers
+	r.Handle("/{item:suppliers}/{id}", securechain.Then(env.AppMiddleware(env.GetSupplierHandler))).Methods("GET")
+	r.Handle("/{item:suppliers}", securechain.Then(env.AppMiddleware(env.CreateSupplierHandler))).Methods("POST")
+	r.Handle("/{item:suppliers}/{id}", securechain.Then(env.AppMiddleware(env.UpdateSupplierHandler))).Methods("PUT")
+	r.Handle("/{item:suppliers}/{id}", securechain.Then(env.AppMiddleware(env.DeleteSupplierHandler))).Methods("DELETE")
+	r.Handle("/{item:suppliers}/{id}/merge/{from}", securechain.Then(env.AppMiddleware(env.MergeSupplierHandler))).Methods("PUT")
+	r.Handle("/{item:supplierrefs}", securechain.Then(env.AppMiddleware(env.GetSupplierRefsHandler))).Methods("GET")
+	r.Handle("/{item:supplierrefs}/{id}", securechain.Then(env.AppMiddleware(env.GetSupplierRefHandler))).Methods("GET")
+	r.Handle("/{item:supplierrefs}", securechain.Then(env.AppMiddleware(env.CreateSupplierRefHandler))).Methods("POST")
+	r.Handle("/{item:supplierrefs}/{id}", securechain.Then(env.AppMiddleware(env.UpdateSupplierRefHandler))).Methods("PUT")
+	r.Handle("/{item:supplierrefs}/{id}", securechain.Then(env.AppMiddleware(env.DeleteSupplierRefHandler))).Methods("DELETE")
+	// borrow requests
+	r.Handle("/{item:borrowrequests}", securechain.Then(env.AppMiddleware(env.GetBorrowRequestsHandler))).Methods("GET")
+	r.Handle("/{item:borrowrequests}", securechain.Then(env.AppMiddleware(env.CreateBorrowRequestHandler))).Methods("POST")
+	r.Handle("/{item:borrowrequests}/{id}", securechain.Then(env.AppMiddleware(env.GetBorrowRequestHandler))).Methods("GET")
+	r.Handle("/{item:borrowrequests}/{id}/messages", securechain.Then(env.AppMiddleware(env.CreateBorrowRequestMessageHandler))).Methods("POST")
+	r.Handle("/{item:borrowrequests}/{id}/accept", securechain.Then(env.AppMiddleware(env.AcceptBorrowRequestHandler))).Methods("PUT")
+	r.Handle("/{item:borrowrequests}/{id}/refuse", securechain.Then(env.AppMiddleware(env.RefuseBorrowRequestHandler))).Methods("PUT")
 
 	r.Handle("/f/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
 	r.Handle("/f/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("PUT")
 	r.Handle("/f/{item:storages}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("POST")
 	r.Handle("/f/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("DELETE")
 
+	r.Handle("/{item:incompatibilities}", securechain.Then(env.AppMiddleware(env.GetIncompatibilitiesHandler))).Methods("GET")
+	r.Handle("/{item:incompatibilities}/{id}", securechain.Then(env.AppMiddleware(env.GetIncompatibilityHandler))).Methods("GET")
+	r.Handle("/{item:incompatibilities}/{id}", securechain.Then(env.AppMiddleware(env.UpdateIncompatibilityHandler))).Methods("PUT")
+	r.Handle("/{item:incompatibilities}", securechain.Then(env.AppMiddleware(env.CreateIncompatibilityHandler))).Methods("POST")
+	r.Handle("/{item:incompatibilities}/{id}", securechain.Then(env.AppMiddleware(env.DeleteIncompatibilityHandler))).Methods("DELETE")
+
 	// validators
 	r.Handle("/validate/entity/{id}/name/", securechain.Then(env.AppMiddleware(env.ValidateEntityNameHandler))).Methods("POST")
+	r.Handle("/validate/entity/{id}/barecodetemplate/", securechain.Then(env.AppMiddleware(env.ValidateEntityBarecodeTemplateHandler))).Methods("POST")
 	r.Handle("/validate/person/{id}/email/", securechain.Then(env.AppMiddleware(env.ValidatePersonEmailHandler))).Methods("POST")
 	r.Handle("/validate/product/{id}/casnumber/", securechain.Then(env.AppMiddleware(env.ValidateProductCasNumberHandler))).Methods("POST")
 	r.Handle("/validate/product/{id}/cenumber/", securechain.Then(env.AppMiddleware(env.ValidateProductCeNumberHandler))).Methods("POST")
 	r.Handle("/validate/product/{id}/name/", securechain.Then(env.AppMiddleware(env.ValidateProductNameHandler))).Methods("POST")
 	r.Handle("/validate/product/{id}/empiricalformula/", securechain.Then(env.AppMiddleware(env.ValidateProductEmpiricalFormulaHandler))).Methods("POST")
+	r.Handle("/validate/product/{id}/smiles/", securechain.Then(env.AppMiddleware(env.ValidateProductSmilesHandler))).Methods("POST")
 
 	// formatters
 	r.Handle("/format/product/{id}/empiricalformula/", securechain.Then(env.AppMiddleware(env.FormatProductEmpiricalFormulaHandler))).Methods("POST")
+	r.Handle("/format/product/{id}/smiles/", securechain.Then(env.AppMiddleware(env.FormatProductSmilesHandler))).Methods("POST")
 
 	// export download
 	r.Handle("/{item:download}/{id}", securechain.Then(env.AppMiddleware(env.DownloadExportHandler))).Methods("GET")
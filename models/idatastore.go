@@ -2,6 +2,7 @@ package models
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/steambap/captcha"
 	"github.com/tbellembois/gochimitheque/helpers"
@@ -12,6 +13,7 @@ import (
 type Datastore interface {
 	CreateDatabase() error
 	Import(dir string) error
+	ImportReferenceDataset(dir string) error
 
 	// welcome announce
 	GetWelcomeAnnounce() (WelcomeAnnounce, error)
@@ -48,22 +50,43 @@ type Datastore interface {
 	CreateProductBookmark(pr Product, pe Person) error
 	DeleteProductBookmark(pr Product, pe Person) error
 	IsProductBookmark(pr Product, pe Person) (bool, error)
+	GetProductsClpClassification(references []string) (ClpClassification, error)
+	GetProductsClpInconsistencies() ([]ClpInconsistency, error)
+	GetProductsDuplicates() ([]ProductDuplicate, error)
+	GetProductsMerges() ([]ProductMerge, error)
+	MergeProduct(from int, to int, personid int) error
+	GetProductClassification(id int) (ProductClassification, error)
+	GetProductReference(casnumber string, name string, inchikey string) (ProductReference, error)
+	GetReferenceDatasets() ([]ReferenceDataset, error)
 
 	// storages
 	GetStorages(helpers.DbselectparamStorage) ([]Storage, int, error)
 	GetOtherStorages(helpers.DbselectparamStorage) ([]Entity, int, error)
 	GetStorage(id int) (Storage, error)
+	GetStorageIDByCode(code string, entityids []int) (int, error)
 	GetStoragesUnits(helpers.Dbselectparam) ([]Unit, int, error)
+	GetUnitByLabel(label string) (Unit, error)
 	GetStoragesSuppliers(helpers.Dbselectparam) ([]Supplier, int, error)
 	DeleteStorage(id int) error
 	ArchiveStorage(id int) error
 	RestoreStorage(id int) error
 	CreateStorage(s Storage) (int, error)
 	UpdateStorage(s Storage) error
+	GetStorageHistory(id int) ([]StorageVersion, error)
+	RestoreStorageVersion(id int, version int, personid int) error
+	SplitStorage(id int, aliquots []StorageAliquot, personid int) ([]int, error)
+	PrepareMixture(p MixturePreparation) (int, error)
+	OpenStorage(id int, personid int) error
+	ComputeStoragesExpirationDates() (int, error)
+	ApplyStorageBulkOperation(op StorageBulkOperation) error
 	GenerateAndUpdateStorageBarecode(s *Storage) error
 	IsStorageBorrowing(b Borrowing) (bool, error)
 	CreateStorageBorrowing(b Borrowing) error
-	DeleteStorageBorrowing(b Borrowing) error
+	ReturnStorageBorrowing(b Borrowing) error
+	GetEntityBorrowings(id int, state string) ([]Borrowing, error)
+	GetPersonBorrowings(id int, state string) ([]Borrowing, error)
+	GetOverdueBorrowings(now time.Time) ([]Borrowing, error)
+	UpdateBorrowingReminder(id int, now time.Time) error
 
 	// store locations
 	GetStoreLocations(helpers.DbselectparamStoreLocation) ([]StoreLocation, int, error)
@@ -86,6 +109,7 @@ type Datastore interface {
 	CreateEntity(e Entity) (int, error)
 	UpdateEntity(e Entity) error
 	IsEntityEmpty(id int) (bool, error)
+	RenumberEntityStorages(id int) (int, error)
 
 	// people
 	GetPeople(helpers.DbselectparamPerson) ([]Person, int, error)
@@ -106,6 +130,87 @@ type Datastore interface {
 	SetPersonAdmin(id int) error
 	IsPersonManager(id int) (bool, error)
 
+	// storage alerts
+	GetStockThresholds(entityid int) ([]StockThreshold, error)
+	GetLowStocks(entityid int) ([]StockThreshold, error)
+	UpdateStockThreshold(t StockThreshold) error
+	CheckStockThresholds(productid int, entityid int) ([]StockThreshold, error)
+	GetAlertSetting(id int) (AlertSetting, error)
+	UpdateAlertSetting(a AlertSetting) error
+	GetStorageAlerts(now time.Time) ([]StorageAlert, error)
+	CreateAlertNotifications(alerts []StorageAlert, now time.Time) error
+
+	// storage consumptions
+	CreateConsumption(c Consumption) (int, error)
+	GetProductConsumptions(id int) (ConsumptionReport, error)
+	GetPersonConsumptions(id int) (ConsumptionReport, error)
+
+	// storage transfers
+	CreateTransfer(t Transfer) (int, error)
+	GetTransfer(id int) (Transfer, error)
+	GetStorageTransfers(id int) ([]Transfer, error)
+	GetEntityTransfers(id int) ([]Transfer, error)
+	AcceptTransfer(id int, personid int) error
+	RefuseTransfer(id int, personid int) error
+
+	// purchases
+	CreatePurchase(p Purchase) (int, error)
+	GetPurchase(id int) (Purchase, error)
+	GetEntityPurchases(id int, open bool) ([]Purchase, error)
+	UpdatePurchaseStatus(id int, personid int, status string) error
+	ReceivePurchase(p Purchase, s Storage) ([]int, error)
+	GetEntitySpendings(id int, from time.Time, to time.Time) ([]SupplierSpending, error)
+
+	// disposals
+	CreateDisposal(d Disposal, storageids []int) (int, error)
+	AddDisposalStorages(id int, storageids []int) error
+	RemoveDisposalStorage(id int, storageid int) error
+	UpdateDisposalStorageCategory(id int, storageid int, category string) error
+	GetDisposal(id int) (Disposal, error)
+	GetEntityDisposals(id int) ([]Disposal, error)
+	CollectDisposal(id int) error
+	DeleteDisposal(id int) error
+
+	// inventory campaigns
+	CreateInventory(i Inventory) (int, error)
+	GetInventory(id int) (Inventory, error)
+	GetEntityInventories(id int) ([]Inventory, error)
+	CloseInventory(id int) error
+	CreateInventoryScan(s InventoryScan) (InventoryScan, error)
+	GetInventoryReport(id int) (InventoryReport, error)
+	ArchiveInventoryMissing(id int) (int, error)
+	MoveInventoryMisplaced(id int, personid int, ids []int) (int, error)
+	UpdateInventoryScanStorage(scanid int, storageid int) error
+
+	// suppliers
+	GetSupplier(id int) (Supplier, error)
+	CreateSupplier(s Supplier) (int, error)
+	UpdateSupplier(s Supplier) error
+	DeleteSupplier(id int) error
+	MergeSupplier(from int, to int) error
+	GetSupplierRef(id int) (SupplierRef, error)
+	GetSupplierRefs(s SupplierRefSearch) ([]SupplierRef, error)
+	CreateSupplierRef(r SupplierRef) (int, error)
+	UpdateSupplierRef(r SupplierRef) error
+	DeleteSupplierRef(id int) error
+
+	// borrow requests
+	CreateBorrowRequest(br BorrowRequest, message string) (int, error)
+	GetBorrowRequest(id int) (BorrowRequest, error)
+	GetPersonBorrowRequests(id int) ([]BorrowRequest, error)
+	CreateBorrowRequestMessage(m BorrowRequestMessage) (int, error)
+	DecideBorrowRequest(br BorrowRequest, personid int, status string) error
+	AcceptBorrowRequest(br BorrowRequest, personid int, b Borrowing, t Transfer) error
+
+	// incompatibilities
+	GetIncompatibilities(helpers.Dbselectparam) ([]Incompatibility, int, error)
+	GetIncompatibility(id int) (Incompatibility, error)
+	DeleteIncompatibility(id int) error
+	CreateIncompatibility(i Incompatibility) (int, error)
+	UpdateIncompatibility(i Incompatibility) error
+	GetStorageIncompatibilities(s Storage) ([]IncompatibilityViolation, error)
+	GetEntityIncompatibilities(id int) ([]IncompatibilityViolation, error)
+
 	// captcha
 	InsertCaptcha(*captcha.Data) (string, error)
 	ValidateCaptcha(token string, text string) (bool, error)
@@ -49,10 +49,21 @@ type StoreLocation struct {
 
 // Entity represent a department, a laboratory...
 type Entity struct {
-	EntityID          int      `db:"entity_id" json:"entity_id" schema:"entity_id"`
-	EntityName        string   `db:"entity_name" json:"entity_name" schema:"entity_name"`
-	EntityDescription string   `db:"entity_description" json:"entity_description" schema:"entity_description"`
-	Managers          []Person `db:"-" json:"managers" schema:"managers"`
+	EntityID               int            `db:"entity_id" json:"entity_id" schema:"entity_id"`
+	EntityName             string         `db:"entity_name" json:"entity_name" schema:"entity_name"`
+	EntityDescription      string         `db:"entity_description" json:"entity_description" schema:"entity_description"`
+	EntityShareStocks      bool           `db:"entity_sharestocks" json:"entity_sharestocks" schema:"entity_sharestocks"`                // show the stocks to the other entities
+	EntityCode             sql.NullString `db:"entity_code" json:"entity_code" schema:"entity_code"`                                     // {entity} token of the barecodes
+	EntityBarecodeTemplate sql.NullString `db:"entity_barecodetemplate" json:"entity_barecodetemplate" schema:"entity_barecodetemplate"` // storages barecodes template, see utils.ValidateBarecodeTemplate
+	EntityLabelPrinter     sql.NullString `db:"entity_labelprinter" json:"entity_labelprinter" schema:"entity_labelprinter"`             // host[:port] of the ZPL labels printer, port 9100 by default
+	Managers               []Person       `db:"-" json:"managers" schema:"managers"`
+	Stocks                 []EntityStock  `db:"-" json:"stocks" schema:"-"` // product stocks when shared
+}
+
+// EntityStock is a quantity of a product held by an entity in a unit
+type EntityStock struct {
+	Quantity  float64        `db:"quantity" json:"quantity"`
+	UnitLabel sql.NullString `db:"unit_label" json:"unit_label"`
 }
 
 // Person represent a person
@@ -76,9 +87,40 @@ type Unit struct {
 
 // Supplier is a product supplier
 type Supplier struct {
-	C             int            `db:"c" json:"c"` // not stored in db but db:"c" set for sqlx
-	SupplierID    sql.NullInt64  `db:"supplier_id" json:"supplier_id" schema:"supplier_id"`
-	SupplierLabel sql.NullString `db:"supplier_label" json:"supplier_label" schema:"supplier_label"`
+	C               int            `db:"c" json:"c"` // not stored in db but db:"c" set for sqlx
+	SupplierID      sql.NullInt64  `db:"supplier_id" json:"supplier_id" schema:"supplier_id"`
+	SupplierLabel   sql.NullString `db:"supplier_label" json:"supplier_label" schema:"supplier_label"`
+	SupplierEmail   sql.NullString `db:"supplier_email" json:"supplier_email" schema:"supplier_email"`
+	SupplierPhone   sql.NullString `db:"supplier_phone" json:"supplier_phone" schema:"supplier_phone"`
+	SupplierAddress sql.NullString `db:"supplier_address" json:"supplier_address" schema:"supplier_address"`
+	SupplierWebsite sql.NullString `db:"supplier_website" json:"supplier_website" schema:"supplier_website"`
+}
+
+// SupplierRef is a catalogue reference of a supplier for a product pack
+type SupplierRef struct {
+	SupplierRefID       int             `db:"supplierref_id" json:"supplierref_id" schema:"supplierref_id"`
+	SupplierRefLabel    string          `db:"supplierref_label" json:"supplierref_label" schema:"supplierref_label"`          // supplier reference
+	SupplierRefQuantity sql.NullFloat64 `db:"supplierref_quantity" json:"supplierref_quantity" schema:"supplierref_quantity"` // pack size
+	SupplierRefPrice    sql.NullFloat64 `db:"supplierref_price" json:"supplierref_price" schema:"supplierref_price"`
+	SupplierRefGTIN     sql.NullString  `db:"supplierref_gtin" json:"supplierref_gtin" schema:"supplierref_gtin"` // GS1 trade item number of the pack
+	SupplierID          int             `db:"supplier_id" json:"supplier_id" schema:"supplier_id"`
+	SupplierLabel       string          `db:"supplier_label" json:"supplier_label" schema:"-"`
+	ProductID           int             `db:"product_id" json:"product_id" schema:"product_id"`
+	NameLabel           string          `db:"name_label" json:"name_label" schema:"-"`
+	CasNumberLabel      sql.NullString  `db:"casnumber_label" json:"casnumber_label" schema:"-"`
+	UnitID              sql.NullInt64   `db:"unit_id" json:"unit_id" schema:"unit_id"`
+	UnitLabel           sql.NullString  `db:"unit_label" json:"unit_label" schema:"-"`
+}
+
+// SupplierRefSearch is the search criteria of the supplier references,
+// zero values are ignored
+type SupplierRefSearch struct {
+	SupplierID int
+	ProductID  int
+	CasNumber  string
+	GTIN       string
+	Quantity   float64 // pack size, in the unit family of UnitID
+	UnitID     int
 }
 
 // Storage is a product storage in a store location
@@ -99,6 +141,9 @@ type Storage struct {
 	StorageQRCode           []byte          `db:"storage_qrcode" json:"storage_qrcode" schema:"storage_qrcode"`
 	StorageToDestroy        sql.NullBool    `db:"storage_todestroy" json:"storage_todestroy" schema:"storage_todestroy"`
 	StorageArchive          sql.NullBool    `db:"storage_archive" json:"storage_archive" schema:"storage_archive"`
+	StorageModifiedBy       sql.NullInt64   `db:"storage_modifiedby" json:"storage_modifiedby" schema:"-"` // author of the storage version, the owner if NULL
+	StorageParent           sql.NullInt64   `db:"storage_parent" json:"storage_parent" schema:"-"`         // storage this storage was aliquoted from
+	StorageChildren         []int           `db:"-" json:"storage_children" schema:"-"`                    // storages aliquoted from this storage
 	Person                  `db:"person" json:"person" schema:"person"`
 	Product                 `db:"product" json:"product" schema:"product"`
 	StoreLocation           `db:"storelocation" json:"storelocation" schema:"storelocation"`
@@ -107,17 +152,65 @@ type Storage struct {
 	Storage                 *Storage   `db:"storage" json:"storage" schema:"storage"`       // history reference storage
 	Borrowing               *Borrowing `db:"borrowing" json:"borrowing" schema:"borrowing"` // not un db but sqlx requires the "db" entry
 
+	// shelf-lives in months overriding the ones of the product,
+	// and origin of the expiration date: computed from the shelf-lives or manual
+	StorageShelfLifeReception sql.NullInt64 `db:"storage_shelflifereception" json:"storage_shelflifereception" schema:"storage_shelflifereception"`
+	StorageShelfLifeOpening   sql.NullInt64 `db:"storage_shelflifeopening" json:"storage_shelflifeopening" schema:"storage_shelflifeopening"`
+	StorageExpirationComputed bool          `db:"storage_expirationcomputed" json:"storage_expirationcomputed" schema:"storage_expirationcomputed"`
+
 	// storage history count
 	StorageHC int `db:"storage_hc" json:"storage_hc" schema:"storage_hc"` // not in db but sqlx requires the "db" entry
+
+	// incompatibilities with the other storages of the store location
+	Incompatibilities []IncompatibilityViolation `db:"-" json:"incompatibilities" schema:"-"`
+}
+
+// StorageAliquot is a child storage created by splitting a storage
+type StorageAliquot struct {
+	StorageQuantity float64 `json:"storage_quantity" schema:"storage_quantity"` // in the unit of the split storage
+	StoreLocationID int     `json:"storelocation_id" schema:"storelocation_id"`
+}
+
+// StorageBulkOperation is an operation applied at once to several storages
+type StorageBulkOperation struct {
+	Operation             string          `json:"operation" schema:"operation"` // archive, restore, move, todestroy, expiration or delete
+	StorageIDs            []int           `json:"storage_ids" schema:"storage_ids"`
+	StoreLocationID       int             `json:"storelocation_id" schema:"storelocation_id"`             // move target
+	StorageToDestroy      bool            `json:"storage_todestroy" schema:"storage_todestroy"`           // todestroy value
+	StorageExpirationDate global.NullTime `json:"storage_expirationdate" schema:"storage_expirationdate"` // expiration value, cleared if NULL
+	PersonID              int             `json:"person_id" schema:"-"`                                   // author of the changes
+}
+
+// StorageChange is the change of a storage field between two versions
+type StorageChange struct {
+	Field string `json:"field"` // storage column name
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// StorageVersion is a version of a storage: a history row or the current storage,
+// with its changes from the previous version
+type StorageVersion struct {
+	StorageID        int             `json:"storage_id"` // id of the history row, or of the storage for the current version
+	Current          bool            `json:"current"`
+	ModificationDate time.Time       `json:"storage_modificationdate"`
+	PersonID         int             `json:"person_id"` // author of the version
+	PersonEmail      string          `json:"person_email"`
+	Changes          []StorageChange `json:"changes"`
 }
 
 // Borrowing represent a storage borrowing
 type Borrowing struct {
-	BorrowingID      sql.NullInt64                               `db:"borrowing_id" json:"borrowing_id" schema:"borrowing_id"`
-	BorrowingComment sql.NullString                              `db:"borrowing_comment" json:"borrowing_comment" schema:"borrowing_comment"`
-	Person           `db:"person" json:"person" schema:"person"` // logged person
-	Storage          `db:"storage" json:"storage" schema:"storage"`
-	Borrower         *Person `db:"borrower" json:"borrower" schema:"borrower"` // logged person
+	BorrowingID             sql.NullInt64                               `db:"borrowing_id" json:"borrowing_id" schema:"borrowing_id"`
+	BorrowingComment        sql.NullString                              `db:"borrowing_comment" json:"borrowing_comment" schema:"borrowing_comment"`
+	BorrowingDate           global.NullTime                             `db:"borrowing_date" json:"borrowing_date" schema:"-"`
+	BorrowingDueDate        global.NullTime                             `db:"borrowing_duedate" json:"borrowing_duedate" schema:"borrowing_duedate"`
+	BorrowingReturnDate     global.NullTime                             `db:"borrowing_returndate" json:"borrowing_returndate" schema:"-"`
+	BorrowingReturnQuantity sql.NullFloat64                             `db:"borrowing_returnquantity" json:"borrowing_returnquantity" schema:"borrowing_returnquantity"` // storage quantity at return
+	BorrowingState          sql.NullString                              `db:"borrowing_state" json:"borrowing_state" schema:"-"`                                          // active, overdue or returned
+	Person                  `db:"person" json:"person" schema:"person"` // logged person
+	Storage                 `db:"storage" json:"storage" schema:"storage"`
+	Borrower                *Person `db:"borrower" json:"borrower" schema:"borrower"` // logged person
 }
 
 // Permission represent who is able to do what on something
@@ -218,6 +311,9 @@ type Product struct {
 	ProductRadioactive      sql.NullBool   `db:"product_radioactive" json:"product_radioactive" schema:"product_radioactive"`
 	ProductThreeDFormula    sql.NullString `db:"product_threedformula" json:"product_threedformula" schema:"product_threedformula"`
 	ProductMolFormula       sql.NullString `db:"product_molformula" json:"product_molformula" schema:"product_molformula"`
+	ProductSmiles           sql.NullString `db:"product_smiles" json:"product_smiles" schema:"product_smiles"`
+	ProductInchi            sql.NullString `db:"product_inchi" json:"product_inchi" schema:"product_inchi"`
+	ProductInchiKey         sql.NullString `db:"product_inchikey" json:"product_inchikey" schema:"product_inchikey"`
 	ProductDisposalComment  sql.NullString `db:"product_disposalcomment" json:"product_disposalcomment" schema:"product_disposalcomment"`
 	ProductRemark           sql.NullString `db:"product_remark" json:"product_remark" schema:"product_remark"`
 	ProductQRCode           string         `db:"product_qrcode" json:"product_qrcode" schema:"product_qrcode"`
@@ -234,9 +330,14 @@ type Product struct {
 	Symbols                 []Symbol                 `db:"-" schema:"symbols" json:"symbols"`
 	HazardStatements        []HazardStatement        `db:"-" schema:"hazardstatements" json:"hazardstatements"`
 	PrecautionaryStatements []PrecautionaryStatement `db:"-" schema:"precautionarystatements" json:"precautionarystatements"`
+	Components              []ProductComponent       `db:"-" schema:"components" json:"components"` // components of a mixture
 
 	Bookmark *Bookmark `db:"bookmark" json:"bookmark" schema:"bookmark"` // not in db but sqlx requires the "db" entry
 
+	// shelf-lives in months of the storages after their entry and after their opening
+	ProductShelfLifeReception sql.NullInt64 `db:"product_shelflifereception" json:"product_shelflifereception" schema:"product_shelflifereception"`
+	ProductShelfLifeOpening   sql.NullInt64 `db:"product_shelflifeopening" json:"product_shelflifeopening" schema:"product_shelflifeopening"`
+
 	// total storage count
 	ProductTSC int `db:"product_tsc" json:"product_tsc" schema:"product_tsc"` // not in db but sqlx requires the "db" entry
 	// storage count in the logged user entity(ies)
@@ -252,6 +353,394 @@ type Bookmark struct {
 	Product    `db:"product" json:"product" schema:"product"`
 }
 
+// Incompatibility is a storage segregation rule between two
+// symbols, hazard statements or classes of compound
+type Incompatibility struct {
+	IncompatibilityID      int            `db:"incompatibility_id" json:"incompatibility_id" schema:"incompatibility_id"`
+	IncompatibilityKind1   string         `db:"incompatibility_kind1" json:"incompatibility_kind1" schema:"incompatibility_kind1"` // ex: symbol
+	IncompatibilityKey1    string         `db:"incompatibility_key1" json:"incompatibility_key1" schema:"incompatibility_key1"`    // ex: SGH02
+	IncompatibilityKind2   string         `db:"incompatibility_kind2" json:"incompatibility_kind2" schema:"incompatibility_kind2"` // ex: symbol
+	IncompatibilityKey2    string         `db:"incompatibility_key2" json:"incompatibility_key2" schema:"incompatibility_key2"`    // ex: SGH03
+	IncompatibilityLevel   string         `db:"incompatibility_level" json:"incompatibility_level" schema:"incompatibility_level"` // warn or block
+	IncompatibilityComment sql.NullString `db:"incompatibility_comment" json:"incompatibility_comment" schema:"incompatibility_comment"`
+}
+
+// ProductDuplicate is a group of products suspected to be duplicates
+type ProductDuplicate struct {
+	Reason   string    `json:"reason"` // casnumber, empiricalformula or molformula
+	Products []Product `json:"products"`
+}
+
+// ProductMerge is the merge of a duplicate product into another one
+type ProductMerge struct {
+	ProductMergeID       int       `db:"productmerge_id" json:"productmerge_id"`
+	ProductMergeDate     time.Time `db:"productmerge_date" json:"productmerge_date"`
+	ProductMergeFromID   int       `db:"productmerge_from_id" json:"productmerge_from_id"` // deleted product
+	ProductMergeFromName string    `db:"productmerge_from_name" json:"productmerge_from_name"`
+	ProductMergeToID     int       `db:"productmerge_to_id" json:"productmerge_to_id"` // surviving product
+	ProductMergeToName   string    `db:"productmerge_to_name" json:"productmerge_to_name"`
+	Person               `db:"person" json:"person"`
+}
+
+// ProductComponent is a component product of a mixture product
+type ProductComponent struct {
+	ProductComponentID                int             `db:"productcomponent_id" json:"productcomponent_id" schema:"productcomponent_id"`
+	ProductComponentConcentration     sql.NullFloat64 `db:"productcomponent_concentration" json:"productcomponent_concentration" schema:"productcomponent_concentration"`
+	ProductComponentConcentrationUnit sql.NullString  `db:"productcomponent_concentrationunit" json:"productcomponent_concentrationunit" schema:"productcomponent_concentrationunit"` // w/w, v/v (percents) or mol/L
+	ProductComponentSolvent           bool            `db:"productcomponent_solvent" json:"productcomponent_solvent" schema:"productcomponent_solvent"`
+	ComponentID                       int             `db:"component_id" json:"component_id" schema:"component_id"`
+	ComponentName                     string          `db:"component_name" json:"component_name" schema:"component_name"`
+}
+
+// ProductClassification is a classification suggested for a mixture from its components
+type ProductClassification struct {
+	Symbols          []Symbol          `json:"symbols"`
+	SignalWord       SignalWord        `json:"signalword"`
+	HazardStatements []HazardStatement `json:"hazardstatements"`
+}
+
+// MixturePreparation is the preparation of a storage of a mixture product from storages of its components
+type MixturePreparation struct {
+	ProductID       int             `json:"product_id" schema:"product_id"` // the mixture
+	StorageQuantity float64         `json:"storage_quantity" schema:"storage_quantity"`
+	UnitID          sql.NullInt64   `json:"unit_id" schema:"unit_id"`
+	StoreLocationID int             `json:"storelocation_id" schema:"storelocation_id"`
+	Sources         []MixtureSource `json:"sources" schema:"sources"`
+	PersonID        int             `json:"person_id" schema:"-"`
+}
+
+// MixtureSource is a quantity of a source storage used by a mixture preparation
+type MixtureSource struct {
+	StorageID int           `json:"storage_id" schema:"storage_id"`
+	Quantity  float64       `json:"quantity" schema:"quantity"`
+	UnitID    sql.NullInt64 `json:"unit_id" schema:"unit_id"` // the storage unit if not set
+}
+
+// ReferenceDataset is an imported offline reference compound dataset
+type ReferenceDataset struct {
+	ReferenceDatasetID      int       `db:"referencedataset_id" json:"referencedataset_id"`
+	ReferenceDatasetSource  string    `db:"referencedataset_source" json:"referencedataset_source"`   // ex: PubChem
+	ReferenceDatasetVersion string    `db:"referencedataset_version" json:"referencedataset_version"` // ex: 2020-06
+	ReferenceDatasetDate    time.Time `db:"referencedataset_date" json:"referencedataset_date"`       // import date
+	ReferenceDatasetCount   int       `db:"referencedataset_count" json:"referencedataset_count"`     // number of compounds
+}
+
+// ReferenceCompound is a compound of a reference dataset
+// multiple values (synonyms, symbols, statements) are | separated
+type ReferenceCompound struct {
+	ReferenceCompoundID                      int    `db:"referencecompound_id" json:"-"`
+	ReferenceCompoundName                    string `db:"referencecompound_name" json:"name"`
+	ReferenceCompoundSynonyms                string `db:"referencecompound_synonyms" json:"synonyms"`
+	ReferenceCompoundCasNumber               string `db:"referencecompound_casnumber" json:"casnumber"`
+	ReferenceCompoundCeNumber                string `db:"referencecompound_cenumber" json:"cenumber"`
+	ReferenceCompoundEmpiricalFormula        string `db:"referencecompound_empiricalformula" json:"empiricalformula"`
+	ReferenceCompoundLinearFormula           string `db:"referencecompound_linearformula" json:"linearformula"`
+	ReferenceCompoundSmiles                  string `db:"referencecompound_smiles" json:"smiles"`
+	ReferenceCompoundInchi                   string `db:"referencecompound_inchi" json:"inchi"`
+	ReferenceCompoundInchiKey                string `db:"referencecompound_inchikey" json:"inchikey"`
+	ReferenceCompoundSymbols                 string `db:"referencecompound_symbols" json:"symbols"`
+	ReferenceCompoundHazardStatements        string `db:"referencecompound_hazardstatements" json:"hazardstatements"`
+	ReferenceCompoundPrecautionaryStatements string `db:"referencecompound_precautionarystatements" json:"precautionarystatements"`
+	ReferenceCompoundSignalWord              string `db:"referencecompound_signalword" json:"signalword"`
+}
+
+// ProductReference is a product prefilled from a reference dataset
+type ProductReference struct {
+	ReferenceDataset `json:"referencedataset"`
+	Product          Product `json:"product"`
+}
+
+// StockThreshold is a minimum stock of a product in an entity
+// for a unit family (identified by its reference unit)
+type StockThreshold struct {
+	StockThresholdID       int     `db:"stockthreshold_id" json:"stockthreshold_id" schema:"stockthreshold_id"`
+	StockThresholdQuantity float64 `db:"stockthreshold_quantity" json:"stockthreshold_quantity" schema:"stockthreshold_quantity"`
+	StockThresholdNotified bool    `db:"stockthreshold_notified" json:"stockthreshold_notified" schema:"-"` // low stock already notified
+	StockThresholdCurrent  float64 `db:"-" json:"stockthreshold_current" schema:"-"`                        // current stock, computed
+	EntityID               int     `db:"entity_id" json:"entity_id" schema:"-"`
+	EntityName             string  `db:"entity_name" json:"entity_name" schema:"-"`
+	ProductID              int     `db:"product_id" json:"product_id" schema:"product_id"`
+	NameLabel              string  `db:"name_label" json:"name_label" schema:"-"`
+	UnitID                 int     `db:"unit_id" json:"unit_id" schema:"unit_id"`
+	UnitLabel              string  `db:"unit_label" json:"unit_label" schema:"-"`
+}
+
+// AlertSetting is the storage alerts thresholds of an entity
+type AlertSetting struct {
+	AlertSettingEntityID     int `db:"alertsetting_entity_id" json:"alertsetting_entity_id" schema:"alertsetting_entity_id"`
+	AlertSettingExpiringDays int `db:"alertsetting_expiringdays" json:"alertsetting_expiringdays" schema:"alertsetting_expiringdays"` // 0 disables the expiring alerts
+	AlertSettingOpenedMonths int `db:"alertsetting_openedmonths" json:"alertsetting_openedmonths" schema:"alertsetting_openedmonths"` // 0 disables the opened alerts
+}
+
+// StorageAlert is a storage expiring soon, expired or opened for too long
+type StorageAlert struct {
+	StorageAlertKind      string          `db:"-" json:"storagealert_kind"` // expiring, expired or opened
+	StorageID             int             `db:"storage_id" json:"storage_id"`
+	StorageBarecode       sql.NullString  `db:"storage_barecode" json:"storage_barecode"`
+	StorageOpeningDate    global.NullTime `db:"storage_openingdate" json:"storage_openingdate"`
+	StorageExpirationDate global.NullTime `db:"storage_expirationdate" json:"storage_expirationdate"`
+	NameLabel             string          `db:"name_label" json:"name_label"`
+	StoreLocationFullPath string          `db:"storelocation_fullpath" json:"storelocation_fullpath"`
+	EntityID              int             `db:"entity_id" json:"entity_id"`
+	EntityName            string          `db:"entity_name" json:"entity_name"`
+}
+
+// Consumption is a quantity withdrawn from a storage
+type Consumption struct {
+	ConsumptionID              int            `db:"consumption_id" json:"consumption_id" schema:"consumption_id"`
+	ConsumptionDate            time.Time      `db:"consumption_date" json:"consumption_date" schema:"-"`
+	ConsumptionQuantity        float64        `db:"consumption_quantity" json:"consumption_quantity" schema:"consumption_quantity"` // withdrawn quantity in the consumption unit
+	ConsumptionStorageQuantity float64        `db:"consumption_storagequantity" json:"consumption_storagequantity" schema:"-"`      // withdrawn quantity in the storage unit
+	ConsumptionReason          sql.NullString `db:"consumption_reason" json:"consumption_reason" schema:"consumption_reason"`
+	ConsumptionArchive         bool           `db:"-" json:"-" schema:"consumption_archive"` // archive the storage when empty, not in db
+	StorageID                  int            `db:"storage_id" json:"storage_id" schema:"-"`
+	StorageBarecode            sql.NullString `db:"storage_barecode" json:"storage_barecode" schema:"-"`
+	ProductID                  int            `db:"product_id" json:"product_id" schema:"-"`
+	NameLabel                  string         `db:"name_label" json:"name_label" schema:"-"`
+	PersonID                   int            `db:"person_id" json:"person_id" schema:"-"` // consuming person
+	PersonEmail                string         `db:"person_email" json:"person_email" schema:"-"`
+	UnitID                     sql.NullInt64  `db:"unit_id" json:"unit_id" schema:"unit_id"` // consumption unit, the storage unit if not valid
+	UnitLabel                  sql.NullString `db:"unit_label" json:"unit_label" schema:"-"`
+}
+
+// ConsumptionTotal is a consumed quantity in a reference unit
+type ConsumptionTotal struct {
+	UnitLabel string  `db:"unit_label" json:"unit_label"`
+	Quantity  float64 `db:"quantity" json:"quantity"`
+}
+
+// ConsumptionReport is a list of consumptions with their totals by reference unit
+type ConsumptionReport struct {
+	Rows   []Consumption      `json:"rows"`
+	Total  int                `json:"total"`
+	Totals []ConsumptionTotal `json:"totals"`
+}
+
+// Transfer is a request to move a storage to a store location of another entity
+type Transfer struct {
+	TransferID                  int             `db:"transfer_id" json:"transfer_id" schema:"transfer_id"`
+	TransferStatus              string          `db:"transfer_status" json:"transfer_status" schema:"-"` // pending, accepted or refused
+	TransferCreationDate        time.Time       `db:"transfer_creationdate" json:"transfer_creationdate" schema:"-"`
+	TransferDecisionDate        global.NullTime `db:"transfer_decisiondate" json:"transfer_decisiondate" schema:"-"`
+	TransferComment             sql.NullString  `db:"transfer_comment" json:"transfer_comment" schema:"transfer_comment"`
+	StorageID                   int             `db:"storage_id" json:"storage_id" schema:"-"`
+	StorageBarecode             sql.NullString  `db:"storage_barecode" json:"storage_barecode" schema:"-"`
+	NameLabel                   string          `db:"name_label" json:"name_label" schema:"-"`
+	PersonID                    int             `db:"person_id" json:"person_id" schema:"-"` // requesting person
+	PersonEmail                 string          `db:"person_email" json:"person_email" schema:"-"`
+	DeciderID                   sql.NullInt64   `db:"decider_id" json:"decider_id" schema:"-"` // accepting or refusing manager
+	DeciderEmail                sql.NullString  `db:"decider_email" json:"decider_email" schema:"-"`
+	SourceStoreLocationID       int             `db:"source_storelocation_id" json:"source_storelocation_id" schema:"-"`
+	SourceStoreLocationFullPath string          `db:"source_storelocation_fullpath" json:"source_storelocation_fullpath" schema:"-"`
+	SourceEntityID              int             `db:"source_entity_id" json:"source_entity_id" schema:"-"`
+	SourceEntityName            string          `db:"source_entity_name" json:"source_entity_name" schema:"-"`
+	TargetStoreLocationID       int             `db:"target_storelocation_id" json:"target_storelocation_id" schema:"target_storelocation_id"`
+	TargetStoreLocationFullPath string          `db:"target_storelocation_fullpath" json:"target_storelocation_fullpath" schema:"-"`
+	TargetEntityID              int             `db:"target_entity_id" json:"target_entity_id" schema:"-"`
+	TargetEntityName            string          `db:"target_entity_name" json:"target_entity_name" schema:"-"`
+}
+
+// Purchase is a purchase request of a product for an entity, followed until its reception
+type Purchase struct {
+	PurchaseID            int             `db:"purchase_id" json:"purchase_id" schema:"purchase_id"`
+	PurchaseStatus        string          `db:"purchase_status" json:"purchase_status" schema:"-"`                     // requested, approved, refused, ordered, received or cancelled
+	PurchaseQuantity      sql.NullFloat64 `db:"purchase_quantity" json:"purchase_quantity" schema:"purchase_quantity"` // quantity of each item
+	PurchaseNbItem        int             `db:"purchase_nbitem" json:"purchase_nbitem" schema:"purchase_nbitem"`
+	PurchasePrice         sql.NullFloat64 `db:"purchase_price" json:"purchase_price" schema:"purchase_price"`             // price of each item
+	PurchaseReference     sql.NullString  `db:"purchase_reference" json:"purchase_reference" schema:"purchase_reference"` // supplier reference
+	PurchaseComment       sql.NullString  `db:"purchase_comment" json:"purchase_comment" schema:"purchase_comment"`
+	PurchaseCreationDate  time.Time       `db:"purchase_creationdate" json:"purchase_creationdate" schema:"-"`
+	PurchaseApprovalDate  global.NullTime `db:"purchase_approvaldate" json:"purchase_approvaldate" schema:"-"`
+	PurchaseOrderDate     global.NullTime `db:"purchase_orderdate" json:"purchase_orderdate" schema:"-"`
+	PurchaseReceptionDate global.NullTime `db:"purchase_receptiondate" json:"purchase_receptiondate" schema:"-"`
+	ProductID             int             `db:"product_id" json:"product_id" schema:"product_id"`
+	NameLabel             string          `db:"name_label" json:"name_label" schema:"-"`
+	EntityID              int             `db:"entity_id" json:"entity_id" schema:"entity_id"`
+	EntityName            string          `db:"entity_name" json:"entity_name" schema:"-"`
+	UnitID                sql.NullInt64   `db:"unit_id" json:"unit_id" schema:"unit_id"`
+	UnitLabel             sql.NullString  `db:"unit_label" json:"unit_label" schema:"-"`
+	SupplierID            sql.NullInt64   `db:"supplier_id" json:"supplier_id" schema:"supplier_id"` // -1 for a new supplier
+	SupplierLabel         sql.NullString  `db:"supplier_label" json:"supplier_label" schema:"supplier_label"`
+	PersonID              int             `db:"person_id" json:"person_id" schema:"-"` // requesting person
+	PersonEmail           string          `db:"person_email" json:"person_email" schema:"-"`
+	ApproverID            sql.NullInt64   `db:"approver_id" json:"approver_id" schema:"-"` // approving or refusing manager
+	ApproverEmail         sql.NullString  `db:"approver_email" json:"approver_email" schema:"-"`
+}
+
+// Disposal is a batch of storages to destroy gathered by an entity
+// until its collection by a waste company
+type Disposal struct {
+	DisposalID             int                `db:"disposal_id" json:"disposal_id" schema:"disposal_id"`
+	DisposalStatus         string             `db:"disposal_status" json:"disposal_status" schema:"-"` // open or collected
+	DisposalComment        sql.NullString     `db:"disposal_comment" json:"disposal_comment" schema:"disposal_comment"`
+	DisposalCreationDate   time.Time          `db:"disposal_creationdate" json:"disposal_creationdate" schema:"-"`
+	DisposalCollectionDate global.NullTime    `db:"disposal_collectiondate" json:"disposal_collectiondate" schema:"-"`
+	EntityID               int                `db:"entity_id" json:"entity_id" schema:"entity_id"`
+	EntityName             string             `db:"entity_name" json:"entity_name" schema:"-"`
+	PersonID               int                `db:"person_id" json:"person_id" schema:"-"`
+	PersonEmail            string             `db:"person_email" json:"person_email" schema:"-"`
+	Storages               []DisposalStorage  `db:"-" json:"storages" schema:"-"`
+	Categories             []DisposalCategory `db:"-" json:"categories" schema:"-"`
+}
+
+// DisposalStorage is a storage of a disposal batch with its waste category
+type DisposalStorage struct {
+	DisposalID              int             `db:"disposal_id" json:"disposal_id"`
+	DisposalStorageCategory string          `db:"disposalstorage_category" json:"disposalstorage_category"`
+	StorageID               int             `db:"storage_id" json:"storage_id"`
+	StorageBarecode         sql.NullString  `db:"storage_barecode" json:"storage_barecode"`
+	StorageQuantity         sql.NullFloat64 `db:"storage_quantity" json:"storage_quantity"`
+	UnitLabel               sql.NullString  `db:"unit_label" json:"unit_label"`
+	NameLabel               string          `db:"name_label" json:"name_label"`
+	CasNumberLabel          sql.NullString  `db:"casnumber_label" json:"casnumber_label"`
+}
+
+// DisposalCategory is the total quantity of a waste category in a disposal batch
+// for a reference unit
+type DisposalCategory struct {
+	DisposalStorageCategory string          `db:"disposalstorage_category" json:"disposalstorage_category"`
+	Count                   int             `db:"count" json:"count"`       // number of storages
+	Quantity                sql.NullFloat64 `db:"quantity" json:"quantity"` // in the reference unit
+	UnitLabel               sql.NullString  `db:"unit_label" json:"unit_label"`
+}
+
+// Inventory is a physical inventory campaign of an entity
+type Inventory struct {
+	InventoryID           int             `db:"inventory_id" json:"inventory_id" schema:"inventory_id"`
+	InventoryStatus       string          `db:"inventory_status" json:"inventory_status" schema:"-"` // open or closed
+	InventoryCreationDate time.Time       `db:"inventory_creationdate" json:"inventory_creationdate" schema:"-"`
+	InventoryCloseDate    global.NullTime `db:"inventory_closedate" json:"inventory_closedate" schema:"-"`
+	EntityID              int             `db:"entity_id" json:"entity_id" schema:"entity_id"`
+	EntityName            string          `db:"entity_name" json:"entity_name" schema:"-"`
+	PersonID              int             `db:"person_id" json:"person_id" schema:"-"`
+	PersonEmail           string          `db:"person_email" json:"person_email" schema:"-"`
+	InventoryScanCount    int             `db:"inventoryscan_count" json:"inventoryscan_count" schema:"-"`
+}
+
+// InventoryScan is a barecode or QR code scanned in a store location during an inventory campaign
+type InventoryScan struct {
+	InventoryScanID   int           `db:"inventoryscan_id" json:"inventoryscan_id" schema:"-"`
+	InventoryScanCode string        `db:"inventoryscan_code" json:"inventoryscan_code" schema:"inventoryscan_code"` // storage barecode or QR code payload
+	InventoryScanDate time.Time     `db:"inventoryscan_date" json:"inventoryscan_date" schema:"-"`
+	InventoryID       int           `db:"inventory_id" json:"inventory_id" schema:"-"`
+	StoreLocationID   int           `db:"storelocation_id" json:"storelocation_id" schema:"storelocation_id"` // scanned store location
+	StorageID         sql.NullInt64 `db:"storage_id" json:"storage_id" schema:"-"`                            // recognized storage
+	PersonID          int           `db:"person_id" json:"person_id" schema:"-"`
+}
+
+// InventoryItem is a storage or an unknown code of an inventory campaign report
+type InventoryItem struct {
+	InventoryScanID          sql.NullInt64  `db:"inventoryscan_id" json:"inventoryscan_id"`
+	InventoryScanCode        sql.NullString `db:"inventoryscan_code" json:"inventoryscan_code"`
+	StorageID                sql.NullInt64  `db:"storage_id" json:"storage_id"`
+	StorageBarecode          sql.NullString `db:"storage_barecode" json:"storage_barecode"`
+	NameLabel                sql.NullString `db:"name_label" json:"name_label"`
+	StoreLocationID          sql.NullInt64  `db:"storelocation_id" json:"storelocation_id"` // storage store location
+	StoreLocationName        sql.NullString `db:"storelocation_name" json:"storelocation_name"`
+	EntityID                 sql.NullInt64  `db:"entity_id" json:"entity_id"` // storage entity
+	ScannedStoreLocationID   sql.NullInt64  `db:"scanned_storelocation_id" json:"scanned_storelocation_id"`
+	ScannedStoreLocationName sql.NullString `db:"scanned_storelocation_name" json:"scanned_storelocation_name"`
+}
+
+// InventoryReport is the reconciliation of the scans of an inventory campaign
+// with the storages of its entity
+type InventoryReport struct {
+	Inventory Inventory       `json:"inventory"`
+	Found     []InventoryItem `json:"found"`     // scanned in their store location
+	Missing   []InventoryItem `json:"missing"`   // not scanned
+	Misplaced []InventoryItem `json:"misplaced"` // scanned in another store location
+	Unknown   []InventoryItem `json:"unknown"`   // scanned codes matching no storage
+	Foreign   []InventoryItem `json:"foreign"`   // scanned storages of other entities
+}
+
+// SupplierSpending is the amount spent by an entity with a supplier
+type SupplierSpending struct {
+	SupplierID    sql.NullInt64  `db:"supplier_id" json:"supplier_id"`
+	SupplierLabel sql.NullString `db:"supplier_label" json:"supplier_label"`
+	Count         int            `db:"count" json:"count"` // number of received purchases
+	Total         float64        `db:"total" json:"total"`
+}
+
+// BorrowRequest is a request to borrow a product stored in another entity
+type BorrowRequest struct {
+	BorrowRequestID           int                    `db:"borrowrequest_id" json:"borrowrequest_id" schema:"borrowrequest_id"`
+	BorrowRequestStatus       string                 `db:"borrowrequest_status" json:"borrowrequest_status" schema:"-"` // pending, accepted or refused
+	BorrowRequestKind         sql.NullString         `db:"borrowrequest_kind" json:"borrowrequest_kind" schema:"-"`     // borrowing or transfer, set on acceptance
+	BorrowRequestQuantity     sql.NullFloat64        `db:"borrowrequest_quantity" json:"borrowrequest_quantity" schema:"borrowrequest_quantity"`
+	BorrowRequestDate         global.NullTime        `db:"borrowrequest_date" json:"borrowrequest_date" schema:"borrowrequest_date"` // wished date
+	BorrowRequestCreationDate time.Time              `db:"borrowrequest_creationdate" json:"borrowrequest_creationdate" schema:"-"`
+	BorrowRequestDecisionDate global.NullTime        `db:"borrowrequest_decisiondate" json:"borrowrequest_decisiondate" schema:"-"`
+	ProductID                 int                    `db:"product_id" json:"product_id" schema:"product_id"`
+	NameLabel                 string                 `db:"name_label" json:"name_label" schema:"-"`
+	EntityID                  int                    `db:"entity_id" json:"entity_id" schema:"entity_id"` // holding entity
+	EntityName                string                 `db:"entity_name" json:"entity_name" schema:"-"`
+	PersonID                  int                    `db:"person_id" json:"person_id" schema:"-"` // requesting person
+	PersonEmail               string                 `db:"person_email" json:"person_email" schema:"-"`
+	DeciderID                 sql.NullInt64          `db:"decider_id" json:"decider_id" schema:"-"` // accepting or refusing manager
+	DeciderEmail              sql.NullString         `db:"decider_email" json:"decider_email" schema:"-"`
+	StorageID                 sql.NullInt64          `db:"storage_id" json:"storage_id" schema:"-"` // lent or transferred storage
+	UnitID                    sql.NullInt64          `db:"unit_id" json:"unit_id" schema:"unit_id"`
+	UnitLabel                 sql.NullString         `db:"unit_label" json:"unit_label" schema:"-"`
+	Messages                  []BorrowRequestMessage `db:"-" json:"messages" schema:"-"`
+}
+
+// BorrowRequestMessage is a message of a borrow request thread
+type BorrowRequestMessage struct {
+	BorrowRequestMessageID   int       `db:"borrowrequestmessage_id" json:"borrowrequestmessage_id" schema:"-"`
+	BorrowRequestMessageDate time.Time `db:"borrowrequestmessage_date" json:"borrowrequestmessage_date" schema:"-"`
+	BorrowRequestMessageText string    `db:"borrowrequestmessage_text" json:"borrowrequestmessage_text" schema:"borrowrequestmessage_text"`
+	BorrowRequestID          int       `db:"borrowrequest_id" json:"borrowrequest_id" schema:"-"`
+	PersonID                 int       `db:"person_id" json:"person_id" schema:"-"`
+	PersonEmail              string    `db:"person_email" json:"person_email" schema:"-"`
+}
+
+// ClpRule maps a hazard statement to its CLP pictogram and signal word
+// a hazard statement may have several rules, one per pictogram
+type ClpRule struct {
+	ClpRuleID                       int            `db:"clprule_id" json:"clprule_id" schema:"clprule_id"`
+	ClpRuleHazardStatementReference string         `db:"clprule_hazardstatement_reference" json:"clprule_hazardstatement_reference" schema:"clprule_hazardstatement_reference"` // ex: H301
+	ClpRuleSymbolLabel              sql.NullString `db:"clprule_symbol_label" json:"clprule_symbol_label" schema:"clprule_symbol_label"`                                     // ex: SGH06
+	ClpRuleSignalWordLabel          sql.NullString `db:"clprule_signalword_label" json:"clprule_signalword_label" schema:"clprule_signalword_label"`                         // ex: danger, null if it depends on the category
+}
+
+// ClpPrecedence is a CLP pictogram precedence rule
+// the superseded pictogram is not shown when the symbol one is present
+type ClpPrecedence struct {
+	ClpPrecedenceID                             int            `db:"clpprecedence_id" json:"clpprecedence_id" schema:"clpprecedence_id"`
+	ClpPrecedenceSymbolLabel                    string         `db:"clpprecedence_symbol_label" json:"clpprecedence_symbol_label" schema:"clpprecedence_symbol_label"`                                                             // ex: SGH06
+	ClpPrecedenceSupersededLabel                string         `db:"clpprecedence_superseded_label" json:"clpprecedence_superseded_label" schema:"clpprecedence_superseded_label"`                                                 // ex: SGH07
+	ClpPrecedenceHazardStatementReference       sql.NullString `db:"clpprecedence_hazardstatement_reference" json:"clpprecedence_hazardstatement_reference" schema:"clpprecedence_hazardstatement_reference"`                      // only for this statement if set
+	ClpPrecedenceSymbolHazardStatementReference sql.NullString `db:"clpprecedence_symbol_hazardstatement_reference" json:"clpprecedence_symbol_hazardstatement_reference" schema:"clpprecedence_symbol_hazardstatement_reference"` // only when the symbol comes from this statement, if set
+}
+
+// ClpClassification is a product classification inferred from its hazard statements
+type ClpClassification struct {
+	Symbols    []Symbol   `json:"symbols"`
+	SignalWord SignalWord `json:"signalword"`
+}
+
+// ClpInconsistency is a product whose stored classification
+// disagrees with the one inferred from its hazard statements
+type ClpInconsistency struct {
+	ProductID  int               `json:"product_id"`
+	NameLabel  string            `json:"name_label"`
+	Symbols    []string          `json:"symbols"`
+	SignalWord string            `json:"signalword"`
+	Expected   ClpClassification `json:"expected"`
+}
+
+// IncompatibilityViolation is a pair of storages of a same store location
+// matching an incompatibility rule
+type IncompatibilityViolation struct {
+	Incompatibility
+	StoreLocationID       int    `db:"storelocation_id" json:"storelocation_id"`
+	StoreLocationFullPath string `db:"storelocation_fullpath" json:"storelocation_fullpath"`
+	StorageID1            int    `db:"storage1_id" json:"storage1_id"`
+	NameLabel1            string `db:"name1_label" json:"name1_label"`
+	StorageID2            int    `db:"storage2_id" json:"storage2_id"`
+	NameLabel2            string `db:"name2_label" json:"name2_label"`
+}
+
 func (p Product) productToStringSlice() []string {
 	ret := make([]string, 0)
 
@@ -271,6 +760,9 @@ func (p Product) productToStringSlice() []string {
 	ret = append(ret, p.EmpiricalFormulaLabel)
 	ret = append(ret, p.LinearFormulaLabel.String)
 	ret = append(ret, p.ProductThreeDFormula.String)
+	ret = append(ret, p.ProductSmiles.String)
+	ret = append(ret, p.ProductInchi.String)
+	ret = append(ret, p.ProductInchiKey.String)
 
 	ret = append(ret, p.ProductMSDS.String)
 
@@ -353,6 +845,9 @@ func ProductsToCSV(prs []Product) string {
 		"empirical_formula",
 		"linear_formula",
 		"3D_formula",
+		"SMILES",
+		"InChI",
+		"InChIKey",
 		"MSDS",
 		"class_of_compounds",
 		"physical_state",
@@ -507,3 +1002,7 @@ func (c CeNumber) String() string {
 	b := c.CeNumberID.Valid
 	return fmt.Sprintf("CeNumberID: %d | CeNumberValid: %t | CeNumberLabel: %s", i, b, v)
 }
+
+func (i IncompatibilityViolation) String() string {
+	return fmt.Sprintf("%s %s/%s %s: %s (%s)", i.StoreLocationFullPath, i.IncompatibilityKey1, i.IncompatibilityKey2, i.IncompatibilityLevel, i.NameLabel2, i.IncompatibilityComment.String)
+}
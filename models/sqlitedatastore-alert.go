@@ -0,0 +1,183 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+)
+
+const (
+	// default storage alerts thresholds of the entities
+	defaultAlertExpiringDays = 30
+	defaultAlertOpenedMonths = 12
+)
+
+// GetAlertSetting returns the storage alerts thresholds of the entity with the given id
+func (db *SQLiteDataStore) GetAlertSetting(id int) (AlertSetting, error) {
+	var (
+		a    AlertSetting
+		sqlr string
+		err  error
+	)
+
+	sqlr = `SELECT alertsetting_entity_id, alertsetting_expiringdays, alertsetting_openedmonths
+	FROM alertsetting
+	WHERE alertsetting_entity_id = ?`
+	if err = db.Get(&a, sqlr, id); err != nil {
+		if err != sql.ErrNoRows {
+			return AlertSetting{}, err
+		}
+		a = AlertSetting{
+			AlertSettingEntityID:     id,
+			AlertSettingExpiringDays: defaultAlertExpiringDays,
+			AlertSettingOpenedMonths: defaultAlertOpenedMonths,
+		}
+	}
+
+	log.WithFields(log.Fields{"id": id, "a": a}).Debug("GetAlertSetting")
+	return a, nil
+}
+
+// UpdateAlertSetting updates the storage alerts thresholds of an entity
+func (db *SQLiteDataStore) UpdateAlertSetting(a AlertSetting) error {
+	var (
+		sqlr string
+		err  error
+	)
+
+	sqlr = `INSERT OR REPLACE INTO alertsetting (alertsetting_entity_id, alertsetting_expiringdays, alertsetting_openedmonths)
+	VALUES (?, ?, ?)`
+	if _, err = db.Exec(sqlr, a.AlertSettingEntityID, a.AlertSettingExpiringDays, a.AlertSettingOpenedMonths); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// storageAlertDate returns the storage date the alert a is about,
+// its opening date for the opened alerts or else its expiration date
+func storageAlertDate(a StorageAlert) global.NullTime {
+	if a.StorageAlertKind == "opened" {
+		return a.StorageOpeningDate
+	}
+	return a.StorageExpirationDate
+}
+
+// GetStorageAlerts returns the storages expiring soon, expired or opened for too long
+// at the date now according to the thresholds of their entity
+// and not notified yet for their current dates
+func (db *SQLiteDataStore) GetStorageAlerts(now time.Time) ([]StorageAlert, error) {
+	var (
+		alerts []StorageAlert
+		sqlr   string
+		err    error
+	)
+
+	// candidate storages with their entity thresholds
+	var rows []struct {
+		StorageAlert
+		ExpiringDays int `db:"expiringdays"`
+		OpenedMonths int `db:"openedmonths"`
+	}
+	sqlr = `SELECT s.storage_id, s.storage_barecode, s.storage_openingdate, s.storage_expirationdate,
+	name.name_label, storelocation.storelocation_fullpath, entity.entity_id, entity.entity_name,
+	IFNULL(alertsetting_expiringdays, ?) AS expiringdays,
+	IFNULL(alertsetting_openedmonths, ?) AS openedmonths
+	FROM storage AS s
+	JOIN product ON s.product = product.product_id
+	JOIN name ON product.name = name.name_id
+	JOIN storelocation ON s.storelocation = storelocation.storelocation_id
+	JOIN entity ON storelocation.entity = entity.entity_id
+	LEFT JOIN alertsetting ON alertsetting_entity_id = entity.entity_id
+	WHERE s.storage IS NULL AND
+	s.storage_archive = false AND
+	s.storage_exitdate IS NULL AND
+	(s.storage_expirationdate IS NOT NULL OR s.storage_openingdate IS NOT NULL)
+	ORDER BY entity.entity_id, storelocation.storelocation_fullpath, s.storage_id`
+	if err = db.Select(&rows, sqlr, defaultAlertExpiringDays, defaultAlertOpenedMonths); err != nil {
+		return nil, err
+	}
+
+	// already sent notifications with the storage date they were about
+	var notifications []struct {
+		StorageID   int             `db:"storage"`
+		Kind        string          `db:"alertnotification_kind"`
+		StorageDate global.NullTime `db:"alertnotification_storagedate"`
+	}
+	sqlr = `SELECT storage, alertnotification_kind, alertnotification_storagedate FROM alertnotification`
+	if err = db.Select(&notifications, sqlr); err != nil {
+		return nil, err
+	}
+	notified := make(map[int]map[string]global.NullTime)
+	for _, n := range notifications {
+		if _, ok := notified[n.StorageID]; !ok {
+			notified[n.StorageID] = make(map[string]global.NullTime)
+		}
+		notified[n.StorageID][n.Kind] = n.StorageDate
+	}
+
+	for _, r := range rows {
+		var kinds []string
+		if r.StorageExpirationDate.Valid {
+			if r.StorageExpirationDate.Time.Before(now) {
+				kinds = append(kinds, "expired")
+			} else if r.ExpiringDays > 0 && r.StorageExpirationDate.Time.Before(now.AddDate(0, 0, r.ExpiringDays)) {
+				kinds = append(kinds, "expiring")
+			}
+		}
+		if r.StorageOpeningDate.Valid && r.OpenedMonths > 0 && r.StorageOpeningDate.Time.Before(now.AddDate(0, -r.OpenedMonths, 0)) {
+			kinds = append(kinds, "opened")
+		}
+		for _, k := range kinds {
+			a := r.StorageAlert
+			a.StorageAlertKind = k
+			// the storages whose date changed since their notification are notified again
+			if d, ok := notified[r.StorageID][k]; ok && d.Valid && d.Time.Equal(storageAlertDate(a).Time) {
+				continue
+			}
+			alerts = append(alerts, a)
+		}
+	}
+
+	log.WithFields(log.Fields{"alerts": len(alerts)}).Debug("GetStorageAlerts")
+	return alerts, nil
+}
+
+// CreateAlertNotifications records the given alerts as notified at the date now,
+// replacing the former notifications of the same storages and kinds
+func (db *SQLiteDataStore) CreateAlertNotifications(alerts []StorageAlert, now time.Time) error {
+	var (
+		tx   *sqlx.Tx
+		sqlr string
+		err  error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	sqlr = `INSERT INTO alertnotification (alertnotification_kind, alertnotification_date, alertnotification_storagedate, storage)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(storage, alertnotification_kind) DO UPDATE SET alertnotification_date = excluded.alertnotification_date,
+	alertnotification_storagedate = excluded.alertnotification_storagedate`
+	for _, a := range alerts {
+		if _, err = tx.Exec(sqlr, a.StorageAlertKind, now, storageAlertDate(a), a.StorageID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// overdue borrowings reminders interval in days
+	borrowingReminderDays = 7
+
+	// borrowingSelect is the common borrowings select query
+	borrowingSelect = `SELECT borrowing_id, borrowing_comment, borrowing_date, borrowing_duedate,
+	borrowing_returndate, borrowing_returnquantity, borrowing_state,
+	person.person_id AS "person.person_id",
+	person.person_email AS "person.person_email",
+	borrower.person_id AS "borrower.person_id",
+	borrower.person_email AS "borrower.person_email",
+	storage.storage_id AS "storage.storage_id",
+	storage.storage_barecode AS "storage.storage_barecode",
+	name.name_label AS "storage.product.name.name_label",
+	storelocation.storelocation_fullpath AS "storage.storelocation.storelocation_fullpath",
+	entity.entity_id AS "storage.storelocation.entity.entity_id",
+	entity.entity_name AS "storage.storelocation.entity.entity_name"
+	FROM borrowing
+	JOIN person ON borrowing.person = person.person_id
+	JOIN person AS borrower ON borrowing.borrower = borrower.person_id
+	JOIN storage ON borrowing.storage = storage.storage_id
+	JOIN product ON storage.product = product.product_id
+	JOIN name ON product.name = name.name_id
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	JOIN entity ON storelocation.entity = entity.entity_id`
+)
+
+// getBorrowings returns the borrowings matching the where clause in the given state:
+// "active" (including overdue), "overdue", "returned" or "" for all
+func (db *SQLiteDataStore) getBorrowings(where string, id int, state string) ([]Borrowing, error) {
+	var (
+		bs   []Borrowing
+		res  []Borrowing
+		sqlr string
+		err  error
+	)
+
+	sqlr = borrowingSelect + " WHERE " + where + " = ?"
+	switch state {
+	case "active", "overdue":
+		sqlr += " AND borrowing_returndate IS NULL"
+	case "returned":
+		sqlr += " AND borrowing_returndate IS NOT NULL"
+	}
+	sqlr += " ORDER BY borrowing_returndate IS NOT NULL, borrowing_date DESC"
+	if err = db.Select(&bs, sqlr, id); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, b := range bs {
+		if !b.BorrowingReturnDate.Valid && b.BorrowingDueDate.Valid && b.BorrowingDueDate.Time.Before(now) {
+			b.BorrowingState.String = "overdue"
+		}
+		if state == "overdue" && b.BorrowingState.String != "overdue" {
+			continue
+		}
+		res = append(res, b)
+	}
+
+	return res, nil
+}
+
+// GetEntityBorrowings returns the borrowings of the storages of the entity with id "id"
+// in the given state
+func (db *SQLiteDataStore) GetEntityBorrowings(id int, state string) ([]Borrowing, error) {
+	log.WithFields(log.Fields{"id": id, "state": state}).Debug("GetEntityBorrowings")
+	return db.getBorrowings("entity.entity_id", id, state)
+}
+
+// GetPersonBorrowings returns the borrowings of the borrower with id "id"
+// in the given state
+func (db *SQLiteDataStore) GetPersonBorrowings(id int, state string) ([]Borrowing, error) {
+	log.WithFields(log.Fields{"id": id, "state": state}).Debug("GetPersonBorrowings")
+	return db.getBorrowings("borrower.person_id", id, state)
+}
+
+// GetOverdueBorrowings returns the overdue borrowings at the date now
+// not reminded for borrowingReminderDays days
+func (db *SQLiteDataStore) GetOverdueBorrowings(now time.Time) ([]Borrowing, error) {
+	var (
+		bs  []Borrowing
+		res []Borrowing
+		err error
+	)
+
+	sqlr := borrowingSelect + ` WHERE borrowing_returndate IS NULL AND borrowing_duedate IS NOT NULL`
+	if err = db.Select(&bs, sqlr); err != nil {
+		return nil, err
+	}
+
+	// last reminders dates
+	var reminded []struct {
+		ID   int        `db:"borrowing_id"`
+		Date *time.Time `db:"borrowing_reminderdate"`
+	}
+	if err = db.Select(&reminded, `SELECT borrowing_id, borrowing_reminderdate FROM borrowing WHERE borrowing_reminderdate IS NOT NULL`); err != nil {
+		return nil, err
+	}
+	last := make(map[int]time.Time)
+	for _, r := range reminded {
+		last[r.ID] = *r.Date
+	}
+
+	for _, b := range bs {
+		if !b.BorrowingDueDate.Time.Before(now) {
+			continue
+		}
+		if d, ok := last[int(b.BorrowingID.Int64)]; ok && d.After(now.AddDate(0, 0, -borrowingReminderDays)) {
+			continue
+		}
+		b.BorrowingState.String = "overdue"
+		res = append(res, b)
+	}
+
+	log.WithFields(log.Fields{"overdue": len(res)}).Debug("GetOverdueBorrowings")
+	return res, nil
+}
+
+// UpdateBorrowingReminder records the reminder of the borrowing with id "id" at the date now
+func (db *SQLiteDataStore) UpdateBorrowingReminder(id int, now time.Time) error {
+	var err error
+
+	if _, err = db.Exec(`UPDATE borrowing SET borrowing_reminderdate = ? WHERE borrowing_id = ?`, now, id); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrBorrowRequestEntity is returned when the requested entity does not hold the product
+	ErrBorrowRequestEntity = errors.New("the entity does not hold the product")
+	// ErrBorrowRequestNotPending is returned when the borrow request has already been accepted or refused
+	ErrBorrowRequestNotPending = errors.New("the borrow request is not pending")
+	// ErrBorrowRequestStorageBorrowed is returned when accepting a borrow request with a storage already borrowed
+	ErrBorrowRequestStorageBorrowed = errors.New("the storage is already borrowed")
+)
+
+// borrowRequestSelect is the common borrow requests select query
+const borrowRequestSelect = `SELECT borrowrequest_id, borrowrequest_status, borrowrequest_kind, borrowrequest_quantity,
+	borrowrequest_date, borrowrequest_creationdate, borrowrequest_decisiondate,
+	product.product_id, name.name_label,
+	entity.entity_id, entity.entity_name,
+	person.person_id, person.person_email,
+	decider.person_id AS decider_id, decider.person_email AS decider_email,
+	borrowrequest.storage AS storage_id,
+	unit.unit_id, unit.unit_label
+	FROM borrowrequest
+	JOIN product ON borrowrequest.product = product.product_id
+	JOIN name ON product.name = name.name_id
+	JOIN entity ON borrowrequest.entity = entity.entity_id
+	JOIN person ON borrowrequest.person = person.person_id
+	LEFT JOIN person AS decider ON borrowrequest.decider = decider.person_id
+	LEFT JOIN unit ON borrowrequest.unit = unit.unit_id`
+
+// CreateBorrowRequest creates the pending borrow request br
+// with its first message and returns its id
+func (db *SQLiteDataStore) CreateBorrowRequest(br BorrowRequest, message string) (int, error) {
+	var (
+		tx     *sqlx.Tx
+		sqlr   string
+		res    sql.Result
+		lastid int64
+		c      int
+		now    = time.Now()
+		err    error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+
+	// the entity must hold the product
+	sqlr = `SELECT count(*) FROM storage
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	WHERE storage.product = ? AND storelocation.entity = ? AND
+	storage.storage IS NULL AND storage.storage_archive = false`
+	if err = tx.Get(&c, sqlr, br.ProductID, br.EntityID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if c == 0 {
+		tx.Rollback()
+		return 0, ErrBorrowRequestEntity
+	}
+
+	sqlr = `INSERT INTO borrowrequest (borrowrequest_status, borrowrequest_quantity, borrowrequest_date, borrowrequest_creationdate,
+	product, entity, person, unit)
+	VALUES ("pending", ?, ?, ?, ?, ?, ?, ?)`
+	if res, err = tx.Exec(sqlr, br.BorrowRequestQuantity, br.BorrowRequestDate, now, br.ProductID, br.EntityID, br.PersonID, br.UnitID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if lastid, err = res.LastInsertId(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if message != "" {
+		sqlr = `INSERT INTO borrowrequestmessage (borrowrequestmessage_date, borrowrequestmessage_text, borrowrequest, person)
+		VALUES (?, ?, ?, ?)`
+		if _, err = tx.Exec(sqlr, now, message, lastid, br.PersonID); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{"br": br, "lastid": lastid}).Debug("CreateBorrowRequest")
+	return int(lastid), nil
+}
+
+// GetBorrowRequest returns the borrow request with id "id" and its messages
+func (db *SQLiteDataStore) GetBorrowRequest(id int) (BorrowRequest, error) {
+	var (
+		br   BorrowRequest
+		sqlr string
+		err  error
+	)
+
+	if err = db.Get(&br, borrowRequestSelect+` WHERE borrowrequest_id = ?`, id); err != nil {
+		return BorrowRequest{}, err
+	}
+
+	sqlr = `SELECT borrowrequestmessage_id, borrowrequestmessage_date, borrowrequestmessage_text,
+	borrowrequest AS borrowrequest_id, person.person_id, person.person_email
+	FROM borrowrequestmessage
+	JOIN person ON borrowrequestmessage.person = person.person_id
+	WHERE borrowrequest = ?
+	ORDER BY borrowrequestmessage_date, borrowrequestmessage_id`
+	if err = db.Select(&br.Messages, sqlr, id); err != nil {
+		return BorrowRequest{}, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "br": br}).Debug("GetBorrowRequest")
+	return br, nil
+}
+
+// GetPersonBorrowRequests returns the borrow requests sent by the person with id "id"
+// or addressed to the entities the person manages, the most recent first
+func (db *SQLiteDataStore) GetPersonBorrowRequests(id int) ([]BorrowRequest, error) {
+	var (
+		brs []BorrowRequest
+		err error
+	)
+
+	sqlr := borrowRequestSelect + ` WHERE borrowrequest.person = ? OR
+	borrowrequest.entity IN (SELECT entitypeople_entity_id FROM entitypeople WHERE entitypeople_person_id = ?)
+	ORDER BY borrowrequest_creationdate DESC, borrowrequest_id DESC`
+	if err = db.Select(&brs, sqlr, id, id); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "brs": len(brs)}).Debug("GetPersonBorrowRequests")
+	return brs, nil
+}
+
+// CreateBorrowRequestMessage adds the message m to its borrow request thread and returns its id
+func (db *SQLiteDataStore) CreateBorrowRequestMessage(m BorrowRequestMessage) (int, error) {
+	var (
+		sqlr   string
+		res    sql.Result
+		lastid int64
+		err    error
+	)
+
+	sqlr = `INSERT INTO borrowrequestmessage (borrowrequestmessage_date, borrowrequestmessage_text, borrowrequest, person)
+	VALUES (?, ?, ?, ?)`
+	if res, err = db.Exec(sqlr, time.Now(), m.BorrowRequestMessageText, m.BorrowRequestID, m.PersonID); err != nil {
+		return 0, err
+	}
+	if lastid, err = res.LastInsertId(); err != nil {
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{"m": m, "lastid": lastid}).Debug("CreateBorrowRequestMessage")
+	return int(lastid), nil
+}
+
+// DecideBorrowRequest sets the pending borrow request br to the status "accepted" or "refused"
+// decided by the person with id personid, recording the lent or transferred storage on acceptance
+func (db *SQLiteDataStore) DecideBorrowRequest(br BorrowRequest, personid int, status string) error {
+	if err := decideBorrowRequest(db, br, personid, status); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"br": br, "personid": personid, "status": status}).Debug("DecideBorrowRequest")
+	return nil
+}
+
+// decideBorrowRequest sets the status of the pending borrow request br with e, see DecideBorrowRequest
+func decideBorrowRequest(e sqlx.Execer, br BorrowRequest, personid int, status string) error {
+	var (
+		sqlr string
+		res  sql.Result
+		n    int64
+		err  error
+	)
+
+	sqlr = `UPDATE borrowrequest SET borrowrequest_status = ?, borrowrequest_kind = ?, borrowrequest_decisiondate = ?,
+	decider = ?, storage = ?
+	WHERE borrowrequest_id = ? AND borrowrequest_status = "pending"`
+	if res, err = e.Exec(sqlr, status, br.BorrowRequestKind, time.Now(), personid, br.StorageID, br.BorrowRequestID); err != nil {
+		return err
+	}
+	if n, err = res.RowsAffected(); err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrBorrowRequestNotPending
+	}
+
+	return nil
+}
+
+// AcceptBorrowRequest accepts the pending borrow request br decided by the person with id personid,
+// creating in the same transaction the borrowing b or the transfer t of the storage br.StorageID
+// according to br.BorrowRequestKind. Nothing is created if the request is not pending anymore.
+func (db *SQLiteDataStore) AcceptBorrowRequest(br BorrowRequest, personid int, b Borrowing, t Transfer) error {
+	var (
+		tx  *sqlx.Tx
+		c   int
+		err error
+	)
+	log.WithFields(log.Fields{"br": br, "personid": personid}).Debug("AcceptBorrowRequest")
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	// the request status is updated first to hold the write lock
+	// so that two managers can not accept it at the same time
+	if err = decideBorrowRequest(tx, br, personid, "accepted"); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	switch br.BorrowRequestKind.String {
+	case "borrowing":
+		sqlr := `SELECT count(*) FROM borrowing WHERE storage = ? AND borrowing_returndate IS NULL`
+		if err = tx.Get(&c, sqlr, br.StorageID); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if c != 0 {
+			tx.Rollback()
+			return ErrBorrowRequestStorageBorrowed
+		}
+		b.Storage.StorageID = br.StorageID
+		err = createStorageBorrowing(tx, b)
+	case "transfer":
+		t.StorageID = int(br.StorageID.Int64)
+		_, err = createTransfer(tx, t)
+	default:
+		err = errors.New("wrong borrow request kind")
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
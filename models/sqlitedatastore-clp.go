@@ -0,0 +1,221 @@
+package models
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+)
+
+// inferClp returns the pictograms and signal word of the given hazard statements
+// references according to the CLP rules and precedences
+func inferClp(rules []ClpRule, precedences []ClpPrecedence, references []string) ([]string, string) {
+	var (
+		symbols    []string
+		signalword string
+	)
+
+	// pictograms with the statements they come from
+	from := make(map[string][]string)
+	for _, ref := range references {
+		for _, r := range rules {
+			if r.ClpRuleHazardStatementReference != ref {
+				continue
+			}
+			if r.ClpRuleSymbolLabel.Valid {
+				from[r.ClpRuleSymbolLabel.String] = append(from[r.ClpRuleSymbolLabel.String], ref)
+			}
+			// danger supersedes warning
+			if r.ClpRuleSignalWordLabel.Valid && signalword != "danger" {
+				signalword = r.ClpRuleSignalWordLabel.String
+			}
+		}
+	}
+
+	// removing the superseded pictograms
+	// a pictogram is superseded if all the statements it comes from are
+	superseded := make(map[string]map[string]bool)
+	for _, p := range precedences {
+		if _, ok := from[p.ClpPrecedenceSymbolLabel]; !ok {
+			continue
+		}
+		// the symbol must come from the given statement if set
+		if p.ClpPrecedenceSymbolHazardStatementReference.Valid {
+			found := false
+			for _, ref := range from[p.ClpPrecedenceSymbolLabel] {
+				if ref == p.ClpPrecedenceSymbolHazardStatementReference.String {
+					found = true
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		if _, ok := superseded[p.ClpPrecedenceSupersededLabel]; !ok {
+			superseded[p.ClpPrecedenceSupersededLabel] = make(map[string]bool)
+		}
+		for _, ref := range from[p.ClpPrecedenceSupersededLabel] {
+			if !p.ClpPrecedenceHazardStatementReference.Valid || p.ClpPrecedenceHazardStatementReference.String == ref {
+				superseded[p.ClpPrecedenceSupersededLabel][ref] = true
+			}
+		}
+	}
+	for sym, refs := range from {
+		keep := false
+		for _, ref := range refs {
+			if !superseded[sym][ref] {
+				keep = true
+			}
+		}
+		if keep {
+			symbols = append(symbols, sym)
+		}
+	}
+	sort.Strings(symbols)
+
+	return symbols, signalword
+}
+
+// getClpRules returns the CLP rules and precedences
+func (db *SQLiteDataStore) getClpRules() ([]ClpRule, []ClpPrecedence, error) {
+	var (
+		rules       []ClpRule
+		precedences []ClpPrecedence
+		err         error
+	)
+
+	if err = db.Select(&rules, `SELECT clprule_id, clprule_hazardstatement_reference, clprule_symbol_label, clprule_signalword_label
+	FROM clprule`); err != nil {
+		return nil, nil, err
+	}
+	if err = db.Select(&precedences, `SELECT clpprecedence_id, clpprecedence_symbol_label, clpprecedence_superseded_label, clpprecedence_hazardstatement_reference,
+	clpprecedence_symbol_hazardstatement_reference
+	FROM clpprecedence`); err != nil {
+		return nil, nil, err
+	}
+
+	return rules, precedences, nil
+}
+
+// buildClpClassification returns the symbols and signal word
+// matching the given labels
+func (db *SQLiteDataStore) buildClpClassification(symbols []string, signalword string) (ClpClassification, error) {
+	var (
+		c    ClpClassification
+		sqlr string
+		sqla []interface{}
+		err  error
+	)
+
+	c.Symbols = []Symbol{}
+	if len(symbols) != 0 {
+		if sqlr, sqla, err = sqlx.In(`SELECT symbol_id, symbol_label, symbol_image FROM symbol
+		WHERE symbol_label IN (?) ORDER BY symbol_label`, symbols); err != nil {
+			return ClpClassification{}, err
+		}
+		if err = db.Select(&c.Symbols, db.Rebind(sqlr), sqla...); err != nil {
+			return ClpClassification{}, err
+		}
+	}
+
+	if signalword != "" {
+		if err = db.Get(&c.SignalWord, `SELECT signalword_id, signalword_label FROM signalword
+		WHERE signalword_label = ?`, signalword); err != nil && err != sql.ErrNoRows {
+			return ClpClassification{}, err
+		}
+	}
+
+	return c, nil
+}
+
+// GetProductsClpClassification returns the symbols and signal word
+// inferred from the given hazard statements references
+func (db *SQLiteDataStore) GetProductsClpClassification(references []string) (ClpClassification, error) {
+	var (
+		rules       []ClpRule
+		precedences []ClpPrecedence
+		err         error
+	)
+
+	if rules, precedences, err = db.getClpRules(); err != nil {
+		return ClpClassification{}, err
+	}
+	symbols, signalword := inferClp(rules, precedences, references)
+
+	log.WithFields(log.Fields{"references": references, "symbols": symbols, "signalword": signalword}).Debug("GetProductsClpClassification")
+	return db.buildClpClassification(symbols, signalword)
+}
+
+// GetProductsClpInconsistencies returns the products whose symbols or signal word
+// disagree with the ones inferred from their hazard statements
+func (db *SQLiteDataStore) GetProductsClpInconsistencies() ([]ClpInconsistency, error) {
+	var (
+		rules           []ClpRule
+		precedences     []ClpPrecedence
+		inconsistencies []ClpInconsistency
+		err             error
+	)
+
+	// products with their classification as concatenated strings
+	type row struct {
+		ProductID        int            `db:"product_id"`
+		NameLabel        string         `db:"name_label"`
+		SignalWordLabel  sql.NullString `db:"signalword_label"`
+		HazardStatements sql.NullString `db:"hazardstatements"`
+		Symbols          sql.NullString `db:"symbols"`
+	}
+	var rows []row
+
+	if rules, precedences, err = db.getClpRules(); err != nil {
+		return nil, err
+	}
+
+	sqlr := `SELECT p.product_id, name.name_label, signalword.signalword_label,
+	(SELECT GROUP_CONCAT(hazardstatement_reference) FROM producthazardstatements
+		JOIN hazardstatement ON producthazardstatements_hazardstatement_id = hazardstatement_id
+		WHERE producthazardstatements_product_id = p.product_id) AS hazardstatements,
+	(SELECT GROUP_CONCAT(symbol_label) FROM productsymbols
+		JOIN symbol ON productsymbols_symbol_id = symbol_id
+		WHERE productsymbols_product_id = p.product_id) AS symbols
+	FROM product AS p
+	JOIN name ON p.name = name.name_id
+	LEFT JOIN signalword ON p.signalword = signalword.signalword_id
+	WHERE EXISTS (SELECT 1 FROM producthazardstatements WHERE producthazardstatements_product_id = p.product_id)
+	ORDER BY name.name_label`
+	if err = db.Select(&rows, sqlr); err != nil {
+		return nil, err
+	}
+
+	for _, r := range rows {
+		var stored []string
+		if r.Symbols.Valid {
+			stored = strings.Split(r.Symbols.String, ",")
+			sort.Strings(stored)
+		}
+		symbols, signalword := inferClp(rules, precedences, strings.Split(r.HazardStatements.String, ","))
+
+		// the signal word is not checked when it depends on the hazard category
+		if strings.Join(stored, ",") == strings.Join(symbols, ",") &&
+			(signalword == "" || signalword == r.SignalWordLabel.String) {
+			continue
+		}
+
+		i := ClpInconsistency{
+			ProductID:  r.ProductID,
+			NameLabel:  r.NameLabel,
+			Symbols:    stored,
+			SignalWord: r.SignalWordLabel.String,
+		}
+		if i.Expected, err = db.buildClpClassification(symbols, signalword); err != nil {
+			return nil, err
+		}
+		inconsistencies = append(inconsistencies, i)
+	}
+
+	log.WithFields(log.Fields{"inconsistencies": len(inconsistencies)}).Debug("GetProductsClpInconsistencies")
+	return inconsistencies, nil
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrConsumptionUnit is returned when the consumption unit can not be converted to the storage unit
+	ErrConsumptionUnit = errors.New("consumption unit not compatible with the storage unit")
+	// ErrConsumptionQuantity is returned when the storage quantity is lower than the consumption
+	ErrConsumptionQuantity = errors.New("not enough quantity in the storage")
+)
+
+// storageUnit is a unit with its multiplier and reference unit
+type storageUnit struct {
+	UnitID         sql.NullInt64   `db:"unit_id"`
+	UnitMultiplier sql.NullFloat64 `db:"unit_multiplier"`
+	UnitReference  sql.NullInt64   `db:"unit_reference"` // the unit itself for the reference units
+}
+
+// CreateConsumption withdraws the consumption c from its storage, records it
+// and returns its id. The storage is archived when empty if asked.
+func (db *SQLiteDataStore) CreateConsumption(c Consumption) (int, error) {
+	var (
+		tx  *sqlx.Tx
+		id  int
+		err error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+
+	if id, err = createConsumption(tx, c); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// createConsumption records the consumption c in the transaction tx, see CreateConsumption
+func createConsumption(tx *sqlx.Tx, c Consumption) (int, error) {
+	var (
+		sqlr     string
+		res      sql.Result
+		lastid   int64
+		quantity sql.NullFloat64
+		su, cu   storageUnit
+		err      error
+	)
+
+	// getting the storage quantity and unit
+	sqlr = `SELECT storage_quantity FROM storage WHERE storage_id = ?`
+	if err = tx.Get(&quantity, sqlr, c.StorageID); err != nil {
+		return 0, err
+	}
+	sqlr = `SELECT unit.unit_id, unit.unit_multiplier, IFNULL(unit.unit, unit.unit_id) AS unit_reference
+	FROM storage
+	LEFT JOIN unit ON storage.unit = unit.unit_id
+	WHERE storage_id = ?`
+	if err = tx.Get(&su, sqlr, c.StorageID); err != nil {
+		return 0, err
+	}
+
+	// getting the consumption unit, the storage one by default
+	cu = su
+	if c.UnitID.Valid && c.UnitID != su.UnitID {
+		sqlr = `SELECT unit_id, unit_multiplier, IFNULL(unit, unit_id) AS unit_reference
+		FROM unit WHERE unit_id = ?`
+		if err = tx.Get(&cu, sqlr, c.UnitID.Int64); err != nil {
+			return 0, err
+		}
+		if !su.UnitID.Valid || cu.UnitReference != su.UnitReference {
+			return 0, ErrConsumptionUnit
+		}
+	}
+	c.UnitID = cu.UnitID
+
+	// converting the consumption in the storage unit
+	c.ConsumptionStorageQuantity = c.ConsumptionQuantity
+	if cu.UnitID != su.UnitID {
+		c.ConsumptionStorageQuantity = c.ConsumptionQuantity * cu.UnitMultiplier.Float64 / su.UnitMultiplier.Float64
+	}
+	if !quantity.Valid {
+		return 0, ErrConsumptionQuantity
+	}
+	rest := quantity.Float64 - c.ConsumptionStorageQuantity
+	// ignoring floating point rounding errors
+	if math.Abs(rest) < 1e-9 {
+		rest = 0
+	}
+	if rest < 0 {
+		return 0, ErrConsumptionQuantity
+	}
+	log.WithFields(log.Fields{"c": c, "rest": rest}).Debug("createConsumption")
+
+	// updating the storage, the former version being kept in its history
+	if err = insertStorageHistory(tx, int64(c.StorageID)); err != nil {
+		return 0, err
+	}
+	sqlr = `UPDATE storage SET storage_quantity = ?, storage_modificationdate = ?, storage_modifiedby = ? WHERE storage_id = ?`
+	if _, err = tx.Exec(sqlr, rest, time.Now(), c.PersonID, c.StorageID); err != nil {
+		return 0, err
+	}
+	if rest == 0 && c.ConsumptionArchive {
+		sqlr = `UPDATE storage SET storage_archive = true WHERE storage_id = ? OR storage.storage = ?`
+		if _, err = tx.Exec(sqlr, c.StorageID, c.StorageID); err != nil {
+			return 0, err
+		}
+	}
+
+	// recording the consumption
+	sqlr = `INSERT INTO consumption (consumption_date, consumption_quantity, consumption_storagequantity, consumption_reason, person, storage, unit)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`
+	if res, err = tx.Exec(sqlr, time.Now(), c.ConsumptionQuantity, c.ConsumptionStorageQuantity, c.ConsumptionReason, c.PersonID, c.StorageID, c.UnitID); err != nil {
+		return 0, err
+	}
+	if lastid, err = res.LastInsertId(); err != nil {
+		return 0, err
+	}
+
+	return int(lastid), nil
+}
+
+// getConsumptions returns the consumptions matching the where clause
+// and their totals by reference unit
+func (db *SQLiteDataStore) getConsumptions(where string, id int) (ConsumptionReport, error) {
+	var (
+		r    ConsumptionReport
+		sqlr string
+		err  error
+	)
+
+	sqlr = `SELECT consumption_id, consumption_date, consumption_quantity, consumption_storagequantity, consumption_reason,
+	storage.storage_id, storage.storage_barecode, product.product_id, name.name_label,
+	person.person_id, person.person_email, unit.unit_id, unit.unit_label
+	FROM consumption
+	JOIN storage ON consumption.storage = storage.storage_id
+	JOIN product ON storage.product = product.product_id
+	JOIN name ON product.name = name.name_id
+	JOIN person ON consumption.person = person.person_id
+	LEFT JOIN unit ON consumption.unit = unit.unit_id
+	WHERE ` + where + ` = ?
+	ORDER BY consumption_date DESC`
+	if err = db.Select(&r.Rows, sqlr, id); err != nil {
+		return ConsumptionReport{}, err
+	}
+	r.Total = len(r.Rows)
+
+	sqlr = `SELECT reference.unit_label, SUM(consumption_quantity * unit.unit_multiplier) AS quantity
+	FROM consumption
+	JOIN storage ON consumption.storage = storage.storage_id
+	JOIN unit ON consumption.unit = unit.unit_id
+	JOIN unit AS reference ON IFNULL(unit.unit, unit.unit_id) = reference.unit_id
+	WHERE ` + where + ` = ?
+	GROUP BY reference.unit_id
+	ORDER BY reference.unit_label`
+	if err = db.Select(&r.Totals, sqlr, id); err != nil {
+		return ConsumptionReport{}, err
+	}
+
+	return r, nil
+}
+
+// GetProductConsumptions returns the consumptions of the storages of the product with the given id
+func (db *SQLiteDataStore) GetProductConsumptions(id int) (ConsumptionReport, error) {
+	log.WithFields(log.Fields{"id": id}).Debug("GetProductConsumptions")
+	return db.getConsumptions("storage.product", id)
+}
+
+// GetPersonConsumptions returns the consumptions of the person with the given id
+func (db *SQLiteDataStore) GetPersonConsumptions(id int) (ConsumptionReport, error) {
+	log.WithFields(log.Fields{"id": id}).Debug("GetPersonConsumptions")
+	return db.getConsumptions("consumption.person", id)
+}
@@ -0,0 +1,381 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/utils"
+)
+
+var (
+	// ErrDisposalStorage is returned when a storage can not join a disposal batch
+	ErrDisposalStorage = errors.New("the storages must be in the entity, flagged to destroy and not already in a disposal batch")
+	// ErrDisposalNotOpen is returned when changing a collected disposal batch
+	ErrDisposalNotOpen = errors.New("the disposal batch is not open")
+	// ErrDisposalCategory is returned for an unknown waste category
+	ErrDisposalCategory = errors.New("unknown waste category")
+)
+
+// disposalSelect is the common disposal batches select query
+const disposalSelect = `SELECT disposal_id, disposal_status, disposal_comment, disposal_creationdate, disposal_collectiondate,
+	entity.entity_id, entity.entity_name,
+	person.person_id, person.person_email
+	FROM disposal
+	JOIN entity ON disposal.entity = entity.entity_id
+	JOIN person ON disposal.person = person.person_id`
+
+// productWasteCategory returns the waste category of the product with id productid
+// derived from its symbols and hazard statements
+func productWasteCategory(tx *sqlx.Tx, productid int) (string, error) {
+	var (
+		symbols          []string
+		hazardstatements []string
+		err              error
+	)
+
+	sqlr := `SELECT symbol_label FROM symbol
+	JOIN productsymbols ON productsymbols.productsymbols_symbol_id = symbol.symbol_id
+	WHERE productsymbols.productsymbols_product_id = ?`
+	if err = tx.Select(&symbols, sqlr, productid); err != nil {
+		return "", err
+	}
+	sqlr = `SELECT hazardstatement_reference FROM hazardstatement
+	JOIN producthazardstatements ON producthazardstatements.producthazardstatements_hazardstatement_id = hazardstatement.hazardstatement_id
+	WHERE producthazardstatements.producthazardstatements_product_id = ?`
+	if err = tx.Select(&hazardstatements, sqlr, productid); err != nil {
+		return "", err
+	}
+
+	return utils.WasteCategory(symbols, hazardstatements), nil
+}
+
+// addDisposalStorages adds the storages with ids storageids to the open disposal batch
+// with id "id" of the entity with id entityid, classified by their product waste category
+func addDisposalStorages(tx *sqlx.Tx, id int, entityid int, storageids []int) error {
+	var (
+		productid int
+		category  string
+		err       error
+	)
+
+	for _, sid := range storageids {
+		sqlr := `SELECT storage.product FROM storage
+		JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+		WHERE storage.storage_id = ? AND storelocation.entity = ? AND
+		storage.storage IS NULL AND storage.storage_archive = false AND storage.storage_todestroy = true AND
+		storage.storage_id NOT IN (SELECT storage FROM disposalstorage)`
+		if err = tx.Get(&productid, sqlr, sid, entityid); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrDisposalStorage
+			}
+			return err
+		}
+		if category, err = productWasteCategory(tx, productid); err != nil {
+			return err
+		}
+
+		sqlr = `INSERT INTO disposalstorage (disposalstorage_category, disposal, storage) VALUES (?, ?, ?)`
+		if _, err = tx.Exec(sqlr, category, id, sid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isDisposalOpen returns the disposal batch with id "id",
+// or ErrDisposalNotOpen if it is not open
+func isDisposalOpen(tx *sqlx.Tx, id int) (Disposal, error) {
+	var (
+		d   Disposal
+		err error
+	)
+
+	if err = tx.Get(&d, disposalSelect+` WHERE disposal_id = ?`, id); err != nil {
+		return Disposal{}, err
+	}
+	if d.DisposalStatus != "open" {
+		return Disposal{}, ErrDisposalNotOpen
+	}
+
+	return d, nil
+}
+
+// CreateDisposal creates the open disposal batch d with the storages with ids storageids
+// and returns its id
+func (db *SQLiteDataStore) CreateDisposal(d Disposal, storageids []int) (int, error) {
+	var (
+		tx     *sqlx.Tx
+		res    sql.Result
+		lastid int64
+		err    error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+
+	sqlr := `INSERT INTO disposal (disposal_status, disposal_comment, disposal_creationdate, entity, person)
+	VALUES ("open", ?, ?, ?, ?)`
+	if res, err = tx.Exec(sqlr, d.DisposalComment, time.Now(), d.EntityID, d.PersonID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if lastid, err = res.LastInsertId(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err = addDisposalStorages(tx, int(lastid), d.EntityID, storageids); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{"d": d, "storageids": storageids, "lastid": lastid}).Debug("CreateDisposal")
+	return int(lastid), nil
+}
+
+// AddDisposalStorages adds the storages with ids storageids to the open disposal batch with id "id"
+func (db *SQLiteDataStore) AddDisposalStorages(id int, storageids []int) error {
+	var (
+		tx  *sqlx.Tx
+		d   Disposal
+		err error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	if d, err = isDisposalOpen(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = addDisposalStorages(tx, id, d.EntityID, storageids); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	log.WithFields(log.Fields{"id": id, "storageids": storageids}).Debug("AddDisposalStorages")
+	return nil
+}
+
+// RemoveDisposalStorage removes the storage with id storageid from the open disposal batch with id "id"
+func (db *SQLiteDataStore) RemoveDisposalStorage(id int, storageid int) error {
+	var (
+		tx  *sqlx.Tx
+		err error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	if _, err = isDisposalOpen(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM disposalstorage WHERE disposal = ? AND storage = ?`, id, storageid); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	log.WithFields(log.Fields{"id": id, "storageid": storageid}).Debug("RemoveDisposalStorage")
+	return nil
+}
+
+// UpdateDisposalStorageCategory sets the waste category of the storage with id storageid
+// in the open disposal batch with id "id"
+func (db *SQLiteDataStore) UpdateDisposalStorageCategory(id int, storageid int, category string) error {
+	var (
+		res sql.Result
+		n   int64
+		err error
+	)
+
+	if !utils.IsWasteCategory(category) {
+		return ErrDisposalCategory
+	}
+
+	sqlr := `UPDATE disposalstorage SET disposalstorage_category = ?
+	WHERE disposal = ? AND storage = ? AND
+	disposal IN (SELECT disposal_id FROM disposal WHERE disposal_status = "open")`
+	if res, err = db.Exec(sqlr, category, id, storageid); err != nil {
+		return err
+	}
+	if n, err = res.RowsAffected(); err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDisposalNotOpen
+	}
+
+	log.WithFields(log.Fields{"id": id, "storageid": storageid, "category": category}).Debug("UpdateDisposalStorageCategory")
+	return nil
+}
+
+// GetDisposal returns the disposal batch with id "id" with its storages
+// and the quantities per waste category
+func (db *SQLiteDataStore) GetDisposal(id int) (Disposal, error) {
+	var (
+		d   Disposal
+		err error
+	)
+
+	if err = db.Get(&d, disposalSelect+` WHERE disposal_id = ?`, id); err != nil {
+		return Disposal{}, err
+	}
+
+	sqlr := `SELECT disposal AS disposal_id, disposalstorage_category,
+	storage.storage_id, storage.storage_barecode, storage.storage_quantity,
+	unit.unit_label, name.name_label, casnumber.casnumber_label
+	FROM disposalstorage
+	JOIN storage ON disposalstorage.storage = storage.storage_id
+	JOIN product ON storage.product = product.product_id
+	JOIN name ON product.name = name.name_id
+	LEFT JOIN casnumber ON product.casnumber = casnumber.casnumber_id
+	LEFT JOIN unit ON storage.unit = unit.unit_id
+	WHERE disposal = ?
+	ORDER BY disposalstorage_category, name.name_label, storage.storage_id`
+	if err = db.Select(&d.Storages, sqlr, id); err != nil {
+		return Disposal{}, err
+	}
+
+	// quantities converted into the reference units
+	sqlr = `SELECT disposalstorage_category, count(*) AS count,
+	SUM(storage.storage_quantity * IFNULL(unit.unit_multiplier, 1)) AS quantity,
+	refunit.unit_label
+	FROM disposalstorage
+	JOIN storage ON disposalstorage.storage = storage.storage_id
+	LEFT JOIN unit ON storage.unit = unit.unit_id
+	LEFT JOIN unit AS refunit ON refunit.unit_id = IFNULL(unit.unit, unit.unit_id)
+	WHERE disposal = ?
+	GROUP BY disposalstorage_category, refunit.unit_id
+	ORDER BY disposalstorage_category, refunit.unit_label`
+	if err = db.Select(&d.Categories, sqlr, id); err != nil {
+		return Disposal{}, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "d": d}).Debug("GetDisposal")
+	return d, nil
+}
+
+// GetEntityDisposals returns the disposal batches of the entity with id "id", the most recent first
+func (db *SQLiteDataStore) GetEntityDisposals(id int) ([]Disposal, error) {
+	var (
+		ds  []Disposal
+		err error
+	)
+
+	sqlr := disposalSelect + ` WHERE disposal.entity = ? ORDER BY disposal_creationdate DESC, disposal_id DESC`
+	if err = db.Select(&ds, sqlr, id); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "ds": len(ds)}).Debug("GetEntityDisposals")
+	return ds, nil
+}
+
+// CollectDisposal marks the open disposal batch with id "id" as collected
+// and archives its storages with their exit date set
+func (db *SQLiteDataStore) CollectDisposal(id int) error {
+	var (
+		tx  *sqlx.Tx
+		now = time.Now()
+		err error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	if _, err = isDisposalOpen(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, sqlr := range []string{
+		`UPDATE disposal SET disposal_status = "collected", disposal_collectiondate = ?1 WHERE disposal_id = ?2`,
+		`UPDATE storage SET storage_archive = true, storage_exitdate = ?1
+		WHERE storage_id IN (SELECT storage FROM disposalstorage WHERE disposal = ?2)`,
+		// history
+		`UPDATE storage SET storage_archive = true
+		WHERE storage.storage IN (SELECT storage FROM disposalstorage WHERE disposal = ?2)`,
+	} {
+		if _, err = tx.Exec(sqlr, now, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	log.WithFields(log.Fields{"id": id}).Debug("CollectDisposal")
+	return nil
+}
+
+// DeleteDisposal deletes the open disposal batch with id "id", releasing its storages
+func (db *SQLiteDataStore) DeleteDisposal(id int) error {
+	var (
+		tx  *sqlx.Tx
+		err error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	if _, err = isDisposalOpen(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, sqlr := range []string{
+		`DELETE FROM disposalstorage WHERE disposal = ?`,
+		`DELETE FROM disposal WHERE disposal_id = ?`,
+	} {
+		if _, err = tx.Exec(sqlr, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	log.WithFields(log.Fields{"id": id}).Debug("DeleteDisposal")
+	return nil
+}
@@ -14,7 +14,8 @@ import (
 	"github.com/tbellembois/gochimitheque/helpers"
 )
 
-// ComputeStockStorelocation returns the quantity of product p in the store location s for the unit u
+// ComputeStockStorelocation returns the quantity of product p in the store location s for the unit u,
+// the storages history and the archived storages excluded
 func (db *SQLiteDataStore) ComputeStockStorelocation(p Product, s *StoreLocation, u Unit) float64 {
 
 	var (
@@ -28,6 +29,8 @@ func (db *SQLiteDataStore) ComputeStockStorelocation(p Product, s *StoreLocation
 	sqlr := `SELECT SUM(storage.storage_quantity * unit_multiplier) FROM storage
 	JOIN unit on storage.unit = unit.unit_id
 	WHERE storage.storelocation = ? AND
+	storage.storage IS NULL AND
+	storage.storage_archive = false AND
 	storage.storage_quantity IS NOT NULL AND
 	storage.product = ? AND
 	(storage.unit = ? OR storage.unit IN (select unit_id FROM unit WHERE unit.unit = ?))`
@@ -145,7 +148,7 @@ func (db *SQLiteDataStore) GetEntities(p helpers.DbselectparamEntity) ([]Entity,
 	log.WithFields(log.Fields{"p": p}).Debug("GetEntities")
 
 	precreq.WriteString(" SELECT count(DISTINCT e.entity_id)")
-	presreq.WriteString(" SELECT e.entity_id, e.entity_name, e.entity_description")
+	presreq.WriteString(" SELECT e.entity_id, e.entity_name, e.entity_description, e.entity_sharestocks, e.entity_code, e.entity_barecodetemplate, e.entity_labelprinter")
 	comreq.WriteString(" FROM entity AS e, person as p")
 	// filter by permissions
 	// comreq.WriteString(` JOIN permission AS perm ON
@@ -224,7 +227,7 @@ func (db *SQLiteDataStore) GetEntity(id int) (Entity, error) {
 	)
 	log.WithFields(log.Fields{"id": id}).Debug("GetEntity")
 
-	sqlr = `SELECT e.entity_id, e.entity_name, e.entity_description
+	sqlr = `SELECT e.entity_id, e.entity_name, e.entity_description, e.entity_sharestocks, e.entity_code, e.entity_barecodetemplate, e.entity_labelprinter
 	FROM entity AS e
 	WHERE e.entity_id = ?`
 	if err = db.Get(&entity, sqlr, id); err != nil {
@@ -258,6 +261,51 @@ func (db *SQLiteDataStore) DeleteEntity(id int) error {
 		sqlr string
 		err  error
 	)
+	sqlr = `DELETE FROM alertsetting
+	WHERE alertsetting_entity_id = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM stockthreshold
+	WHERE entity = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM purchase
+	WHERE entity = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM inventoryscan
+	WHERE inventory IN (SELECT inventory_id FROM inventory WHERE entity = ?)`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM inventory
+	WHERE entity = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM disposalstorage
+	WHERE disposal IN (SELECT disposal_id FROM disposal WHERE entity = ?)`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM disposal
+	WHERE entity = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM borrowrequestmessage
+	WHERE borrowrequest IN (SELECT borrowrequest_id FROM borrowrequest WHERE entity = ?)`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM borrowrequest
+	WHERE entity = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
 	sqlr = `DELETE FROM entity 
 	WHERE entity_id = ?`
 	if _, err = db.Exec(sqlr, id); err != nil {
@@ -281,8 +329,8 @@ func (db *SQLiteDataStore) CreateEntity(e Entity) (int, error) {
 		return 0, err
 	}
 
-	sqlr = `INSERT INTO entity(entity_name, entity_description) VALUES (?, ?)`
-	if res, err = tx.Exec(sqlr, e.EntityName, e.EntityDescription); err != nil {
+	sqlr = `INSERT INTO entity(entity_name, entity_description, entity_sharestocks, entity_code, entity_barecodetemplate, entity_labelprinter) VALUES (?, ?, ?, ?, ?, ?)`
+	if res, err = tx.Exec(sqlr, e.EntityName, e.EntityDescription, e.EntityShareStocks, e.EntityCode, e.EntityBarecodeTemplate, e.EntityLabelPrinter); err != nil {
 		tx.Rollback()
 		return 0, err
 	}
@@ -353,9 +401,9 @@ func (db *SQLiteDataStore) UpdateEntity(e Entity) error {
 	}
 
 	// updating the entity
-	sqlr = `UPDATE entity SET entity_name = ?, entity_description = ?
+	sqlr = `UPDATE entity SET entity_name = ?, entity_description = ?, entity_sharestocks = ?, entity_code = ?, entity_barecodetemplate = ?, entity_labelprinter = ?
 	WHERE entity_id = ?`
-	if _, err = tx.Exec(sqlr, e.EntityName, e.EntityDescription, e.EntityID); err != nil {
+	if _, err = tx.Exec(sqlr, e.EntityName, e.EntityDescription, e.EntityShareStocks, e.EntityCode, e.EntityBarecodeTemplate, e.EntityLabelPrinter, e.EntityID); err != nil {
 		tx.Rollback()
 		return err
 	}
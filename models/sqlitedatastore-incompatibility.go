@@ -0,0 +1,265 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/constants"
+	"github.com/tbellembois/gochimitheque/helpers"
+)
+
+const (
+	// productkeys lists the symbols, hazard statements and classes of compound
+	// of the products as (product_id, pkind, pkey) rows
+	productkeys = `WITH productkey AS (
+		SELECT productsymbols_product_id AS product_id, 'symbol' AS pkind, symbol_label AS pkey
+		FROM productsymbols JOIN symbol ON productsymbols_symbol_id = symbol_id
+		UNION
+		SELECT producthazardstatements_product_id, 'hazardstatement', hazardstatement_reference
+		FROM producthazardstatements JOIN hazardstatement ON producthazardstatements_hazardstatement_id = hazardstatement_id
+		UNION
+		SELECT productclassofcompound_product_id, 'classofcompound', classofcompound_label
+		FROM productclassofcompound JOIN classofcompound ON productclassofcompound_classofcompound_id = classofcompound_id
+	)`
+	// incompatibilitycolumns are the IncompatibilityViolation columns
+	incompatibilitycolumns = ` SELECT DISTINCT incompatibility.incompatibility_id,
+		incompatibility.incompatibility_kind1,
+		incompatibility.incompatibility_key1,
+		incompatibility.incompatibility_kind2,
+		incompatibility.incompatibility_key2,
+		incompatibility.incompatibility_level,
+		incompatibility.incompatibility_comment,
+		storelocation.storelocation_id,
+		storelocation.storelocation_fullpath,
+		n1.name_label AS name1_label,
+		s2.storage_id AS storage2_id,
+		n2.name_label AS name2_label,`
+	// incompatibilityjoin matches the k1 and k2 product keys against the rules
+	// in both directions
+	incompatibilityjoin = ` JOIN incompatibility ON
+		(incompatibility_kind1 = k1.pkind AND incompatibility_key1 = k1.pkey AND incompatibility_kind2 = k2.pkind AND incompatibility_key2 = k2.pkey) OR
+		(incompatibility_kind1 = k2.pkind AND incompatibility_key1 = k2.pkey AND incompatibility_kind2 = k1.pkind AND incompatibility_key2 = k1.pkey)`
+)
+
+// GetIncompatibilities returns the incompatibility rules matching the search criteria
+func (db *SQLiteDataStore) GetIncompatibilities(p helpers.Dbselectparam) ([]Incompatibility, int, error) {
+	var (
+		incompatibilities                  []Incompatibility
+		count                              int
+		precreq, presreq, comreq, postsreq strings.Builder
+		cnstmt                             *sqlx.NamedStmt
+		snstmt                             *sqlx.NamedStmt
+		err                                error
+	)
+
+	precreq.WriteString(" SELECT count(DISTINCT incompatibility.incompatibility_id)")
+	presreq.WriteString(` SELECT incompatibility_id, incompatibility_kind1, incompatibility_key1,
+	incompatibility_kind2, incompatibility_key2, incompatibility_level, incompatibility_comment`)
+
+	comreq.WriteString(" FROM incompatibility")
+	comreq.WriteString(" WHERE incompatibility_key1 LIKE :search OR incompatibility_key2 LIKE :search")
+	postsreq.WriteString(" ORDER BY incompatibility_key1 " + p.GetOrder() + ", incompatibility_key2 " + p.GetOrder())
+
+	// limit
+	if p.GetLimit() != constants.MaxUint64 {
+		postsreq.WriteString(" LIMIT :limit OFFSET :offset")
+	}
+
+	// building count and select statements
+	if cnstmt, err = db.PrepareNamed(precreq.String() + comreq.String()); err != nil {
+		return nil, 0, err
+	}
+	if snstmt, err = db.PrepareNamed(presreq.String() + comreq.String() + postsreq.String()); err != nil {
+		return nil, 0, err
+	}
+
+	// building argument map
+	m := map[string]interface{}{
+		"search": p.GetSearch(),
+		"order":  p.GetOrder(),
+		"limit":  p.GetLimit(),
+		"offset": p.GetOffset(),
+	}
+
+	// select
+	if err = snstmt.Select(&incompatibilities, m); err != nil {
+		return nil, 0, err
+	}
+	// count
+	if err = cnstmt.Get(&count, m); err != nil {
+		return nil, 0, err
+	}
+
+	log.WithFields(log.Fields{"incompatibilities": incompatibilities}).Debug("GetIncompatibilities")
+	return incompatibilities, count, nil
+}
+
+// GetIncompatibility returns the incompatibility rule with the given id
+func (db *SQLiteDataStore) GetIncompatibility(id int) (Incompatibility, error) {
+	var (
+		incompatibility Incompatibility
+		sqlr            string
+		err             error
+	)
+
+	sqlr = `SELECT incompatibility_id, incompatibility_kind1, incompatibility_key1,
+	incompatibility_kind2, incompatibility_key2, incompatibility_level, incompatibility_comment
+	FROM incompatibility
+	WHERE incompatibility_id = ?`
+	if err = db.Get(&incompatibility, sqlr, id); err != nil {
+		return Incompatibility{}, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "incompatibility": incompatibility}).Debug("GetIncompatibility")
+	return incompatibility, nil
+}
+
+// DeleteIncompatibility deletes the incompatibility rule with the given id
+func (db *SQLiteDataStore) DeleteIncompatibility(id int) error {
+	var (
+		sqlr string
+		err  error
+	)
+	sqlr = `DELETE FROM incompatibility
+	WHERE incompatibility_id = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateIncompatibility creates the given incompatibility rule
+func (db *SQLiteDataStore) CreateIncompatibility(i Incompatibility) (int, error) {
+	var (
+		sqlr   string
+		res    sql.Result
+		lastid int64
+		err    error
+	)
+
+	sqlr = `INSERT INTO incompatibility(incompatibility_kind1, incompatibility_key1,
+	incompatibility_kind2, incompatibility_key2, incompatibility_level, incompatibility_comment)
+	VALUES (?, ?, ?, ?, ?, ?)`
+	if res, err = db.Exec(sqlr, i.IncompatibilityKind1, strings.ToUpper(i.IncompatibilityKey1),
+		i.IncompatibilityKind2, strings.ToUpper(i.IncompatibilityKey2),
+		i.IncompatibilityLevel, i.IncompatibilityComment); err != nil {
+		return 0, err
+	}
+
+	// getting the last inserted id
+	if lastid, err = res.LastInsertId(); err != nil {
+		return 0, err
+	}
+
+	return int(lastid), nil
+}
+
+// UpdateIncompatibility updates the given incompatibility rule
+func (db *SQLiteDataStore) UpdateIncompatibility(i Incompatibility) error {
+	var (
+		sqlr string
+		err  error
+	)
+
+	sqlr = `UPDATE incompatibility SET incompatibility_kind1 = ?, incompatibility_key1 = ?,
+	incompatibility_kind2 = ?, incompatibility_key2 = ?, incompatibility_level = ?, incompatibility_comment = ?
+	WHERE incompatibility_id = ?`
+	if _, err = db.Exec(sqlr, i.IncompatibilityKind1, strings.ToUpper(i.IncompatibilityKey1),
+		i.IncompatibilityKind2, strings.ToUpper(i.IncompatibilityKey2),
+		i.IncompatibilityLevel, i.IncompatibilityComment, i.IncompatibilityID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetStorageIncompatibilities returns the incompatibilities between the storage s
+// and the other storages of its store location
+func (db *SQLiteDataStore) GetStorageIncompatibilities(s Storage) ([]IncompatibilityViolation, error) {
+	var (
+		violations []IncompatibilityViolation
+		sqlr       string
+		storageid  int64
+		snstmt     *sqlx.NamedStmt
+		err        error
+	)
+
+	// s is not yet created
+	storageid = -1
+	if s.StorageID.Valid {
+		storageid = s.StorageID.Int64
+	}
+
+	sqlr = productkeys + incompatibilitycolumns + `
+	:storage AS storage1_id
+	FROM storage AS s2
+	JOIN storelocation ON s2.storelocation = storelocation.storelocation_id
+	JOIN product AS p1 ON p1.product_id = :product
+	JOIN name AS n1 ON p1.name = n1.name_id
+	JOIN product AS p2 ON s2.product = p2.product_id
+	JOIN name AS n2 ON p2.name = n2.name_id
+	JOIN productkey AS k1 ON k1.product_id = p1.product_id
+	JOIN productkey AS k2 ON k2.product_id = p2.product_id` +
+		incompatibilityjoin + `
+	WHERE s2.storelocation = :storelocation AND
+	s2.storage_id != :storage AND
+	s2.product != :product AND
+	s2.storage IS NULL AND
+	s2.storage_archive = false
+	ORDER BY incompatibility_level, storage2_id`
+
+	if snstmt, err = db.PrepareNamed(sqlr); err != nil {
+		return nil, err
+	}
+
+	m := map[string]interface{}{
+		"storage":       storageid,
+		"product":       s.ProductID,
+		"storelocation": s.StoreLocationID.Int64,
+	}
+	if err = snstmt.Select(&violations, m); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{"s": s.StorageID, "violations": violations}).Debug("GetStorageIncompatibilities")
+	return violations, nil
+}
+
+// GetEntityIncompatibilities returns the incompatibilities between the storages
+// of each store location of the entity with the given id
+func (db *SQLiteDataStore) GetEntityIncompatibilities(id int) ([]IncompatibilityViolation, error) {
+	var (
+		violations []IncompatibilityViolation
+		sqlr       string
+		err        error
+	)
+
+	sqlr = productkeys + incompatibilitycolumns + `
+	s1.storage_id AS storage1_id
+	FROM storage AS s1
+	JOIN storage AS s2 ON s1.storelocation = s2.storelocation AND s1.storage_id < s2.storage_id
+	JOIN storelocation ON s1.storelocation = storelocation.storelocation_id
+	JOIN product AS p1 ON s1.product = p1.product_id
+	JOIN name AS n1 ON p1.name = n1.name_id
+	JOIN product AS p2 ON s2.product = p2.product_id
+	JOIN name AS n2 ON p2.name = n2.name_id
+	JOIN productkey AS k1 ON k1.product_id = p1.product_id
+	JOIN productkey AS k2 ON k2.product_id = p2.product_id` +
+		incompatibilityjoin + `
+	WHERE storelocation.entity = ? AND
+	s1.product != s2.product AND
+	s1.storage IS NULL AND s2.storage IS NULL AND
+	s1.storage_archive = false AND s2.storage_archive = false
+	ORDER BY storelocation.storelocation_fullpath, storage1_id, storage2_id`
+
+	if err = db.Select(&violations, sqlr, id); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "violations": violations}).Debug("GetEntityIncompatibilities")
+	return violations, nil
+}
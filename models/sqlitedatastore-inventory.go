@@ -0,0 +1,372 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrInventoryOpen is returned when opening a campaign while another one is open in the entity
+	ErrInventoryOpen = errors.New("an inventory campaign is already open in the entity")
+	// ErrInventoryNotOpen is returned when scanning in a closed campaign
+	ErrInventoryNotOpen = errors.New("the inventory campaign is not open")
+	// ErrInventoryStoreLocation is returned when scanning in a store location out of the campaign entity
+	ErrInventoryStoreLocation = errors.New("the store location is not in the inventory campaign entity")
+)
+
+// inventorySelect is the common inventory campaigns select query
+const inventorySelect = `SELECT inventory_id, inventory_status, inventory_creationdate, inventory_closedate,
+	entity.entity_id, entity.entity_name,
+	person.person_id, person.person_email,
+	(SELECT count(*) FROM inventoryscan WHERE inventoryscan.inventory = inventory.inventory_id) AS inventoryscan_count
+	FROM inventory
+	JOIN entity ON inventory.entity = entity.entity_id
+	JOIN person ON inventory.person = person.person_id`
+
+// inventoryMissing selects the current storages of the inventory ?1 entity not scanned
+const inventoryMissing = `SELECT storage.storage_id FROM storage
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	WHERE storelocation.entity = (SELECT entity FROM inventory WHERE inventory_id = ?1) AND
+	storage.storage IS NULL AND storage.storage_archive = false AND
+	storage.storage_id NOT IN (SELECT storage FROM inventoryscan WHERE inventory = ?1 AND storage IS NOT NULL)`
+
+// inventoryMisplaced selects the storages of the inventory ?1 entity scanned in another store location
+const inventoryMisplaced = `SELECT storage.storage_id FROM inventoryscan
+	JOIN storage ON inventoryscan.storage = storage.storage_id
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	WHERE inventoryscan.inventory = ?1 AND storage.storelocation != inventoryscan.storelocation AND
+	storelocation.entity = (SELECT entity FROM inventory WHERE inventory_id = ?1)`
+
+// CreateInventory opens the inventory campaign i and returns its id
+func (db *SQLiteDataStore) CreateInventory(i Inventory) (int, error) {
+	var (
+		tx     *sqlx.Tx
+		res    sql.Result
+		lastid int64
+		c      int
+		err    error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+
+	sqlr := `SELECT count(*) FROM inventory WHERE entity = ? AND inventory_status = "open"`
+	if err = tx.Get(&c, sqlr, i.EntityID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if c != 0 {
+		tx.Rollback()
+		return 0, ErrInventoryOpen
+	}
+
+	sqlr = `INSERT INTO inventory (inventory_status, inventory_creationdate, entity, person) VALUES ("open", ?, ?, ?)`
+	if res, err = tx.Exec(sqlr, time.Now(), i.EntityID, i.PersonID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if lastid, err = res.LastInsertId(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{"i": i, "lastid": lastid}).Debug("CreateInventory")
+	return int(lastid), nil
+}
+
+// GetInventory returns the inventory campaign with id "id"
+func (db *SQLiteDataStore) GetInventory(id int) (Inventory, error) {
+	var (
+		i   Inventory
+		err error
+	)
+
+	if err = db.Get(&i, inventorySelect+` WHERE inventory_id = ?`, id); err != nil {
+		return Inventory{}, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "i": i}).Debug("GetInventory")
+	return i, nil
+}
+
+// GetEntityInventories returns the inventory campaigns of the entity with id "id", the most recent first
+func (db *SQLiteDataStore) GetEntityInventories(id int) ([]Inventory, error) {
+	var (
+		is  []Inventory
+		err error
+	)
+
+	sqlr := inventorySelect + ` WHERE inventory.entity = ? ORDER BY inventory_creationdate DESC, inventory_id DESC`
+	if err = db.Select(&is, sqlr, id); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "is": len(is)}).Debug("GetEntityInventories")
+	return is, nil
+}
+
+// CloseInventory closes the open inventory campaign with id "id"
+func (db *SQLiteDataStore) CloseInventory(id int) error {
+	var (
+		res sql.Result
+		n   int64
+		err error
+	)
+
+	sqlr := `UPDATE inventory SET inventory_status = "closed", inventory_closedate = ?
+	WHERE inventory_id = ? AND inventory_status = "open"`
+	if res, err = db.Exec(sqlr, time.Now(), id); err != nil {
+		return err
+	}
+	if n, err = res.RowsAffected(); err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInventoryNotOpen
+	}
+
+	log.WithFields(log.Fields{"id": id}).Debug("CloseInventory")
+	return nil
+}
+
+// CreateInventoryScan records the scan s of a storage barecode or QR code in the open campaign,
+// recognizing its storage, and returns it. A code scanned again replaces its former scan.
+func (db *SQLiteDataStore) CreateInventoryScan(s InventoryScan) (InventoryScan, error) {
+	var (
+		tx        *sqlx.Tx
+		inventory Inventory
+		entityid  int
+		storageid int
+		err       error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return InventoryScan{}, err
+	}
+
+	if err = tx.Get(&inventory, inventorySelect+` WHERE inventory_id = ?`, s.InventoryID); err != nil {
+		tx.Rollback()
+		return InventoryScan{}, err
+	}
+	if inventory.InventoryStatus != "open" {
+		tx.Rollback()
+		return InventoryScan{}, ErrInventoryNotOpen
+	}
+	if err = tx.Get(&entityid, `SELECT entity FROM storelocation WHERE storelocation_id = ?`, s.StoreLocationID); err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return InventoryScan{}, err
+	}
+	if entityid != inventory.EntityID {
+		tx.Rollback()
+		return InventoryScan{}, ErrInventoryStoreLocation
+	}
+
+	// barecodes are looked for in the campaign entity first
+	if storageid, err = storageIDByCode(tx, s.InventoryScanCode, []int{inventory.EntityID}); err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return InventoryScan{}, err
+	}
+	s.StorageID = sql.NullInt64{Valid: storageid != 0, Int64: int64(storageid)}
+	s.InventoryScanDate = time.Now()
+
+	sqlr := `INSERT INTO inventoryscan (inventoryscan_code, inventoryscan_date, inventory, storelocation, storage, person)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(inventory, inventoryscan_code) DO UPDATE SET inventoryscan_date = excluded.inventoryscan_date,
+	storelocation = excluded.storelocation, storage = excluded.storage, person = excluded.person`
+	if _, err = tx.Exec(sqlr, s.InventoryScanCode, s.InventoryScanDate, s.InventoryID, s.StoreLocationID, s.StorageID, s.PersonID); err != nil {
+		tx.Rollback()
+		return InventoryScan{}, err
+	}
+	sqlr = `SELECT inventoryscan_id FROM inventoryscan WHERE inventory = ? AND inventoryscan_code = ?`
+	if err = tx.Get(&s.InventoryScanID, sqlr, s.InventoryID, s.InventoryScanCode); err != nil {
+		tx.Rollback()
+		return InventoryScan{}, err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return InventoryScan{}, err
+	}
+
+	log.WithFields(log.Fields{"s": s}).Debug("CreateInventoryScan")
+	return s, nil
+}
+
+// GetInventoryReport returns the found, missing, misplaced, unknown and foreign items
+// of the inventory campaign with id "id"
+func (db *SQLiteDataStore) GetInventoryReport(id int) (InventoryReport, error) {
+	var (
+		r       InventoryReport
+		scanned []InventoryItem
+		err     error
+	)
+
+	if r.Inventory, err = db.GetInventory(id); err != nil {
+		return InventoryReport{}, err
+	}
+
+	sqlr := `SELECT inventoryscan_id, inventoryscan_code,
+	storage.storage_id, storage.storage_barecode, name.name_label,
+	storelocation.storelocation_id, storelocation.storelocation_fullpath AS storelocation_name, storelocation.entity AS entity_id,
+	scanned.storelocation_id AS scanned_storelocation_id, scanned.storelocation_fullpath AS scanned_storelocation_name
+	FROM inventoryscan
+	JOIN storelocation AS scanned ON inventoryscan.storelocation = scanned.storelocation_id
+	LEFT JOIN storage ON inventoryscan.storage = storage.storage_id
+	LEFT JOIN product ON storage.product = product.product_id
+	LEFT JOIN name ON product.name = name.name_id
+	LEFT JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	WHERE inventoryscan.inventory = ?
+	ORDER BY scanned.storelocation_fullpath, inventoryscan_code`
+	if err = db.Select(&scanned, sqlr, id); err != nil {
+		return InventoryReport{}, err
+	}
+	for _, s := range scanned {
+		switch {
+		case !s.StorageID.Valid:
+			r.Unknown = append(r.Unknown, s)
+		case s.EntityID.Int64 != int64(r.Inventory.EntityID):
+			// can not be moved without a transfer
+			r.Foreign = append(r.Foreign, s)
+		case s.StoreLocationID == s.ScannedStoreLocationID:
+			r.Found = append(r.Found, s)
+		default:
+			r.Misplaced = append(r.Misplaced, s)
+		}
+	}
+
+	sqlr = `SELECT storage.storage_id, storage.storage_barecode, name.name_label,
+	storelocation.storelocation_id, storelocation.storelocation_fullpath AS storelocation_name
+	FROM storage
+	JOIN product ON storage.product = product.product_id
+	JOIN name ON product.name = name.name_id
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	WHERE storage.storage_id IN (` + inventoryMissing + `)
+	ORDER BY storelocation.storelocation_fullpath, storage.storage_barecode`
+	if err = db.Select(&r.Missing, sqlr, id); err != nil {
+		return InventoryReport{}, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "found": len(r.Found), "missing": len(r.Missing), "misplaced": len(r.Misplaced), "unknown": len(r.Unknown), "foreign": len(r.Foreign)}).Debug("GetInventoryReport")
+	return r, nil
+}
+
+// ArchiveInventoryMissing archives the storages not scanned during the inventory campaign
+// with id "id" and returns their number
+func (db *SQLiteDataStore) ArchiveInventoryMissing(id int) (int, error) {
+	var (
+		tx  *sqlx.Tx
+		ids []int
+		err error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Select(&ids, inventoryMissing, id); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	for _, sid := range ids {
+		// with their history
+		sqlr := `UPDATE storage SET storage_archive = true WHERE storage_id = ? OR storage.storage = ?`
+		if _, err = tx.Exec(sqlr, sid, sid); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "ids": ids}).Debug("ArchiveInventoryMissing")
+	return len(ids), nil
+}
+
+// MoveInventoryMisplaced moves the storages "ids" of the campaign entity scanned in another store location
+// during the inventory campaign with id "id" to this store location, for the person "personid",
+// and returns their number. The moved storages are kept in their history as by UpdateStorage.
+func (db *SQLiteDataStore) MoveInventoryMisplaced(id int, personid int, ids []int) (int, error) {
+	var (
+		tx        *sqlx.Tx
+		misplaced []int
+		moved     []int
+		err       error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Select(&misplaced, inventoryMisplaced, id); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	checked := make(map[int]bool)
+	for _, sid := range ids {
+		checked[sid] = true
+	}
+	now := time.Now()
+	for _, sid := range misplaced {
+		// the storages scanned since their checks are left misplaced
+		if !checked[sid] {
+			continue
+		}
+		if err = insertStorageHistory(tx, int64(sid)); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		sqlr := `UPDATE storage SET storage_modificationdate = ?1, storage_modifiedby = ?2,
+		storelocation = (SELECT storelocation FROM inventoryscan WHERE inventory = ?3 AND storage = ?4)
+		WHERE storage_id = ?4`
+		if _, err = tx.Exec(sqlr, now, personid, id, sid); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		moved = append(moved, sid)
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "moved": moved}).Debug("MoveInventoryMisplaced")
+	return len(moved), nil
+}
+
+// UpdateInventoryScanStorage links the unknown scan with id scanid to the storage
+// with id storageid created for it
+func (db *SQLiteDataStore) UpdateInventoryScanStorage(scanid int, storageid int) error {
+	var err error
+
+	sqlr := `UPDATE inventoryscan SET storage = ? WHERE inventoryscan_id = ?`
+	if _, err = db.Exec(sqlr, storageid, scanid); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"scanid": scanid, "storageid": storageid}).Debug("UpdateInventoryScanStorage")
+	return nil
+}
@@ -465,6 +465,42 @@ func (db *SQLiteDataStore) DeletePerson(id int) error {
 	if _, err = db.Exec(sqlr, admin.PersonID, id); err != nil {
 		return err
 	}
+	sqlr = `UPDATE storage SET storage_modifiedby = ? WHERE storage_modifiedby = ?`
+	if _, err = db.Exec(sqlr, admin.PersonID, id); err != nil {
+		return err
+	}
+
+	// updating consumptions ownership to admin
+	sqlr = `UPDATE consumption SET person = ? WHERE person = ?`
+	if _, err = db.Exec(sqlr, admin.PersonID, id); err != nil {
+		return err
+	}
+
+	// updating transfers ownership to admin
+	sqlr = `UPDATE transfer SET person = ? WHERE person = ?`
+	if _, err = db.Exec(sqlr, admin.PersonID, id); err != nil {
+		return err
+	}
+	sqlr = `UPDATE transfer SET decider = ? WHERE decider = ?`
+	if _, err = db.Exec(sqlr, admin.PersonID, id); err != nil {
+		return err
+	}
+
+	// updating borrow requests and purchases ownership to admin
+	for _, sqlr = range []string{
+		`UPDATE purchase SET person = ? WHERE person = ?`,
+		`UPDATE purchase SET approver = ? WHERE approver = ?`,
+		`UPDATE disposal SET person = ? WHERE person = ?`,
+		`UPDATE inventory SET person = ? WHERE person = ?`,
+		`UPDATE inventoryscan SET person = ? WHERE person = ?`,
+		`UPDATE borrowrequest SET person = ? WHERE person = ?`,
+		`UPDATE borrowrequest SET decider = ? WHERE decider = ?`,
+		`UPDATE borrowrequestmessage SET person = ? WHERE person = ?`,
+	} {
+		if _, err = db.Exec(sqlr, admin.PersonID, id); err != nil {
+			return err
+		}
+	}
 
 	// updating product ownership to admin
 	sqlr = `UPDATE product SET person = ? WHERE person = ?`
@@ -497,6 +533,10 @@ func (db *SQLiteDataStore) DeletePerson(id int) error {
 	if _, err = db.Exec(sqlr, id); err != nil {
 		return err
 	}
+	sqlr = `UPDATE borrowing SET person = ? WHERE person = ?`
+	if _, err = db.Exec(sqlr, admin.PersonID, id); err != nil {
+		return err
+	}
 
 	sqlr = `DELETE FROM person 
 	WHERE person_id = ?`
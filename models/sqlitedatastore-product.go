@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
@@ -14,6 +15,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/tbellembois/gochimitheque/constants"
 	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/utils"
 )
 
 // IsProductBookmark returns true if there is a bookmark for the product pr for the person pe
@@ -972,8 +974,13 @@ func (db *SQLiteDataStore) GetProducts(p helpers.DbselectparamProduct) ([]Produc
 	p.product_radioactive,
 	p.product_threedformula,
 	p.product_molformula,
+	p.product_smiles,
+	p.product_inchi,
+	p.product_inchikey,
 	p.product_disposalcomment,
 	p.product_remark,
+	p.product_shelflifereception,
+	p.product_shelflifeopening,
 	linearformula.linearformula_id AS "linearformula.linearformula_id",
 	linearformula.linearformula_label AS "linearformula.linearformula_label",
 	empiricalformula.empiricalformula_id AS "empiricalformula.empiricalformula_id",
@@ -1087,6 +1094,15 @@ func (db *SQLiteDataStore) GetProducts(p helpers.DbselectparamProduct) ([]Produc
 	if p.GetCustomNamePartOf() != "" {
 		comreq.WriteString(" AND name.name_label LIKE :custom_name_part_of")
 	}
+	if p.GetProductSmiles() != "" {
+		comreq.WriteString(" AND p.product_smiles = :product_smiles")
+	}
+	if p.GetProductInchi() != "" {
+		comreq.WriteString(" AND p.product_inchi = :product_inchi")
+	}
+	if p.GetProductInchiKey() != "" {
+		comreq.WriteString(" AND p.product_inchikey = :product_inchikey")
+	}
 	if len(p.GetSymbols()) != 0 {
 		comreq.WriteString(" AND ps.productsymbols_symbol_id IN (")
 		for _, s := range p.GetSymbols() {
@@ -1154,6 +1170,9 @@ func (db *SQLiteDataStore) GetProducts(p helpers.DbselectparamProduct) ([]Produc
 		"casnumber":           p.GetCasNumber(),
 		"empiricalformula":    p.GetEmpiricalFormula(),
 		"product_specificity": p.GetProductSpecificity(),
+		"product_smiles":      p.GetProductSmiles(),
+		"product_inchi":       p.GetProductInchi(),
+		"product_inchikey":    p.GetProductInchiKey(),
 		"storage_barecode":    p.GetStorageBarecode(),
 		"custom_name_part_of": "%" + p.GetCustomNamePartOf() + "%",
 		"signalword":          p.GetSignalWord(),
@@ -1266,6 +1285,15 @@ func (db *SQLiteDataStore) GetProducts(p helpers.DbselectparamProduct) ([]Produc
 		}
 	}
 
+	//
+	// getting mixtures components
+	//
+	for i, pr := range products {
+		if products[i].Components, err = getProductComponents(db, pr.ProductID); err != nil {
+			return nil, 0, err
+		}
+	}
+
 	//
 	// getting number of storages for each product
 	//
@@ -1331,8 +1359,13 @@ func (db *SQLiteDataStore) GetProduct(id int) (Product, error) {
 	product_radioactive,
 	product_threedformula,
 	product_molformula,
+	product_smiles,
+	product_inchi,
+	product_inchikey,
 	product_disposalcomment,
 	product_remark,
+	product_shelflifereception,
+	product_shelflifeopening,
 	linearformula.linearformula_id AS "linearformula.linearformula_id",
 	linearformula.linearformula_label AS "linearformula.linearformula_label",
 	empiricalformula.empiricalformula_id AS "empiricalformula.empiricalformula_id",
@@ -1419,6 +1452,13 @@ func (db *SQLiteDataStore) GetProduct(id int) (Product, error) {
 		return product, err
 	}
 
+	//
+	// getting mixture components
+	//
+	if product.Components, err = getProductComponents(db, product.ProductID); err != nil {
+		return product, err
+	}
+
 	log.WithFields(log.Fields{"id": id, "product": product}).Debug("GetProduct")
 	return product, nil
 }
@@ -1430,6 +1470,29 @@ func (db *SQLiteDataStore) DeleteProduct(id int) error {
 		err  error
 	)
 	log.WithFields(log.Fields{"id": id}).Debug("DeleteProduct")
+	// deleting stock thresholds, supplier references and purchases
+	sqlr = `DELETE FROM stockthreshold WHERE product = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM supplierref WHERE product = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM purchase WHERE product = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+	// deleting borrow requests
+	sqlr = `DELETE FROM borrowrequestmessage WHERE borrowrequest IN (SELECT borrowrequest_id FROM borrowrequest WHERE product = ?)`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM borrowrequest WHERE product = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+
 	// deleting symbols
 	sqlr = `DELETE FROM productsymbols WHERE productsymbols.productsymbols_product_id = (?)`
 	if _, err = db.Exec(sqlr, id); err != nil {
@@ -1460,6 +1523,12 @@ func (db *SQLiteDataStore) DeleteProduct(id int) error {
 		return err
 	}
 
+	// deleting mixture components, and the product from the mixtures
+	sqlr = `DELETE FROM productcomponent WHERE product = ?1 OR component = ?1`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+
 	// deleting product
 	sqlr = `DELETE FROM product WHERE product_id = ?`
 	if _, err = db.Exec(sqlr, id); err != nil {
@@ -1656,6 +1725,12 @@ func (db *SQLiteDataStore) CreateProduct(p Product) (int, error) {
 	if p.ProductRemark.Valid {
 		s["product_remark"] = p.ProductRemark.String
 	}
+	if p.ProductShelfLifeReception.Valid {
+		s["product_shelflifereception"] = int(p.ProductShelfLifeReception.Int64)
+	}
+	if p.ProductShelfLifeOpening.Valid {
+		s["product_shelflifeopening"] = int(p.ProductShelfLifeOpening.Int64)
+	}
 	if p.LinearFormulaID.Valid {
 		s["linearformula"] = int(p.LinearFormulaID.Int64)
 	}
@@ -1671,6 +1746,15 @@ func (db *SQLiteDataStore) CreateProduct(p Product) (int, error) {
 	if p.ProductMolFormula.Valid {
 		s["product_molformula"] = p.ProductMolFormula.String
 	}
+	if p.ProductSmiles.Valid {
+		s["product_smiles"] = p.ProductSmiles.String
+	}
+	if p.ProductInchi.Valid {
+		s["product_inchi"] = p.ProductInchi.String
+	}
+	if p.ProductInchiKey.Valid {
+		s["product_inchikey"] = p.ProductInchiKey.String
+	}
 	s["casnumber"] = p.CasNumberID
 	s["name"] = p.NameID
 	s["empiricalformula"] = p.EmpiricalFormulaID
@@ -1762,6 +1846,11 @@ func (db *SQLiteDataStore) CreateProduct(p Product) (int, error) {
 			return 0, err
 		}
 	}
+	// adding mixture components
+	if err = setProductComponents(tx, p); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
 
 	// committing changes
 	if err = tx.Commit(); err != nil {
@@ -1944,6 +2033,9 @@ func (db *SQLiteDataStore) UpdateProduct(p Product) error {
 	if p.ProductRemark.Valid {
 		s["product_remark"] = p.ProductRemark.String
 	}
+	// the shelf-lives are cleared if not set
+	s["product_shelflifereception"] = p.ProductShelfLifeReception
+	s["product_shelflifeopening"] = p.ProductShelfLifeOpening
 	if p.LinearFormulaID.Valid {
 		s["linearformula"] = int(p.LinearFormulaID.Int64)
 	}
@@ -1959,6 +2051,15 @@ func (db *SQLiteDataStore) UpdateProduct(p Product) error {
 	if p.ProductMolFormula.Valid {
 		s["product_molformula"] = p.ProductMolFormula.String
 	}
+	if p.ProductSmiles.Valid {
+		s["product_smiles"] = p.ProductSmiles.String
+	}
+	if p.ProductInchi.Valid {
+		s["product_inchi"] = p.ProductInchi.String
+	}
+	if p.ProductInchiKey.Valid {
+		s["product_inchikey"] = p.ProductInchiKey.String
+	}
 	s["casnumber"] = p.CasNumberID
 	s["name"] = p.NameID
 	s["empiricalformula"] = p.EmpiricalFormulaID
@@ -2056,11 +2157,270 @@ func (db *SQLiteDataStore) UpdateProduct(p Product) error {
 		}
 	}
 
+	// replacing mixture components
+	if err = setProductComponents(tx, p); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// normalizeProductName returns the n name in upper case without non alphanumeric characters
+// for the duplicates detection
+func normalizeProductName(n string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, strings.ToUpper(n))
+}
+
+// normalizeMolFormula returns the m MOL block without its header block
+// (name, program and comment lines) for the duplicates detection
+func normalizeMolFormula(m string) string {
+	lines := strings.Split(strings.Replace(m, "\r\n", "\n", -1), "\n")
+	if len(lines) <= 3 {
+		return ""
+	}
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return strings.TrimSpace(strings.Join(lines[3:], "\n"))
+}
+
+// GetProductsDuplicates returns the groups of products suspected to be duplicates:
+// same cas number and specificity, same empirical formula and similar names
+// or same MOL formula
+func (db *SQLiteDataStore) GetProductsDuplicates() ([]ProductDuplicate, error) {
+	var (
+		products   []Product
+		duplicates []ProductDuplicate
+		sqlr       string
+		err        error
+	)
+
+	sqlr = `SELECT product.product_id,
+	product.product_specificity,
+	product.product_molformula,
+	name.name_id AS "name.name_id",
+	name.name_label AS "name.name_label",
+	IFNULL(casnumber.casnumber_id, 0) AS "casnumber.casnumber_id",
+	IFNULL(casnumber.casnumber_label, '') AS "casnumber.casnumber_label",
+	empiricalformula.empiricalformula_id AS "empiricalformula.empiricalformula_id",
+	empiricalformula.empiricalformula_label AS "empiricalformula.empiricalformula_label"
+	FROM product
+	JOIN name ON product.name = name.name_id
+	LEFT JOIN casnumber ON product.casnumber = casnumber.casnumber_id
+	JOIN empiricalformula ON product.empiricalformula = empiricalformula.empiricalformula_id
+	ORDER BY product.product_id`
+	if err = db.Select(&products, sqlr); err != nil {
+		return nil, err
+	}
+
+	// grouping the products by cas number and specificity, empirical formula and MOL formula
+	bycas := make(map[string][]Product)
+	byef := make(map[string][]Product)
+	bymol := make(map[string][]Product)
+	var cass, efs, mols []string
+	for _, p := range products {
+		if p.CasNumberLabel != "" && p.CasNumberLabel != "0000" {
+			k := p.CasNumberLabel + "|" + p.ProductSpecificity.String
+			if _, ok := bycas[k]; !ok {
+				cass = append(cass, k)
+			}
+			bycas[k] = append(bycas[k], p)
+		}
+		if p.EmpiricalFormulaLabel != "XXXX" {
+			k := p.EmpiricalFormulaLabel
+			if _, ok := byef[k]; !ok {
+				efs = append(efs, k)
+			}
+			byef[k] = append(byef[k], p)
+		}
+		if k := normalizeMolFormula(p.ProductMolFormula.String); k != "" {
+			if _, ok := bymol[k]; !ok {
+				mols = append(mols, k)
+			}
+			bymol[k] = append(bymol[k], p)
+		}
+	}
+
+	for _, k := range cass {
+		if len(bycas[k]) > 1 {
+			duplicates = append(duplicates, ProductDuplicate{Reason: "casnumber", Products: bycas[k]})
+		}
+	}
+	for _, k := range efs {
+		// clustering the products with similar names
+		ps := byef[k]
+		group := make([]int, len(ps))
+		for i := range ps {
+			group[i] = i
+		}
+		for i := range ps {
+			for j := i + 1; j < len(ps); j++ {
+				ni, nj := normalizeProductName(ps[i].NameLabel), normalizeProductName(ps[j].NameLabel)
+				d := utils.Levenshtein(ni, nj)
+				if d <= 2 && d*5 <= len(ni) && group[j] == j {
+					group[j] = group[i]
+				}
+			}
+		}
+		for i := range ps {
+			if group[i] != i {
+				continue
+			}
+			dup := ProductDuplicate{Reason: "empiricalformula"}
+			for j := range ps {
+				if group[j] == i {
+					dup.Products = append(dup.Products, ps[j])
+				}
+			}
+			if len(dup.Products) > 1 {
+				duplicates = append(duplicates, dup)
+			}
+		}
+	}
+	for _, k := range mols {
+		if len(bymol[k]) > 1 {
+			duplicates = append(duplicates, ProductDuplicate{Reason: "molformula", Products: bymol[k]})
+		}
+	}
+
+	log.WithFields(log.Fields{"duplicates": len(duplicates)}).Debug("GetProductsDuplicates")
+	return duplicates, nil
+}
+
+// GetProductsMerges returns the product merges history
+func (db *SQLiteDataStore) GetProductsMerges() ([]ProductMerge, error) {
+	var (
+		merges []ProductMerge
+		sqlr   string
+		err    error
+	)
+
+	sqlr = `SELECT productmerge_id, productmerge_date,
+	productmerge_from_id, productmerge_from_name,
+	productmerge_to_id, productmerge_to_name,
+	person.person_id AS "person.person_id",
+	person.person_email AS "person.person_email"
+	FROM productmerge
+	JOIN person ON productmerge.person = person.person_id
+	ORDER BY productmerge_date DESC`
+	if err = db.Select(&merges, sqlr); err != nil {
+		return nil, err
+	}
+
+	return merges, nil
+}
+
+// MergeProduct merges the product with id from into the product with id to:
+// storages, bookmarks, synonyms, symbols, classes of compound, statements
+// and mixtures components are moved and the from product is deleted
+func (db *SQLiteDataStore) MergeProduct(from int, to int, personid int) error {
+	var (
+		tx       *sqlx.Tx
+		sqlr     string
+		fromname string
+		toname   string
+		err      error
+	)
+	log.WithFields(log.Fields{"from": from, "to": to}).Debug("MergeProduct")
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	sqlr = `SELECT name_label FROM product JOIN name ON product.name = name.name_id WHERE product_id = ?`
+	if err = tx.Get(&fromname, sqlr, from); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Get(&toname, sqlr, to); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, sqlr = range []string{
+		// moving storages (and their history)
+		`UPDATE storage SET product = ? WHERE product = ?`,
+		`UPDATE borrowrequest SET product = ? WHERE product = ?`,
+		`UPDATE purchase SET product = ? WHERE product = ?`,
+		// moving the stock thresholds not already set for the to product
+		`UPDATE OR IGNORE stockthreshold SET product = ? WHERE product = ?`,
+		`UPDATE supplierref SET product = ? WHERE product = ?`,
+		// moving the bookmarks of the people who did not bookmark the to product
+		`UPDATE bookmark SET product = ?1 WHERE product = ?2
+		AND person NOT IN (SELECT person FROM bookmark WHERE product = ?1)`,
+		// the from name becomes a synonym
+		`INSERT OR IGNORE INTO productsynonyms (productsynonyms_product_id, productsynonyms_name_id)
+		SELECT ?1, name FROM product WHERE product_id = ?2`,
+		`INSERT OR IGNORE INTO productsynonyms (productsynonyms_product_id, productsynonyms_name_id)
+		SELECT ?1, productsynonyms_name_id FROM productsynonyms WHERE productsynonyms_product_id = ?2`,
+		`INSERT OR IGNORE INTO productsymbols (productsymbols_product_id, productsymbols_symbol_id)
+		SELECT ?1, productsymbols_symbol_id FROM productsymbols WHERE productsymbols_product_id = ?2`,
+		`INSERT OR IGNORE INTO productclassofcompound (productclassofcompound_product_id, productclassofcompound_classofcompound_id)
+		SELECT ?1, productclassofcompound_classofcompound_id FROM productclassofcompound WHERE productclassofcompound_product_id = ?2`,
+		`INSERT OR IGNORE INTO producthazardstatements (producthazardstatements_product_id, producthazardstatements_hazardstatement_id)
+		SELECT ?1, producthazardstatements_hazardstatement_id FROM producthazardstatements WHERE producthazardstatements_product_id = ?2`,
+		`INSERT OR IGNORE INTO productprecautionarystatements (productprecautionarystatements_product_id, productprecautionarystatements_precautionarystatement_id)
+		SELECT ?1, productprecautionarystatements_precautionarystatement_id FROM productprecautionarystatements WHERE productprecautionarystatements_product_id = ?2`,
+		// moving the mixtures components not already set for the to product
+		`UPDATE OR IGNORE productcomponent SET product = ? WHERE product = ?`,
+		`UPDATE OR IGNORE productcomponent SET component = ? WHERE component = ?`,
+		// the to product can not be one of its components
+		`DELETE FROM productcomponent WHERE product = ?1 AND component = ?1`,
+		// the to name can not be one of its synonyms
+		`DELETE FROM productsynonyms WHERE productsynonyms_product_id = ?1
+		AND productsynonyms_name_id = (SELECT name FROM product WHERE product_id = ?1)`,
+	} {
+		if _, err = tx.Exec(sqlr, to, from); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// deleting the from product
+	for _, sqlr = range []string{
+		`DELETE FROM bookmark WHERE product = ?`,
+		`DELETE FROM stockthreshold WHERE product = ?`,
+		`DELETE FROM productsynonyms WHERE productsynonyms_product_id = ?`,
+		`DELETE FROM productsymbols WHERE productsymbols_product_id = ?`,
+		`DELETE FROM productclassofcompound WHERE productclassofcompound_product_id = ?`,
+		`DELETE FROM producthazardstatements WHERE producthazardstatements_product_id = ?`,
+		`DELETE FROM productprecautionarystatements WHERE productprecautionarystatements_product_id = ?`,
+		`DELETE FROM productcomponent WHERE product = ?1 OR component = ?1`,
+		`DELETE FROM product WHERE product_id = ?`,
+	} {
+		if _, err = tx.Exec(sqlr, from); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// logging the merge
+	sqlr = `INSERT INTO productmerge (productmerge_date, productmerge_from_id, productmerge_from_name,
+	productmerge_to_id, productmerge_to_name, person) VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err = tx.Exec(sqlr, time.Now(), from, fromname, to, toname, personid); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// committing changes
 	if err = tx.Commit(); err != nil {
 		tx.Rollback()
 		return err
 	}
 
+	log.WithFields(log.Fields{"from": from, "fromname": fromname, "to": to, "toname": toname, "personid": personid}).Info("product merged")
 	return nil
 }
@@ -0,0 +1,237 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+)
+
+var (
+	// ErrProductComponent is returned for a mixture component with a wrong concentration unit
+	// or being the mixture itself
+	ErrProductComponent = errors.New("wrong mixture component")
+	// ErrMixtureSource is returned when a preparation source storage is not a storage of a mixture component
+	ErrMixtureSource = errors.New("the source storage is not a storage of a mixture component")
+)
+
+// productComponentUnits are the concentration units of the mixtures components
+var productComponentUnits = map[string]bool{
+	"w/w":   true,
+	"v/v":   true,
+	"mol/L": true,
+}
+
+// setProductComponents replaces the components of the product p in the transaction tx
+func setProductComponents(tx sqlx.Execer, p Product) error {
+	var err error
+
+	sqlr := `DELETE FROM productcomponent WHERE product = ?`
+	if _, err = tx.Exec(sqlr, p.ProductID); err != nil {
+		return err
+	}
+	for _, c := range p.Components {
+		if c.ComponentID == p.ProductID ||
+			(c.ProductComponentConcentrationUnit.Valid && !productComponentUnits[c.ProductComponentConcentrationUnit.String]) {
+			return ErrProductComponent
+		}
+		sqlr = `INSERT INTO productcomponent (productcomponent_concentration, productcomponent_concentrationunit, productcomponent_solvent, product, component)
+		VALUES (?, ?, ?, ?, ?)`
+		if _, err = tx.Exec(sqlr, c.ProductComponentConcentration, c.ProductComponentConcentrationUnit, c.ProductComponentSolvent, p.ProductID, c.ComponentID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getProductComponents returns the components of the product with the given id
+func getProductComponents(q sqlx.Queryer, id int) ([]ProductComponent, error) {
+	var (
+		components []ProductComponent
+		err        error
+	)
+
+	sqlr := `SELECT productcomponent_id, productcomponent_concentration, productcomponent_concentrationunit, productcomponent_solvent,
+	product.product_id AS component_id, name.name_label AS component_name
+	FROM productcomponent
+	JOIN product ON productcomponent.component = product.product_id
+	JOIN name ON product.name = name.name_id
+	WHERE productcomponent.product = ?
+	ORDER BY productcomponent_solvent, name.name_label`
+	if err = sqlx.Select(q, &components, sqlr, id); err != nil {
+		return nil, err
+	}
+
+	return components, nil
+}
+
+// componentCutOff returns the concentration in percents from which the hazard statement
+// with the given reference is kept for a mixture, from the CLP generic cut-off values
+func componentCutOff(reference string) float64 {
+	// carcinogenicity, mutagenicity and reproductive toxicity
+	for _, h := range []string{"H340", "H350", "H360"} {
+		if strings.HasPrefix(reference, h) {
+			return 0.1
+		}
+	}
+	return 1
+}
+
+// GetProductClassification returns the symbols, signal word and hazard statements suggested
+// for the mixture product with the given id from the ones of its components.
+// The statements of the components with a w/w or v/v concentration under their
+// generic cut-off value are ignored, the solvent and the components without a percent
+// concentration being always kept. The symbols and signal word are inferred from the
+// kept statements with the CLP rules.
+func (db *SQLiteDataStore) GetProductClassification(id int) (ProductClassification, error) {
+	var (
+		components  []ProductComponent
+		rules       []ClpRule
+		precedences []ClpPrecedence
+		clp         ClpClassification
+		c           ProductClassification
+		err         error
+	)
+	log.WithFields(log.Fields{"id": id}).Debug("GetProductClassification")
+
+	if components, err = getProductComponents(db, id); err != nil {
+		return ProductClassification{}, err
+	}
+	if rules, precedences, err = db.getClpRules(); err != nil {
+		return ProductClassification{}, err
+	}
+
+	c.HazardStatements = []HazardStatement{}
+	statements := make(map[int]bool)
+	var references []string
+	for _, pc := range components {
+		var hs []HazardStatement
+
+		// concentration in percents, -1 if not applicable
+		concentration := -1.0
+		if !pc.ProductComponentSolvent && pc.ProductComponentConcentration.Valid &&
+			(pc.ProductComponentConcentrationUnit.String == "w/w" || pc.ProductComponentConcentrationUnit.String == "v/v") {
+			concentration = pc.ProductComponentConcentration.Float64
+		}
+
+		sqlr := `SELECT hazardstatement_id, hazardstatement_label, hazardstatement_reference FROM hazardstatement
+		JOIN producthazardstatements ON producthazardstatements.producthazardstatements_hazardstatement_id = hazardstatement.hazardstatement_id
+		WHERE producthazardstatements.producthazardstatements_product_id = ?
+		ORDER BY hazardstatement_reference`
+		if err = db.Select(&hs, sqlr, pc.ComponentID); err != nil {
+			return ProductClassification{}, err
+		}
+		for _, h := range hs {
+			if concentration >= 0 && concentration < componentCutOff(h.HazardStatementReference) {
+				continue
+			}
+			if !statements[h.HazardStatementID] {
+				statements[h.HazardStatementID] = true
+				c.HazardStatements = append(c.HazardStatements, h)
+				references = append(references, h.HazardStatementReference)
+			}
+		}
+	}
+
+	symbols, signalword := inferClp(rules, precedences, references)
+	if clp, err = db.buildClpClassification(symbols, signalword); err != nil {
+		return ProductClassification{}, err
+	}
+	c.Symbols = clp.Symbols
+	c.SignalWord = clp.SignalWord
+
+	return c, nil
+}
+
+// PrepareMixture creates a storage of the mixture product of the preparation p,
+// withdrawing the quantities of its source storages as consumptions, and returns its id.
+// The sources must be storages of the mixture components.
+func (db *SQLiteDataStore) PrepareMixture(p MixturePreparation) (int, error) {
+	var (
+		tx         *sqlx.Tx
+		err        error
+		id         int
+		barecode   string
+		components []ProductComponent
+	)
+	log.WithFields(log.Fields{"p": p}).Debug("PrepareMixture")
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+
+	if components, err = getProductComponents(tx, p.ProductID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	iscomponent := make(map[int]bool)
+	for _, c := range components {
+		iscomponent[c.ComponentID] = true
+	}
+
+	now := time.Now()
+	s := Storage{
+		StorageCreationDate:     now,
+		StorageModificationDate: now,
+		StorageEntryDate:        global.NullTime{Valid: true, Time: now},
+		StorageQuantity:         sql.NullFloat64{Valid: true, Float64: p.StorageQuantity},
+		Person:                  Person{PersonID: p.PersonID},
+		Product:                 Product{ProductID: p.ProductID},
+		StoreLocation:           StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(p.StoreLocationID)}},
+		Unit:                    Unit{UnitID: p.UnitID},
+	}
+	if id, err = createStorage(tx, s); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	sqlr := `SELECT storage_barecode FROM storage WHERE storage_id = ?`
+	if err = tx.Get(&barecode, sqlr, id); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	for _, src := range p.Sources {
+		var product int
+
+		sqlr = `SELECT product FROM storage WHERE storage_id = ? AND storage IS NULL AND NOT storage_archive`
+		if err = tx.Get(&product, sqlr, src.StorageID); err != nil {
+			tx.Rollback()
+			if err == sql.ErrNoRows {
+				return 0, ErrMixtureSource
+			}
+			return 0, err
+		}
+		if !iscomponent[product] {
+			tx.Rollback()
+			return 0, ErrMixtureSource
+		}
+
+		c := Consumption{
+			ConsumptionQuantity: src.Quantity,
+			ConsumptionReason:   sql.NullString{Valid: true, String: fmt.Sprintf("preparation of %s", barecode)},
+			StorageID:           src.StorageID,
+			PersonID:            p.PersonID,
+			UnitID:              src.UnitID,
+		}
+		if _, err = createConsumption(tx, c); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return id, nil
+}
@@ -0,0 +1,264 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrPurchaseStatus is returned when the purchase can not go to the requested status
+var ErrPurchaseStatus = errors.New("wrong purchase status")
+
+var (
+	// purchaseTransitions are the purchase statuses allowed before each status
+	purchaseTransitions = map[string][]string{
+		"approved":  {"requested"},
+		"refused":   {"requested"},
+		"ordered":   {"approved"},
+		"received":  {"ordered"},
+		"cancelled": {"requested", "approved"},
+	}
+	// purchaseDates are the purchase dates set by each status
+	purchaseDates = map[string]string{
+		"approved": "purchase_approvaldate",
+		"refused":  "purchase_approvaldate",
+		"ordered":  "purchase_orderdate",
+		"received": "purchase_receptiondate",
+	}
+)
+
+// purchaseSelect is the common purchases select query
+const purchaseSelect = `SELECT purchase_id, purchase_status, purchase_quantity, purchase_nbitem, purchase_price,
+	purchase_reference, purchase_comment,
+	purchase_creationdate, purchase_approvaldate, purchase_orderdate, purchase_receptiondate,
+	product.product_id, name.name_label,
+	entity.entity_id, entity.entity_name,
+	unit.unit_id, unit.unit_label,
+	supplier.supplier_id, supplier.supplier_label,
+	person.person_id, person.person_email,
+	approver.person_id AS approver_id, approver.person_email AS approver_email
+	FROM purchase
+	JOIN product ON purchase.product = product.product_id
+	JOIN name ON product.name = name.name_id
+	JOIN entity ON purchase.entity = entity.entity_id
+	LEFT JOIN unit ON purchase.unit = unit.unit_id
+	LEFT JOIN supplier ON purchase.supplier = supplier.supplier_id
+	JOIN person ON purchase.person = person.person_id
+	LEFT JOIN person AS approver ON purchase.approver = approver.person_id`
+
+// CreatePurchase creates the purchase request p and returns its id.
+// A SupplierID of -1 creates the new supplier p.SupplierLabel.
+func (db *SQLiteDataStore) CreatePurchase(p Purchase) (int, error) {
+	var (
+		tx     *sqlx.Tx
+		sqlr   string
+		res    sql.Result
+		lastid int64
+		err    error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+
+	// if SupplierID = -1 then it is a new supplier
+	if p.SupplierID.Valid && p.SupplierID.Int64 == -1 {
+		sqlr = `INSERT INTO supplier (supplier_label) VALUES (?)`
+		if res, err = tx.Exec(sqlr, p.SupplierLabel); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if lastid, err = res.LastInsertId(); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		p.SupplierID = sql.NullInt64{Valid: true, Int64: lastid}
+	}
+
+	if p.PurchaseNbItem < 1 {
+		p.PurchaseNbItem = 1
+	}
+
+	sqlr = `INSERT INTO purchase (purchase_status, purchase_quantity, purchase_nbitem, purchase_price,
+	purchase_reference, purchase_comment, purchase_creationdate,
+	product, entity, unit, supplier, person)
+	VALUES ("requested", ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	if res, err = tx.Exec(sqlr, p.PurchaseQuantity, p.PurchaseNbItem, p.PurchasePrice,
+		p.PurchaseReference, p.PurchaseComment, time.Now(),
+		p.ProductID, p.EntityID, p.UnitID, p.SupplierID, p.PersonID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if lastid, err = res.LastInsertId(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{"p": p, "lastid": lastid}).Debug("CreatePurchase")
+	return int(lastid), nil
+}
+
+// GetPurchase returns the purchase with id "id"
+func (db *SQLiteDataStore) GetPurchase(id int) (Purchase, error) {
+	var (
+		p   Purchase
+		err error
+	)
+
+	if err = db.Get(&p, purchaseSelect+` WHERE purchase_id = ?`, id); err != nil {
+		return Purchase{}, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "p": p}).Debug("GetPurchase")
+	return p, nil
+}
+
+// GetEntityPurchases returns the purchases of the entity with id "id", the most recent first.
+// If open is true only the purchases not received, refused or cancelled yet are returned.
+func (db *SQLiteDataStore) GetEntityPurchases(id int, open bool) ([]Purchase, error) {
+	var (
+		ps  []Purchase
+		err error
+	)
+
+	sqlr := purchaseSelect + ` WHERE purchase.entity = ?`
+	if open {
+		sqlr += ` AND purchase_status IN ("requested", "approved", "ordered")`
+	}
+	sqlr += ` ORDER BY purchase_creationdate DESC, purchase_id DESC`
+	if err = db.Select(&ps, sqlr, id); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "open": open, "ps": len(ps)}).Debug("GetEntityPurchases")
+	return ps, nil
+}
+
+// UpdatePurchaseStatus moves the purchase with id "id" to the status
+// by the person with id personid, recording the approver and the status date
+func (db *SQLiteDataStore) UpdatePurchaseStatus(id int, personid int, status string) error {
+	if err := updatePurchaseStatus(db, id, personid, status); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"id": id, "personid": personid, "status": status}).Debug("UpdatePurchaseStatus")
+	return nil
+}
+
+// updatePurchaseStatus moves the purchase with id "id" to the status with e, see UpdatePurchaseStatus
+func updatePurchaseStatus(e sqlx.Execer, id int, personid int, status string) error {
+	var (
+		sqlr string
+		args []interface{}
+		res  sql.Result
+		n    int64
+		err  error
+	)
+
+	from, ok := purchaseTransitions[status]
+	if !ok {
+		return ErrPurchaseStatus
+	}
+
+	sqlr = `UPDATE purchase SET purchase_status = ?`
+	args = append(args, status)
+	if d, ok := purchaseDates[status]; ok {
+		sqlr += `, ` + d + ` = ?`
+		args = append(args, time.Now())
+	}
+	if status == "approved" || status == "refused" {
+		sqlr += `, approver = ?`
+		args = append(args, personid)
+	}
+	q, qargs, err := sqlx.In(sqlr+` WHERE purchase_id = ? AND purchase_status IN (?)`, append(args, id, from)...)
+	if err != nil {
+		return err
+	}
+	if res, err = e.Exec(q, qargs...); err != nil {
+		return err
+	}
+	if n, err = res.RowsAffected(); err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrPurchaseStatus
+	}
+
+	return nil
+}
+
+// ReceivePurchase sets the purchase p as received by the person s.PersonID and creates
+// its p.PurchaseNbItem storages s, in a single transaction, and returns their ids.
+// Nothing is changed if a storage can not be created.
+func (db *SQLiteDataStore) ReceivePurchase(p Purchase, s Storage) ([]int, error) {
+	var (
+		tx  *sqlx.Tx
+		err error
+		id  int
+		ids []int
+	)
+	log.WithFields(log.Fields{"p": p, "s": s}).Debug("ReceivePurchase")
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return nil, err
+	}
+
+	// the purchase can be received only once
+	if err = updatePurchaseStatus(tx, p.PurchaseID, s.PersonID, "received"); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for i := 1; i <= p.PurchaseNbItem; i++ {
+		if id, err = createStorage(tx, s); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// GetEntitySpendings returns the amounts spent by the entity with id "id" per supplier
+// for the purchases received between from and to
+func (db *SQLiteDataStore) GetEntitySpendings(id int, from time.Time, to time.Time) ([]SupplierSpending, error) {
+	var (
+		ss  []SupplierSpending
+		err error
+	)
+
+	sqlr := `SELECT supplier.supplier_id, supplier.supplier_label,
+	count(purchase_id) AS count,
+	IFNULL(SUM(purchase_price * purchase_nbitem), 0) AS total
+	FROM purchase
+	LEFT JOIN supplier ON purchase.supplier = supplier.supplier_id
+	WHERE purchase.entity = ? AND purchase_status = "received" AND
+	purchase_receptiondate >= ? AND purchase_receptiondate < ?
+	GROUP BY supplier.supplier_id
+	ORDER BY total DESC`
+	if err = db.Select(&ss, sqlr, id, from, to); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "from": from, "to": to, "ss": ss}).Debug("GetEntitySpendings")
+	return ss, nil
+}
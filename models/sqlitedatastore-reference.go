@@ -0,0 +1,431 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/utils"
+)
+
+const (
+	// referencecompoundcolumns are the ReferenceCompound columns
+	referencecompoundcolumns = `referencecompound_id,
+	referencecompound_name,
+	referencecompound_synonyms,
+	referencecompound_casnumber,
+	referencecompound_cenumber,
+	referencecompound_empiricalformula,
+	referencecompound_linearformula,
+	referencecompound_smiles,
+	referencecompound_inchi,
+	referencecompound_inchikey,
+	referencecompound_symbols,
+	referencecompound_hazardstatements,
+	referencecompound_precautionarystatements,
+	referencecompound_signalword`
+)
+
+// readReferenceCompoundsCSV returns the compounds of the CSV file f
+// the first line is the header with the ReferenceCompound json names
+func readReferenceCompoundsCSV(f string) ([]ReferenceCompound, error) {
+	var (
+		csvFile   *os.File
+		records   [][]string
+		compounds []ReferenceCompound
+		err       error
+	)
+
+	if csvFile, err = os.Open(f); err != nil {
+		return nil, err
+	}
+	defer csvFile.Close()
+
+	if records, err = csv.NewReader(csvFile).ReadAll(); err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	for _, record := range records[1:] {
+		var c ReferenceCompound
+		fields := map[string]*string{
+			"name":                    &c.ReferenceCompoundName,
+			"synonyms":                &c.ReferenceCompoundSynonyms,
+			"casnumber":               &c.ReferenceCompoundCasNumber,
+			"cenumber":                &c.ReferenceCompoundCeNumber,
+			"empiricalformula":        &c.ReferenceCompoundEmpiricalFormula,
+			"linearformula":           &c.ReferenceCompoundLinearFormula,
+			"smiles":                  &c.ReferenceCompoundSmiles,
+			"inchi":                   &c.ReferenceCompoundInchi,
+			"inchikey":                &c.ReferenceCompoundInchiKey,
+			"symbols":                 &c.ReferenceCompoundSymbols,
+			"hazardstatements":        &c.ReferenceCompoundHazardStatements,
+			"precautionarystatements": &c.ReferenceCompoundPrecautionaryStatements,
+			"signalword":              &c.ReferenceCompoundSignalWord,
+		}
+		for i, h := range records[0] {
+			if field, ok := fields[strings.TrimSpace(h)]; ok && i < len(record) {
+				*field = strings.TrimSpace(record[i])
+			}
+		}
+		compounds = append(compounds, c)
+	}
+
+	return compounds, nil
+}
+
+// ImportReferenceDataset imports the reference dataset bundle of the directory dir.
+// The bundle contains a manifest.json file with the dataset source and version:
+// {"source": "PubChem", "version": "2020-06"}
+// and a compounds.json (list of ReferenceCompound) and/or compounds.csv file.
+// The compounds of the former versions of the same source are replaced.
+func (db *SQLiteDataStore) ImportReferenceDataset(dir string) error {
+	var (
+		manifest struct {
+			Source  string `json:"source"`
+			Version string `json:"version"`
+		}
+		compounds []ReferenceCompound
+		content   []byte
+		tx        *sqlx.Tx
+		res       sql.Result
+		lastid    int64
+		c         int
+		sqlr      string
+		err       error
+	)
+
+	// reading the bundle
+	if content, err = ioutil.ReadFile(path.Join(dir, "manifest.json")); err != nil {
+		return err
+	}
+	if err = json.Unmarshal(content, &manifest); err != nil {
+		return err
+	}
+	if manifest.Source == "" || manifest.Version == "" {
+		return errors.New("missing source or version in manifest.json")
+	}
+	if content, err = ioutil.ReadFile(path.Join(dir, "compounds.json")); err == nil {
+		if err = json.Unmarshal(content, &compounds); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if _, err = os.Stat(path.Join(dir, "compounds.csv")); err == nil {
+		var csvcompounds []ReferenceCompound
+		if csvcompounds, err = readReferenceCompoundsCSV(path.Join(dir, "compounds.csv")); err != nil {
+			return err
+		}
+		compounds = append(compounds, csvcompounds...)
+	}
+	if len(compounds) == 0 {
+		return errors.New("no compounds found in " + dir)
+	}
+	log.WithFields(log.Fields{"source": manifest.Source, "version": manifest.Version, "compounds": len(compounds)}).Info("importing reference dataset")
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	if err = tx.Get(&c, `SELECT count(*) FROM referencedataset
+	WHERE referencedataset_source = ? AND referencedataset_version = ?`, manifest.Source, manifest.Version); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if c != 0 {
+		tx.Rollback()
+		return errors.New("reference dataset " + manifest.Source + " " + manifest.Version + " already imported")
+	}
+
+	// removing the compounds of the former versions
+	sqlr = `DELETE FROM referencecompound WHERE referencedataset IN
+	(SELECT referencedataset_id FROM referencedataset WHERE referencedataset_source = ?)`
+	if _, err = tx.Exec(sqlr, manifest.Source); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	sqlr = `INSERT INTO referencedataset (referencedataset_source, referencedataset_version, referencedataset_date) VALUES (?, ?, ?)`
+	if res, err = tx.Exec(sqlr, manifest.Source, manifest.Version, time.Now()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if lastid, err = res.LastInsertId(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	sqlr = `INSERT INTO referencecompound (referencecompound_name,
+	referencecompound_synonyms,
+	referencecompound_casnumber,
+	referencecompound_cenumber,
+	referencecompound_empiricalformula,
+	referencecompound_linearformula,
+	referencecompound_smiles,
+	referencecompound_inchi,
+	referencecompound_inchikey,
+	referencecompound_symbols,
+	referencecompound_hazardstatements,
+	referencecompound_precautionarystatements,
+	referencecompound_signalword,
+	referencedataset) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	for _, rc := range compounds {
+		if rc.ReferenceCompoundName == "" {
+			log.WithFields(log.Fields{"rc": rc}).Warn("skipping reference compound without name")
+			continue
+		}
+		// formula stored sorted when valid
+		if ef, err := utils.SortEmpiricalFormula(rc.ReferenceCompoundEmpiricalFormula); err == nil && ef != "" {
+			rc.ReferenceCompoundEmpiricalFormula = ef
+		}
+		if _, err = tx.Exec(sqlr, strings.ToUpper(rc.ReferenceCompoundName),
+			strings.ToUpper(rc.ReferenceCompoundSynonyms),
+			rc.ReferenceCompoundCasNumber,
+			rc.ReferenceCompoundCeNumber,
+			rc.ReferenceCompoundEmpiricalFormula,
+			rc.ReferenceCompoundLinearFormula,
+			rc.ReferenceCompoundSmiles,
+			rc.ReferenceCompoundInchi,
+			strings.ToUpper(rc.ReferenceCompoundInchiKey),
+			rc.ReferenceCompoundSymbols,
+			rc.ReferenceCompoundHazardStatements,
+			rc.ReferenceCompoundPrecautionaryStatements,
+			strings.ToLower(rc.ReferenceCompoundSignalWord),
+			lastid); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// GetReferenceDatasets returns the imported reference datasets
+func (db *SQLiteDataStore) GetReferenceDatasets() ([]ReferenceDataset, error) {
+	var (
+		datasets []ReferenceDataset
+		sqlr     string
+		err      error
+	)
+
+	sqlr = `SELECT referencedataset_id, referencedataset_source, referencedataset_version, referencedataset_date,
+	(SELECT count(*) FROM referencecompound WHERE referencedataset = referencedataset_id) AS referencedataset_count
+	FROM referencedataset
+	ORDER BY referencedataset_source, referencedataset_date DESC`
+	if err = db.Select(&datasets, sqlr); err != nil {
+		return nil, err
+	}
+
+	return datasets, nil
+}
+
+// getReferenceID returns the id of the table row with the given label
+// or -1 if it does not exist
+func (db *SQLiteDataStore) getReferenceID(table string, label string) (int64, error) {
+	var (
+		id  int64
+		err error
+	)
+
+	if err = db.Get(&id, "SELECT "+table+"_id FROM "+table+" WHERE "+table+"_label = ?", label); err != nil {
+		if err == sql.ErrNoRows {
+			return -1, nil
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// splitReference returns the non empty trimmed values of the | separated s
+func splitReference(s string) []string {
+	var r []string
+	for _, v := range strings.Split(s, "|") {
+		if v = strings.TrimSpace(v); v != "" {
+			r = append(r, v)
+		}
+	}
+	return r
+}
+
+// referenceCompoundToProduct returns a product prefilled with the rc reference compound,
+// the ids being set to -1 for the names and formulas not yet in the database
+func (db *SQLiteDataStore) referenceCompoundToProduct(rc ReferenceCompound) (Product, error) {
+	var (
+		p   Product
+		id  int64
+		err error
+	)
+
+	if id, err = db.getReferenceID("name", rc.ReferenceCompoundName); err != nil {
+		return Product{}, err
+	}
+	p.Name = Name{NameID: int(id), NameLabel: rc.ReferenceCompoundName}
+
+	p.Synonyms = []Name{}
+	for _, syn := range splitReference(rc.ReferenceCompoundSynonyms) {
+		if syn == rc.ReferenceCompoundName {
+			continue
+		}
+		if id, err = db.getReferenceID("name", syn); err != nil {
+			return Product{}, err
+		}
+		p.Synonyms = append(p.Synonyms, Name{NameID: int(id), NameLabel: syn})
+	}
+
+	if rc.ReferenceCompoundCasNumber == "" {
+		rc.ReferenceCompoundCasNumber = "0000"
+	}
+	if id, err = db.getReferenceID("casnumber", rc.ReferenceCompoundCasNumber); err != nil {
+		return Product{}, err
+	}
+	p.CasNumber = CasNumber{CasNumberID: int(id), CasNumberLabel: rc.ReferenceCompoundCasNumber}
+
+	if rc.ReferenceCompoundCeNumber != "" {
+		if id, err = db.getReferenceID("cenumber", rc.ReferenceCompoundCeNumber); err != nil {
+			return Product{}, err
+		}
+		p.CeNumber = CeNumber{
+			CeNumberID:    sql.NullInt64{Valid: true, Int64: id},
+			CeNumberLabel: sql.NullString{Valid: true, String: rc.ReferenceCompoundCeNumber}}
+	}
+
+	if rc.ReferenceCompoundEmpiricalFormula == "" {
+		rc.ReferenceCompoundEmpiricalFormula = "XXXX"
+	}
+	if id, err = db.getReferenceID("empiricalformula", rc.ReferenceCompoundEmpiricalFormula); err != nil {
+		return Product{}, err
+	}
+	p.EmpiricalFormula = EmpiricalFormula{EmpiricalFormulaID: int(id), EmpiricalFormulaLabel: rc.ReferenceCompoundEmpiricalFormula}
+
+	if rc.ReferenceCompoundLinearFormula != "" {
+		if id, err = db.getReferenceID("linearformula", rc.ReferenceCompoundLinearFormula); err != nil {
+			return Product{}, err
+		}
+		p.LinearFormula = LinearFormula{
+			LinearFormulaID:    sql.NullInt64{Valid: true, Int64: id},
+			LinearFormulaLabel: sql.NullString{Valid: true, String: rc.ReferenceCompoundLinearFormula}}
+	}
+
+	// the symbols, statements and signal word must exist
+	p.Symbols = []Symbol{}
+	for _, label := range splitReference(rc.ReferenceCompoundSymbols) {
+		var s Symbol
+		if err = db.Get(&s, `SELECT symbol_id, symbol_label, symbol_image FROM symbol WHERE symbol_label = ?`, label); err != nil {
+			if err == sql.ErrNoRows {
+				log.WithFields(log.Fields{"label": label}).Debug("referenceCompoundToProduct unknown symbol")
+				continue
+			}
+			return Product{}, err
+		}
+		p.Symbols = append(p.Symbols, s)
+	}
+	p.HazardStatements = []HazardStatement{}
+	for _, ref := range splitReference(rc.ReferenceCompoundHazardStatements) {
+		var hs HazardStatement
+		if hs, err = db.GetProductsHazardStatementByReference(ref); err != nil {
+			if err == sql.ErrNoRows {
+				log.WithFields(log.Fields{"ref": ref}).Debug("referenceCompoundToProduct unknown hazard statement")
+				continue
+			}
+			return Product{}, err
+		}
+		p.HazardStatements = append(p.HazardStatements, hs)
+	}
+	p.PrecautionaryStatements = []PrecautionaryStatement{}
+	for _, ref := range splitReference(rc.ReferenceCompoundPrecautionaryStatements) {
+		var ps PrecautionaryStatement
+		if ps, err = db.GetProductsPrecautionaryStatementByReference(ref); err != nil {
+			if err == sql.ErrNoRows {
+				log.WithFields(log.Fields{"ref": ref}).Debug("referenceCompoundToProduct unknown precautionary statement")
+				continue
+			}
+			return Product{}, err
+		}
+		p.PrecautionaryStatements = append(p.PrecautionaryStatements, ps)
+	}
+	if rc.ReferenceCompoundSignalWord != "" {
+		if err = db.Get(&p.SignalWord, `SELECT signalword_id, signalword_label FROM signalword
+		WHERE signalword_label = ?`, rc.ReferenceCompoundSignalWord); err != nil && err != sql.ErrNoRows {
+			return Product{}, err
+		}
+	}
+
+	p.ProductSmiles = sql.NullString{Valid: rc.ReferenceCompoundSmiles != "", String: rc.ReferenceCompoundSmiles}
+	p.ProductInchi = sql.NullString{Valid: rc.ReferenceCompoundInchi != "", String: rc.ReferenceCompoundInchi}
+	p.ProductInchiKey = sql.NullString{Valid: rc.ReferenceCompoundInchiKey != "", String: rc.ReferenceCompoundInchiKey}
+
+	return p, nil
+}
+
+// GetProductReference returns a product prefilled from the reference compound
+// matching the given InChIKey, cas number or name (in this order of priority)
+// found in the latest imported dataset
+func (db *SQLiteDataStore) GetProductReference(casnumber string, name string, inchikey string) (ProductReference, error) {
+	var (
+		pr     ProductReference
+		snstmt *sqlx.NamedStmt
+		err    error
+	)
+
+	// reference compound with its dataset id
+	var rc struct {
+		ReferenceCompound
+		ReferenceDatasetID int `db:"referencedataset"`
+	}
+
+	sqlr := `SELECT ` + referencecompoundcolumns + `, referencedataset
+	FROM referencecompound
+	WHERE (:inchikey != "" AND referencecompound_inchikey = :inchikey) OR
+	(:casnumber != "" AND referencecompound_casnumber = :casnumber) OR
+	(:name != "" AND (referencecompound_name = :name OR "|" || referencecompound_synonyms || "|" LIKE "%|" || :name || "|%"))
+	ORDER BY CASE WHEN referencecompound_inchikey = :inchikey THEN 0
+	WHEN referencecompound_casnumber = :casnumber THEN 1
+	ELSE 2 END, referencedataset DESC
+	LIMIT 1`
+	if snstmt, err = db.PrepareNamed(sqlr); err != nil {
+		return ProductReference{}, err
+	}
+	m := map[string]interface{}{
+		"inchikey":  strings.ToUpper(strings.TrimSpace(inchikey)),
+		"casnumber": strings.TrimSpace(casnumber),
+		"name":      strings.ToUpper(strings.TrimSpace(name)),
+	}
+	if err = snstmt.Get(&rc, m); err != nil {
+		return ProductReference{}, err
+	}
+
+	sqlr = `SELECT referencedataset_id, referencedataset_source, referencedataset_version, referencedataset_date,
+	(SELECT count(*) FROM referencecompound WHERE referencedataset = referencedataset_id) AS referencedataset_count
+	FROM referencedataset
+	WHERE referencedataset_id = ?`
+	if err = db.Get(&pr.ReferenceDataset, sqlr, rc.ReferenceDatasetID); err != nil {
+		return ProductReference{}, err
+	}
+
+	if pr.Product, err = db.referenceCompoundToProduct(rc.ReferenceCompound); err != nil {
+		return ProductReference{}, err
+	}
+
+	log.WithFields(log.Fields{"m": m, "rc": rc}).Debug("GetProductReference")
+	return pr, nil
+}
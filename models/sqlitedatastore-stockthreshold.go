@@ -0,0 +1,186 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrStockThresholdUnit is returned when the threshold unit is not a reference unit
+var ErrStockThresholdUnit = errors.New("the threshold unit must be a reference unit")
+
+// stockThresholdSelect is the common stock thresholds select query
+const stockThresholdSelect = `SELECT stockthreshold_id, stockthreshold_quantity, stockthreshold_notified,
+	entity.entity_id, entity.entity_name,
+	product.product_id, name.name_label,
+	unit.unit_id, unit.unit_label
+	FROM stockthreshold
+	JOIN entity ON stockthreshold.entity = entity.entity_id
+	JOIN product ON stockthreshold.product = product.product_id
+	JOIN name ON product.name = name.name_id
+	JOIN unit ON stockthreshold.unit = unit.unit_id`
+
+// computeStockEntityUnit returns the stock of the product p in the entity with id entityid
+// for the unit family of the reference unit u, aggregated like ComputeStockEntity
+func (db *SQLiteDataStore) computeStockEntityUnit(p Product, entityid int, u Unit) (float64, error) {
+	var (
+		storelocations []StoreLocation
+		t              float64
+		err            error
+	)
+
+	sqlr := `SELECT storelocation.storelocation_id, storelocation.storelocation_name
+	FROM storelocation
+	WHERE storelocation.storelocation IS NULL AND storelocation.entity = ?`
+	if err = db.Select(&storelocations, sqlr, entityid); err != nil {
+		return 0, err
+	}
+
+	for i := range storelocations {
+		db.ComputeStockStorelocation(p, &storelocations[i], u)
+		t += storelocations[i].Stocks[len(storelocations[i].Stocks)-1].Total
+	}
+
+	return t, nil
+}
+
+// getStockThresholds returns the stock thresholds matching the where clause
+// with their current stock
+func (db *SQLiteDataStore) getStockThresholds(where string, args ...interface{}) ([]StockThreshold, error) {
+	var (
+		ts  []StockThreshold
+		err error
+	)
+
+	if err = db.Select(&ts, stockThresholdSelect+where+` ORDER BY name.name_label, unit.unit_label`, args...); err != nil {
+		return nil, err
+	}
+	for i, t := range ts {
+		u := Unit{UnitID: sql.NullInt64{Valid: true, Int64: int64(t.UnitID)}}
+		if ts[i].StockThresholdCurrent, err = db.computeStockEntityUnit(Product{ProductID: t.ProductID}, t.EntityID, u); err != nil {
+			return nil, err
+		}
+	}
+
+	return ts, nil
+}
+
+// GetStockThresholds returns the stock thresholds of the entity with id entityid
+func (db *SQLiteDataStore) GetStockThresholds(entityid int) ([]StockThreshold, error) {
+	ts, err := db.getStockThresholds(` WHERE stockthreshold.entity = ?`, entityid)
+
+	log.WithFields(log.Fields{"entityid": entityid, "ts": len(ts)}).Debug("GetStockThresholds")
+	return ts, err
+}
+
+// GetLowStocks returns the stock thresholds of the entity with id entityid
+// whose current stock is under the threshold quantity
+func (db *SQLiteDataStore) GetLowStocks(entityid int) ([]StockThreshold, error) {
+	var (
+		ts  []StockThreshold
+		low []StockThreshold
+		err error
+	)
+
+	if ts, err = db.GetStockThresholds(entityid); err != nil {
+		return nil, err
+	}
+	for _, t := range ts {
+		if t.StockThresholdCurrent < t.StockThresholdQuantity {
+			low = append(low, t)
+		}
+	}
+
+	return low, nil
+}
+
+// UpdateStockThreshold sets the stock threshold t of its entity, product and unit family.
+// A zero quantity removes the threshold.
+func (db *SQLiteDataStore) UpdateStockThreshold(t StockThreshold) error {
+	var (
+		sqlr string
+		c    int
+		err  error
+	)
+
+	if t.StockThresholdQuantity <= 0 {
+		sqlr = `DELETE FROM stockthreshold WHERE entity = ? AND product = ? AND unit = ?`
+		_, err = db.Exec(sqlr, t.EntityID, t.ProductID, t.UnitID)
+		return err
+	}
+
+	sqlr = `SELECT count(*) FROM unit WHERE unit_id = ? AND unit.unit IS NULL`
+	if err = db.Get(&c, sqlr, t.UnitID); err != nil {
+		return err
+	}
+	if c == 0 {
+		return ErrStockThresholdUnit
+	}
+
+	sqlr = `INSERT INTO stockthreshold (stockthreshold_quantity, stockthreshold_notified, entity, product, unit)
+	VALUES (?, false, ?, ?, ?)
+	ON CONFLICT(entity, product, unit) DO UPDATE SET stockthreshold_quantity = excluded.stockthreshold_quantity, stockthreshold_notified = false`
+	if _, err = db.Exec(sqlr, t.StockThresholdQuantity, t.EntityID, t.ProductID, t.UnitID); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"t": t}).Debug("UpdateStockThreshold")
+	return nil
+}
+
+// CheckStockThresholds evaluates the stock thresholds of the product with id productid
+// in the entity with id entityid and returns the ones newly crossed, marking them as notified.
+// Thresholds back over their quantity are notified again on the next crossing.
+func (db *SQLiteDataStore) CheckStockThresholds(productid int, entityid int) ([]StockThreshold, error) {
+	var (
+		tx  *sqlx.Tx
+		res sql.Result
+		n   int64
+		ts  []StockThreshold
+		low []StockThreshold
+		err error
+	)
+
+	if ts, err = db.getStockThresholds(` WHERE stockthreshold.product = ? AND stockthreshold.entity = ?`, productid, entityid); err != nil {
+		return nil, err
+	}
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return nil, err
+	}
+
+	// the thresholds are read before the transaction, only the call
+	// actually changing the notified flag reports the crossing
+	sqlr := `UPDATE stockthreshold SET stockthreshold_notified = ?1 WHERE stockthreshold_id = ?2 AND stockthreshold_notified != ?1`
+	for _, t := range ts {
+		below := t.StockThresholdCurrent < t.StockThresholdQuantity
+		if below == t.StockThresholdNotified {
+			continue
+		}
+		if res, err = tx.Exec(sqlr, below, t.StockThresholdID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if n, err = res.RowsAffected(); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if below && n == 1 {
+			low = append(low, t)
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{"productid": productid, "entityid": entityid, "low": len(low)}).Debug("CheckStockThresholds")
+	return low, nil
+}
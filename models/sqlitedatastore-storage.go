@@ -2,11 +2,13 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
@@ -16,17 +18,18 @@ import (
 	"github.com/tbellembois/gochimitheque/constants"
 	"github.com/tbellembois/gochimitheque/global"
 	"github.com/tbellembois/gochimitheque/helpers"
+	"github.com/tbellembois/gochimitheque/utils"
 )
 
-// IsStorageBorrowing returns true if there is a borrowing b in the database
+// IsStorageBorrowing returns true if the storage of the borrowing b is currently borrowed
 func (db *SQLiteDataStore) IsStorageBorrowing(b Borrowing) (bool, error) {
 	var (
 		sqlr string
 		err  error
 		i    int
 	)
-	sqlr = `SELECT count(*) FROM borrowing WHERE borrower = ? AND storage = ?`
-	if err = db.Get(&i, sqlr, b.Borrower.PersonID, b.Storage.StorageID.Int64); err != nil {
+	sqlr = `SELECT count(*) FROM borrowing WHERE storage = ? AND borrowing_returndate IS NULL`
+	if err = db.Get(&i, sqlr, b.Storage.StorageID.Int64); err != nil {
 		return false, err
 	}
 	return i != 0, err
@@ -34,28 +37,57 @@ func (db *SQLiteDataStore) IsStorageBorrowing(b Borrowing) (bool, error) {
 
 // CreateStorageBorrowing creates the borrowing b
 func (db *SQLiteDataStore) CreateStorageBorrowing(b Borrowing) error {
+	return createStorageBorrowing(db, b)
+}
+
+// createStorageBorrowing inserts the borrowing b with e, see CreateStorageBorrowing
+func createStorageBorrowing(e sqlx.Execer, b Borrowing) error {
 	var (
 		sqlr string
 		err  error
 	)
-	sqlr = `INSERT into borrowing(person, storage, borrower, borrowing_comment) VALUES (?, ?, ?, ?)`
-	if _, err = db.Exec(sqlr, b.Person.PersonID, b.Storage.StorageID.Int64, b.Borrower.PersonID, b.BorrowingComment); err != nil {
+	sqlr = `INSERT into borrowing(person, storage, borrower, borrowing_comment, borrowing_date, borrowing_duedate, borrowing_state) VALUES (?, ?, ?, ?, ?, ?, "active")`
+	if _, err = e.Exec(sqlr, b.Person.PersonID, b.Storage.StorageID.Int64, b.Borrower.PersonID, b.BorrowingComment, time.Now(), b.BorrowingDueDate); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// DeleteStorageBorrowing deletes the borrowing b
-func (db *SQLiteDataStore) DeleteStorageBorrowing(b Borrowing) error {
+// ReturnStorageBorrowing ends the current borrowing of the storage of the borrowing b
+// and updates the storage quantity with the returned one if any
+func (db *SQLiteDataStore) ReturnStorageBorrowing(b Borrowing) error {
 	var (
 		sqlr string
 		err  error
+		tx   *sqlx.Tx
 	)
-	sqlr = `DELETE from borrowing WHERE storage = ?`
-	if _, err = db.Exec(sqlr, b.Storage.StorageID.Int64); err != nil {
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	sqlr = `UPDATE borrowing SET borrowing_returndate = ?, borrowing_returnquantity = ?, borrowing_state = "returned"
+	WHERE storage = ? AND borrowing_returndate IS NULL`
+	if _, err = tx.Exec(sqlr, time.Now(), b.BorrowingReturnQuantity, b.Storage.StorageID.Int64); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if b.BorrowingReturnQuantity.Valid {
+		sqlr = `UPDATE storage SET storage_quantity = ?, storage_modificationdate = ? WHERE storage_id = ?`
+		if _, err = tx.Exec(sqlr, b.BorrowingReturnQuantity.Float64, time.Now(), b.Storage.StorageID.Int64); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
 		return err
 	}
+
 	return nil
 }
 
@@ -111,6 +143,21 @@ func (db *SQLiteDataStore) GetStoragesUnits(p helpers.Dbselectparam) ([]Unit, in
 	return units, count, nil
 }
 
+// GetUnitByLabel returns the unit with label "label"
+func (db *SQLiteDataStore) GetUnitByLabel(label string) (Unit, error) {
+	var (
+		u   Unit
+		err error
+	)
+
+	if err = db.Get(&u, `SELECT unit_id, unit_label FROM unit WHERE unit_label = ?`, label); err != nil {
+		return Unit{}, err
+	}
+
+	log.WithFields(log.Fields{"label": label, "u": u}).Debug("GetUnitByLabel")
+	return u, nil
+}
+
 // GetStoragesSuppliers return the suppliers matching the search criteria
 func (db *SQLiteDataStore) GetStoragesSuppliers(p helpers.Dbselectparam) ([]Supplier, int, error) {
 	var (
@@ -123,7 +170,7 @@ func (db *SQLiteDataStore) GetStoragesSuppliers(p helpers.Dbselectparam) ([]Supp
 	)
 
 	precreq.WriteString(" SELECT count(DISTINCT supplier.supplier_id)")
-	presreq.WriteString(" SELECT supplier_id, supplier_label")
+	presreq.WriteString(" SELECT supplier_id, supplier_label, supplier_email, supplier_phone, supplier_address, supplier_website")
 
 	comreq.WriteString(" FROM supplier")
 	comreq.WriteString(" WHERE supplier_label LIKE :search")
@@ -220,6 +267,10 @@ func (db *SQLiteDataStore) GetStorages(p helpers.DbselectparamStorage) ([]Storag
 		s.storage_qrcode,
 		s.storage_comment,
 		s.storage_archive,
+		s.storage_parent,
+		s.storage_shelflifereception,
+		s.storage_shelflifeopening,
+		s.storage_expirationcomputed,
 		storage.storage_id AS "storage.storage_id",
 		unit.unit_label AS "unit.unit_label",
 		supplier.supplier_label AS "supplier.supplier_label",
@@ -227,6 +278,7 @@ func (db *SQLiteDataStore) GetStorages(p helpers.DbselectparamStorage) ([]Storag
 		product.product_id AS "product.product_id",
 		name.name_label AS "product.name.name_label",
 		borrowing.borrowing_id AS "borrowing.borrowing_id",
+		borrowing.borrowing_duedate AS "borrowing.borrowing_duedate",
 		storelocation.storelocation_name AS "storelocation.storelocation_name",
 		storelocation.storelocation_color AS "storelocation.storelocation_color",
 		storelocation.storelocation_fullpath AS "storelocation.storelocation_fullpath",
@@ -254,7 +306,7 @@ func (db *SQLiteDataStore) GetStorages(p helpers.DbselectparamStorage) ([]Storag
 	// get supplier
 	comreq.WriteString(" LEFT JOIN supplier ON s.supplier = supplier.supplier_id")
 	// get borrowing
-	comreq.WriteString(" LEFT JOIN borrowing ON s.storage_id = borrowing.storage")
+	comreq.WriteString(" LEFT JOIN borrowing ON s.storage_id = borrowing.storage AND borrowing.borrowing_returndate IS NULL")
 
 	// get name
 	//comreq.WriteString(" JOIN name ON product.name = name.name_id")
@@ -422,7 +474,7 @@ func (db *SQLiteDataStore) GetStorages(p helpers.DbselectparamStorage) ([]Storag
 	}
 
 	//
-	// getting number of history for each storage
+	// getting number of history and the aliquots of each storage
 	//
 	for i, st := range storages {
 		// getting the total storage count
@@ -432,6 +484,9 @@ func (db *SQLiteDataStore) GetStorages(p helpers.DbselectparamStorage) ([]Storag
 		if err = db.Get(&storages[i].StorageHC, reqhc.String(), st.StorageID); err != nil {
 			return nil, 0, err
 		}
+		if storages[i].StorageChildren, err = storageChildren(db, int(st.StorageID.Int64)); err != nil {
+			return nil, 0, err
+		}
 	}
 
 	return storages, count, nil
@@ -439,6 +494,7 @@ func (db *SQLiteDataStore) GetStorages(p helpers.DbselectparamStorage) ([]Storag
 
 // GetOtherStorages returns the entity manager(s) email of the entities
 // storing the product with the id passed in the request parameters p
+// and their stocks of the product if they share them
 func (db *SQLiteDataStore) GetOtherStorages(p helpers.DbselectparamStorage) ([]Entity, int, error) {
 	var (
 		entities                           []Entity
@@ -454,6 +510,7 @@ func (db *SQLiteDataStore) GetOtherStorages(p helpers.DbselectparamStorage) ([]E
 	precreq.WriteString(" SELECT count(DISTINCT e.entity_id)")
 	presreq.WriteString(` SELECT e.entity_id AS "entity_id",
 	e.entity_name AS "entity_name",
+	e.entity_sharestocks AS "entity_sharestocks",
 	GROUP_CONCAT(DISTINCT person.person_email) AS "entity_description"
 	`)
 
@@ -513,6 +570,25 @@ func (db *SQLiteDataStore) GetOtherStorages(p helpers.DbselectparamStorage) ([]E
 		return nil, 0, err
 	}
 
+	//
+	// getting the product stocks of the entities sharing them
+	//
+	for i, e := range entities {
+		if !e.EntityShareStocks || p.GetProduct() == -1 {
+			continue
+		}
+		sqlr := `SELECT SUM(storage.storage_quantity) AS quantity, unit.unit_label
+		FROM storage
+		JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+		LEFT JOIN unit ON storage.unit = unit.unit_id
+		WHERE storelocation.entity = ? AND storage.product = ? AND
+		storage.storage IS NULL AND storage.storage_archive = false AND storage.storage_quantity IS NOT NULL
+		GROUP BY unit.unit_id`
+		if err = db.Select(&entities[i].Stocks, sqlr, e.EntityID, p.GetProduct()); err != nil {
+			return nil, 0, err
+		}
+	}
+
 	return entities, count, nil
 }
 
@@ -540,10 +616,17 @@ func (db *SQLiteDataStore) GetStorage(id int) (Storage, error) {
 	storage.storage_qrcode,
 	storage.storage_comment,
 	storage.storage_archive,
+	storage.storage_modifiedby,
+	storage.storage AS "storage.storage_id",
+	storage.storage_parent,
+	storage.storage_shelflifereception,
+	storage.storage_shelflifeopening,
+	storage.storage_expirationcomputed,
 	unit.unit_id AS "unit.unit_id",
 	unit.unit_label AS "unit.unit_label",
 	supplier.supplier_id AS "supplier.supplier_id",
 	supplier.supplier_label AS "supplier.supplier_label",
+	person.person_id AS "person.person_id",
 	person.person_email AS "person.person_email",
 	name.name_label AS "product.name.name_label",
 	product.product_id AS "product.product_id",
@@ -566,20 +649,158 @@ func (db *SQLiteDataStore) GetStorage(id int) (Storage, error) {
 	if err = db.Get(&storage, sqlr, id); err != nil {
 		return Storage{}, err
 	}
+	if storage.StorageChildren, err = storageChildren(db, id); err != nil {
+		return Storage{}, err
+	}
 	log.WithFields(log.Fields{"ID": id, "storage": storage}).Debug("GetStorage")
 	return storage, nil
 }
 
+// storageChildren returns the ids of the storages aliquoted from the storage with id "id"
+func storageChildren(q sqlx.Queryer, id int) ([]int, error) {
+	children := []int{}
+	if err := sqlx.Select(q, &children, `SELECT storage_id FROM storage WHERE storage_parent = ? ORDER BY storage_id`, id); err != nil {
+		return nil, err
+	}
+	return children, nil
+}
+
+// storageQRCode matches the storage id of the storages QR codes payload
+var storageQRCode = regexp.MustCompile(`[?&]storage=([0-9]+)`)
+
+// storageIDByCode returns the id of the current storage with the QR code payload or barecode "code",
+// the storages of the entities "entityids" first,
+// sql.ErrNoRows if none matches
+func storageIDByCode(q sqlx.Queryer, code string, entityids []int) (int, error) {
+	var (
+		id   int
+		args []interface{}
+		err  error
+	)
+
+	sqlr := `SELECT storage.storage_id FROM storage
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	WHERE storage.storage IS NULL AND storage.storage_archive = false AND `
+	if m := storageQRCode.FindStringSubmatch(code); m != nil {
+		sqlr += `storage.storage_id = ?`
+		args = append(args, m[1])
+	} else {
+		sqlr += `storage.storage_barecode = ?`
+		args = append(args, code)
+	}
+	if len(entityids) > 0 {
+		sqlr += ` ORDER BY storelocation.entity IN (?) DESC`
+		args = append(args, entityids)
+		if sqlr, args, err = sqlx.In(sqlr, args...); err != nil {
+			return 0, err
+		}
+	}
+	sqlr += ` LIMIT 1`
+	if err = sqlx.Get(q, &id, sqlr, args...); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetStorageIDByCode returns the id of the current storage with the QR code payload or barecode "code",
+// the storages of the entities "entityids" first,
+// sql.ErrNoRows if none matches
+func (db *SQLiteDataStore) GetStorageIDByCode(code string, entityids []int) (int, error) {
+	var (
+		id  int
+		err error
+	)
+
+	if id, err = storageIDByCode(db, code, entityids); err != nil {
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{"code": code, "id": id}).Debug("GetStorageIDByCode")
+	return id, nil
+}
+
 // DeleteStorage deletes the storages with the given id
 func (db *SQLiteDataStore) DeleteStorage(id int) error {
+	var (
+		tx  *sqlx.Tx
+		err error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	if err = deleteStorage(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// deleteStorage deletes the storage with the given id, its history and its references
+func deleteStorage(tx sqlx.Execer, id int) error {
 
 	var (
 		sqlr string
 		err  error
 	)
+	sqlr = `DELETE FROM alertnotification
+	WHERE storage = ?`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM consumption
+	WHERE storage = ?`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM transfer
+	WHERE storage = ?`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM borrowing
+	WHERE storage = ?`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `UPDATE borrowrequest SET storage = NULL
+	WHERE storage = ?`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM disposalstorage
+	WHERE storage = ?`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM inventoryscan
+	WHERE storage = ?`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `UPDATE storage SET storage_parent = NULL
+	WHERE storage_parent = ?`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM storage
+	WHERE storage.storage = ?`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return err
+	}
 	sqlr = `DELETE FROM storage 
 	WHERE storage_id = ?`
-	if _, err = db.Exec(sqlr, id); err != nil {
+	if _, err = tx.Exec(sqlr, id); err != nil {
 		return err
 	}
 	return nil
@@ -587,167 +808,320 @@ func (db *SQLiteDataStore) DeleteStorage(id int) error {
 
 // ArchiveStorage archives the storages with the given id
 func (db *SQLiteDataStore) ArchiveStorage(id int) error {
+	return db.updateStorageArchive(id, true)
+}
 
+// RestoreStorage restores (unarchive) the storages with the given id
+func (db *SQLiteDataStore) RestoreStorage(id int) error {
+	return db.updateStorageArchive(id, false)
+}
+
+// updateStorageArchive archives or restores the storage with the given id
+// and its history in a single transaction
+func (db *SQLiteDataStore) updateStorageArchive(id int, archive bool) error {
 	var (
-		sqlr string
-		err  error
+		tx  *sqlx.Tx
+		err error
 	)
-	sqlr = `UPDATE storage SET storage_archive = true 
-	WHERE storage_id = ?`
-	if _, err = db.Exec(sqlr, id); err != nil {
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
 		return err
 	}
-	sqlr = `UPDATE storage SET storage_archive = true 
-	WHERE storage.storage = ?`
-	if _, err = db.Exec(sqlr, id); err != nil {
+
+	if err = setStorageArchive(tx, id, archive); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
 		return err
 	}
 
 	return nil
 }
 
-// RestoreStorage restores (unarchive) the storages with the given id
-func (db *SQLiteDataStore) RestoreStorage(id int) error {
+// setStorageArchive archives or restores the storage with the given id and its history
+func setStorageArchive(tx sqlx.Execer, id int, archive bool) error {
 
 	var (
 		sqlr string
 		err  error
 	)
-	sqlr = `UPDATE storage SET storage_archive = false 
+	sqlr = `UPDATE storage SET storage_archive = ? 
 	WHERE storage_id = ?`
-	if _, err = db.Exec(sqlr, id); err != nil {
+	if _, err = tx.Exec(sqlr, archive, id); err != nil {
 		return err
 	}
-	sqlr = `UPDATE storage SET storage_archive = false 
+	sqlr = `UPDATE storage SET storage_archive = ? 
 	WHERE storage.storage = ?`
-	if _, err = db.Exec(sqlr, id); err != nil {
+	if _, err = tx.Exec(sqlr, archive, id); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// GenerateAndUpdateStorageBarecode generate and set a barecode for the storage s
-// the barecode is [prefix]major.minor
-// with
-// prefix: extracted from the storelocation name [prefix]storelocation_name, or ""
-// major: unique uid identical for the differents storages of the same product in an entity
-// minor: incremental number for the differents storages of the same product in an entity
-func (db *SQLiteDataStore) GenerateAndUpdateStorageBarecode(s *Storage) error {
+// ErrStorageBarecodeUsed is returned when a barecode is already used by another storage
+var ErrStorageBarecodeUsed = errors.New("the barecode is already used")
 
+// storageBarecodeMaxTries is the number of sequence numbers tried to find an unused barecode
+const storageBarecodeMaxTries = 100
+
+// generateStorageBarecode generates and sets a barecode for the storage s
+// from the barecode template of its entity, or utils.DefaultBarecodeTemplate.
+// The sequence numbers are allocated from the barecodesequence table, by pattern of the barecodes
+// sharing the other tokens values, and start after the greatest one of the current storages.
+// The transaction tx must hold the database write lock so that two storages can not get the same number,
+// the barecodes unique index being the last guard.
+func generateStorageBarecode(tx sqlx.Ext, s *Storage) (string, error) {
 	var (
-		err      error
-		m        []string
-		png      []byte
-		lastbc   string
+		e        Entity
+		sl       StoreLocation
+		last     []string
+		seq      int
+		pattern  string
 		prefix   string
-		major    string
-		minor    string
-		iminor   int
 		barecode string
+		err      error
 	)
-	log.WithFields(log.Fields{"s": s}).Debug("GenerateAndUpdateStorageBarecode")
 
-	//
-	// prefix
-	//
-	// regex to detect store locations names starting with [a-zA-Z] to build barecode prefixes
-	slr := regexp.MustCompile("^\\[(?P<groupone>[a-zA-Z]{1})\\].*$")
-	// finding group names
-	n := slr.SubexpNames()
-	// finding matches
-	ms := slr.FindAllStringSubmatch(s.StoreLocationName.String, -1)
-	// then building a map of matches
-	md := map[string]string{}
-	if len(ms) != 0 {
-		m = ms[0]
-		for i, j := range m {
-			md[n[i]] = j
-		}
+	sqlr := `SELECT storelocation_id, storelocation_name FROM storelocation WHERE storelocation_id = ?`
+	if err = sqlx.Get(tx, &sl, sqlr, s.StoreLocationID.Int64); err != nil {
+		return "", err
+	}
+	sqlr = `SELECT entity_id, entity_code, entity_barecodetemplate FROM entity
+	WHERE entity_id = (SELECT entity FROM storelocation WHERE storelocation_id = ?)`
+	if err = sqlx.Get(tx, &e, sqlr, s.StoreLocationID.Int64); err != nil {
+		return "", err
 	}
-	if len(md) > 0 {
-		prefix = md["groupone"]
+	t := utils.DefaultBarecodeTemplate
+	if e.EntityBarecodeTemplate.Valid && e.EntityBarecodeTemplate.String != "" {
+		t = e.EntityBarecodeTemplate.String
 	}
 
-	//
-	// major
-	//
-	// getting the last storage barecode
-	// for the same product
-	// in the same entity
-	sqlr := `SELECT storage_barecode FROM storage 
-	JOIN storelocation on storage.storelocation = storelocation.storelocation_id 
-	WHERE product = ? AND storelocation.entity = ? AND regexp('^[a-zA-Z]{0,1}[0-9]+\.[0-9]+$', '' || storage_barecode || '') = true
-	ORDER BY storage_barecode desc 
-	LIMIT 1`
-	if err = db.Get(&lastbc, sqlr, s.ProductID, s.EntityID); err != nil && err != sql.ErrNoRows {
-		return err
+	v := utils.BarecodeValues{
+		Entity:        e.EntityCode.String,
+		StoreLocation: utils.StoreLocationCode(sl.StoreLocationName.String),
+		Product:       s.ProductID,
+		Date:          s.StorageCreationDate,
+	}
+	if v.Date.IsZero() {
+		v.Date = time.Now()
 	}
-	log.WithFields(log.Fields{"lastbc": lastbc}).Debug("GenerateAndUpdateStorageBarecode")
-
-	// regex to extract the major from a barecode
-	majorr := regexp.MustCompile("^[a-zA-Z]{0,1}(?P<groupone>[0-9]+)\\.(?P<grouptwo>[0-9]+)$")
-	// finding group names
-	n = majorr.SubexpNames()
-	// finding matches
-	ms = majorr.FindAllStringSubmatch(lastbc, -1)
-	// then building a map of matches
-	md = map[string]string{}
-	if len(ms) != 0 {
-		m = ms[0]
-		for i, j := range m {
-			md[n[i]] = j
+	if pattern, prefix, err = utils.BarecodeSeqPattern(t, v); err != nil {
+		return "", err
+	}
+
+	sqlr = `SELECT barecodesequence_value FROM barecodesequence WHERE barecodesequence_pattern = ?`
+	if err = sqlx.Get(tx, &seq, sqlr, pattern); err == sql.ErrNoRows {
+		// new sequence following the greatest number of the current storages with the same prefix
+		sqlr = `SELECT storage_barecode FROM storage
+		WHERE storage.storage IS NULL AND storage_id <> ? AND substr(storage_barecode, 1, ?) = ?`
+		if err = sqlx.Select(tx, &last, sqlr, s.StorageID.Int64, len(prefix), prefix); err != nil {
+			return "", err
+		}
+		r := regexp.MustCompile(pattern)
+		for _, bc := range last {
+			if m := r.FindStringSubmatch(bc); m != nil {
+				if i, _ := strconv.Atoi(m[1]); i > seq {
+					seq = i
+				}
+			}
 		}
+	} else if err != nil {
+		return "", err
 	}
-	if len(md) > 0 {
-		major = md["groupone"]
-		minor = md["grouptwo"]
-	} else {
-		major = strconv.Itoa(s.ProductID)
-		minor = "0"
+
+	// skipping the barecodes used by other templates or set by hand
+	for try := 0; try < storageBarecodeMaxTries; try++ {
+		var c int
+
+		seq++
+		v.Seq = seq
+		if barecode, err = utils.RenderBarecode(t, v); err != nil {
+			return "", err
+		}
+		sqlr = `SELECT count(*) FROM storage WHERE storage.storage IS NULL AND storage_id <> ? AND storage_barecode = ?`
+		if err = sqlx.Get(tx, &c, sqlr, s.StorageID.Int64, barecode); err != nil {
+			return "", err
+		}
+		if c != 0 {
+			continue
+		}
+
+		sqlr = `INSERT INTO barecodesequence (barecodesequence_pattern, barecodesequence_value) VALUES (?, ?)
+		ON CONFLICT(barecodesequence_pattern) DO UPDATE SET barecodesequence_value = excluded.barecodesequence_value`
+		if _, err = tx.Exec(sqlr, pattern, seq); err != nil {
+			return "", err
+		}
+		sqlr = `UPDATE storage SET storage_barecode = ? WHERE storage_id = ?`
+		if _, err = tx.Exec(sqlr, barecode, s.StorageID.Int64); err != nil {
+			if isUniqueConstraintError(err) {
+				return "", ErrStorageBarecodeUsed
+			}
+			return "", err
+		}
+		return barecode, nil
 	}
-	log.WithFields(log.Fields{"major": major, "minor": minor}).Debug("GenerateAndUpdateStorageBarecode")
 
-	if iminor, err = strconv.Atoi(minor); err != nil {
+	return "", ErrStorageBarecodeUsed
+}
+
+// StorageQRCodeURL returns the storage page URL encoded in the QR code
+// of the storage with id "id"
+func StorageQRCodeURL(id int64) string {
+	return global.ProxyURL + global.ProxyPath + "v/storages?storage=" + strconv.FormatInt(id, 10)
+}
+
+// updateStorageQRCode sets the QR code of the storage with id "id",
+// pointing to the storage page
+func updateStorageQRCode(tx sqlx.Execer, id int64) error {
+	var (
+		png []byte
+		err error
+	)
+
+	if png, err = qrcode.Encode(StorageQRCodeURL(id), qrcode.Medium, 128); err != nil {
 		return err
 	}
-	iminor++
-	minor = strconv.Itoa(iminor)
-	barecode = prefix + major + "." + minor
-	log.WithFields(log.Fields{"barecode": barecode}).Debug("GenerateAndUpdateStorageBarecode")
+	sqlr := `UPDATE storage 
+	SET storage_qrcode = ? 
+	WHERE storage_id = ?`
+	if _, err = tx.Exec(sqlr, png, id); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GenerateAndUpdateStorageBarecode generate and set a barecode for the storage s
+// from the barecode template of its entity, see generateStorageBarecode,
+// and its QR code
+func (db *SQLiteDataStore) GenerateAndUpdateStorageBarecode(s *Storage) error {
+	var (
+		err      error
+		tx       *sqlx.Tx
+		barecode string
+	)
+	log.WithFields(log.Fields{"s": s}).Debug("GenerateAndUpdateStorageBarecode")
 
-	// sqlr := `UPDATE storage
-	// SET storage_barecode = '` + prefix + `' || storage.product || '.' || (select count(*) from storage join storelocation on storage.storelocation = storelocation.storelocation_id join entity on storelocation.entity = entity.entity_id where storage.product = ? and entity_id = ?)
-	// WHERE storage_id = ?`
-	sqlr = `UPDATE storage 
-	SET storage_barecode = ? WHERE storage_id = ?`
-	if _, err = db.Exec(sqlr, barecode, s.StorageID.Int64); err != nil {
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
 		return err
 	}
 
-	//
-	// qrcode
-	//
-	qr := global.ProxyURL + global.ProxyPath + "v/storages?storage=" + strconv.FormatInt(s.StorageID.Int64, 10)
-	if png, err = qrcode.Encode(qr, qrcode.Medium, 128); err != nil {
+	// writing first to hold the write lock during the sequence allocation
+	if err = updateStorageQRCode(tx, s.StorageID.Int64); err != nil {
+		tx.Rollback()
 		return err
 	}
-	sqlr = `UPDATE storage 
-	SET storage_qrcode = ? 
-	WHERE storage_id = ?`
-	if _, err = db.Exec(sqlr, png, s.StorageID.Int64); err != nil {
+	if barecode, err = generateStorageBarecode(tx, s); err != nil {
+		tx.Rollback()
+		return err
+	}
+	log.WithFields(log.Fields{"barecode": barecode}).Debug("GenerateAndUpdateStorageBarecode")
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
 		return err
 	}
 
 	return nil
 }
 
-// CreateStorage creates a new storage
+// RenumberEntityStorages regenerates the barecodes of the current storages of the entity with id "id",
+// after a change of its barecode template, and returns the number of renumbered storages.
+// The barecodes of the storages history are kept and the sequences numbers are never reused.
+func (db *SQLiteDataStore) RenumberEntityStorages(id int) (int, error) {
+	var (
+		err      error
+		tx       *sqlx.Tx
+		storages []Storage
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+
+	// the former barecodes must not be followed nor collide,
+	// clearing them first also holds the write lock during the sequences allocation
+	sqlr := `UPDATE storage SET storage_barecode = NULL
+	WHERE storage.storage IS NULL AND storelocation IN (SELECT storelocation_id FROM storelocation WHERE entity = ?)`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	sqlr = `SELECT storage.storage_id,
+	storage.storage_creationdate,
+	storage.storage_modificationdate,
+	storage.product AS "product.product_id",
+	storage.storelocation AS "storelocation.storelocation_id"
+	FROM storage
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	WHERE storage.storage IS NULL AND storelocation.entity = ?
+	ORDER BY storage.storage_id`
+	if err = tx.Select(&storages, sqlr, id); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	for i := range storages {
+		if _, err = generateStorageBarecode(tx, &storages[i]); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "storages": len(storages)}).Debug("RenumberEntityStorages")
+	return len(storages), nil
+}
+
+// CreateStorage creates a new storage, with a generated barecode if none is given, and its QR code
 func (db *SQLiteDataStore) CreateStorage(s Storage) (int, error) {
 
+	var (
+		id  int
+		tx  *sqlx.Tx
+		err error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+
+	if id, err = createStorage(tx, s); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	log.WithFields(log.Fields{"id": id}).Debug("CreateStorage")
+
+	return id, nil
+}
+
+// createStorage inserts the storage s in the transaction tx, see CreateStorage
+func createStorage(tx *sqlx.Tx, s Storage) (int, error) {
+
 	var (
 		lastid   int64
-		tx       *sql.Tx
 		sqlr     string
 		res      sql.Result
 		sqla     []interface{}
@@ -755,21 +1129,14 @@ func (db *SQLiteDataStore) CreateStorage(s Storage) (int, error) {
 		err      error
 	)
 
-	// beginning transaction
-	if tx, err = db.Begin(); err != nil {
-		return 0, err
-	}
-
 	// if SupplierID = -1 then it is a new supplier
 	if v, err := s.Supplier.SupplierID.Value(); s.Supplier.SupplierID.Valid && err == nil && v.(int64) == -1 {
 		sqlr = `INSERT INTO supplier (supplier_label) VALUES (?)`
 		if res, err = tx.Exec(sqlr, s.Supplier.SupplierLabel); err != nil {
-			tx.Rollback()
 			return 0, err
 		}
 		// getting the last inserted id
 		if lastid, err = res.LastInsertId(); err != nil {
-			tx.Rollback()
 			return 0, err
 		}
 		// updating the storage SupplierId (SupplierLabel already set)
@@ -777,7 +1144,6 @@ func (db *SQLiteDataStore) CreateStorage(s Storage) (int, error) {
 	}
 	if err != nil {
 		log.Error("supplier error - " + err.Error())
-		tx.Rollback()
 		return 0, err
 	}
 
@@ -821,6 +1187,11 @@ func (db *SQLiteDataStore) CreateStorage(s Storage) (int, error) {
 	}
 
 	m["person"] = s.PersonID
+	m["storage_modifiedby"] = s.StorageModifiedBy
+	m["storage_parent"] = s.StorageParent
+	m["storage_shelflifereception"] = s.StorageShelfLifeReception
+	m["storage_shelflifeopening"] = s.StorageShelfLifeOpening
+	m["storage_expirationcomputed"] = s.StorageExpirationComputed
 	m["storelocation"] = s.StoreLocationID.Int64
 	m["product"] = s.ProductID
 	m["storage_creationdate"] = s.StorageCreationDate
@@ -853,30 +1224,46 @@ func (db *SQLiteDataStore) CreateStorage(s Storage) (int, error) {
 
 	ibuilder = sq.Insert("storage").Columns(col...).Values(val...)
 	if sqlr, sqla, err = ibuilder.ToSql(); err != nil {
-		tx.Rollback()
 		return 0, err
 	}
 
 	if res, err = tx.Exec(sqlr, sqla...); err != nil {
 		log.Error("storage error - " + err.Error())
 		log.Error("sql:" + sqlr)
-		tx.Rollback()
-		return 0, err
-	}
-
-	// committing changes
-	if err = tx.Commit(); err != nil {
-		tx.Rollback()
+		if isUniqueConstraintError(err) {
+			return 0, ErrStorageBarecodeUsed
+		}
 		return 0, err
 	}
 
 	// getting the last inserted id
 	if lastid, err = res.LastInsertId(); err != nil {
-		tx.Rollback()
 		return 0, err
 	}
 	s.StorageID = sql.NullInt64{Valid: true, Int64: lastid}
-	log.WithFields(log.Fields{"s": s}).Debug("CreateStorage")
+
+	// computing the expiration date once the write lock is held,
+	// reading the product shelf-lives first would fail the concurrent inserts
+	if err = setStorageExpirationDate(tx, &s); err != nil {
+		return 0, err
+	}
+	sqlr = `UPDATE storage SET storage_expirationdate = ?, storage_expirationcomputed = ? WHERE storage_id = ?`
+	if _, err = tx.Exec(sqlr, s.StorageExpirationDate, s.StorageExpirationComputed, lastid); err != nil {
+		return 0, err
+	}
+
+	// generating the barecode if not specified, in the insert transaction
+	// holding the write lock so that the sequence numbers are not allocated twice
+	if s.StorageBarecode.String == "" {
+		if _, err = generateStorageBarecode(tx, &s); err != nil {
+			return 0, err
+		}
+	}
+	if err = updateStorageQRCode(tx, lastid); err != nil {
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{"s": s}).Debug("createStorage")
 
 	return int(s.StorageID.Int64), nil
 }
@@ -887,7 +1274,7 @@ func (db *SQLiteDataStore) UpdateStorage(s Storage) error {
 	var (
 		sqlr     string
 		err      error
-		tx       *sql.Tx
+		tx       *sqlx.Tx
 		res      sql.Result
 		lastid   int64
 		sqla     []interface{}
@@ -895,49 +1282,12 @@ func (db *SQLiteDataStore) UpdateStorage(s Storage) error {
 	)
 
 	// beginning transaction
-	if tx, err = db.Begin(); err != nil {
+	if tx, err = db.Beginx(); err != nil {
 		return err
 	}
 
 	// create an history of the storage
-	sqlr = `INSERT into storage (storage_creationdate, 
-		storage_modificationdate,
-		storage_entrydate, 
-		storage_exitdate, 
-		storage_openingdate, 
-		storage_expirationdate,
-		storage_comment,
-		storage_reference,
-		storage_batchnumber,
-		storage_quantity,
-		storage_barecode,
-		storage_todestroy,
-		storage_archive,
-		person,
-		product,
-		storelocation,
-		unit,
-		supplier,
-		storage) select storage_creationdate, 
-				storage_modificationdate,
-				storage_entrydate, 
-				storage_exitdate, 
-				storage_openingdate, 
-				storage_expirationdate,
-				storage_comment,
-				storage_reference,
-				storage_batchnumber,
-				storage_quantity,
-				storage_barecode,
-				storage_todestroy,
-				storage_archive,
-				person,
-				product,
-				storelocation,
-				unit,
-				supplier,
-				? FROM storage WHERE storage_id = ?`
-	if res, err = tx.Exec(sqlr, s.StorageID, s.StorageID); err != nil {
+	if err = insertStorageHistory(tx, s.StorageID.Int64); err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -963,6 +1313,11 @@ func (db *SQLiteDataStore) UpdateStorage(s Storage) error {
 		return err
 	}
 
+	if err = setStorageExpirationDate(tx, &s); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// finally updating the storage
 	m := make(map[string]interface{})
 	if s.StorageComment.Valid {
@@ -1004,9 +1359,18 @@ func (db *SQLiteDataStore) UpdateStorage(s Storage) error {
 	m["storage_modificationdate"] = s.StorageModificationDate
 	m["storage_archive"] = s.StorageArchive
 	m["person"] = s.PersonID
+	m["storage_modifiedby"] = s.StorageModifiedBy
 	m["storelocation"] = s.StoreLocationID
 	m["unit"] = s.UnitID
 	m["supplier"] = s.SupplierID
+	m["storage_shelflifereception"] = s.StorageShelfLifeReception
+	m["storage_shelflifeopening"] = s.StorageShelfLifeOpening
+	m["storage_expirationcomputed"] = s.StorageExpirationComputed
+	// a computed expiration date is not set before the opening of the storage
+	// with only a shelf-life after opening
+	if s.StorageExpirationComputed {
+		m["storage_expirationdate"] = s.StorageExpirationDate
+	}
 
 	ubuilder = sq.Update("storage").
 		SetMap(m).
@@ -1017,6 +1381,9 @@ func (db *SQLiteDataStore) UpdateStorage(s Storage) error {
 	}
 	if _, err = tx.Exec(sqlr, sqla...); err != nil {
 		tx.Rollback()
+		if isUniqueConstraintError(err) {
+			return ErrStorageBarecodeUsed
+		}
 		return err
 	}
 
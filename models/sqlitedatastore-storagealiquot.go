@@ -0,0 +1,118 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrStorageSplitQuantity is returned when the aliquots quantities exceed the quantity of the split storage
+	ErrStorageSplitQuantity = errors.New("the aliquots quantities exceed the storage quantity")
+	// ErrStorageSplitArchive is returned when splitting an archived storage
+	ErrStorageSplitArchive = errors.New("an archived storage can not be split")
+)
+
+// SplitStorage splits the storage with id "id" into the aliquots, created by the person "personid",
+// and returns their ids. The aliquots inherit the product, batch number, reference, supplier, unit,
+// dates and shelf-lives of the storage, get generated barecodes, and their quantities are removed from the storage,
+// the storage being kept in its history as by UpdateStorage.
+func (db *SQLiteDataStore) SplitStorage(id int, aliquots []StorageAliquot, personid int) ([]int, error) {
+	var (
+		tx     *sqlx.Tx
+		err    error
+		parent Storage
+		total  float64
+		ids    []int
+	)
+	log.WithFields(log.Fields{"id": id, "aliquots": aliquots}).Debug("SplitStorage")
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return nil, err
+	}
+
+	sqlr := `SELECT storage_id, storage_entrydate, storage_openingdate, storage_expirationdate,
+	storage_quantity, storage_reference, storage_batchnumber, storage_archive,
+	storage_shelflifereception, storage_shelflifeopening, storage_expirationcomputed,
+	product AS "product.product_id",
+	unit AS "unit.unit_id",
+	supplier AS "supplier.supplier_id"
+	FROM storage
+	WHERE storage_id = ? AND storage IS NULL`
+	if err = tx.Get(&parent, sqlr, id); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if parent.StorageArchive.Bool {
+		tx.Rollback()
+		return nil, ErrStorageSplitArchive
+	}
+
+	for _, a := range aliquots {
+		total += a.StorageQuantity
+	}
+	// rounding errors of the decimal quantities
+	if !parent.StorageQuantity.Valid || total > parent.StorageQuantity.Float64*(1+1e-9) {
+		tx.Rollback()
+		return nil, ErrStorageSplitQuantity
+	}
+
+	// the split storage is updated first to hold the write lock during the barecodes allocation
+	if err = insertStorageHistory(tx, int64(id)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	now := time.Now()
+	remaining := parent.StorageQuantity.Float64 - total
+	if remaining < 0 {
+		remaining = 0
+	}
+	sqlr = `UPDATE storage SET storage_quantity = ?, storage_modificationdate = ?, storage_modifiedby = ?
+	WHERE storage_id = ?`
+	if _, err = tx.Exec(sqlr, remaining, now, personid, id); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	for _, a := range aliquots {
+		var cid int
+
+		child := Storage{
+			StorageCreationDate:       now,
+			StorageModificationDate:   now,
+			StorageEntryDate:          parent.StorageEntryDate,
+			StorageOpeningDate:        parent.StorageOpeningDate,
+			StorageExpirationDate:     parent.StorageExpirationDate,
+			StorageShelfLifeReception: parent.StorageShelfLifeReception,
+			StorageShelfLifeOpening:   parent.StorageShelfLifeOpening,
+			StorageExpirationComputed: parent.StorageExpirationComputed,
+			StorageQuantity:           sql.NullFloat64{Valid: true, Float64: a.StorageQuantity},
+			StorageReference:          parent.StorageReference,
+			StorageBatchNumber:        parent.StorageBatchNumber,
+			StorageParent:             sql.NullInt64{Valid: true, Int64: int64(id)},
+			Person:                    Person{PersonID: personid},
+			Product:                   Product{ProductID: parent.ProductID},
+			StoreLocation:             StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(a.StoreLocationID)}},
+			Unit:                      Unit{UnitID: parent.UnitID},
+			Supplier:                  Supplier{SupplierID: parent.SupplierID},
+		}
+		if cid, err = createStorage(tx, child); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		ids = append(ids, cid)
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrStorageBulkOperation is returned for an unknown storage bulk operation
+var ErrStorageBulkOperation = errors.New("wrong storage bulk operation")
+
+// storageBulkColumns are the storage columns set by the update bulk operations
+var storageBulkColumns = map[string]string{
+	"move":       "storelocation",
+	"todestroy":  "storage_todestroy",
+	"expiration": "storage_expirationdate",
+}
+
+// IsStorageBulkOperation returns true if op is a storage bulk operation
+func IsStorageBulkOperation(op string) bool {
+	switch op {
+	case "archive", "restore", "delete":
+		return true
+	}
+	_, ok := storageBulkColumns[op]
+	return ok
+}
+
+// ApplyStorageBulkOperation applies the operation op to all its storages in a single transaction,
+// the updated storages being kept in their history as by UpdateStorage
+func (db *SQLiteDataStore) ApplyStorageBulkOperation(op StorageBulkOperation) error {
+	var (
+		tx    *sqlx.Tx
+		err   error
+		value interface{}
+	)
+	log.WithFields(log.Fields{"op": op}).Debug("ApplyStorageBulkOperation")
+
+	if !IsStorageBulkOperation(op.Operation) {
+		return ErrStorageBulkOperation
+	}
+	switch op.Operation {
+	case "move":
+		value = op.StoreLocationID
+	case "todestroy":
+		value = op.StorageToDestroy
+	case "expiration":
+		value = op.StorageExpirationDate
+	}
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	// the expiration dates set are manual
+	set := storageBulkColumns[op.Operation] + ` = ?`
+	if op.Operation == "expiration" {
+		set += `, storage_expirationcomputed = 0`
+	}
+
+	now := time.Now()
+	for _, id := range op.StorageIDs {
+		switch op.Operation {
+		case "archive", "restore":
+			err = setStorageArchive(tx, id, op.Operation == "archive")
+		case "delete":
+			err = deleteStorage(tx, id)
+		default:
+			if err = insertStorageHistory(tx, int64(id)); err == nil {
+				sqlr := `UPDATE storage SET ` + set + `,
+				storage_modificationdate = ?, storage_modifiedby = ?
+				WHERE storage_id = ?`
+				_, err = tx.Exec(sqlr, value, now, op.PersonID, id)
+			}
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+)
+
+// ErrStorageVersionNotFound is returned when the version is not a history version of the storage
+var ErrStorageVersionNotFound = errors.New("the version is not a version of the storage")
+
+// storageVersion is a storage version row with the labels of its references
+type storageVersion struct {
+	StorageID             int             `db:"storage_id"`
+	Current               bool            `db:"current"`
+	ModificationDate      time.Time       `db:"storage_modificationdate"`
+	PersonID              int             `db:"person_id"`
+	PersonEmail           string          `db:"person_email"`
+	StorageEntryDate      global.NullTime `db:"storage_entrydate"`
+	StorageExitDate       global.NullTime `db:"storage_exitdate"`
+	StorageOpeningDate    global.NullTime `db:"storage_openingdate"`
+	StorageExpirationDate global.NullTime `db:"storage_expirationdate"`
+	StorageQuantity       sql.NullFloat64 `db:"storage_quantity"`
+	UnitLabel             sql.NullString  `db:"unit_label"`
+	StorageBarecode       sql.NullString  `db:"storage_barecode"`
+	StorageComment        sql.NullString  `db:"storage_comment"`
+	StorageReference      sql.NullString  `db:"storage_reference"`
+	StorageBatchNumber    sql.NullString  `db:"storage_batchnumber"`
+	StorageToDestroy      sql.NullBool    `db:"storage_todestroy"`
+	StoreLocationFullPath string          `db:"storelocation_fullpath"`
+	SupplierLabel         sql.NullString  `db:"supplier_label"`
+}
+
+// storageVersionFields are the compared fields of the storages versions
+var storageVersionFields = []struct {
+	name  string
+	value func(v storageVersion) string
+}{
+	{"storelocation", func(v storageVersion) string { return v.StoreLocationFullPath }},
+	{"storage_quantity", func(v storageVersion) string {
+		if !v.StorageQuantity.Valid {
+			return ""
+		}
+		return strconv.FormatFloat(v.StorageQuantity.Float64, 'g', -1, 64)
+	}},
+	{"unit", func(v storageVersion) string { return v.UnitLabel.String }},
+	{"storage_barecode", func(v storageVersion) string { return v.StorageBarecode.String }},
+	{"supplier", func(v storageVersion) string { return v.SupplierLabel.String }},
+	{"storage_reference", func(v storageVersion) string { return v.StorageReference.String }},
+	{"storage_batchnumber", func(v storageVersion) string { return v.StorageBatchNumber.String }},
+	{"storage_entrydate", func(v storageVersion) string { return versionDate(v.StorageEntryDate) }},
+	{"storage_exitdate", func(v storageVersion) string { return versionDate(v.StorageExitDate) }},
+	{"storage_openingdate", func(v storageVersion) string { return versionDate(v.StorageOpeningDate) }},
+	{"storage_expirationdate", func(v storageVersion) string { return versionDate(v.StorageExpirationDate) }},
+	{"storage_todestroy", func(v storageVersion) string {
+		if !v.StorageToDestroy.Valid {
+			return ""
+		}
+		return strconv.FormatBool(v.StorageToDestroy.Bool)
+	}},
+	{"storage_comment", func(v storageVersion) string { return v.StorageComment.String }},
+}
+
+// versionDate returns the date of t, empty if NULL
+func versionDate(t global.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format("2006-01-02")
+}
+
+// insertStorageHistory copies the storage with id "id" into a new history row
+// pointing to it
+func insertStorageHistory(tx sqlx.Execer, id int64) error {
+	sqlr := `INSERT into storage (storage_creationdate,
+		storage_modificationdate,
+		storage_entrydate,
+		storage_exitdate,
+		storage_openingdate,
+		storage_expirationdate,
+		storage_comment,
+		storage_reference,
+		storage_batchnumber,
+		storage_quantity,
+		storage_barecode,
+		storage_todestroy,
+		storage_archive,
+		person,
+		storage_modifiedby,
+		product,
+		storelocation,
+		unit,
+		supplier,
+		storage_shelflifereception,
+		storage_shelflifeopening,
+		storage_expirationcomputed,
+		storage) select storage_creationdate,
+				storage_modificationdate,
+				storage_entrydate,
+				storage_exitdate,
+				storage_openingdate,
+				storage_expirationdate,
+				storage_comment,
+				storage_reference,
+				storage_batchnumber,
+				storage_quantity,
+				storage_barecode,
+				storage_todestroy,
+				storage_archive,
+				person,
+				storage_modifiedby,
+				product,
+				storelocation,
+				unit,
+				supplier,
+				storage_shelflifereception,
+				storage_shelflifeopening,
+				storage_expirationcomputed,
+				? FROM storage WHERE storage_id = ?`
+	_, err := tx.Exec(sqlr, id, id)
+	return err
+}
+
+// GetStorageHistory returns the versions of the storage with id "id" from the oldest
+// to the current one, with the fields changed by each version
+func (db *SQLiteDataStore) GetStorageHistory(id int) ([]StorageVersion, error) {
+	var (
+		rows     []storageVersion
+		versions []StorageVersion
+		err      error
+	)
+
+	// the history rows are created in the updates order,
+	// the author of a version is its owner before the authors were recorded
+	sqlr := `SELECT s.storage_id, s.storage IS NULL AS current, s.storage_modificationdate,
+	person.person_id, person.person_email,
+	s.storage_entrydate, s.storage_exitdate, s.storage_openingdate, s.storage_expirationdate,
+	s.storage_quantity, unit.unit_label, s.storage_barecode, s.storage_comment,
+	s.storage_reference, s.storage_batchnumber, s.storage_todestroy,
+	storelocation.storelocation_fullpath, supplier.supplier_label
+	FROM storage AS s
+	JOIN person ON COALESCE(s.storage_modifiedby, s.person) = person.person_id
+	JOIN storelocation ON s.storelocation = storelocation.storelocation_id
+	LEFT JOIN unit ON s.unit = unit.unit_id
+	LEFT JOIN supplier ON s.supplier = supplier.supplier_id
+	WHERE s.storage_id = ? OR s.storage = ?
+	ORDER BY s.storage IS NULL, s.storage_id`
+	if err = db.Select(&rows, sqlr, id, id); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	for i, r := range rows {
+		v := StorageVersion{
+			StorageID:        r.StorageID,
+			Current:          r.Current,
+			ModificationDate: r.ModificationDate,
+			PersonID:         r.PersonID,
+			PersonEmail:      r.PersonEmail,
+			Changes:          []StorageChange{},
+		}
+		for _, f := range storageVersionFields {
+			var old string
+			if i > 0 {
+				old = f.value(rows[i-1])
+			}
+			if n := f.value(r); n != old {
+				v.Changes = append(v.Changes, StorageChange{Field: f.name, Old: old, New: n})
+			}
+		}
+		versions = append(versions, v)
+	}
+
+	log.WithFields(log.Fields{"id": id, "versions": versions}).Debug("GetStorageHistory")
+	return versions, nil
+}
+
+// RestoreStorageVersion reapplies the history version "version" of the storage with id "id"
+// but its quantity as a new update by the person "personid", the current storage being kept in its history
+func (db *SQLiteDataStore) RestoreStorageVersion(id int, version int, personid int) error {
+	var (
+		sqlr string
+		c    int
+		tx   *sqlx.Tx
+		err  error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	sqlr = `SELECT count(*) FROM storage WHERE storage_id = ? AND storage = ?`
+	if err = tx.Get(&c, sqlr, version, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if c == 0 {
+		tx.Rollback()
+		return ErrStorageVersionNotFound
+	}
+
+	if err = insertStorageHistory(tx, int64(id)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// the owner, product and archive state are not versioned
+	// the quantity and its unit are not restored not to undo the consumptions
+	sqlr = `UPDATE storage SET (storage_entrydate, storage_exitdate, storage_openingdate, storage_expirationdate,
+		storage_barecode, storage_comment, storage_reference, storage_batchnumber,
+		storage_todestroy, storelocation, supplier,
+		storage_shelflifereception, storage_shelflifeopening, storage_expirationcomputed) =
+		(SELECT storage_entrydate, storage_exitdate, storage_openingdate, storage_expirationdate,
+		storage_barecode, storage_comment, storage_reference, storage_batchnumber,
+		storage_todestroy, storelocation, supplier,
+		storage_shelflifereception, storage_shelflifeopening, storage_expirationcomputed FROM storage WHERE storage_id = ?),
+		storage_modificationdate = ?, storage_modifiedby = ?
+	WHERE storage_id = ?`
+	if _, err = tx.Exec(sqlr, version, time.Now(), personid, id); err != nil {
+		tx.Rollback()
+		if isUniqueConstraintError(err) {
+			return ErrStorageBarecodeUsed
+		}
+		return err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/global"
+)
+
+// ErrStorageOpened is returned when opening a storage already opened
+var ErrStorageOpened = errors.New("the storage is already opened")
+
+// setStorageExpirationDate computes the expiration date of the storage s when it is computed
+// or not set: the earliest of its entry date, or creation date if not set, plus its shelf-life
+// after reception and of its opening date plus its shelf-life after opening.
+// The shelf-lives of the storage override the ones of its product.
+// A storage without shelf-life keeps its expiration date, then not computed.
+func setStorageExpirationDate(q sqlx.Queryer, s *Storage) error {
+	var (
+		reception sql.NullInt64
+		opening   sql.NullInt64
+		err       error
+	)
+
+	if !s.StorageExpirationComputed && s.StorageExpirationDate.Valid {
+		return nil
+	}
+
+	sqlr := `SELECT product_shelflifereception, product_shelflifeopening FROM product WHERE product_id = ?`
+	if err = q.QueryRowx(sqlr, s.ProductID).Scan(&reception, &opening); err != nil {
+		return err
+	}
+	if s.StorageShelfLifeReception.Valid {
+		reception = s.StorageShelfLifeReception
+	}
+	if s.StorageShelfLifeOpening.Valid {
+		opening = s.StorageShelfLifeOpening
+	}
+	if !reception.Valid && !opening.Valid {
+		s.StorageExpirationComputed = false
+		return nil
+	}
+
+	// the expiration date of a storage with only a shelf-life after opening
+	// is not set until its opening
+	expiration := global.NullTime{}
+	if reception.Valid {
+		entry := s.StorageCreationDate
+		if s.StorageEntryDate.Valid {
+			entry = s.StorageEntryDate.Time
+		}
+		expiration = global.NullTime{Valid: true, Time: entry.AddDate(0, int(reception.Int64), 0)}
+	}
+	if opening.Valid && s.StorageOpeningDate.Valid {
+		t := s.StorageOpeningDate.Time.AddDate(0, int(opening.Int64), 0)
+		if !expiration.Valid || t.Before(expiration.Time) {
+			expiration = global.NullTime{Valid: true, Time: t}
+		}
+	}
+	s.StorageExpirationDate = expiration
+	s.StorageExpirationComputed = true
+
+	return nil
+}
+
+// OpenStorage sets the opening date of the storage with id "id" to now, opened by the person "personid",
+// and computes its expiration date, the storage being kept in its history as by UpdateStorage
+func (db *SQLiteDataStore) OpenStorage(id int, personid int) error {
+	var (
+		tx  *sqlx.Tx
+		err error
+		s   Storage
+	)
+	log.WithFields(log.Fields{"id": id, "personid": personid}).Debug("OpenStorage")
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	sqlr := `SELECT storage_id, storage_creationdate, storage_entrydate, storage_openingdate, storage_expirationdate,
+	storage_shelflifereception, storage_shelflifeopening, storage_expirationcomputed,
+	product AS "product.product_id"
+	FROM storage
+	WHERE storage_id = ? AND storage IS NULL`
+	if err = tx.Get(&s, sqlr, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if s.StorageOpeningDate.Valid {
+		tx.Rollback()
+		return ErrStorageOpened
+	}
+
+	now := time.Now()
+	s.StorageOpeningDate = global.NullTime{Valid: true, Time: now}
+	if err = setStorageExpirationDate(tx, &s); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = insertStorageHistory(tx, int64(id)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	sqlr = `UPDATE storage SET storage_openingdate = ?, storage_expirationdate = ?, storage_expirationcomputed = ?,
+	storage_modificationdate = ?, storage_modifiedby = ?
+	WHERE storage_id = ?`
+	if _, err = tx.Exec(sqlr, s.StorageOpeningDate, s.StorageExpirationDate, s.StorageExpirationComputed, now, personid, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// ComputeStoragesExpirationDates recomputes the expiration dates of the current storages
+// computed or not set, for example after a change of the products shelf-lives,
+// and returns the number of storages whose expiration date or origin changed.
+// The storages histories are not modified.
+func (db *SQLiteDataStore) ComputeStoragesExpirationDates() (int, error) {
+	var (
+		tx       *sqlx.Tx
+		err      error
+		storages []Storage
+		n        int
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+
+	sqlr := `SELECT storage_id, storage_creationdate, storage_entrydate, storage_openingdate, storage_expirationdate,
+	storage_shelflifereception, storage_shelflifeopening, storage_expirationcomputed,
+	product AS "product.product_id"
+	FROM storage
+	WHERE storage IS NULL AND NOT storage_archive
+	AND (storage_expirationcomputed OR storage_expirationdate IS NULL)`
+	if err = tx.Select(&storages, sqlr); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	for _, s := range storages {
+		previous, computed := s.StorageExpirationDate, s.StorageExpirationComputed
+		if err = setStorageExpirationDate(tx, &s); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if computed == s.StorageExpirationComputed &&
+			previous.Valid == s.StorageExpirationDate.Valid && previous.Time.Equal(s.StorageExpirationDate.Time) {
+			continue
+		}
+
+		sqlr = `UPDATE storage SET storage_expirationdate = ?, storage_expirationcomputed = ? WHERE storage_id = ?`
+		if _, err = tx.Exec(sqlr, s.StorageExpirationDate, s.StorageExpirationComputed, s.StorageID); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		n++
+	}
+	log.WithFields(log.Fields{"n": n}).Debug("ComputeStoragesExpirationDates")
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return n, nil
+}
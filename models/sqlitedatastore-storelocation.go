@@ -214,6 +214,16 @@ func (db *SQLiteDataStore) DeleteStoreLocation(id int) error {
 		sqlr string
 		err  error
 	)
+	sqlr = `DELETE FROM transfer
+	WHERE source = ? OR target = ?`
+	if _, err = db.Exec(sqlr, id, id); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM inventoryscan
+	WHERE storelocation = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
 	sqlr = `DELETE FROM storelocation 
 	WHERE storelocation_id = ?`
 	if _, err = db.Exec(sqlr, id); err != nil {
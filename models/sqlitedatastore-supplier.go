@@ -0,0 +1,285 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrSupplierUsed is returned when deleting a supplier still referenced by storages or purchases
+var ErrSupplierUsed = errors.New("the supplier is used by storages or purchases")
+
+// supplierRefQuantityTolerance is the relative tolerance of the pack size search
+const supplierRefQuantityTolerance = 0.001
+
+// supplierRefSelect is the common supplier references select query
+const supplierRefSelect = `SELECT supplierref_id, supplierref_label, supplierref_quantity, supplierref_price, supplierref_gtin,
+	supplier.supplier_id, supplier.supplier_label,
+	product.product_id, name.name_label, casnumber.casnumber_label,
+	unit.unit_id, unit.unit_label
+	FROM supplierref
+	JOIN supplier ON supplierref.supplier = supplier.supplier_id
+	JOIN product ON supplierref.product = product.product_id
+	JOIN name ON product.name = name.name_id
+	LEFT JOIN casnumber ON product.casnumber = casnumber.casnumber_id
+	LEFT JOIN unit ON supplierref.unit = unit.unit_id`
+
+// GetSupplier returns the supplier with id "id"
+func (db *SQLiteDataStore) GetSupplier(id int) (Supplier, error) {
+	var (
+		s   Supplier
+		err error
+	)
+
+	sqlr := `SELECT supplier_id, supplier_label, supplier_email, supplier_phone, supplier_address, supplier_website
+	FROM supplier WHERE supplier_id = ?`
+	if err = db.Get(&s, sqlr, id); err != nil {
+		return Supplier{}, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "s": s}).Debug("GetSupplier")
+	return s, nil
+}
+
+// CreateSupplier creates the supplier s and returns its id
+func (db *SQLiteDataStore) CreateSupplier(s Supplier) (int, error) {
+	var (
+		res    sql.Result
+		lastid int64
+		err    error
+	)
+
+	sqlr := `INSERT INTO supplier (supplier_label, supplier_email, supplier_phone, supplier_address, supplier_website)
+	VALUES (?, ?, ?, ?, ?)`
+	if res, err = db.Exec(sqlr, s.SupplierLabel, s.SupplierEmail, s.SupplierPhone, s.SupplierAddress, s.SupplierWebsite); err != nil {
+		return 0, err
+	}
+	if lastid, err = res.LastInsertId(); err != nil {
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{"s": s, "lastid": lastid}).Debug("CreateSupplier")
+	return int(lastid), nil
+}
+
+// UpdateSupplier updates the supplier s
+func (db *SQLiteDataStore) UpdateSupplier(s Supplier) error {
+	var err error
+
+	sqlr := `UPDATE supplier SET supplier_label = ?, supplier_email = ?, supplier_phone = ?, supplier_address = ?, supplier_website = ?
+	WHERE supplier_id = ?`
+	if _, err = db.Exec(sqlr, s.SupplierLabel, s.SupplierEmail, s.SupplierPhone, s.SupplierAddress, s.SupplierWebsite, s.SupplierID); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"s": s}).Debug("UpdateSupplier")
+	return nil
+}
+
+// DeleteSupplier deletes the supplier with id "id" and its references
+func (db *SQLiteDataStore) DeleteSupplier(id int) error {
+	var (
+		tx  *sqlx.Tx
+		c   int
+		err error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	sqlr := `SELECT (SELECT count(*) FROM storage WHERE supplier = ?1) + (SELECT count(*) FROM purchase WHERE supplier = ?1)`
+	if err = tx.Get(&c, sqlr, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if c != 0 {
+		tx.Rollback()
+		return ErrSupplierUsed
+	}
+
+	for _, sqlr = range []string{
+		`DELETE FROM supplierref WHERE supplier = ?`,
+		`DELETE FROM supplier WHERE supplier_id = ?`,
+	} {
+		if _, err = tx.Exec(sqlr, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	log.WithFields(log.Fields{"id": id}).Debug("DeleteSupplier")
+	return nil
+}
+
+// MergeSupplier merges the duplicate supplier with id "from" into the supplier with id "to":
+// storages, purchases and references are moved and the from supplier is deleted.
+// The references already known by the to supplier are dropped.
+func (db *SQLiteDataStore) MergeSupplier(from int, to int) error {
+	var (
+		tx   *sqlx.Tx
+		sqlr string
+		err  error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	for _, sqlr = range []string{
+		`UPDATE storage SET supplier = ? WHERE supplier = ?`,
+		`UPDATE purchase SET supplier = ? WHERE supplier = ?`,
+		`UPDATE OR IGNORE supplierref SET supplier = ? WHERE supplier = ?`,
+	} {
+		if _, err = tx.Exec(sqlr, to, from); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, sqlr = range []string{
+		`DELETE FROM supplierref WHERE supplier = ?`,
+		`DELETE FROM supplier WHERE supplier_id = ?`,
+	} {
+		if _, err = tx.Exec(sqlr, from); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	log.WithFields(log.Fields{"from": from, "to": to}).Debug("MergeSupplier")
+	return nil
+}
+
+// GetSupplierRef returns the supplier reference with id "id"
+func (db *SQLiteDataStore) GetSupplierRef(id int) (SupplierRef, error) {
+	var (
+		r   SupplierRef
+		err error
+	)
+
+	if err = db.Get(&r, supplierRefSelect+` WHERE supplierref_id = ?`, id); err != nil {
+		return SupplierRef{}, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "r": r}).Debug("GetSupplierRef")
+	return r, nil
+}
+
+// GetSupplierRefs returns the supplier references matching the search s, the cheapest first.
+// The pack size search compares the quantities converted into the reference unit of s.UnitID.
+func (db *SQLiteDataStore) GetSupplierRefs(s SupplierRefSearch) ([]SupplierRef, error) {
+	var (
+		rs    []SupplierRef
+		where []string
+		args  []interface{}
+		err   error
+	)
+
+	if s.SupplierID != 0 {
+		where = append(where, `supplier.supplier_id = ?`)
+		args = append(args, s.SupplierID)
+	}
+	if s.ProductID != 0 {
+		where = append(where, `product.product_id = ?`)
+		args = append(args, s.ProductID)
+	}
+	if s.GTIN != "" {
+		where = append(where, `supplierref_gtin = ?`)
+		args = append(args, s.GTIN)
+	}
+	if s.CasNumber != "" {
+		where = append(where, `casnumber.casnumber_label = ?`)
+		args = append(args, s.CasNumber)
+	}
+	if s.UnitID != 0 {
+		// same unit family
+		where = append(where, `IFNULL(unit.unit, unit.unit_id) = (SELECT IFNULL(u.unit, u.unit_id) FROM unit AS u WHERE u.unit_id = ?)`)
+		args = append(args, s.UnitID)
+		if s.Quantity != 0 {
+			where = append(where, `ABS(supplierref_quantity * IFNULL(unit.unit_multiplier, 1) -
+			? * (SELECT IFNULL(u.unit_multiplier, 1) FROM unit AS u WHERE u.unit_id = ?)) <=
+			? * (SELECT IFNULL(u.unit_multiplier, 1) FROM unit AS u WHERE u.unit_id = ?)`)
+			args = append(args, s.Quantity, s.UnitID, s.Quantity*supplierRefQuantityTolerance, s.UnitID)
+		}
+	}
+
+	sqlr := supplierRefSelect
+	if len(where) > 0 {
+		sqlr += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	sqlr += ` ORDER BY supplierref_price IS NULL, supplierref_price, supplier.supplier_label, supplierref_label`
+	if err = db.Select(&rs, sqlr, args...); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{"s": s, "rs": len(rs)}).Debug("GetSupplierRefs")
+	return rs, nil
+}
+
+// CreateSupplierRef creates the supplier reference r and returns its id
+func (db *SQLiteDataStore) CreateSupplierRef(r SupplierRef) (int, error) {
+	var (
+		res    sql.Result
+		lastid int64
+		err    error
+	)
+
+	sqlr := `INSERT INTO supplierref (supplierref_label, supplierref_quantity, supplierref_price, supplierref_gtin, supplier, product, unit)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`
+	if res, err = db.Exec(sqlr, r.SupplierRefLabel, r.SupplierRefQuantity, r.SupplierRefPrice, r.SupplierRefGTIN, r.SupplierID, r.ProductID, r.UnitID); err != nil {
+		return 0, err
+	}
+	if lastid, err = res.LastInsertId(); err != nil {
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{"r": r, "lastid": lastid}).Debug("CreateSupplierRef")
+	return int(lastid), nil
+}
+
+// UpdateSupplierRef updates the supplier reference r
+func (db *SQLiteDataStore) UpdateSupplierRef(r SupplierRef) error {
+	var err error
+
+	sqlr := `UPDATE supplierref SET supplierref_label = ?, supplierref_quantity = ?, supplierref_price = ?, supplierref_gtin = ?,
+	supplier = ?, product = ?, unit = ?
+	WHERE supplierref_id = ?`
+	if _, err = db.Exec(sqlr, r.SupplierRefLabel, r.SupplierRefQuantity, r.SupplierRefPrice, r.SupplierRefGTIN, r.SupplierID, r.ProductID, r.UnitID, r.SupplierRefID); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"r": r}).Debug("UpdateSupplierRef")
+	return nil
+}
+
+// DeleteSupplierRef deletes the supplier reference with id "id"
+func (db *SQLiteDataStore) DeleteSupplierRef(id int) error {
+	var err error
+
+	if _, err = db.Exec(`DELETE FROM supplierref WHERE supplierref_id = ?`, id); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"id": id}).Debug("DeleteSupplierRef")
+	return nil
+}
@@ -0,0 +1,251 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrTransferPending is returned when the storage already has a pending transfer
+	ErrTransferPending = errors.New("the storage already has a pending transfer")
+	// ErrTransferTarget is returned when the target store location can not receive the storage
+	ErrTransferTarget = errors.New("wrong transfer target store location")
+	// ErrTransferNotPending is returned when the transfer has already been accepted or refused
+	ErrTransferNotPending = errors.New("the transfer is not pending")
+)
+
+// transferSelect is the common transfers select query
+const transferSelect = `SELECT transfer_id, transfer_status, transfer_creationdate, transfer_decisiondate, transfer_comment,
+	storage.storage_id, storage.storage_barecode, name.name_label,
+	person.person_id, person.person_email,
+	decider.person_id AS decider_id, decider.person_email AS decider_email,
+	source.storelocation_id AS source_storelocation_id, source.storelocation_fullpath AS source_storelocation_fullpath,
+	sourceentity.entity_id AS source_entity_id, sourceentity.entity_name AS source_entity_name,
+	target.storelocation_id AS target_storelocation_id, target.storelocation_fullpath AS target_storelocation_fullpath,
+	targetentity.entity_id AS target_entity_id, targetentity.entity_name AS target_entity_name
+	FROM transfer
+	JOIN storage ON transfer.storage = storage.storage_id
+	JOIN product ON storage.product = product.product_id
+	JOIN name ON product.name = name.name_id
+	JOIN person ON transfer.person = person.person_id
+	LEFT JOIN person AS decider ON transfer.decider = decider.person_id
+	JOIN storelocation AS source ON transfer.source = source.storelocation_id
+	JOIN entity AS sourceentity ON source.entity = sourceentity.entity_id
+	JOIN storelocation AS target ON transfer.target = target.storelocation_id
+	JOIN entity AS targetentity ON target.entity = targetentity.entity_id`
+
+// CreateTransfer creates a pending transfer of the storage t.StorageID
+// to the store location t.TargetStoreLocationID and returns its id
+func (db *SQLiteDataStore) CreateTransfer(t Transfer) (int, error) {
+	var (
+		tx     *sqlx.Tx
+		lastid int
+		err    error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+
+	if lastid, err = createTransfer(tx, t); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{"t": t, "lastid": lastid}).Debug("CreateTransfer")
+	return lastid, nil
+}
+
+// createTransfer inserts the transfer t in the transaction tx, see CreateTransfer
+func createTransfer(tx *sqlx.Tx, t Transfer) (int, error) {
+	var (
+		sqlr     string
+		res      sql.Result
+		lastid   int64
+		source   int
+		c        int
+		canstore sql.NullBool
+		err      error
+	)
+
+	// only one pending transfer per storage
+	sqlr = `SELECT count(*) FROM transfer WHERE storage = ? AND transfer_status = "pending"`
+	if err = tx.Get(&c, sqlr, t.StorageID); err != nil {
+		return 0, err
+	}
+	if c != 0 {
+		return 0, ErrTransferPending
+	}
+
+	// the target must be another store location that can store
+	sqlr = `SELECT storelocation FROM storage WHERE storage_id = ?`
+	if err = tx.Get(&source, sqlr, t.StorageID); err != nil {
+		return 0, err
+	}
+	sqlr = `SELECT storelocation_canstore FROM storelocation WHERE storelocation_id = ?`
+	if err = tx.Get(&canstore, sqlr, t.TargetStoreLocationID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrTransferTarget
+		}
+		return 0, err
+	}
+	if !canstore.Bool || source == t.TargetStoreLocationID {
+		return 0, ErrTransferTarget
+	}
+
+	sqlr = `INSERT INTO transfer (transfer_status, transfer_creationdate, transfer_comment, storage, person, source, target)
+	VALUES ("pending", ?, ?, ?, ?, ?, ?)`
+	if res, err = tx.Exec(sqlr, time.Now(), t.TransferComment, t.StorageID, t.PersonID, source, t.TargetStoreLocationID); err != nil {
+		return 0, err
+	}
+	if lastid, err = res.LastInsertId(); err != nil {
+		return 0, err
+	}
+
+	return int(lastid), nil
+}
+
+// GetTransfer returns the transfer with id "id"
+func (db *SQLiteDataStore) GetTransfer(id int) (Transfer, error) {
+	var (
+		t   Transfer
+		err error
+	)
+
+	if err = db.Get(&t, transferSelect+` WHERE transfer_id = ?`, id); err != nil {
+		return Transfer{}, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "t": t}).Debug("GetTransfer")
+	return t, nil
+}
+
+// GetStorageTransfers returns the transfers history of the storage with id "id"
+func (db *SQLiteDataStore) GetStorageTransfers(id int) ([]Transfer, error) {
+	var (
+		ts  []Transfer
+		err error
+	)
+
+	if err = db.Select(&ts, transferSelect+` WHERE transfer.storage = ? ORDER BY transfer_creationdate DESC`, id); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "ts": ts}).Debug("GetStorageTransfers")
+	return ts, nil
+}
+
+// GetEntityTransfers returns the transfers from or to the entity with id "id"
+// the pending ones first
+func (db *SQLiteDataStore) GetEntityTransfers(id int) ([]Transfer, error) {
+	var (
+		ts  []Transfer
+		err error
+	)
+
+	sqlr := transferSelect + ` WHERE sourceentity.entity_id = ? OR targetentity.entity_id = ?
+	ORDER BY transfer_status != "pending", transfer_creationdate DESC`
+	if err = db.Select(&ts, sqlr, id, id); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "ts": ts}).Debug("GetEntityTransfers")
+	return ts, nil
+}
+
+// decideTransfer sets the status of the pending transfer with id "id"
+// and moves the storage to the target store location when accepted, keeping the former
+// version in its history and regenerating its barecode if it changes of entity
+func (db *SQLiteDataStore) decideTransfer(id int, personid int, status string) (Transfer, error) {
+	var (
+		tx   *sqlx.Tx
+		t    Transfer
+		s    Storage
+		sqlr string
+		err  error
+	)
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return Transfer{}, err
+	}
+
+	if err = tx.Get(&t, transferSelect+` WHERE transfer_id = ?`, id); err != nil {
+		tx.Rollback()
+		return Transfer{}, err
+	}
+	if t.TransferStatus != "pending" {
+		tx.Rollback()
+		return Transfer{}, ErrTransferNotPending
+	}
+
+	sqlr = `UPDATE transfer SET transfer_status = ?, transfer_decisiondate = ?, decider = ? WHERE transfer_id = ?`
+	if _, err = tx.Exec(sqlr, status, time.Now(), personid, id); err != nil {
+		tx.Rollback()
+		return Transfer{}, err
+	}
+
+	if status == "accepted" {
+		// the storage before the transfer is kept in its history
+		if err = insertStorageHistory(tx, int64(t.StorageID)); err != nil {
+			tx.Rollback()
+			return Transfer{}, err
+		}
+		sqlr = `UPDATE storage SET storelocation = ?, storage_modificationdate = ?, storage_modifiedby = ? WHERE storage_id = ?`
+		if _, err = tx.Exec(sqlr, t.TargetStoreLocationID, time.Now(), personid, t.StorageID); err != nil {
+			tx.Rollback()
+			return Transfer{}, err
+		}
+
+		// barecodes follow the template of the storage entity
+		if t.SourceEntityID != t.TargetEntityID {
+			sqlr = `SELECT storage_id, storage_creationdate,
+			product AS "product.product_id",
+			storelocation AS "storelocation.storelocation_id"
+			FROM storage WHERE storage_id = ?`
+			if err = tx.Get(&s, sqlr, t.StorageID); err != nil {
+				tx.Rollback()
+				return Transfer{}, err
+			}
+			if _, err = generateStorageBarecode(tx, &s); err != nil {
+				tx.Rollback()
+				return Transfer{}, err
+			}
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return Transfer{}, err
+	}
+
+	log.WithFields(log.Fields{"id": id, "status": status}).Info("storage transfer decided")
+	return t, nil
+}
+
+// AcceptTransfer accepts the pending transfer with id "id" for the manager personid,
+// moves the storage and regenerates its barecode if it changes of entity
+func (db *SQLiteDataStore) AcceptTransfer(id int, personid int) error {
+	_, err := db.decideTransfer(id, personid, "accepted")
+	return err
+}
+
+// RefuseTransfer refuses the pending transfer with id "id" for the manager personid
+func (db *SQLiteDataStore) RefuseTransfer(id int, personid int) error {
+	_, err := db.decideTransfer(id, personid, "refused")
+	return err
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"bufio"
+	"context"
 	"database/sql"
 	"encoding/csv"
 	"io"
@@ -100,13 +101,251 @@ func NewSQLiteDBstore(dataSourceName string) (*SQLiteDataStore, error) {
 	)
 
 	log.WithFields(log.Fields{"dbdriver": "sqlite3", "dataSourceName": dataSourceName}).Debug("NewDBstore")
-	if db, err = sqlx.Connect("sqlite3_with_go_func", dataSourceName+"?_journal=wal&_fk=1"); err != nil {
+	if db, err = sqlx.Connect("sqlite3_with_go_func", dataSourceName+"?_journal=wal&_fk=1&_busy_timeout=5000"); err != nil {
 		return &SQLiteDataStore{}, err
 	}
 
 	return &SQLiteDataStore{db}, nil
 }
 
+// addColumn adds the column with the given definition to the table
+// if it does not exist yet
+func (db *SQLiteDataStore) addColumn(table string, column string, definition string) error {
+	var (
+		c   int
+		err error
+	)
+
+	if err = db.Get(&c, `SELECT count(*) FROM pragma_table_info(?) WHERE name = ?`, table, column); err != nil {
+		return err
+	}
+	if c == 0 {
+		log.Info("  adding column " + table + "." + column)
+		if _, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateBorrowing rebuilds the former borrowing table allowing one borrowing per storage
+// to keep the borrowings history
+func (db *SQLiteDataStore) migrateBorrowing() error {
+	var (
+		c   int
+		tx  *sqlx.Tx
+		err error
+	)
+
+	if err = db.Get(&c, `SELECT count(*) FROM pragma_table_info("borrowing") WHERE name = "borrowing_state"`); err != nil {
+		return err
+	}
+	if c == 0 {
+		log.Info("  migrating borrowing table")
+
+		// beginning transaction
+		if tx, err = db.Beginx(); err != nil {
+			return err
+		}
+		sqlr := `CREATE TABLE borrowing_new (
+			borrowing_id integer PRIMARY KEY,
+			borrowing_comment string,
+			borrowing_date datetime,
+			borrowing_duedate datetime,
+			borrowing_returndate datetime,
+			borrowing_returnquantity float,
+			borrowing_reminderdate datetime,
+			borrowing_state string NOT NULL default "active",
+			person integer NOT NULL,
+			borrower integer NOT NULL,
+			storage integer NOT NULL,
+			FOREIGN KEY(person) references person(person_id),
+			FOREIGN KEY(storage) references storage(storage_id),
+			FOREIGN KEY(borrower) references person(person_id));
+		INSERT INTO borrowing_new (borrowing_id, borrowing_comment, person, borrower, storage)
+			SELECT borrowing_id, borrowing_comment, person, borrower, storage FROM borrowing;
+		DROP TABLE borrowing;
+		ALTER TABLE borrowing_new RENAME TO borrowing;`
+		if _, err = tx.Exec(sqlr); err != nil {
+			tx.Rollback()
+			return err
+		}
+		// committing changes
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// one active borrowing per storage
+	if _, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_borrowing_active ON borrowing(storage) WHERE borrowing_returndate IS NULL`); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// migrateStorageBarecode rebuilds the former storage table with a text storage_barecode column:
+// with the numeric affinity of the former string type the barecodes looking like numbers
+// were converted, 12.10 becoming 12.1
+func (db *SQLiteDataStore) migrateStorageBarecode() error {
+	var (
+		t    string
+		conn *sql.Conn
+		tx   *sql.Tx
+		err  error
+	)
+
+	if err = db.Get(&t, `SELECT type FROM pragma_table_info("storage") WHERE name = "storage_barecode"`); err != nil {
+		return err
+	}
+	if strings.EqualFold(t, "text") {
+		return nil
+	}
+	log.Info("  migrating storage table")
+
+	// the foreign keys can not be disabled in a transaction,
+	// a dedicated connection is used to drop the referenced storage table
+	ctx := context.Background()
+	if conn, err = db.DB.DB.Conn(ctx); err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+
+	// beginning transaction
+	if tx, err = conn.BeginTx(ctx, nil); err != nil {
+		return err
+	}
+	sqlr := `CREATE TABLE storage_new (
+			storage_id integer PRIMARY KEY,
+			storage_creationdate datetime NOT NULL,
+			storage_modificationdate datetime NOT NULL,
+			storage_entrydate datetime,
+			storage_exitdate datetime,
+			storage_openingdate datetime,
+			storage_expirationdate datetime,
+			storage_quantity float,
+			storage_barecode text,
+			storage_comment string,
+			storage_reference string,
+			storage_batchnumber string,
+			storage_todestroy boolean default 0,
+			storage_archive boolean default 0,
+			storage_qrcode blob,
+			person integer NOT NULL,
+			product integer NOT NULL,
+			storelocation integer NOT NULL,
+			unit integer,
+			supplier integer,
+			storage integer,
+			FOREIGN KEY(storage) references storage(storage_id),
+			FOREIGN KEY(unit) references unit(unit_id),
+			FOREIGN KEY(supplier) references supplier(supplier_id),
+			FOREIGN KEY(person) references person(person_id),
+			FOREIGN KEY(product) references product(product_id),
+			FOREIGN KEY(storelocation) references storelocation(storelocation_id));
+		INSERT INTO storage_new (storage_id, storage_creationdate, storage_modificationdate, storage_entrydate, storage_exitdate,
+			storage_openingdate, storage_expirationdate, storage_quantity, storage_barecode, storage_comment,
+			storage_reference, storage_batchnumber, storage_todestroy, storage_archive, storage_qrcode,
+			person, product, storelocation, unit, supplier, storage)
+			SELECT storage_id, storage_creationdate, storage_modificationdate, storage_entrydate, storage_exitdate,
+			storage_openingdate, storage_expirationdate, storage_quantity, storage_barecode, storage_comment,
+			storage_reference, storage_batchnumber, storage_todestroy, storage_archive, storage_qrcode,
+			person, product, storelocation, unit, supplier, storage FROM storage;
+		DROP TABLE storage;
+		ALTER TABLE storage_new RENAME TO storage;
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_storage_product ON storage(storage_id, product);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_storage_storelocation ON storage(storage_id, storelocation);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_storage_storelocation_product ON storage(storage_id, storelocation, product);`
+	if _, err = tx.Exec(sqlr); err != nil {
+		tx.Rollback()
+		return err
+	}
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// uniqueStorageBarecodes creates the unique index of the current storages barecodes if needed,
+// the duplicated barecodes of the former databases, unique per entity only, being regenerated first.
+// Each regenerated barecode is logged to relabel its storage.
+func (db *SQLiteDataStore) uniqueStorageBarecodes() error {
+	var (
+		c        int
+		tx       *sqlx.Tx
+		storages []Storage
+		barecode string
+		err      error
+	)
+
+	if err = db.Get(&c, `SELECT count(*) FROM sqlite_master WHERE type = "index" AND name = "idx_storage_barecode"`); err != nil {
+		return err
+	}
+	if c != 0 {
+		return nil
+	}
+
+	// beginning transaction
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	// all the duplicates but the oldest
+	sqlr := `SELECT storage_id, storage_creationdate, storage_modificationdate, storage_barecode,
+	product AS "product.product_id",
+	storelocation AS "storelocation.storelocation_id"
+	FROM storage AS s
+	WHERE storage IS NULL AND storage_barecode IS NOT NULL AND storage_barecode <> ''
+	AND EXISTS (SELECT 1 FROM storage AS d WHERE d.storage IS NULL AND d.storage_barecode = s.storage_barecode AND d.storage_id < s.storage_id)
+	ORDER BY storage_id`
+	if err = tx.Select(&storages, sqlr); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if len(storages) > 0 {
+		log.Info("  regenerating " + strconv.Itoa(len(storages)) + " duplicated storages barecodes")
+	}
+	for i := range storages {
+		old := storages[i].StorageBarecode.String
+		if barecode, err = generateStorageBarecode(tx, &storages[i]); err != nil {
+			tx.Rollback()
+			return err
+		}
+		// the storages labels must be printed again
+		log.WithFields(log.Fields{"storage_id": storages[i].StorageID.Int64, "old": old, "new": barecode}).Warn("  duplicated storage barecode regenerated")
+	}
+
+	sqlr = `CREATE UNIQUE INDEX idx_storage_barecode ON storage(storage_barecode)
+	WHERE storage IS NULL AND storage_barecode IS NOT NULL AND storage_barecode <> ''`
+	if _, err = tx.Exec(sqlr); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// isUniqueConstraintError returns true if err is a SQLite unique constraint violation
+func isUniqueConstraintError(err error) bool {
+	e, ok := err.(sqlite3.Error)
+	return ok && (e.ExtendedCode == sqlite3.ErrConstraintUnique || e.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
 // CreateDatabase creates the database tables
 func (db *SQLiteDataStore) CreateDatabase() error {
 	var (
@@ -137,7 +376,11 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 	CREATE TABLE IF NOT EXISTS entity (
 		entity_id integer PRIMARY KEY,
 		entity_name string UNIQUE NOT NULL,
-		entity_description string);
+		entity_description string,
+		entity_sharestocks boolean default 0,
+		entity_code string,
+		entity_barecodetemplate string,
+		entity_labelprinter string);
 	CREATE UNIQUE INDEX IF NOT EXISTS idx_entity ON entity(entity_name);
 
 	CREATE TABLE IF NOT EXISTS storelocation (
@@ -153,7 +396,26 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 	
 	CREATE TABLE IF NOT EXISTS supplier (
 		supplier_id integer PRIMARY KEY,
-		supplier_label string NOT NULL);
+		supplier_label string NOT NULL,
+		supplier_email string,
+		supplier_phone string,
+		supplier_address string,
+		supplier_website string);
+	CREATE TABLE IF NOT EXISTS supplierref (
+		supplierref_id integer PRIMARY KEY,
+		supplierref_label string NOT NULL,
+		supplierref_quantity float,
+		supplierref_price float,
+		supplierref_gtin text, -- text affinity keeps the GTINs leading zeros
+		supplier integer NOT NULL,
+		product integer NOT NULL,
+		unit integer,
+		FOREIGN KEY(supplier) references supplier(supplier_id),
+		FOREIGN KEY(product) references product(product_id),
+		FOREIGN KEY(unit) references unit(unit_id),
+		UNIQUE(supplier, supplierref_label));
+	CREATE INDEX IF NOT EXISTS idx_supplierref_product ON supplierref(product);
+	CREATE INDEX IF NOT EXISTS idx_supplierref_gtin ON supplierref(supplierref_gtin);
 	CREATE TABLE IF NOT EXISTS unit (
 		unit_id integer PRIMARY KEY,
 		unit_label string NOT NULL,
@@ -169,7 +431,7 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 		storage_openingdate datetime,
 		storage_expirationdate datetime,
 		storage_quantity float,
-		storage_barecode string,
+		storage_barecode text,
 		storage_comment string,
 		storage_reference string,
 		storage_batchnumber string,
@@ -182,12 +444,19 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 		unit integer,
 		supplier integer,
 		storage integer,
+		storage_modifiedby integer,
+		storage_parent integer,
+		storage_shelflifereception integer,
+		storage_shelflifeopening integer,
+		storage_expirationcomputed boolean default 0,
 		FOREIGN KEY(storage) references storage(storage_id),
 		FOREIGN KEY(unit) references unit(unit_id),
 		FOREIGN KEY(supplier) references supplier(supplier_id),
 		FOREIGN KEY(person) references person(person_id),
 		FOREIGN KEY(product) references product(product_id),
-		FOREIGN KEY(storelocation) references storelocation(storelocation_id));
+		FOREIGN KEY(storelocation) references storelocation(storelocation_id),
+		FOREIGN KEY(storage_modifiedby) references person(person_id),
+		FOREIGN KEY(storage_parent) references storage(storage_id));
 	CREATE UNIQUE INDEX IF NOT EXISTS idx_storage_product ON storage(storage_id, product);
 	CREATE UNIQUE INDEX IF NOT EXISTS idx_storage_storelocation ON storage(storage_id, storelocation);
 	CREATE UNIQUE INDEX IF NOT EXISTS idx_storage_storelocation_product ON storage(storage_id, storelocation, product);
@@ -195,9 +464,15 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 	CREATE TABLE IF NOT EXISTS borrowing (
 		borrowing_id integer PRIMARY KEY,
 		borrowing_comment string,
+		borrowing_date datetime,
+		borrowing_duedate datetime,
+		borrowing_returndate datetime,
+		borrowing_returnquantity float,
+		borrowing_reminderdate datetime,
+		borrowing_state string NOT NULL default "active",
 		person integer NOT NULL,
 		borrower integer NOT NULL,
-		storage integer NOT NULL UNIQUE,
+		storage integer NOT NULL,
 		FOREIGN KEY(person) references person(person_id),
 		FOREIGN KEY(storage) references storage(storage_id),
 		FOREIGN KEY(borrower) references person(person_id)
@@ -307,9 +582,14 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 		product_radioactive boolean default 0,
 		product_threedformula string,
 		product_molformula blob,
+		product_smiles string,
+		product_inchi string,
+		product_inchikey string,
 		product_disposalcomment string,
 		product_remark string,
 		product_qrcode string,
+		product_shelflifereception integer,
+		product_shelflifeopening integer,
 		casnumber integer,
 		cenumber integer,
 		person integer NOT NULL,
@@ -371,6 +651,18 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 		FOREIGN KEY(productprecautionarystatements_precautionarystatement_id) references precautionarystatement(precautionarystatement_id));
 	CREATE UNIQUE INDEX IF NOT EXISTS idx_productprecautionarystatements ON productprecautionarystatements(productprecautionarystatements_product_id, productprecautionarystatements_precautionarystatement_id);
 
+	-- mixtures components
+	CREATE TABLE IF NOT EXISTS productcomponent (
+		productcomponent_id integer PRIMARY KEY,
+		productcomponent_concentration float,
+		productcomponent_concentrationunit string,
+		productcomponent_solvent boolean default 0,
+		product integer NOT NULL,
+		component integer NOT NULL,
+		FOREIGN KEY(product) references product(product_id),
+		FOREIGN KEY(component) references product(product_id),
+		UNIQUE(product, component));
+
 	CREATE TABLE IF NOT EXISTS bookmark (
 		bookmark_id integer PRIMARY KEY,
 		person integer NOT NULL,
@@ -378,10 +670,247 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 		FOREIGN KEY(person) references person(person_id),
 		FOREIGN KEY(product) references product(product_id));
 		
+	-- storage alerts thresholds and sent notifications
+	CREATE TABLE IF NOT EXISTS alertsetting (
+		alertsetting_entity_id integer PRIMARY KEY,
+		alertsetting_expiringdays integer NOT NULL,
+		alertsetting_openedmonths integer NOT NULL,
+		FOREIGN KEY(alertsetting_entity_id) references entity(entity_id));
+	CREATE TABLE IF NOT EXISTS stockthreshold (
+		stockthreshold_id integer PRIMARY KEY,
+		stockthreshold_quantity float NOT NULL,
+		stockthreshold_notified boolean default 0,
+		entity integer NOT NULL,
+		product integer NOT NULL,
+		unit integer NOT NULL,
+		FOREIGN KEY(entity) references entity(entity_id),
+		FOREIGN KEY(product) references product(product_id),
+		FOREIGN KEY(unit) references unit(unit_id),
+		UNIQUE(entity, product, unit));
+	CREATE TABLE IF NOT EXISTS alertnotification (
+		alertnotification_id integer PRIMARY KEY,
+		alertnotification_kind string NOT NULL,
+		alertnotification_date datetime NOT NULL,
+		alertnotification_storagedate datetime,
+		storage integer NOT NULL,
+		FOREIGN KEY(storage) references storage(storage_id));
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_alertnotification ON alertnotification(storage, alertnotification_kind);
+
+	-- storages quantity consumptions
+	CREATE TABLE IF NOT EXISTS consumption (
+		consumption_id integer PRIMARY KEY,
+		consumption_date datetime NOT NULL,
+		consumption_quantity float NOT NULL,
+		consumption_storagequantity float NOT NULL,
+		consumption_reason string,
+		person integer NOT NULL,
+		storage integer NOT NULL,
+		unit integer,
+		FOREIGN KEY(person) references person(person_id),
+		FOREIGN KEY(storage) references storage(storage_id),
+		FOREIGN KEY(unit) references unit(unit_id));
+	CREATE INDEX IF NOT EXISTS idx_consumption_storage ON consumption(storage);
+	CREATE INDEX IF NOT EXISTS idx_consumption_person ON consumption(person);
+
+	-- storages transfers between entities
+	CREATE TABLE IF NOT EXISTS transfer (
+		transfer_id integer PRIMARY KEY,
+		transfer_status string NOT NULL,
+		transfer_creationdate datetime NOT NULL,
+		transfer_decisiondate datetime,
+		transfer_comment string,
+		storage integer NOT NULL,
+		person integer NOT NULL,
+		decider integer,
+		source integer NOT NULL,
+		target integer NOT NULL,
+		FOREIGN KEY(storage) references storage(storage_id),
+		FOREIGN KEY(person) references person(person_id),
+		FOREIGN KEY(decider) references person(person_id),
+		FOREIGN KEY(source) references storelocation(storelocation_id),
+		FOREIGN KEY(target) references storelocation(storelocation_id));
+	CREATE INDEX IF NOT EXISTS idx_transfer_storage ON transfer(storage);
+
+	-- purchase requests and orders
+	CREATE TABLE IF NOT EXISTS purchase (
+		purchase_id integer PRIMARY KEY,
+		purchase_status string NOT NULL,
+		purchase_quantity float,
+		purchase_nbitem integer NOT NULL default 1,
+		purchase_price float,
+		purchase_reference string,
+		purchase_comment string,
+		purchase_creationdate datetime NOT NULL,
+		purchase_approvaldate datetime,
+		purchase_orderdate datetime,
+		purchase_receptiondate datetime,
+		product integer NOT NULL,
+		entity integer NOT NULL,
+		unit integer,
+		supplier integer,
+		person integer NOT NULL,
+		approver integer,
+		FOREIGN KEY(product) references product(product_id),
+		FOREIGN KEY(entity) references entity(entity_id),
+		FOREIGN KEY(unit) references unit(unit_id),
+		FOREIGN KEY(supplier) references supplier(supplier_id),
+		FOREIGN KEY(person) references person(person_id),
+		FOREIGN KEY(approver) references person(person_id));
+	CREATE INDEX IF NOT EXISTS idx_purchase_entity ON purchase(entity, purchase_status);
+
+	-- chemical waste disposal batches
+	CREATE TABLE IF NOT EXISTS disposal (
+		disposal_id integer PRIMARY KEY,
+		disposal_status string NOT NULL,
+		disposal_comment string,
+		disposal_creationdate datetime NOT NULL,
+		disposal_collectiondate datetime,
+		entity integer NOT NULL,
+		person integer NOT NULL,
+		FOREIGN KEY(entity) references entity(entity_id),
+		FOREIGN KEY(person) references person(person_id));
+	CREATE TABLE IF NOT EXISTS disposalstorage (
+		disposalstorage_id integer PRIMARY KEY,
+		disposalstorage_category string NOT NULL,
+		disposal integer NOT NULL,
+		storage integer NOT NULL,
+		FOREIGN KEY(disposal) references disposal(disposal_id),
+		FOREIGN KEY(storage) references storage(storage_id),
+		UNIQUE(storage));
+	CREATE INDEX IF NOT EXISTS idx_disposalstorage_disposal ON disposalstorage(disposal);
+
+	-- physical inventory campaigns and their barecodes scans
+	CREATE TABLE IF NOT EXISTS inventory (
+		inventory_id integer PRIMARY KEY,
+		inventory_status string NOT NULL,
+		inventory_creationdate datetime NOT NULL,
+		inventory_closedate datetime,
+		entity integer NOT NULL,
+		person integer NOT NULL,
+		FOREIGN KEY(entity) references entity(entity_id),
+		FOREIGN KEY(person) references person(person_id));
+	CREATE TABLE IF NOT EXISTS inventoryscan (
+		inventoryscan_id integer PRIMARY KEY,
+		inventoryscan_code string NOT NULL,
+		inventoryscan_date datetime NOT NULL,
+		inventory integer NOT NULL,
+		storelocation integer NOT NULL,
+		storage integer,
+		person integer NOT NULL,
+		FOREIGN KEY(inventory) references inventory(inventory_id),
+		FOREIGN KEY(storelocation) references storelocation(storelocation_id),
+		FOREIGN KEY(storage) references storage(storage_id),
+		FOREIGN KEY(person) references person(person_id),
+		UNIQUE(inventory, inventoryscan_code));
+
+	-- storages barecodes sequences by barecode pattern, see generateStorageBarecode
+	CREATE TABLE IF NOT EXISTS barecodesequence (
+		barecodesequence_pattern text PRIMARY KEY,
+		barecodesequence_value integer NOT NULL);
+
+	-- storages borrow requests to other entities
+	CREATE TABLE IF NOT EXISTS borrowrequest (
+		borrowrequest_id integer PRIMARY KEY,
+		borrowrequest_status string NOT NULL,
+		borrowrequest_kind string,
+		borrowrequest_quantity float,
+		borrowrequest_date datetime,
+		borrowrequest_creationdate datetime NOT NULL,
+		borrowrequest_decisiondate datetime,
+		product integer NOT NULL,
+		entity integer NOT NULL,
+		person integer NOT NULL,
+		decider integer,
+		storage integer,
+		unit integer,
+		FOREIGN KEY(product) references product(product_id),
+		FOREIGN KEY(entity) references entity(entity_id),
+		FOREIGN KEY(person) references person(person_id),
+		FOREIGN KEY(decider) references person(person_id),
+		FOREIGN KEY(storage) references storage(storage_id),
+		FOREIGN KEY(unit) references unit(unit_id));
+	CREATE TABLE IF NOT EXISTS borrowrequestmessage (
+		borrowrequestmessage_id integer PRIMARY KEY,
+		borrowrequestmessage_date datetime NOT NULL,
+		borrowrequestmessage_text string NOT NULL,
+		borrowrequest integer NOT NULL,
+		person integer NOT NULL,
+		FOREIGN KEY(borrowrequest) references borrowrequest(borrowrequest_id),
+		FOREIGN KEY(person) references person(person_id));
+	CREATE INDEX IF NOT EXISTS idx_borrowrequestmessage ON borrowrequestmessage(borrowrequest);
+
+	-- offline reference datasets
+	CREATE TABLE IF NOT EXISTS referencedataset (
+		referencedataset_id integer PRIMARY KEY,
+		referencedataset_source string NOT NULL,
+		referencedataset_version string NOT NULL,
+		referencedataset_date datetime NOT NULL);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_referencedataset ON referencedataset(referencedataset_source, referencedataset_version);
+	CREATE TABLE IF NOT EXISTS referencecompound (
+		referencecompound_id integer PRIMARY KEY,
+		referencecompound_name string NOT NULL,
+		referencecompound_synonyms string,
+		referencecompound_casnumber string,
+		referencecompound_cenumber string,
+		referencecompound_empiricalformula string,
+		referencecompound_linearformula string,
+		referencecompound_smiles string,
+		referencecompound_inchi string,
+		referencecompound_inchikey string,
+		referencecompound_symbols string,
+		referencecompound_hazardstatements string,
+		referencecompound_precautionarystatements string,
+		referencecompound_signalword string,
+		referencedataset integer NOT NULL,
+		FOREIGN KEY(referencedataset) references referencedataset(referencedataset_id));
+	CREATE INDEX IF NOT EXISTS idx_referencecompound_casnumber ON referencecompound(referencecompound_casnumber);
+	CREATE INDEX IF NOT EXISTS idx_referencecompound_name ON referencecompound(referencecompound_name);
+	CREATE INDEX IF NOT EXISTS idx_referencecompound_inchikey ON referencecompound(referencecompound_inchikey);
+
+	-- products merges history
+	CREATE TABLE IF NOT EXISTS productmerge (
+		productmerge_id integer PRIMARY KEY,
+		productmerge_date datetime NOT NULL,
+		productmerge_from_id integer NOT NULL,
+		productmerge_from_name string NOT NULL,
+		productmerge_to_id integer NOT NULL,
+		productmerge_to_name string NOT NULL,
+		person integer NOT NULL,
+		FOREIGN KEY(person) references person(person_id));
+
 	CREATE TABLE IF NOT EXISTS captcha (
 		captcha_id integer PRIMARY KEY,
 		captcha_token string NOT NULL,
 		captcha_text string NOT NULL);
+
+	-- storage incompatibility rules
+	-- kinds are "symbol", "hazardstatement" or "classofcompound"
+	-- levels are "warn" or "block"
+	CREATE TABLE IF NOT EXISTS incompatibility (
+		incompatibility_id integer PRIMARY KEY,
+		incompatibility_kind1 string NOT NULL,
+		incompatibility_key1 string NOT NULL,
+		incompatibility_kind2 string NOT NULL,
+		incompatibility_key2 string NOT NULL,
+		incompatibility_level string NOT NULL default "warn",
+		incompatibility_comment string);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_incompatibility ON incompatibility(incompatibility_kind1, incompatibility_key1, incompatibility_kind2, incompatibility_key2);
+
+	-- CLP classification rules
+	CREATE TABLE IF NOT EXISTS clprule (
+		clprule_id integer PRIMARY KEY,
+		clprule_hazardstatement_reference string NOT NULL,
+		clprule_symbol_label string,
+		clprule_signalword_label string);
+	CREATE INDEX IF NOT EXISTS idx_clprule ON clprule(clprule_hazardstatement_reference);
+
+	-- CLP pictograms precedence
+	CREATE TABLE IF NOT EXISTS clpprecedence (
+		clpprecedence_id integer PRIMARY KEY,
+		clpprecedence_symbol_label string NOT NULL,
+		clpprecedence_superseded_label string NOT NULL,
+		clpprecedence_hazardstatement_reference string,
+		clpprecedence_symbol_hazardstatement_reference string);
 	`
 
 	// values definition
@@ -396,11 +925,67 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 	("SGH08", "image/png;base64,iVBORw0KGgoAAAANSUhEUgAAACYAAAAmCAYAAACoPemuAAAABHNCSVQICAgIfAhkiAAAAAlwSFlzAAAN1wAADdcBQiibeAAAABl0RVh0U29mdHdhcmUAd3d3Lmlua3NjYXBlLm9yZ5vuPBoAAAKJSURBVFiFzdixix1FGADw38QDUbQQqyNewiEYCxNN4ECjkuIaFYLNQQpTCBLkzD8gJsVLOqPGJiBYeGB1SeFhYXEhmCIpTgIpRDAEosWhckXU6AknCUyKN49bn+/tze6OnAsDuzA789v5vvnevg0xRkWOEHogxl6R8WKM3Ru9SEytV2LM0qhiuLIrVXDlyoevEK4sqiCuGApTeBo7SuA6o7AX3yKmdh3PdsV1RU3hzwpq0NbxZBdc1/AtjEAN2lddcq41KsG+qYH9jYfb4lqjEuxWDSxissl4ebCMQbBSg/qp7bjjYbk3c7oGttjpoduiEuz5GthbndKkLaqCu5Qgd/FdOv8FD3XaWF1QCfZawqzhWDo/mnv/2FLUEfUA3kuYL/FyOn87GzZm/rbhm8JH+LmSU6t4pHL9A87gmTa4Hf9+px19hBAmQgjzIYQVnMIGHqt0+QKvVq6ncRAzIYSlEMLZEMKu3PmyQ4kTldWI+lX/MD7GZ5jHJH7ESbyJs/qbYnDP79idF8rc7Tu6mK7hHexJfQLewE7jfxWO5Cd/zvblypiJ/sBzQ32vjun7T1hWudjqCdiH20OTrOJz7MJTqd8reAk3RqCu4fGsCDWqLezHr2mSdcxgFss4nkK4iPcxh8v6myTiazyandONCx8H8Ck+wM3KapxP+Ta43tDfqXM4hweb1MzGha+CuzMUpoWU+MPh+yR3g+XD6nEvpMQfAJaxNIT6EKEpKg9Wj3vR5jv/b/r1a4B6t81KNYPV4w7hL3yfcu+e6ivPf/pnZGvcLC7iAl7vimoOq8dN44kSqHawnEm35RPBVpNv60eVcYj/xWeo0bgiqDKwguGrtgkljhh7Qtg8L3DcB497IINNg8B2AAAAAElFTkSuQmCC"),
 	("SGH09", "image/png;base64,iVBORw0KGgoAAAANSUhEUgAAACYAAAAmCAYAAACoPemuAAAABHNCSVQICAgIfAhkiAAAAAlwSFlzAAAN1wAADdcBQiibeAAAABl0RVh0U29mdHdhcmUAd3d3Lmlua3NjYXBlLm9yZ5vuPBoAAAI8SURBVFiFzdi7a1VBEMDhb0EjYhFfaCEICopBi4haWUiqqGgQW1OKaBpNIQEVvREi2lhaWCiC/4CSImgv2IgQELSSdKKlMUKEtTgr3jxuPI+9iQMD5+y9u/NjdmbO7IYYoywSQgvE2MqyXoyxudKKxKStHGvmhsoGl9dTGT2Xf/syweWFygiXHyoTXHegMsDVgprjLk5hS4wRenLD1fYUhjGans9jF/rRlwOuMhS2Yz924F0CO4EBjOTyXK0YwUVcwAcEHMJr9OaKudqLYBA/cQx7cT+NB1xrCld5cvLOGA7gqSIRricv7sED9Df1XB1PbcVOXMZnzOA7pvEcg3UTqjNY1QDlKmLSsRX+14NNlXamLlQyeDJBfenw+xmcxQ3cxunSCVYpINmYatUfHUlg3xaN9+MmjqR5uxPkaNltrZbChcFYUi8tmjuOqbIxt25pT7uifMThtvcBPMS84kvwKY2fizE+hhDCBkXGzuBZaUsN4qtPUVQj3uOJIhmGFSXlOO4loEmsr5KhtYIfvRjCUTxS1K8reKnIwAkLt/UHhqqUjUblIkFuxi18TRCv8KsNah5v8UbqRqqVi5JwOKhI/ym8wKzlg3+xzmGyrJ2QjC2U4ox4J72NS2fFEMI27CsdwEtlNsY43Wn9BVIlILNoo494t+CytD254bI2irngutJaN4Xr6mGkrpFVOb5VNbaqB96yRtfkiuBfxtf0UqUTxH9xDbU8XBaoPGAZt69dq3awy0uMLSH8fc4gvwFyuYuihNiCxwAAAABJRU5ErkJggg==");`
 	inssignalword := `INSERT INTO signalword (signalword_label) VALUES ("danger"), ("warning")`
+	// the parent units are set by label by fixunit
 	insunit := `INSERT INTO unit (unit_label, unit_multiplier, unit) VALUES 
-	("L", 1, NULL), ("mL", 0.001, 1), ("µL", 0.00001, 1),
-	("kg", 1000, 2), ("g", 1, NULL), ("mg", 0.001, 2), ("µg", 0.00001, 2),
-	("m", 1, NULL), ("dm", 0.1, 3), ("cm", 0.01, 3)`
+	("L", 1, NULL), ("mL", 0.001, NULL), ("µL", 0.000001, NULL),
+	("kg", 1000, NULL), ("g", 1, NULL), ("mg", 0.001, NULL), ("µg", 0.000001, NULL),
+	("m", 1, NULL), ("dm", 0.1, NULL), ("cm", 0.01, NULL)`
+	// setting the parent units, also fixing the units of the former databases
+	// referencing the wrong parent units with wrong micro multipliers, see CHANGELOG.md
+	fixunit := `UPDATE unit SET unit = (SELECT unit_id FROM unit WHERE unit_label = "L") WHERE unit_label IN ("mL", "µL");
+	UPDATE unit SET unit = (SELECT unit_id FROM unit WHERE unit_label = "g") WHERE unit_label IN ("kg", "mg", "µg");
+	UPDATE unit SET unit = (SELECT unit_id FROM unit WHERE unit_label = "m") WHERE unit_label IN ("dm", "cm");
+	UPDATE unit SET unit_multiplier = 0.000001 WHERE unit_label IN ("µL", "µg");`
 	inswelcomeannounce := `INSERT INTO welcomeannounce (welcomeannounce_text) VALUES ("")`
+	// CLP pictograms and signal words of the hazard statements (regulation (EC) No 1272/2008, annex I)
+	// a NULL signal word depends on the hazard category
+	insclprule := `INSERT INTO clprule (clprule_hazardstatement_reference, clprule_symbol_label, clprule_signalword_label) VALUES
+	("H200", "SGH01", "danger"), ("H201", "SGH01", "danger"), ("H202", "SGH01", "danger"), ("H203", "SGH01", "danger"),
+	("H204", "SGH01", "warning"), ("H205", NULL, "danger"), ("H220", "SGH02", "danger"), ("H221", NULL, "warning"),
+	("H222", "SGH02", "danger"), ("H223", "SGH02", "warning"), ("H224", "SGH02", "danger"), ("H225", "SGH02", "danger"),
+	("H226", "SGH02", "warning"), ("H228", "SGH02", NULL), ("H240", "SGH01", "danger"), ("H241", "SGH01", "danger"),
+	("H241", "SGH02", "danger"), ("H242", "SGH02", NULL), ("H250", "SGH02", "danger"), ("H251", "SGH02", "danger"),
+	("H252", "SGH02", "warning"), ("H260", "SGH02", "danger"), ("H261", "SGH02", NULL), ("H270", "SGH03", "danger"),
+	("H271", "SGH03", "danger"), ("H272", "SGH03", NULL), ("H280", "SGH04", "warning"), ("H281", "SGH04", "warning"),
+	("H290", "SGH05", "warning"), ("H300", "SGH06", "danger"), ("H301", "SGH06", "danger"), ("H302", "SGH07", "warning"),
+	("H304", "SGH08", "danger"), ("H310", "SGH06", "danger"), ("H311", "SGH06", "danger"), ("H312", "SGH07", "warning"),
+	("H314", "SGH05", "danger"), ("H315", "SGH07", "warning"), ("H317", "SGH07", "warning"), ("H318", "SGH05", "danger"),
+	("H319", "SGH07", "warning"), ("H330", "SGH06", "danger"), ("H331", "SGH06", "danger"), ("H332", "SGH07", "warning"),
+	("H334", "SGH08", "danger"), ("H335", "SGH07", "warning"), ("H336", "SGH07", "warning"), ("H340", "SGH08", "danger"),
+	("H341", "SGH08", "warning"), ("H350", "SGH08", "danger"), ("H350i", "SGH08", "danger"), ("H351", "SGH08", "warning"),
+	("H360", "SGH08", "danger"), ("H360F", "SGH08", "danger"), ("H360D", "SGH08", "danger"), ("H360FD", "SGH08", "danger"),
+	("H360Fd", "SGH08", "danger"), ("H360Df", "SGH08", "danger"), ("H361", "SGH08", "warning"), ("H361f", "SGH08", "warning"),
+	("H361d", "SGH08", "warning"), ("H361fd", "SGH08", "warning"), ("H370", "SGH08", "danger"), ("H371", "SGH08", "warning"),
+	("H372", "SGH08", "danger"), ("H373", "SGH08", "warning"), ("H400", "SGH09", "warning"), ("H410", "SGH09", "warning"),
+	("H411", "SGH09", NULL)`
+	// CLP pictograms precedence (regulation (EC) No 1272/2008, article 26)
+	insclpprecedence := `INSERT INTO clpprecedence (clpprecedence_symbol_label, clpprecedence_superseded_label, clpprecedence_hazardstatement_reference, clpprecedence_symbol_hazardstatement_reference) VALUES
+	("SGH06", "SGH07", NULL, NULL),
+	("SGH05", "SGH07", "H315", NULL), ("SGH05", "SGH07", "H319", NULL),
+	("SGH08", "SGH07", "H315", "H334"), ("SGH08", "SGH07", "H317", "H334"), ("SGH08", "SGH07", "H319", "H334")`
+	// default EU storage compatibility matrix
+	insincompatibility := `INSERT INTO incompatibility (incompatibility_kind1, incompatibility_key1, incompatibility_kind2, incompatibility_key2, incompatibility_level, incompatibility_comment) VALUES
+	("symbol", "SGH01", "symbol", "SGH02", "block", "explosives must be stored separately"),
+	("symbol", "SGH01", "symbol", "SGH03", "block", "explosives must be stored separately"),
+	("symbol", "SGH01", "symbol", "SGH04", "block", "explosives must be stored separately"),
+	("symbol", "SGH01", "symbol", "SGH05", "block", "explosives must be stored separately"),
+	("symbol", "SGH01", "symbol", "SGH06", "block", "explosives must be stored separately"),
+	("symbol", "SGH01", "symbol", "SGH08", "block", "explosives must be stored separately"),
+	("symbol", "SGH02", "symbol", "SGH03", "block", "flammables must not be stored with oxidizers"),
+	("symbol", "SGH02", "symbol", "SGH04", "warn", "flammables should not be stored with gases under pressure"),
+	("symbol", "SGH03", "symbol", "SGH04", "warn", "oxidizers should not be stored with gases under pressure"),
+	("symbol", "SGH03", "symbol", "SGH05", "warn", "oxidizers should not be stored with corrosives"),
+	("symbol", "SGH03", "symbol", "SGH06", "warn", "oxidizers should not be stored with toxics"),
+	("hazardstatement", "H271", "hazardstatement", "H224", "block", "strong oxidizers must not be stored with extremely flammable liquids"),
+	("hazardstatement", "H271", "hazardstatement", "H225", "block", "strong oxidizers must not be stored with highly flammable liquids"),
+	("hazardstatement", "H271", "hazardstatement", "H226", "warn", "strong oxidizers should not be stored with flammable liquids"),
+	("hazardstatement", "H271", "hazardstatement", "H250", "block", "strong oxidizers must not be stored with pyrophoric substances"),
+	("hazardstatement", "H272", "hazardstatement", "H224", "warn", "oxidizers should not be stored with extremely flammable liquids"),
+	("hazardstatement", "H272", "hazardstatement", "H225", "warn", "oxidizers should not be stored with highly flammable liquids"),
+	("hazardstatement", "EUH032", "classofcompound", "ACID", "block", "contact with acids liberates very toxic gas"),
+	("hazardstatement", "EUH031", "classofcompound", "ACID", "warn", "contact with acids liberates toxic gas"),
+	("classofcompound", "CYANIDE", "classofcompound", "ACID", "block", "cyanides must not be stored with acids"),
+	("classofcompound", "ACID", "classofcompound", "BASE", "warn", "acids should not be stored with bases")`
 
 	// tables creation
 	log.Info("  creating sqlite tables")
@@ -408,6 +993,60 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 		return err
 	}
 
+	// borrowings history of the former databases
+	if err = db.migrateBorrowing(); err != nil {
+		return err
+	}
+	// barecodes numeric conversions of the former databases
+	if err = db.migrateStorageBarecode(); err != nil {
+		return err
+	}
+
+	// columns added after the tables creation
+	for _, col := range [][]string{
+		{"product", "product_smiles", "string"},
+		{"product", "product_inchi", "string"},
+		{"product", "product_inchikey", "string"},
+		{"entity", "entity_sharestocks", "boolean default 0"},
+		{"supplier", "supplier_email", "string"},
+		{"supplier", "supplier_phone", "string"},
+		{"supplier", "supplier_address", "string"},
+		{"supplier", "supplier_website", "string"},
+		{"supplierref", "supplierref_gtin", "text"},
+		{"entity", "entity_code", "string"},
+		{"entity", "entity_barecodetemplate", "string"},
+		{"entity", "entity_labelprinter", "string"},
+		{"storage", "storage_modifiedby", "integer REFERENCES person(person_id)"},
+		{"storage", "storage_parent", "integer REFERENCES storage(storage_id)"},
+		{"product", "product_shelflifereception", "integer"},
+		{"product", "product_shelflifeopening", "integer"},
+		{"storage", "storage_shelflifereception", "integer"},
+		{"storage", "storage_shelflifeopening", "integer"},
+		{"storage", "storage_expirationcomputed", "boolean default 0"},
+		{"alertnotification", "alertnotification_storagedate", "datetime"},
+		{"clpprecedence", "clpprecedence_symbol_hazardstatement_reference", "string"},
+	} {
+		if err = db.addColumn(col[0], col[1], col[2]); err != nil {
+			return err
+		}
+	}
+	// the former notifications are about the current storages dates
+	sqlr := `UPDATE alertnotification SET alertnotification_storagedate = (SELECT
+	CASE alertnotification_kind WHEN "opened" THEN storage_openingdate ELSE storage_expirationdate END
+	FROM storage WHERE storage_id = alertnotification.storage)
+	WHERE alertnotification_storagedate IS NULL`
+	if _, err = db.Exec(sqlr); err != nil {
+		return err
+	}
+	// the entities codes are part of the barecodes
+	if _, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_entity_code ON entity(entity_code)`); err != nil {
+		return err
+	}
+	// the current storages barecodes are unique across the instance
+	if err = db.uniqueStorageBarecodes(); err != nil {
+		return err
+	}
+
 	// welcome announce
 	if err = db.Get(&c, `SELECT count(*) FROM welcomeannounce`); err != nil {
 		return err
@@ -451,6 +1090,40 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 			return err
 		}
 	}
+	if _, err = db.Exec(fixunit); err != nil {
+		return err
+	}
+
+	// incompatibilities
+	if err = db.Get(&c, `SELECT count(*) FROM incompatibility`); err != nil {
+		return err
+	}
+	if c == 0 {
+		log.Info("  inserting incompatibilities")
+		if _, err = db.Exec(insincompatibility); err != nil {
+			return err
+		}
+	}
+
+	// CLP rules
+	if err = db.Get(&c, `SELECT count(*) FROM clprule`); err != nil {
+		return err
+	}
+	if c == 0 {
+		log.Info("  inserting CLP rules")
+		if _, err = db.Exec(insclprule); err != nil {
+			return err
+		}
+		if _, err = db.Exec(insclpprecedence); err != nil {
+			return err
+		}
+	}
+	// GHS08 supersedes GHS07 only for respiratory sensitisation
+	sqlr = `UPDATE clpprecedence SET clpprecedence_symbol_hazardstatement_reference = "H334"
+	WHERE clpprecedence_symbol_label = "SGH08" AND clpprecedence_superseded_label = "SGH07"`
+	if _, err = db.Exec(sqlr); err != nil {
+		return err
+	}
 
 	// zero cas number
 	if err = db.Get(&c, `SELECT count(*) FROM casnumber`); err != nil {
@@ -1651,6 +2324,12 @@ func (db *SQLiteDataStore) Import(dir string) error {
 		return err
 	}
 
+	// the imported barecodes are unique per entity only, see uniqueStorageBarecodes
+	if _, err = tx.Exec(`DROP INDEX IF EXISTS idx_storage_barecode`); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	if csvFile, err = os.Open(path.Join(dir, "storage.csv")); err != nil {
 		return (err)
 	}
@@ -1884,5 +2563,6 @@ func (db *SQLiteDataStore) Import(dir string) error {
 		return err
 	}
 
-	return nil
+	log.Info("- checking storages barecodes unicity")
+	return db.uniqueStorageBarecodes()
 }
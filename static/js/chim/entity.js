@@ -30,6 +30,19 @@ $( document ).ready(function() {
                     },
                 },               
             },
+            entity_barecodetemplate: {
+                remote: {
+                    url: "",
+                    type: "post",
+                    beforeSend: function(jqXhr, settings) {
+                        id = -1
+                        if ($("form#entity input#entity_id").length) {
+                            id = $("form#entity input#entity_id").val()
+                        }
+                        settings.url = proxyPath + "validate/entity/" + id + "/barecodetemplate/";
+                    },
+                },
+            },
         },
         messages: {
             entity_name: {
@@ -191,6 +204,10 @@ window.operateEvents = {
             fdata = flatten(data);
             // autofilling form
             $("#edit-collapse").autofill( fdata, {"findbyname": false } );
+            $("input#entity_sharestocks").prop("checked", data.entity_sharestocks);
+            $("input#entity_code").val(data.entity_code.Valid ? data.entity_code.String : "");
+            $("input#entity_barecodetemplate").val(data.entity_barecodetemplate.Valid ? data.entity_barecodetemplate.String : "");
+            $("input#entity_labelprinter").val(data.entity_labelprinter.Valid ? data.entity_labelprinter.String : "");
             // setting index hidden input
             $("input#index").val(index);
         }).fail(function(jqXHR, textStatus, errorThrown) {
@@ -273,6 +290,10 @@ function saveEntity() {
     var entity_id = $("input#entity_id").val(),
         entity_name = $("input#entity_name").val(),
         entity_description = $("input#entity_description").val(),
+        entity_sharestocks = $("input#entity_sharestocks").is(":checked"),
+        entity_code = $("input#entity_code").val(),
+        entity_barecodetemplate = $("input#entity_barecodetemplate").val(),
+        entity_labelprinter = $("input#entity_labelprinter").val(),
         managers = $('select#managers').select2('data'),
         ajax_url = proxyPath + "entities",
         ajax_method = "POST",
@@ -293,6 +314,10 @@ function saveEntity() {
             "entity_id": entity_id,
             "entity_name": entity_name,
             "entity_description": entity_description,
+            "entity_sharestocks": entity_sharestocks,
+            "entity_code": entity_code,
+            "entity_barecodetemplate": entity_barecodetemplate,
+            "entity_labelprinter": entity_labelprinter,
         });
     $.ajax({
         url: ajax_url,
@@ -1122,6 +1122,7 @@ $('#table').on('load-success.bs.table refresh.bs.table', function () {
     
     hasPermission("storages", "", "POST").done(function(){
         $(".store").fadeIn();
+        $(".prepare").fadeIn();
         localStorage.setItem("storages::POST", true);
     }).fail(function(){
         localStorage.setItem("storages::POST", false);
@@ -1293,6 +1294,22 @@ function detailFormatter(index, row) {
     html.push("</div>")
 
 
+    if (row["components"] != null && row["components"].length != 0) {
+        html.push("<div class='row mt-sm-3'>")
+
+            html.push("<div class='col-sm-12'>")
+            html.push("<div><span class='iconlabel'>" + global.t("product_components_title", container.PersonLanguage) + "</span></div>")
+            html.push("<ul>")
+            $.each(row["components"], function (key, value) {
+                html.push("<li>" + componentLabel(value) + "</li>");
+            });
+            html.push("</ul>")
+            html.push("</div>")
+
+        html.push("</div>")
+    }
+
+
     html.push("<div class='row mt-sm-3'>")
 
         if (row["product_disposalcomment"]["Valid"] && row["product_disposalcomment"]["String"] != "") {
@@ -1306,6 +1323,12 @@ function detailFormatter(index, row) {
         if (row["product_remark"]["Valid"] && row["product_remark"]["String"] != "") {
             html.push("<div class='col-sm-12'><span class='iconlabel'>" + global.t("product_remark_title", container.PersonLanguage) + "</span> " + row["product_remark"]["String"] + "</div>")
         }
+        if (row["product_shelflifereception"]["Valid"]) {
+            html.push("<div class='col-sm-12'><span class='iconlabel'>" + global.t("product_shelflifereception_title", container.PersonLanguage) + "</span> " + row["product_shelflifereception"]["Int64"] + "</div>")
+        }
+        if (row["product_shelflifeopening"]["Valid"]) {
+            html.push("<div class='col-sm-12'><span class='iconlabel'>" + global.t("product_shelflifeopening_title", container.PersonLanguage) + "</span> " + row["product_shelflifeopening"]["Int64"] + "</div>")
+        }
 
     html.push("</div>")
 
@@ -1393,6 +1416,12 @@ function operateFormatter(value, row, index) {
         actions.push('<button class="btn btn-link btn-sm"><span class="mdi mdi-24px mdi-blank">&nbsp;</span></button>');
     }
 
+    if (row.components != null && row.components.length != 0) {
+        actions.push('<button id="prepare' + pid + '" class="prepare btn btn-link btn-sm" style="display: none;" title="prepare" type="button">',
+        '<span class="mdi mdi-24px mdi-flask">',
+        '</button>');
+    }
+
     actions.push(
     '<button id="store' + pid + '" class="store btn btn-link btn-sm" style="display: none;" title="store" type="button">',
         '<span class="mdi mdi-24px mdi-forklift">',
@@ -1431,6 +1460,9 @@ window.operateEvents = {
     'click .store': function (e, value, row, index) {
         window.location.href = proxyPath + "vc/storages?product=" + row['product_id'];
     },
+    'click .prepare': function (e, value, row, index) {
+        operatePrepare(e, value, row, index)
+    },
     'click .storages': function (e, value, row, index) {
         var urlParams = new URLSearchParams(window.location.search);
         var url = proxyPath + "v/storages?product=" + row['product_id'];
@@ -1492,7 +1524,15 @@ function operateOStorages(e, value, row, index) {
     }).done(function(data, textStatus, jqXHR) {
         var html = [];
         $.each(data["rows"], function (key, value) {
-            html.push("<p><span class='iconlabel'>" + value.entity_name + "</span><span class='blockquote-footer'>" + value.entity_description+ "</span></p>");
+            var stocks = [];
+            $.each(value.stocks, function (k, s) {
+                stocks.push(s.quantity + " " + (s.unit_label.Valid ? s.unit_label.String : ""));
+            });
+            html.push("<p><span class='iconlabel'>" + value.entity_name + "</span>" +
+                (stocks.length ? " <span class='badge badge-light'>" + stocks.join(", ") + "</span>" : "") +
+                " <button class='btn btn-link btn-sm' type='button' title='" + global.t("borrowrequest_title", container.PersonLanguage) + "'" +
+                " onclick='operateBorrowRequest(" + row['product_id'] + ", " + value.entity_id + ")'><span class='mdi mdi-hand mdi-18px'></span></button>" +
+                "<span class='blockquote-footer'>" + value.entity_description+ "</span></p>");
         });
         
         $("#ostorages-collapse-" + row['product_id']).html(html.join('&nbsp;'));
@@ -1503,13 +1543,54 @@ function operateOStorages(e, value, row, index) {
     // finally collapsing the view
     $('#ostorages-collapse-' + row['product_id']).collapse('show');
 }
+function operateBorrowRequest(product_id, entity_id) {
+    $("input#brproduct_id").val(product_id);
+    $("input#brentity_id").val(entity_id);
+    $("input#borrowrequest_quantity").val(null);
+    $("input#borrowrequest_date").val(null);
+    $("textarea#borrowrequestmessage_text").val(null);
+    $("#borrowrequest").modal("show");
+}
+function saveBorrowRequest() {
+    var borrowrequest_quantity = $("input#borrowrequest_quantity").val(),
+        borrowrequest_date = $("input#borrowrequest_date").val(),
+        data = {
+            "product_id": $("input#brproduct_id").val(),
+            "entity_id": $("input#brentity_id").val(),
+            "borrowrequestmessage_text": $("textarea#borrowrequestmessage_text").val(),
+        };
+
+    if (borrowrequest_quantity !== "") {
+        data["borrowrequest_quantity"] = borrowrequest_quantity;
+    }
+    if (borrowrequest_date !== "") {
+        data["borrowrequest_date"] = borrowrequest_date;
+    }
+
+    $.ajax({
+        url: proxyPath + "borrowrequests",
+        method: "POST",
+        dataType: 'json',
+        data: data,
+    }).done(function(data, textStatus, jqXHR) {
+        $("#borrowrequest").modal("hide");
+        global.displayMessage(global.t("borrowrequest_sent_message", container.PersonLanguage), "success");
+    }).fail(function(jqXHR, textStatus, errorThrown) {
+        handleHTTPError(jqXHR.statusText, jqXHR.status);
+    });
+}
 function operateEdit(e, value, row, index) {
     // clearing selections
     $('textarea#product_remark').val(null);
     $('textarea#product_disposalcomment').val(null);
+    $('input#product_shelflifereception').val(null);
+    $('input#product_shelflifeopening').val(null);
     $('input#product_specificity').val(null);
     $('input#product_msds').val(null);
     $('input#product_threedformula').val(null);
+    $('input#product_smiles').val(null);
+    $('input#product_inchi').val(null);
+    $('input#product_inchikey').val(null);
 
     $('select#casnumber').val(null).trigger('change');
     $('select#casnumber').find('option').remove();
@@ -1604,6 +1685,11 @@ function operateEdit(e, value, row, index) {
            var newOption = new Option(data.precautionarystatements[i].precautionarystatement_reference, data.precautionarystatements[i].precautionarystatement_id, true, true);
            $('select#precautionarystatements').append(newOption).trigger('change');
         }
+
+        $("#components").empty();
+        for(var i in data.components) {
+           addComponent(data.components[i]);
+        }
     }).fail(function(jqXHR, textStatus, errorThrown) {
         handleHTTPError(jqXHR.statusText, jqXHR.status)
     });
@@ -1721,12 +1807,17 @@ function operateEdit(e, value, row, index) {
         var product_id = $("input#product_id").val(),
             product_specificity = $("input#product_specificity").val(),
             product_threedformula = $("input#product_threedformula").val(),
+            product_smiles = $("input#product_smiles").val(),
+            product_inchi = $("input#product_inchi").val(),
+            product_inchikey = $("input#product_inchikey").val(),
 
             product_molformula = $("#hidden_product_molformula_content").html(),
 
             product_msds = $("input#product_msds").val(),
             product_disposalcomment = $("textarea#product_disposalcomment").val(),
             product_remark = $("textarea#product_remark").val(),
+            product_shelflifereception = $("input#product_shelflifereception").val(),
+            product_shelflifeopening = $("input#product_shelflifeopening").val(),
             product_restricted = $("input#product_restricted:CHECKED").val(),
             product_radioactive = $("input#product_radioactive:CHECKED").val(),
             casnumber = $('select#casnumber').select2('data')[0],
@@ -1772,6 +1863,25 @@ function operateEdit(e, value, row, index) {
                 data["precautionarystatements." + index +".precautionarystatement_id"] = s.id;
                 data["precautionarystatements." + index +".precautionarystatement_reference"] = s.text;
             });
+            var ncomponents = 0;
+            $("#components .component").each(function( index, c ) {
+                var component = $(c).find("select.component_id").select2('data')[0],
+                    concentration = $(c).find("input.productcomponent_concentration").val(),
+                    unit = $(c).find("select.productcomponent_concentrationunit").val(),
+                    prefix = "components." + ncomponents;
+                if (component === undefined) {
+                    return;
+                }
+                data[prefix + ".component_id"] = component.id;
+                data[prefix + ".productcomponent_solvent"] = $(c).find("input.productcomponent_solvent").is(":checked");
+                if (concentration !== "") {
+                    data[prefix + ".productcomponent_concentration"] = concentration;
+                }
+                if (unit !== "") {
+                    data[prefix + ".productcomponent_concentrationunit"] = unit;
+                }
+                ncomponents++;
+            });
             $.extend(data, {
                 "product_id": product_id,
                 "product_disposalcomment": product_disposalcomment,
@@ -1790,6 +1900,16 @@ function operateEdit(e, value, row, index) {
                     "product_molformula": product_molformula,
                 });  
             }
+            if (product_shelflifereception !== "") {
+                $.extend(data, {
+                    "product_shelflifereception": product_shelflifereception,
+                });
+            }
+            if (product_shelflifeopening !== "") {
+                $.extend(data, {
+                    "product_shelflifeopening": product_shelflifeopening,
+                });
+            }
             if (product_specificity !== "") {
                 $.extend(data, {
                     "product_specificity": product_specificity,
@@ -1805,6 +1925,21 @@ function operateEdit(e, value, row, index) {
                     "product_threedformula": product_threedformula,
                 });                    
             } 
+            if (product_smiles !== "") {
+                $.extend(data, {
+                    "product_smiles": product_smiles,
+                });
+            }
+            if (product_inchi !== "") {
+                $.extend(data, {
+                    "product_inchi": product_inchi,
+                });
+            }
+            if (product_inchikey !== "") {
+                $.extend(data, {
+                    "product_inchikey": product_inchikey,
+                });
+            }
             if (cenumber !== undefined) {
                 $.extend(data, {
                     "cenumber.cenumber_id": cenumber.id == cenumber.text ? -1 : cenumber.id,
@@ -1940,4 +2075,203 @@ function operateEdit(e, value, row, index) {
     //
     function howToMagicalSelector() {
         window.open(proxyPath + "img/magicalselector.webm", '_blank');
-    }
\ No newline at end of file
+    }
+
+//
+// mixtures
+//
+function componentLabel(c) {
+    var label = c.component_name;
+    if (c.productcomponent_concentration.Valid) {
+        label += " " + c.productcomponent_concentration.Float64 + " " + c.productcomponent_concentrationunit.String;
+    }
+    if (c.productcomponent_solvent) {
+        label += " <i>" + global.t("product_component_solvent", container.PersonLanguage) + "</i>";
+    }
+    return label;
+}
+
+// modalSelect2 initializes the select2 of the select element of a modal,
+// the rows returned by the url being converted to select2 items by the item function
+function modalSelect2(select, modal, url, params, item) {
+    select.select2({
+        dropdownParent: modal,
+        ajax: {
+            url: proxyPath + url,
+            delay: 400,
+            data: function (p) {
+                return $.extend({
+                    search: p.term,
+                    page: p.page || 1,
+                    offset: (p.page-1)*10 || 0,
+                    limit: 10
+                }, params);
+            },
+            dataType: 'json',
+            processResults: function (data, p) {
+                return {
+                    results: $.map(data.rows, item),
+                    pagination: {more: (p.page || 1)*10 < data.total}
+                };
+            }
+        }
+    });
+}
+
+// addComponent adds a component row to the product form, filled with the component c if any
+function addComponent(c) {
+    var units = $("<select>").addClass("form-control productcomponent_concentrationunit").append(new Option("", ""));
+    $.each(["w/w", "v/v", "mol/L"], function (index, u) {
+        units.append(new Option(u, u));
+    });
+    var row = $("<div>").addClass("form-row component")
+        .append($("<div>").addClass("form-group col-sm-5")
+            .append($("<select>").addClass("component_id").css("width", "100%")))
+        .append($("<div>").addClass("form-group col-sm-2")
+            .append($("<input>").addClass("form-control productcomponent_concentration").attr({type: "number", min: "0", step: "any"})))
+        .append($("<div>").addClass("form-group col-sm-2").append(units))
+        .append($("<div>").addClass("form-group col-sm-2")
+            .append($("<div>").addClass("form-check")
+                .append($("<input>").addClass("form-check-input productcomponent_solvent").attr({type: "checkbox"}))
+                .append($("<label>").addClass("form-check-label").text(global.t("product_component_solvent", container.PersonLanguage)))))
+        .append($("<div>").addClass("form-group col-sm-1")
+            .append($("<button>").addClass("btn btn-link").attr({type: "button", title: "remove"})
+                .append($("<span>").addClass("mdi mdi-24px mdi-delete"))
+                .on("click", function () { row.remove(); })));
+    $("#components").append(row);
+
+    var select = row.find("select.component_id");
+    if (c !== undefined) {
+        select.append(new Option(c.component_name, c.component_id, true, true));
+        if (c.productcomponent_concentration.Valid) {
+            row.find("input.productcomponent_concentration").val(c.productcomponent_concentration.Float64);
+        }
+        units.val(c.productcomponent_concentrationunit.String);
+        row.find("input.productcomponent_solvent").prop("checked", c.productcomponent_solvent);
+    }
+    select.select2({
+        ajax: {
+            url: proxyPath + 'products',
+            delay: 400,
+            data: function (params) {
+                return {
+                    search: params.term,
+                    page: params.page || 1,
+                    offset: (params.page-1)*10 || 0,
+                    limit: 10
+                };
+            },
+            dataType: 'json',
+            processResults: function (data, params) {
+                var newdata = $.map(data.rows, function (obj) {
+                    obj.text = obj.name.name_label;
+                    if (obj.product_specificity.Valid) {
+                        obj.text += " " + obj.product_specificity.String;
+                    }
+                    obj.id = obj.product_id;
+                    return obj;
+                });
+                return {
+                    results: newdata,
+                    pagination: {more: (params.page || 1)*10 < data.total}
+                };
+            }
+        }
+    });
+}
+
+// suggestClassification adds the symbols, signal word and hazard statements suggested
+// from the saved components of the edited product
+function suggestClassification() {
+    $.ajax({
+        url: proxyPath + "products/" + $("input#product_id").val() + "/classification",
+        method: "GET",
+    }).done(function(data, textStatus, jqXHR) {
+        var symbols = $('select#symbols').val() || [],
+            hazardstatements = $('select#hazardstatements').val() || [];
+        $.each(data.symbols, function (index, s) {
+            if ($.inArray(String(s.symbol_id), symbols) == -1) {
+                $('select#symbols').append(new Option(s.symbol_label, s.symbol_id, true, true)).trigger('change');
+            }
+        });
+        $.each(data.hazardstatements, function (index, hs) {
+            if ($.inArray(String(hs.hazardstatement_id), hazardstatements) == -1) {
+                $('select#hazardstatements').append(new Option(hs.hazardstatement_reference, hs.hazardstatement_id, true, true)).trigger('change');
+            }
+        });
+        if (data.signalword.signalword_id.Valid && !$('select#signalword').val()) {
+            $('select#signalword').append(new Option(data.signalword.signalword_label.String, data.signalword.signalword_id.Int64, true, true)).trigger('change');
+        }
+    }).fail(function(jqXHR, textStatus, errorThrown) {
+        handleHTTPError(jqXHR.statusText, jqXHR.status);
+    });
+}
+
+// operatePrepare opens the preparation form of the mixture with a source row by component
+function operatePrepare(e, value, row, index) {
+    $("#prepare").attr("pid", row.product_id);
+    $("#prepare-title").text(global.t("product_prepare", container.PersonLanguage) + " " + row.name.name_label);
+    $("#prepare-form")[0].reset();
+    $("#prepare-sources").empty();
+
+    modalSelect2($("select#prepare_unit").empty(), $("#prepare"), "storages/units", {}, function (obj) {
+        return {id: obj.unit_id.Int64, text: obj.unit_label.String};
+    });
+    modalSelect2($("select#prepare_storelocation").empty(), $("#prepare"), "storelocations", {}, function (obj) {
+        return {id: obj.storelocation_id.Int64, text: obj.storelocation_fullpath};
+    });
+
+    $.each(row.components, function (index, c) {
+        var source = $("<div>").addClass("form-row source")
+            .append($("<div>").addClass("form-group col-sm-4").html(componentLabel(c)))
+            .append($("<div>").addClass("form-group col-sm-5")
+                .append($("<select>").addClass("storage_id").css("width", "100%")))
+            .append($("<div>").addClass("form-group col-sm-3")
+                .append($("<input>").addClass("form-control quantity").attr({type: "number", min: "0", step: "any"})));
+        $("#prepare-sources").append(source);
+
+        modalSelect2(source.find("select"), $("#prepare"), "storages", {product: c.component_id}, function (obj) {
+            return {id: obj.storage_id.Int64, text: obj.storage_barecode.String + " - " + obj.storage_quantity.Float64 + " " + obj.unit.unit_label.String};
+        });
+    });
+
+    $("#prepare").modal("show");
+}
+
+// prepareMixture creates a storage of the mixture of the preparation form from its sources
+function prepareMixture() {
+    var data = {
+            "product_id": $("#prepare").attr("pid"),
+            "storage_quantity": $("input#prepare_quantity").val(),
+            "storelocation_id": $("select#prepare_storelocation").val(),
+        },
+        unit = $("select#prepare_unit").val(),
+        nsources = 0;
+
+    if (unit !== null) {
+        data["unit_id"] = unit;
+    }
+    $("#prepare-sources .source").each(function (index, s) {
+        var storage = $(s).find("select.storage_id").val(),
+            quantity = $(s).find("input.quantity").val();
+        if (storage === null || quantity === "") {
+            return;
+        }
+        data["sources." + nsources + ".storage_id"] = storage;
+        data["sources." + nsources + ".quantity"] = quantity;
+        nsources++;
+    });
+
+    $.ajax({
+        url: proxyPath + "storages/prepare",
+        method: "POST",
+        dataType: 'json',
+        data: data,
+    }).done(function(data, textStatus, jqXHR) {
+        $("#prepare").modal("hide");
+        global.displayMessage(global.t("product_prepare_done", container.PersonLanguage) + " " + data.storage_barecode.String, "success");
+        $('#table').bootstrapTable('refresh');
+    }).fail(function(jqXHR, textStatus, errorThrown) {
+        handleHTTPError(jqXHR.statusText, jqXHR.status);
+    });
+}
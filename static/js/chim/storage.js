@@ -502,6 +502,60 @@ $( document ).ready(function() {
         $(this).valid(); // FIXME: see https://github.com/select2/select2/issues/3901
     });
 
+    //
+    // supplier references select2
+    //
+    $('select#supplierref').select2({
+        allowClear: true,
+        placeholder: "select a catalogue reference",
+        ajax: {
+            url: proxyPath + 'supplierrefs',
+            delay: 400,
+            data: function (params) {
+                var query = {
+                    product: $("input#product_id").val(),
+                }
+                return query;
+            },
+            dataType: 'json',
+            processResults: function (data) {
+                // replacing name by text expected by select2
+                var newdata = $.map(data.rows, function (obj) {
+                    var text = obj.supplier_label + " - " + obj.supplierref_label;
+                    if (obj.supplierref_quantity.Valid) {
+                        text += " - " + obj.supplierref_quantity.Float64 + " " + obj.unit_label.String;
+                    }
+                    if (obj.supplierref_price.Valid) {
+                        text += " - " + obj.supplierref_price.Float64;
+                    }
+                    obj.text = obj.text || text;
+                    obj.id = obj.id || obj.supplierref_id;
+                    return obj;
+                });
+
+                return {
+                    results: newdata,
+                };
+            }
+        }
+    }).on("select2:select", function (e) {
+        // prefilling the storage with the catalogue reference
+        var ref = e.params.data;
+
+        if (ref.supplierref_quantity.Valid) {
+            $("input#storage_quantity").val(ref.supplierref_quantity.Float64);
+        }
+        if (ref.unit_id.Valid) {
+            $('select#unit').find('option').remove();
+            var newOption = new Option(ref.unit_label.String, ref.unit_id.Int64, true, true);
+            $('select#unit').append(newOption).trigger('change');
+        }
+        $('select#supplier').find('option').remove();
+        var newOption = new Option(ref.supplier_label, ref.supplier_id, true, true);
+        $('select#supplier').append(newOption).trigger('change');
+        $("input#storage_reference").val(ref.supplierref_label);
+    });
+
     //
     // borrowers select2
     //
@@ -532,6 +586,224 @@ $( document ).ready(function() {
     });
 });
 
+// labelsParams returns the labels parameters of the storages of the table
+// with the last AJAX query parameters
+function labelsParams() {
+    var newp = {};
+    $.each(lastQueryParams.data, function(k, v) {
+        if (v !== "") {
+            newp[k] = v;
+        }
+    });
+    newp["template"] = $("#labels_template").val();
+    newp["skip"] = $("#labels_skip").val();
+    newp["dpi"] = $("#labels_dpi").val();
+    return newp;
+}
+
+// printLabels downloads the PDF labels sheets of the storages of the table
+function printLabels() {
+    window.location.href = proxyPath + "storages/labels?" + $.param(labelsParams());
+    $("#labelsprint").modal("hide");
+}
+
+// downloadLabelsZPL downloads the ZPL labels of the storages of the table
+function downloadLabelsZPL() {
+    window.location.href = proxyPath + "storages/zpl?" + $.param(labelsParams());
+    $("#labelsprint").modal("hide");
+}
+
+// sendLabelsZPL sends the ZPL labels of the storages of the table
+// to the labels printers of their entities
+function sendLabelsZPL() {
+    $.ajax({
+        url: proxyPath + "storages/zpl?" + $.param(labelsParams()),
+        method: "POST",
+    }).done(function(data, textStatus, jqXHR) {
+        $("#labelsprint").modal("hide");
+        global.displayMessage(data + " labels sent", "success");
+    }).fail(function(jqXHR, textStatus, errorThrown) {
+        handleHTTPError(jqXHR.statusText, jqXHR.status);
+    });
+}
+
+//
+// bulk operations
+//
+$( document ).ready(function() {
+    $('select#bulk_storelocation').select2({
+        templateResult: formatStorelocation,
+        dropdownParent: $('#bulkedit'),
+        ajax: {
+            url: proxyPath + 'storelocations',
+            delay: 400,
+            data: function (params) {
+                var query = {
+                    search: params.term,
+                    page: params.page || 1,
+                    offset: (params.page-1)*10 || 0,
+                    limit: 10
+                }
+                return query;
+            },
+            dataType: 'json',
+            processResults: function (data) {
+                var newdata = $.map(data.rows, function (obj) {
+                    obj.text = obj.text || obj.storelocation_fullpath;
+                    obj.id = obj.id || obj.storelocation_id.Int64;
+                    return obj;
+                });
+                selectnbitems = $("ul#select2-bulk_storelocation-results li").length + 10;
+
+                return {
+                    results: newdata,
+                    pagination: {more: selectnbitems<data.total}
+                };
+            }
+        }
+    });
+
+    // showing the parameters of the selected operation only
+    $('select#bulk_operation').on('change', function() {
+        $(".bulk-param").hide();
+        $("#bulk-" + $(this).val()).show();
+    }).trigger('change');
+    $('#bulkedit').on('show.bs.modal', function() {
+        $("#bulk-report").empty();
+    });
+});
+
+// applyBulk applies the selected operation to all the storages of the table,
+// the whole filter being sent without the table pagination
+function applyBulk() {
+    var filter = {};
+    $.each(lastQueryParams.data, function(k, v) {
+        if (v !== "" && k !== "limit" && k !== "offset") {
+            filter[k] = v;
+        }
+    });
+    var form = {
+        operation: $("#bulk_operation").val(),
+        storelocation_id: $("#bulk_storelocation").val(),
+        storage_todestroy: $("#bulk_todestroy").is(":checked"),
+        storage_expirationdate: $("#bulk_expirationdate").val(),
+    };
+    // empty values are not sent, an empty expiration date clears it
+    $.each(form, function(k, v) {
+        if (v === "" || v === null) {
+            delete form[k];
+        }
+    });
+
+    $.ajax({
+        url: proxyPath + "storages/bulk?" + $.param(filter),
+        method: "POST",
+        dataType: "JSON",
+        data: form,
+    }).done(function(data, textStatus, jqXHR) {
+        if (data.applied) {
+            $("#bulkedit").modal("hide");
+            global.displayMessage(data.items.length + " " + global.t("bulk_applied_text", container.PersonLanguage), "success");
+            $('#table').bootstrapTable('refresh');
+            return;
+        }
+        var ul = $("<ul>");
+        $.each(data.items, function(i, item) {
+            if (item.error) {
+                ul.append($("<li>").text(item.storage_id + ": " + item.error));
+            }
+        });
+        $("#bulk-report").empty()
+            .append($("<div>").addClass("alert alert-danger").text(global.t("bulk_rejected_text", container.PersonLanguage)).append(ul));
+    }).fail(function(jqXHR, textStatus, errorThrown) {
+        handleHTTPError(jqXHR.statusText, jqXHR.status);
+    });
+}
+
+//
+// aliquoting
+//
+function operateSplit(e, value, row, index) {
+    $("#split").attr("sid", row.storage_id.Int64);
+    $("#split-title").text(row.product.name.name_label + " - " + storage_quantityFormatter(null, row, null, null));
+    $("#split-aliquots").empty();
+    addAliquot(row.storelocation.storelocation_id.Int64, row.storelocation.storelocation_fullpath);
+    $("#split").modal("show");
+}
+
+// addAliquot adds an aliquot row in the split form, in the store location "slid" by default
+function addAliquot(slid, slfullpath) {
+    var i = $("#split-aliquots .aliquot").length;
+    var row = $("<div>").addClass("form-row aliquot")
+        .append($("<div>").addClass("form-group col-sm-4")
+            .append($("<input>").addClass("form-control").attr({type: "number", min: "0", step: "any", name: "aliquots." + i + ".storage_quantity"})))
+        .append($("<div>").addClass("form-group col-sm-8")
+            .append($("<select>").attr({name: "aliquots." + i + ".storelocation_id"}).css("width", "100%")));
+    $("#split-aliquots").append(row);
+
+    var select = row.find("select");
+    if (slid) {
+        select.append(new Option(slfullpath, slid, true, true));
+    }
+    select.select2({
+        templateResult: formatStorelocation,
+        dropdownParent: $('#split'),
+        ajax: {
+            url: proxyPath + 'storelocations',
+            delay: 400,
+            data: function (params) {
+                var query = {
+                    search: params.term,
+                    page: params.page || 1,
+                    offset: (params.page-1)*10 || 0,
+                    limit: 10
+                }
+                return query;
+            },
+            dataType: 'json',
+            processResults: function (data, params) {
+                var newdata = $.map(data.rows, function (obj) {
+                    obj.text = obj.text || obj.storelocation_fullpath;
+                    obj.id = obj.id || obj.storelocation_id.Int64;
+                    return obj;
+                });
+                return {
+                    results: newdata,
+                    pagination: {more: (params.page || 1)*10 < data.total}
+                };
+            }
+        }
+    });
+}
+
+// splitStorage splits the storage of the split form into its aliquots
+function splitStorage() {
+    $.ajax({
+        url: proxyPath + "storages/" + $("#split").attr("sid") + "/split",
+        method: "PUT",
+        data: $("#split-form").serialize(),
+    }).done(function(data, textStatus, jqXHR) {
+        $("#split").modal("hide");
+        global.displayMessage(global.t("storage_split_done", container.PersonLanguage), "success");
+        $('#table').bootstrapTable('refresh');
+    }).fail(function(jqXHR, textStatus, errorThrown) {
+        handleHTTPError(jqXHR.statusText, jqXHR.status);
+    });
+}
+
+// operateOpen sets the opening date of the storage to today, its expiration date being computed
+function operateOpen(e, value, row, index) {
+    $.ajax({
+        url: proxyPath + "storages/" + row.storage_id.Int64 + "/open",
+        method: "PUT",
+    }).done(function(data, textStatus, jqXHR) {
+        global.displayMessage(global.t("storage_open_done", container.PersonLanguage), "success");
+        $('#table').bootstrapTable('refresh');
+    }).fail(function(jqXHR, textStatus, errorThrown) {
+        handleHTTPError(jqXHR.statusText, jqXHR.status);
+    });
+}
+
 function getData(params) {
     // saving the query parameters
     lastQueryParams = params;
@@ -570,6 +842,8 @@ $('#table').on('load-success.bs.table refresh.bs.table', function () {
             $("#edit"+$(b).attr("storage_id")).fadeIn();
             $("#clone"+$(b).attr("storage_id")).fadeIn();
             $("#borrow"+$(b).attr("storage_id")).fadeIn();
+            $("#split"+$(b).attr("storage_id")).fadeIn();
+            $("#open"+$(b).attr("storage_id")).fadeIn();
             localStorage.setItem("storages:" + $(b).attr("storage_id") + ":PUT", true);
         }).fail(function(){
             localStorage.setItem("storages:" + $(b).attr("storage_id") + ":PUT", false);
@@ -724,10 +998,29 @@ function detailFormatter(index, row) {
                 html.push("<div class='col-sm-12'><span class='iconlabel'> " + global.t("storage_openingdate_title", container.PersonLanguage) + "</span> " + dateFormatter(row["storage_openingdate"]["Time"], null, null, null) + "</div>")
             }
             if (row["storage_expirationdate"]["Valid"]) {
-                html.push("<div class='col-sm-12'><span class='iconlabel'> " + global.t("storage_expirationdate_title", container.PersonLanguage) + "</span> " + dateFormatter(row["storage_expirationdate"]["Time"], null, null, null) + "</div>")
+                var origin = row["storage_expirationcomputed"] ? "storage_expirationdate_computed" : "storage_expirationdate_manual";
+                html.push("<div class='col-sm-12'><span class='iconlabel'> " + global.t("storage_expirationdate_title", container.PersonLanguage) + "</span> " + dateFormatter(row["storage_expirationdate"]["Time"], null, null, null) + " <span class='badge badge-secondary'>" + global.t(origin, container.PersonLanguage) + "</span></div>")
+            }
+            if (row["storage_shelflifereception"]["Valid"]) {
+                html.push("<div class='col-sm-12'><span class='iconlabel'> " + global.t("storage_shelflifereception_title", container.PersonLanguage) + "</span> " + row["storage_shelflifereception"]["Int64"] + "</div>")
+            }
+            if (row["storage_shelflifeopening"]["Valid"]) {
+                html.push("<div class='col-sm-12'><span class='iconlabel'> " + global.t("storage_shelflifeopening_title", container.PersonLanguage) + "</span> " + row["storage_shelflifeopening"]["Int64"] + "</div>")
             }
         html.push("</div>")   
     
+        html.push("<div class='row mb-sm-3'>")
+            if (row["storage_parent"]["Valid"]) {
+                html.push("<div class='col-sm-12'><span class='iconlabel'> " + global.t("storage_parent_title", container.PersonLanguage) + "</span> <a href='" + proxyPath + "v/storages?storage=" + row["storage_parent"]["Int64"] + "'>" + row["storage_parent"]["Int64"] + "</a></div>")
+            }
+            if (row["storage_children"] != null && row["storage_children"].length != 0) {
+                var children = $.map(row["storage_children"], function(id) {
+                    return "<a href='" + proxyPath + "v/storages?storage=" + id + "'>" + id + "</a>";
+                });
+                html.push("<div class='col-sm-12'><span class='iconlabel'> " + global.t("storage_children_title", container.PersonLanguage) + "</span> " + children.join(", ") + "</div>")
+            }
+        html.push("</div>")
+
         html.push("<div class='row mb-sm-3'>")
         if (row["storage_comment"]["Valid"] && row["storage_comment"]["String"] != "") {
             html.push("<div class='col-sm-12'><span class='iconlabel'> " + global.t("storage_comment_title", container.PersonLanguage) + "</span> " + row["storage_comment"]["String"] + "</div>")
@@ -863,7 +1156,15 @@ function operateFormatter(value, row, index) {
             '</button>',
             '<button id="borrow' + sid + '" sid="' + sid + '" data-target="#borrow" class="borrow btn btn-link btn-sm" style="display: none;" title="' + borrowingtitle + '" type="button">',
             '<span class="mdi mdi-24px mdi-' + borrowingicon + '"></span>',
+            '</button>',
+            '<button id="split' + sid + '" sid="' + sid + '" class="split btn btn-link btn-sm" style="display: none;" title="' + global.t("storage_split", container.PersonLanguage) + '" type="button">',
+            '<span class="mdi mdi-24px mdi-call-split"></span>',
             '</button>'];
+        if (!row.storage_openingdate.Valid) {
+            actions.push('<button id="open' + sid + '" sid="' + sid + '" class="open btn btn-link btn-sm" style="display: none;" title="' + global.t("storage_open", container.PersonLanguage) + '" type="button">');
+            actions.push('<span class="mdi mdi-24px mdi-package-variant"></span>');
+            actions.push('</button>');
+        }
     }
                 
     if (row.storage.storage_id.Valid) {
@@ -895,6 +1196,12 @@ window.operateEvents = {
     'click .borrow': function (e, value, row, index) {
         operateBorrow(e, value, row, index)
     },
+    'click .split': function (e, value, row, index) {
+        operateSplit(e, value, row, index)
+    },
+    'click .open': function (e, value, row, index) {
+        operateOpen(e, value, row, index)
+    },
     'click .history': function (e, value, row, index) {
         var urlParams = new URLSearchParams(window.location.search);
         window.location = proxyPath + "v/storages?storage="+row['storage_id'].Int64+"&history=true&" + urlParams;
@@ -967,6 +1274,7 @@ function operateBorrow(e, value, row, index) {
     // clean select2 input selection
     $('select#borrower').val(null).trigger('change');
     $('select#borrower').find('option').remove();
+    $('input#borrowing_duedate').val(null);
     
     // get borrowed storage id
     $("input#bstorage_id").val(row['storage_id'].Int64);
@@ -995,6 +1303,7 @@ function saveBorrowing() {
     };
 
     var borrowing_comment = $("textarea#borrowing_comment").val(),
+        borrowing_duedate = $("input#borrowing_duedate").val(),
         borrower = $('select#borrower').select2('data')[0],
         storage_id = $("input#bstorage_id").val(),
         data = {};
@@ -1004,6 +1313,11 @@ function saveBorrowing() {
             "borrowing_comment": borrowing_comment,
             "borrower.person_id": borrower.id,
         });
+        if (borrowing_duedate !== "") {
+            $.extend(data, {
+                "borrowing_duedate": borrowing_duedate,
+            });
+        }
     }
 
     $.ajax({
@@ -1027,6 +1341,9 @@ function operateEdit(e, value, row, index) {
     $('input#storage_exitdate').val(null);
     $('input#storage_openingdate').val(null);
     $('input#storage_expirationdate').val(null);
+    $('input#storage_shelflifereception').val(null);
+    $('input#storage_shelflifeopening').val(null);
+    $('input#storage_expirationcomputed').prop("checked", false);
     $('input#storage_reference').val(null);
     $('input#storage_batchnumber').val(null);
     $('input#storage_barecode').val(null);
@@ -1055,6 +1372,8 @@ function operateEdit(e, value, row, index) {
         
         // setting index hidden input
         $("input#index").val(index);
+
+        $('input#storage_expirationcomputed').prop("checked", data.storage_expirationcomputed);
         
         // select2 is not autofilled - we need a special operation
         var newOption = new Option(data.storelocation.storelocation_name.String, data.storelocation.storelocation_id.Int64, true, true);
@@ -1185,6 +1504,8 @@ function operateEdit(e, value, row, index) {
             storage_reference = $("input#storage_reference").val(),
             storage_batchnumber = $("input#storage_batchnumber").val(),
             storage_todestroy = $("input#storage_todestroy:CHECKED").val(),
+            storage_shelflifereception = $("input#storage_shelflifereception").val(),
+            storage_shelflifeopening = $("input#storage_shelflifeopening").val(),
             unit = $('select#unit').select2('data')[0],
             supplier = $('select#supplier').select2('data')[0],
             storelocation = $('select#storelocation').select2('data')[0],
@@ -1209,6 +1530,7 @@ function operateEdit(e, value, row, index) {
                 "storage_reference": storage_reference,
                 "storage_batchnumber": storage_batchnumber,
                 "storage_todestroy": storage_todestroy == "on" ? true : false,
+                "storage_expirationcomputed": $("input#storage_expirationcomputed").is(":checked"),
                 "storelocation.storelocation_id": storelocation.id,
             });
             if (supplier !== undefined) {
@@ -1243,6 +1565,16 @@ function operateEdit(e, value, row, index) {
                     "storage_expirationdate": storage_expirationdate,
                 });
             }
+            if (storage_shelflifereception !== "") {
+                $.extend(data, {
+                    "storage_shelflifereception": storage_shelflifereception,
+                });
+            }
+            if (storage_shelflifeopening !== "") {
+                $.extend(data, {
+                    "storage_shelflifeopening": storage_shelflifeopening,
+                });
+            }
             $.ajax({
                 url: ajax_url,
                 method: ajax_method,
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// TestStorageAlerts checks that the storage alerts are notified once
+// and notified again when the storage dates change
+func TestStorageAlerts(t *testing.T) {
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	now := time.Now()
+	id, err := db.CreateStorage(models.Storage{
+		StorageCreationDate:     now,
+		StorageModificationDate: now,
+		StorageBarecode:         sql.NullString{Valid: true, String: ""},
+		StorageExpirationDate:   global.NullTime{Valid: true, Time: now.AddDate(0, 0, -1)},
+		Person:                  models.Person{PersonID: 1},
+		Product:                 models.Product{ProductID: pid},
+		StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alerts := func(n int) []models.StorageAlert {
+		a, err := db.GetStorageAlerts(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(a) != n {
+			t.Errorf("%d alerts expected - output: %+v", n, a)
+		}
+		return a
+	}
+	a := alerts(1)
+	if len(a) == 1 && (a[0].StorageID != id || a[0].StorageAlertKind != "expired") {
+		t.Errorf("the storage should be expired - output: %+v", a[0])
+	}
+	if err = db.CreateAlertNotifications(a, now); err != nil {
+		t.Fatal(err)
+	}
+	alerts(0)
+
+	// a new expiration date is notified again
+	if err = db.ApplyStorageBulkOperation(models.StorageBulkOperation{
+		Operation:             "expiration",
+		StorageIDs:            []int{id},
+		StorageExpirationDate: global.NullTime{Valid: true, Time: now.AddDate(0, 0, -2)},
+		PersonID:              1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.CreateAlertNotifications(alerts(1), now); err != nil {
+		t.Fatal(err)
+	}
+	alerts(0)
+
+	// an opening date older than the entity threshold
+	if _, err = db.Exec(`UPDATE storage SET storage_openingdate = ? WHERE storage_id = ?`, now.AddDate(-2, 0, 0), id); err != nil {
+		t.Fatal(err)
+	}
+	if a = alerts(1); len(a) == 1 && a[0].StorageAlertKind != "opened" {
+		t.Errorf("the storage should be opened for too long - output: %+v", a[0])
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// TestAcceptBorrowRequest accepts borrow requests as a borrowing and as a transfer
+// and checks that a request can not be decided twice
+func TestAcceptBorrowRequest(t *testing.T) {
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	e, err := db.GetStoreLocationEntity(slid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid, err := db.CreateStorage(models.Storage{
+		StorageCreationDate:     time.Now(),
+		StorageModificationDate: time.Now(),
+		StorageBarecode:         sql.NullString{Valid: true, String: ""},
+		Person:                  models.Person{PersonID: 1},
+		Product:                 models.Product{ProductID: pid},
+		StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	teid, err := db.CreateEntity(models.Entity{EntityName: "borrower"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tslid, err := db.CreateStoreLocation(models.StoreLocation{
+		StoreLocationName:     sql.NullString{Valid: true, String: "[B] shelf"},
+		StoreLocationCanStore: sql.NullBool{Valid: true, Bool: true},
+		Entity:                models.Entity{EntityID: teid},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRequest := func() models.BorrowRequest {
+		id, err := db.CreateBorrowRequest(models.BorrowRequest{ProductID: pid, EntityID: e.EntityID, PersonID: 1}, "please")
+		if err != nil {
+			t.Fatal(err)
+		}
+		br, err := db.GetBorrowRequest(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		br.StorageID = sql.NullInt64{Valid: true, Int64: int64(sid)}
+		return br
+	}
+	b := models.Borrowing{
+		Person:   models.Person{PersonID: 1},
+		Borrower: &models.Person{PersonID: 1},
+	}
+	tr := models.Transfer{PersonID: 1, TargetStoreLocationID: tslid}
+	count := func(sqlr string) int {
+		var n int
+		if err := db.Get(&n, sqlr, sid); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// borrowing
+	br := newRequest()
+	br.BorrowRequestKind = sql.NullString{Valid: true, String: "borrowing"}
+	if err = db.AcceptBorrowRequest(br, 1, b, tr); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AcceptBorrowRequest(br, 1, b, tr); err != models.ErrBorrowRequestNotPending {
+		t.Errorf("a second acceptance should fail - output: %v", err)
+	}
+	if err = db.DecideBorrowRequest(br, 1, "refused"); err != models.ErrBorrowRequestNotPending {
+		t.Errorf("an accepted request should not be refused - output: %v", err)
+	}
+	if n := count(`SELECT count(*) FROM borrowing WHERE storage = ?`); n != 1 {
+		t.Errorf("one borrowing expected - output: %d", n)
+	}
+	if br, err = db.GetBorrowRequest(br.BorrowRequestID); err != nil || br.BorrowRequestStatus != "accepted" {
+		t.Errorf("the request should be accepted - output: %s %v", br.BorrowRequestStatus, err)
+	}
+
+	// the storage is already borrowed: nothing is decided
+	br = newRequest()
+	br.BorrowRequestKind = sql.NullString{Valid: true, String: "borrowing"}
+	if err = db.AcceptBorrowRequest(br, 1, b, tr); err != models.ErrBorrowRequestStorageBorrowed {
+		t.Errorf("the storage is borrowed - output: %v", err)
+	}
+	if br, err = db.GetBorrowRequest(br.BorrowRequestID); err != nil || br.BorrowRequestStatus != "pending" {
+		t.Errorf("the request should still be pending - output: %s %v", br.BorrowRequestStatus, err)
+	}
+
+	// transfer, the second acceptance leaves no orphan transfer
+	br.StorageID = sql.NullInt64{Valid: true, Int64: int64(sid)}
+	br.BorrowRequestKind = sql.NullString{Valid: true, String: "transfer"}
+	if err = db.AcceptBorrowRequest(br, 1, b, tr); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AcceptBorrowRequest(br, 1, b, tr); err != models.ErrBorrowRequestNotPending {
+		t.Errorf("a second acceptance should fail - output: %v", err)
+	}
+	if n := count(`SELECT count(*) FROM transfer WHERE storage = ?`); n != 1 {
+		t.Errorf("one transfer expected - output: %d", n)
+	}
+
+	// refusal
+	br = newRequest()
+	if err = db.DecideBorrowRequest(br, 1, "refused"); err != nil {
+		t.Fatal(err)
+	}
+	br.BorrowRequestKind = sql.NullString{Valid: true, String: "transfer"}
+	if err = db.AcceptBorrowRequest(br, 1, b, tr); err != models.ErrBorrowRequestNotPending {
+		t.Errorf("a refused request should not be accepted - output: %v", err)
+	}
+}
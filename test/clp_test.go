@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestGetProductsClpClassification checks the pictograms and signal word
+// inferred from hazard statements, with the superseded pictograms
+func TestGetProductsClpClassification(t *testing.T) {
+	db, _, _, clean := newStorageTestDB(t)
+	defer clean()
+
+	for _, c := range []struct {
+		references []string
+		symbols    string
+		signalword string
+	}{
+		{[]string{"H225", "H301"}, "SGH02,SGH06", "danger"},
+		{[]string{"H302"}, "SGH07", "warning"},
+		// danger supersedes warning
+		{[]string{"H226", "H301"}, "SGH02,SGH06", "danger"},
+		// SGH06 always supersedes SGH07
+		{[]string{"H301", "H302"}, "SGH06", "danger"},
+		// SGH05 supersedes SGH07 for H315 only
+		{[]string{"H314", "H315"}, "SGH05", "danger"},
+		{[]string{"H314", "H315", "H335"}, "SGH05,SGH07", "danger"},
+		// SGH08 supersedes SGH07 for respiratory sensitisation only
+		{[]string{"H334", "H315"}, "SGH08", "danger"},
+		{[]string{"H350", "H315"}, "SGH07,SGH08", "danger"},
+		// no signal word
+		{[]string{"H228"}, "SGH02", ""},
+		{[]string{}, "", ""},
+	} {
+		clp, err := db.GetProductsClpClassification(c.references)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var symbols []string
+		for _, s := range clp.Symbols {
+			symbols = append(symbols, s.SymbolLabel)
+		}
+		if strings.Join(symbols, ",") != c.symbols || clp.SignalWord.SignalWordLabel.String != c.signalword {
+			t.Errorf("%v should be %s %s - output: %v %s", c.references, c.symbols, c.signalword, symbols, clp.SignalWord.SignalWordLabel.String)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// TestCreateConsumption withdraws quantities in other units from a storage
+// and checks the refusal of the incompatible units and negative stocks
+func TestCreateConsumption(t *testing.T) {
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	unit := func(label string) models.Unit {
+		var u models.Unit
+		if err := db.Get(&u, `SELECT unit_id, unit_label FROM unit WHERE unit_label = ?`, label); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	sid, err := db.CreateStorage(models.Storage{
+		StorageCreationDate:     time.Now(),
+		StorageModificationDate: time.Now(),
+		StorageQuantity:         sql.NullFloat64{Valid: true, Float64: 1},
+		StorageBarecode:         sql.NullString{Valid: true, String: ""},
+		Unit:                    unit("L"),
+		Person:                  models.Person{PersonID: 1},
+		Product:                 models.Product{ProductID: pid},
+		StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quantity := func(q float64, archive bool) {
+		s, err := db.GetStorage(sid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(s.StorageQuantity.Float64-q) > 1e-9 || s.StorageArchive.Bool != archive {
+			t.Errorf("the storage should be %v L archived %v - output: %v %v", q, archive, s.StorageQuantity.Float64, s.StorageArchive.Bool)
+		}
+	}
+
+	for _, c := range []struct {
+		quantity float64
+		unit     string
+		err      error
+		rest     float64
+	}{
+		{250, "mL", nil, 0.75},
+		{1, "g", models.ErrConsumptionUnit, 0.75},
+		{1, "L", models.ErrConsumptionQuantity, 0.75},
+		{500000, "µL", nil, 0.25},
+	} {
+		_, err = db.CreateConsumption(models.Consumption{
+			ConsumptionQuantity: c.quantity,
+			StorageID:           sid,
+			PersonID:            1,
+			UnitID:              unit(c.unit).UnitID,
+		})
+		if err != c.err {
+			t.Errorf("%v %s should return %v - output: %v", c.quantity, c.unit, c.err, err)
+		}
+		quantity(c.rest, false)
+	}
+
+	// the storage unit by default, archiving the empty storage
+	if _, err = db.CreateConsumption(models.Consumption{ConsumptionQuantity: 0.25, ConsumptionArchive: true, StorageID: sid, PersonID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	quantity(0, true)
+
+	r, err := db.GetProductConsumptions(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Total != 3 || len(r.Totals) != 1 || r.Totals[0].UnitLabel != "L" || math.Abs(r.Totals[0].Quantity-1) > 1e-9 {
+		t.Errorf("3 consumptions of 1 L expected - output: %+v", r)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// TestCollectDisposal collects a disposal batch and checks that its storages
+// and their history are archived with their exit date set
+func TestCollectDisposal(t *testing.T) {
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	e, err := db.GetStoreLocationEntity(slid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newStorage := func(todestroy bool) int {
+		id, err := db.CreateStorage(models.Storage{
+			StorageCreationDate:     time.Now(),
+			StorageModificationDate: time.Now(),
+			StorageBarecode:         sql.NullString{Valid: true, String: ""},
+			StorageToDestroy:        sql.NullBool{Valid: true, Bool: todestroy},
+			Person:                  models.Person{PersonID: 1},
+			Product:                 models.Product{ProductID: pid},
+			StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	destroyed := newStorage(true)
+	kept := newStorage(false)
+
+	// a history version of the destroyed storage
+	s, err := db.GetStorage(destroyed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.StorageQuantity = sql.NullFloat64{Valid: true, Float64: 2}
+	s.PersonID = 1
+	if err = db.UpdateStorage(s); err != nil {
+		t.Fatal(err)
+	}
+
+	d := models.Disposal{EntityID: e.EntityID, PersonID: 1}
+	if _, err = db.CreateDisposal(d, []int{destroyed, kept}); err != models.ErrDisposalStorage {
+		t.Errorf("the storage not to destroy should be refused - output: %v", err)
+	}
+	id, err := db.CreateDisposal(d, []int{destroyed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.CreateDisposal(d, []int{destroyed}); err != models.ErrDisposalStorage {
+		t.Errorf("the storage already in a batch should be refused - output: %v", err)
+	}
+
+	if err = db.CollectDisposal(id); err != nil {
+		t.Fatal(err)
+	}
+	if d, err = db.GetDisposal(id); err != nil || d.DisposalStatus != "collected" || !d.DisposalCollectionDate.Valid || len(d.Storages) != 1 {
+		t.Errorf("the batch should be collected - output: %+v %v", d, err)
+	}
+	var archives []struct {
+		ID      int           `db:"storage_id"`
+		Archive bool          `db:"storage_archive"`
+		Exited  bool          `db:"exited"`
+		Storage sql.NullInt64 `db:"storage"`
+	}
+	if err = db.Select(&archives, `SELECT storage_id, storage_archive, storage_exitdate IS NOT NULL AS exited, storage FROM storage
+	WHERE storage_id = ?1 OR storage = ?1 OR storage_id = ?2`, destroyed, kept); err != nil {
+		t.Fatal(err)
+	}
+	if len(archives) != 3 {
+		t.Fatalf("the storage, its history and the kept storage expected - output: %+v", archives)
+	}
+	for _, a := range archives {
+		switch {
+		case a.ID == kept:
+			if a.Archive {
+				t.Errorf("the kept storage should not be archived - output: %+v", a)
+			}
+		case a.ID == destroyed:
+			if !a.Archive || !a.Exited {
+				t.Errorf("the storage should be archived with its exit date - output: %+v", a)
+			}
+		default:
+			if !a.Archive {
+				t.Errorf("the history should be archived - output: %+v", a)
+			}
+		}
+	}
+
+	// a collected batch is closed
+	if err = db.CollectDisposal(id); err != models.ErrDisposalNotOpen {
+		t.Errorf("the batch should not be collected twice - output: %v", err)
+	}
+	if err = db.AddDisposalStorages(id, []int{kept}); err != models.ErrDisposalNotOpen {
+		t.Errorf("the collected batch should not change - output: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// TestGetStorageIncompatibilities stores products with the SGH02, SGH03 and SGH04 pictograms
+// and checks the blocking and warning rules between them
+func TestGetStorageIncompatibilities(t *testing.T) {
+	db, slid, _, clean := newStorageTestDB(t)
+	defer clean()
+
+	newProduct := func(name string, symbol string) int {
+		var sid int
+		if err := db.Get(&sid, `SELECT symbol_id FROM symbol WHERE symbol_label = ?`, symbol); err != nil {
+			t.Fatal(err)
+		}
+		id, err := db.CreateProduct(models.Product{
+			Name:             models.Name{NameID: -1, NameLabel: name},
+			CasNumber:        models.CasNumber{CasNumberID: 1},
+			EmpiricalFormula: models.EmpiricalFormula{EmpiricalFormulaID: 1},
+			Person:           models.Person{PersonID: 1},
+			Symbols:          []models.Symbol{{SymbolID: sid}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	newStorage := func(pid int) models.Storage {
+		return models.Storage{
+			StorageCreationDate:     time.Now(),
+			StorageModificationDate: time.Now(),
+			StorageBarecode:         sql.NullString{Valid: true, String: ""},
+			Person:                  models.Person{PersonID: 1},
+			Product:                 models.Product{ProductID: pid},
+			StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+		}
+	}
+
+	flammable := newProduct("flammable", "SGH02")
+	if _, err := db.CreateStorage(newStorage(flammable)); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name   string
+		symbol string
+		level  string
+	}{
+		{"oxidizer", "SGH03", "block"},
+		{"gas", "SGH04", "warn"},
+		{"toxic", "SGH06", ""},
+	} {
+		v, err := db.GetStorageIncompatibilities(newStorage(newProduct(c.name, c.symbol)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.level == "" {
+			if len(v) != 0 {
+				t.Errorf("%s should be compatible - output: %+v", c.name, v)
+			}
+			continue
+		}
+		if len(v) != 1 || v[0].IncompatibilityLevel != c.level || v[0].NameLabel2 != "FLAMMABLE" {
+			t.Errorf("%s should %s with the flammable - output: %+v", c.name, c.level, v)
+		}
+	}
+
+	// the storages of the same product are compatible
+	if v, err := db.GetStorageIncompatibilities(newStorage(flammable)); err != nil || len(v) != 0 {
+		t.Errorf("the same product should be compatible - output: %+v %v", v, err)
+	}
+}
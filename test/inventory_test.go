@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// TestInventoryReport scans storages of an inventory campaign, checks the report buckets
+// and moves the misplaced storages keeping their history
+func TestInventoryReport(t *testing.T) {
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	e, err := db.GetStoreLocationEntity(slid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newStoreLocation := func(name string, eid int) int {
+		id, err := db.CreateStoreLocation(models.StoreLocation{
+			StoreLocationName:     sql.NullString{Valid: true, String: name},
+			StoreLocationCanStore: sql.NullBool{Valid: true, Bool: true},
+			Entity:                models.Entity{EntityID: eid},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	newStorage := func(barecode string, slid int) int {
+		id, err := db.CreateStorage(models.Storage{
+			StorageCreationDate:     time.Now(),
+			StorageModificationDate: time.Now(),
+			StorageBarecode:         sql.NullString{Valid: true, String: barecode},
+			Person:                  models.Person{PersonID: 1},
+			Product:                 models.Product{ProductID: pid},
+			StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	feid, err := db.CreateEntity(models.Entity{EntityName: "foreign"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shelf := newStoreLocation("[S] shelf", e.EntityID)
+	found := newStorage("FOUND", slid)
+	newStorage("MISSING", slid)
+	misplaced := newStorage("MISPLACED", slid)
+	newStorage("FOREIGN", newStoreLocation("[F] shelf", feid))
+
+	iid, err := db.CreateInventory(models.Inventory{EntityID: e.EntityID, PersonID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for code, sl := range map[string]int{"FOUND": slid, "MISPLACED": shelf, "FOREIGN": shelf, "UNKNOWN": shelf} {
+		if _, err = db.CreateInventoryScan(models.InventoryScan{InventoryID: iid, InventoryScanCode: code, StoreLocationID: sl, PersonID: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := db.GetInventoryReport(iid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []struct {
+		name  string
+		items []models.InventoryItem
+		code  string
+	}{
+		{"found", r.Found, "FOUND"},
+		{"missing", r.Missing, "MISSING"},
+		{"misplaced", r.Misplaced, "MISPLACED"},
+		{"unknown", r.Unknown, "UNKNOWN"},
+		{"foreign", r.Foreign, "FOREIGN"},
+	} {
+		if len(b.items) != 1 || (b.items[0].InventoryScanCode.String != b.code && b.items[0].StorageBarecode.String != b.code) {
+			t.Errorf("%s items should be %s - output: %+v", b.name, b.code, b.items)
+		}
+	}
+
+	// the foreign storage is never moved
+	if n, err := db.MoveInventoryMisplaced(iid, 1, []int{found, misplaced}); err != nil || n != 1 {
+		t.Fatalf("one storage should be moved - output: %d %v", n, err)
+	}
+	s, err := db.GetStorage(misplaced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.StoreLocationID.Int64 != int64(shelf) || !s.StorageModifiedBy.Valid {
+		t.Errorf("the storage should be moved by the person - output: %d %v", s.StoreLocationID.Int64, s.StorageModifiedBy)
+	}
+	var sl []int
+	if err = db.Select(&sl, `SELECT storelocation FROM storage WHERE storage = ?`, misplaced); err != nil {
+		t.Fatal(err)
+	}
+	if len(sl) != 1 || sl[0] != slid {
+		t.Errorf("the history should keep the former store location - output: %v", sl)
+	}
+	if r, err = db.GetInventoryReport(iid); err != nil || len(r.Misplaced) != 0 || len(r.Found) != 2 {
+		t.Errorf("the moved storage should be found - output: %+v %v", r, err)
+	}
+}
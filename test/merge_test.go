@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// TestMergeProduct merges a product into another one and checks that its storages,
+// bookmarks and stock thresholds are moved without overriding the target ones
+func TestMergeProduct(t *testing.T) {
+	db, slid, from, clean := newStorageTestDB(t)
+	defer clean()
+
+	to, err := db.CreateProduct(models.Product{
+		Name:             models.Name{NameID: -1, NameLabel: "merge target"},
+		CasNumber:        models.CasNumber{CasNumberID: 1},
+		EmpiricalFormula: models.EmpiricalFormula{EmpiricalFormulaID: 1},
+		Person:           models.Person{PersonID: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := db.GetStoreLocationEntity(slid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := db.CreatePerson(models.Person{PersonEmail: "merge@test.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unit := func(label string) int {
+		var id int
+		if err := db.Get(&id, `SELECT unit_id FROM unit WHERE unit_label = ?`, label); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	sid, err := db.CreateStorage(models.Storage{
+		StorageCreationDate:     time.Now(),
+		StorageModificationDate: time.Now(),
+		StorageBarecode:         sql.NullString{Valid: true, String: ""},
+		Person:                  models.Person{PersonID: 1},
+		Product:                 models.Product{ProductID: from},
+		StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the person 1 bookmarked both products, the other one only the from product
+	for _, b := range []struct{ product, person int }{{from, 1}, {to, 1}, {from, pid}} {
+		if err = db.CreateProductBookmark(models.Product{ProductID: b.product}, models.Person{PersonID: b.person}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, th := range []models.StockThreshold{
+		{StockThresholdQuantity: 2, EntityID: e.EntityID, ProductID: from, UnitID: unit("L")},
+		{StockThresholdQuantity: 5, EntityID: e.EntityID, ProductID: from, UnitID: unit("g")},
+		{StockThresholdQuantity: 1, EntityID: e.EntityID, ProductID: to, UnitID: unit("L")},
+	} {
+		if err = db.UpdateStockThreshold(th); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = db.MergeProduct(from, to, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := db.GetStorage(sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ProductID != to {
+		t.Errorf("the storage should be moved - output: %d", s.ProductID)
+	}
+	for _, person := range []int{1, pid} {
+		if b, err := db.IsProductBookmark(models.Product{ProductID: to}, models.Person{PersonID: person}); err != nil || !b {
+			t.Errorf("the person %d should bookmark the product - output: %v %v", person, b, err)
+		}
+	}
+	var c int
+	if err = db.Get(&c, `SELECT count(*) FROM bookmark WHERE product = ?`, from); err != nil || c != 0 {
+		t.Errorf("the from bookmarks should be deleted - output: %d %v", c, err)
+	}
+
+	ts, err := db.GetStockThresholds(e.EntityID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := map[string]float64{}
+	for _, th := range ts {
+		if th.ProductID != to {
+			t.Errorf("the threshold should be moved - output: %+v", th)
+		}
+		q[th.UnitLabel] = th.StockThresholdQuantity
+	}
+	if len(ts) != 2 || q["L"] != 1 || q["g"] != 5 {
+		t.Errorf("the to threshold should be kept and the g one moved - output: %+v", ts)
+	}
+}
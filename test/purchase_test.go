@@ -0,0 +1,73 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// TestReceivePurchase checks that a purchase reception creating its storages
+// is rolled back as a whole when a storage can not be created
+func TestReceivePurchase(t *testing.T) {
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	e, err := db.GetStoreLocationEntity(slid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := db.CreatePurchase(models.Purchase{
+		PurchaseQuantity: sql.NullFloat64{Valid: true, Float64: 1},
+		PurchaseNbItem:   2,
+		ProductID:        pid,
+		EntityID:         e.EntityID,
+		PersonID:         1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []string{"approved", "ordered"} {
+		if err = db.UpdatePurchaseStatus(id, 1, status); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := db.GetPurchase(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := models.Storage{
+		StorageCreationDate:     time.Now(),
+		StorageModificationDate: time.Now(),
+		StorageQuantity:         p.PurchaseQuantity,
+		StorageBarecode:         sql.NullString{Valid: true, String: "RECEIVED"},
+		Person:                  models.Person{PersonID: 1},
+		Product:                 models.Product{ProductID: pid},
+		StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+	}
+	// the second storage gets the barecode of the first one
+	if _, err = db.ReceivePurchase(p, s); err != models.ErrStorageBarecodeUsed {
+		t.Errorf("the reception should fail - output: %v", err)
+	}
+	var n int
+	if err = db.Get(&n, `SELECT count(*) FROM storage WHERE product = ?`, pid); err != nil || n != 0 {
+		t.Errorf("the storages should be rolled back - output: %d %v", n, err)
+	}
+	if p, err = db.GetPurchase(id); err != nil || p.PurchaseStatus != "ordered" {
+		t.Errorf("the purchase status should be rolled back - output: %s %v", p.PurchaseStatus, err)
+	}
+
+	s.StorageBarecode = sql.NullString{Valid: true, String: ""}
+	ids, err := db.ReceivePurchase(p, s)
+	if err != nil || len(ids) != 2 {
+		t.Errorf("ReceivePurchase - output: %v %v expected: 2 storages", ids, err)
+	}
+	if p, err = db.GetPurchase(id); err != nil || p.PurchaseStatus != "received" || !p.PurchaseReceptionDate.Valid {
+		t.Errorf("the purchase should be received - output: %+v %v", p, err)
+	}
+	if _, err = db.ReceivePurchase(p, s); err != models.ErrPurchaseStatus {
+		t.Errorf("a purchase should be received only once - output: %v", err)
+	}
+}
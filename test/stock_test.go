@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// TestComputeStockStorelocation checks that the store location stock
+// excludes the storages history and the archived storages
+func TestComputeStockStorelocation(t *testing.T) {
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	unit := func(label string) models.Unit {
+		var u models.Unit
+		if err := db.Get(&u, `SELECT unit_id, unit_label FROM unit WHERE unit_label = ?`, label); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	l, ml := unit("L"), unit("mL")
+	var ids []int
+	for _, u := range []models.Unit{l, ml, ml} {
+		id, err := db.CreateStorage(models.Storage{
+			StorageCreationDate:     time.Now(),
+			StorageModificationDate: time.Now(),
+			StorageQuantity:         sql.NullFloat64{Valid: true, Float64: 500},
+			StorageBarecode:         sql.NullString{Valid: true, String: ""},
+			Unit:                    u,
+			Person:                  models.Person{PersonID: 1},
+			Product:                 models.Product{ProductID: pid},
+			StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	// a history version of the first storage
+	s, err := db.GetStorage(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.StorageQuantity = sql.NullFloat64{Valid: true, Float64: 2}
+	s.PersonID = 1
+	if err = db.UpdateStorage(s); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.ArchiveStorage(ids[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	sl := models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}}
+	if c := db.ComputeStockStorelocation(models.Product{ProductID: pid}, &sl, l); c != 2.5 {
+		t.Errorf("the stock should be 2.5 L - output: %v", c)
+	}
+}
+
+// TestCheckStockThresholds checks that a low stock is reported once
+// by concurrent checks
+func TestCheckStockThresholds(t *testing.T) {
+	const n = 10
+
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	e, err := db.GetStoreLocationEntity(slid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uid int
+	if err = db.Get(&uid, `SELECT unit_id FROM unit WHERE unit_label = "L"`); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.UpdateStockThreshold(models.StockThreshold{StockThresholdQuantity: 1, EntityID: e.EntityID, ProductID: pid, UnitID: uid}); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		lows = make(chan int, n)
+		errs = make(chan error, n)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			low, err := db.CheckStockThresholds(pid, e.EntityID)
+			if err != nil {
+				errs <- err
+				return
+			}
+			lows <- len(low)
+		}()
+	}
+	wg.Wait()
+	close(lows)
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+	c := 0
+	for l := range lows {
+		c += l
+	}
+	if c != 1 {
+		t.Errorf("the low stock should be reported once - output: %d", c)
+	}
+}
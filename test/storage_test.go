@@ -0,0 +1,562 @@
+package main
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/global"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// newStorageTestDB returns a new database with a "[C] cupboard" store location
+// of id slid and a product of id pid, clean removes it
+func newStorageTestDB(t *testing.T) (db *models.SQLiteDataStore, slid int, pid int, clean func()) {
+	dir, err := ioutil.TempDir("", "chimitheque")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db, err = models.NewSQLiteDBstore(path.Join(dir, "storage.db")); err != nil {
+		t.Fatal(err)
+	}
+	clean = func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+	if err = db.CreateDatabase(); err != nil {
+		clean()
+		t.Fatal(err)
+	}
+
+	eid, err := db.CreateEntity(models.Entity{EntityName: "storage"})
+	if err != nil {
+		clean()
+		t.Fatal(err)
+	}
+	if slid, err = db.CreateStoreLocation(models.StoreLocation{
+		StoreLocationName:     sql.NullString{Valid: true, String: "[C] cupboard"},
+		StoreLocationCanStore: sql.NullBool{Valid: true, Bool: true},
+		Entity:                models.Entity{EntityID: eid},
+	}); err != nil {
+		clean()
+		t.Fatal(err)
+	}
+	if pid, err = db.CreateProduct(models.Product{
+		Name:             models.Name{NameID: -1, NameLabel: "storage"},
+		CasNumber:        models.CasNumber{CasNumberID: 1},
+		EmpiricalFormula: models.EmpiricalFormula{EmpiricalFormulaID: 1},
+		Person:           models.Person{PersonID: 1},
+	}); err != nil {
+		clean()
+		t.Fatal(err)
+	}
+
+	return db, slid, pid, clean
+}
+
+// TestCreateStorageConcurrentBarecodes creates storages of the same product in parallel
+// and checks that their barecodes sequence numbers are all different
+func TestCreateStorageConcurrentBarecodes(t *testing.T) {
+	const n = 20
+
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	var (
+		wg   sync.WaitGroup
+		ids  = make(chan int, n)
+		errs = make(chan error, n)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := models.Storage{
+				StorageCreationDate:     time.Now(),
+				StorageModificationDate: time.Now(),
+				StorageBarecode:         sql.NullString{Valid: true, String: ""},
+				Person:                  models.Person{PersonID: 1},
+				Product:                 models.Product{ProductID: pid},
+				StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+			}
+			id, err := db.CreateStorage(s)
+			if err != nil {
+				errs <- err
+				return
+			}
+			ids <- id
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+	barecodes := make(map[string]bool)
+	for id := range ids {
+		s, err := db.GetStorage(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !s.StorageBarecode.Valid || s.StorageBarecode.String == "" || barecodes[s.StorageBarecode.String] {
+			t.Errorf("storage %d barecode %q is empty or duplicated", id, s.StorageBarecode.String)
+		}
+		barecodes[s.StorageBarecode.String] = true
+	}
+	// no number is lost and the .10 ordering is not broken
+	for i := 1; i <= n; i++ {
+		if bc := "C" + strconv.Itoa(pid) + "." + strconv.Itoa(i); !barecodes[bc] {
+			t.Errorf("barecode %s was not allocated", bc)
+		}
+	}
+}
+
+// TestStorageHistory updates a storage by another person, checks the history changes
+// and restores the first version
+func TestStorageHistory(t *testing.T) {
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	editor, err := db.CreatePerson(models.Person{PersonEmail: "editor@chimitheque.fr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := db.CreateStorage(models.Storage{
+		StorageCreationDate:     time.Now(),
+		StorageModificationDate: time.Now(),
+		StorageQuantity:         sql.NullFloat64{Valid: true, Float64: 10},
+		StorageComment:          sql.NullString{Valid: true, String: "first"},
+		Person:                  models.Person{PersonID: 1},
+		Product:                 models.Product{ProductID: pid},
+		StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := db.GetStorage(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.StorageQuantity = sql.NullFloat64{Valid: true, Float64: 5}
+	s.StorageComment = sql.NullString{Valid: true, String: "second"}
+	s.StorageModifiedBy = sql.NullInt64{Valid: true, Int64: int64(editor)}
+	s.StorageModificationDate = time.Now()
+	if err = db.UpdateStorage(s); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := db.GetStorageHistory(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Current || !versions[1].Current || versions[0].PersonID != 1 || versions[1].PersonID != editor {
+		t.Fatalf("wrong versions %+v", versions)
+	}
+	if c := versions[1].Changes; len(c) != 2 || c[0] != (models.StorageChange{Field: "storage_quantity", Old: "10", New: "5"}) ||
+		c[1] != (models.StorageChange{Field: "storage_comment", Old: "first", New: "second"}) {
+		t.Errorf("the update should change the quantity and the comment - output: %+v", c)
+	}
+
+	if err = db.RestoreStorageVersion(id, versions[0].StorageID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = db.GetStorage(id); err != nil {
+		t.Fatal(err)
+	}
+	// the consumed quantity is not restored
+	if s.StorageQuantity.Float64 != 5 || s.StorageComment.String != "first" || s.PersonID != 1 {
+		t.Errorf("the first version but its quantity should be restored - output: %+v", s)
+	}
+	if versions, err = db.GetStorageHistory(id); err != nil {
+		t.Fatal(err)
+	}
+	if c := versions[len(versions)-1].Changes; len(versions) != 3 || versions[2].PersonID != 1 || len(c) != 1 || c[0].New != "first" {
+		t.Errorf("the restore should be a new version - output: %+v", versions)
+	}
+
+	if err = db.RestoreStorageVersion(id, id, 1); err != models.ErrStorageVersionNotFound {
+		t.Errorf("the current storage is not a version - output: %v", err)
+	}
+
+	// a consumption is a new version
+	if _, err = db.CreateConsumption(models.Consumption{ConsumptionQuantity: 1, StorageID: id, PersonID: editor}); err != nil {
+		t.Fatal(err)
+	}
+	if versions, err = db.GetStorageHistory(id); err != nil {
+		t.Fatal(err)
+	}
+	if c := versions[len(versions)-1].Changes; len(versions) != 4 || versions[3].PersonID != editor || len(c) != 1 || c[0].New != "4" {
+		t.Errorf("the consumption should be a new version - output: %+v", versions)
+	}
+}
+
+// TestApplyStorageBulkOperation moves, archives and deletes storages at once
+func TestApplyStorageBulkOperation(t *testing.T) {
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	sl, err := db.GetStoreLocation(slid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := db.CreateStoreLocation(models.StoreLocation{
+		StoreLocationName:     sql.NullString{Valid: true, String: "[F] fridge"},
+		StoreLocationCanStore: sql.NullBool{Valid: true, Bool: true},
+		Entity:                models.Entity{EntityID: sl.EntityID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for i := 0; i < 3; i++ {
+		id, err := db.CreateStorage(models.Storage{
+			StorageCreationDate:     time.Now(),
+			StorageModificationDate: time.Now(),
+			Person:                  models.Person{PersonID: 1},
+			Product:                 models.Product{ProductID: pid},
+			StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err = db.ApplyStorageBulkOperation(models.StorageBulkOperation{Operation: "paint", StorageIDs: ids}); err != models.ErrStorageBulkOperation {
+		t.Errorf("paint is not a bulk operation - output: %v", err)
+	}
+
+	if err = db.ApplyStorageBulkOperation(models.StorageBulkOperation{Operation: "move", StorageIDs: ids, StoreLocationID: target, PersonID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		s, err := db.GetStorage(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.StoreLocationID.Int64 != int64(target) {
+			t.Errorf("storage %d should be moved - output: %d", id, s.StoreLocationID.Int64)
+		}
+		if v, err := db.GetStorageHistory(id); err != nil || len(v) != 2 || v[1].Changes[0].Field != "storelocation" {
+			t.Errorf("storage %d move should be in its history - output: %+v %v", id, v, err)
+		}
+	}
+
+	if err = db.ApplyStorageBulkOperation(models.StorageBulkOperation{Operation: "archive", StorageIDs: ids[:2]}); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := db.GetStorage(ids[0]); !s.StorageArchive.Bool {
+		t.Errorf("storage %d should be archived", ids[0])
+	}
+
+	// the storages are deleted with their history
+	if err = db.ApplyStorageBulkOperation(models.StorageBulkOperation{Operation: "delete", StorageIDs: ids}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		if _, err = db.GetStorage(id); err != sql.ErrNoRows {
+			t.Errorf("storage %d should be deleted - output: %v", id, err)
+		}
+	}
+}
+
+// TestSplitStorage splits a storage into aliquots and checks their lineage
+func TestSplitStorage(t *testing.T) {
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	id, err := db.CreateStorage(models.Storage{
+		StorageCreationDate:     time.Now(),
+		StorageModificationDate: time.Now(),
+		StorageQuantity:         sql.NullFloat64{Valid: true, Float64: 1000},
+		StorageBatchNumber:      sql.NullString{Valid: true, String: "B1"},
+		Person:                  models.Person{PersonID: 1},
+		Product:                 models.Product{ProductID: pid},
+		StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliquots := []models.StorageAliquot{{StorageQuantity: 100, StoreLocationID: slid}, {StorageQuantity: 100, StoreLocationID: slid}}
+	if _, err = db.SplitStorage(id, append(aliquots, models.StorageAliquot{StorageQuantity: 900, StoreLocationID: slid}), 1); err != models.ErrStorageSplitQuantity {
+		t.Errorf("the aliquots should not exceed the storage quantity - output: %v", err)
+	}
+	ids, err := db.SplitStorage(id, aliquots, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent, err := db.GetStorage(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent.StorageQuantity.Float64 != 800 || len(parent.StorageChildren) != 2 || parent.StorageChildren[0] != ids[0] || parent.StorageChildren[1] != ids[1] {
+		t.Errorf("the storage should be decremented and list its aliquots - output: %v %v", parent.StorageQuantity, parent.StorageChildren)
+	}
+	barecodes := map[string]bool{parent.StorageBarecode.String: true}
+	for _, cid := range ids {
+		c, err := db.GetStorage(cid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.StorageParent.Int64 != int64(id) || c.StorageQuantity.Float64 != 100 || c.StorageBatchNumber.String != "B1" || c.ProductID != pid {
+			t.Errorf("the aliquot %d should inherit the storage - output: %+v", cid, c)
+		}
+		if c.StorageBarecode.String == "" || barecodes[c.StorageBarecode.String] {
+			t.Errorf("the aliquot %d barecode %q is empty or duplicated", cid, c.StorageBarecode.String)
+		}
+		barecodes[c.StorageBarecode.String] = true
+	}
+
+	// the aliquots are kept when the split storage is deleted
+	if err = db.DeleteStorage(id); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := db.GetStorage(ids[0]); err != nil || c.StorageParent.Valid {
+		t.Errorf("the aliquot should lose its parent - output: %+v %v", c.StorageParent, err)
+	}
+}
+
+// TestMixture creates a mixture of a carcinogenic component in a solvent,
+// checks its suggested classification and prepares it from a component storage
+func TestMixture(t *testing.T) {
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	h350, err := db.GetProductsHazardStatementByReference("H350")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h315, err := db.GetProductsHazardStatementByReference("H315")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ml, err := db.GetUnitByLabel("mL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, p := range []models.Product{
+		{Name: models.Name{NameID: -1, NameLabel: "component"}, HazardStatements: []models.HazardStatement{h350, h315}, Symbols: []models.Symbol{{SymbolID: 7}, {SymbolID: 8}}},
+		{Name: models.Name{NameID: -1, NameLabel: "solvent"}},
+	} {
+		p.CasNumber = models.CasNumber{CasNumberID: 1}
+		p.EmpiricalFormula = models.EmpiricalFormula{EmpiricalFormulaID: 1}
+		p.Person = models.Person{PersonID: 1}
+		id, err := db.CreateProduct(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	mixture, err := db.GetProduct(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mixture.Components = []models.ProductComponent{{ComponentID: pid}}
+	if err = db.UpdateProduct(mixture); err != models.ErrProductComponent {
+		t.Errorf("a mixture should not be its own component - output: %v", err)
+	}
+
+	// the symbols are inferred from the kept statements,
+	// SGH07 being dropped with H315 under its cut-off value
+	tests := []struct {
+		concentration float64
+		symbols       string
+		signalword    string
+		statements    int
+	}{
+		{0.05, "", "", 0},
+		{0.5, "SGH08", "danger", 1},
+		{5, "SGH07,SGH08", "danger", 2},
+	}
+	for _, test := range tests {
+		mixture.Components = []models.ProductComponent{
+			{ComponentID: ids[0], ProductComponentConcentration: sql.NullFloat64{Valid: true, Float64: test.concentration}, ProductComponentConcentrationUnit: sql.NullString{Valid: true, String: "w/w"}},
+			{ComponentID: ids[1], ProductComponentSolvent: true},
+		}
+		if err = db.UpdateProduct(mixture); err != nil {
+			t.Fatal(err)
+		}
+		c, err := db.GetProductClassification(pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var symbols []string
+		for _, s := range c.Symbols {
+			symbols = append(symbols, s.SymbolLabel)
+		}
+		if strings.Join(symbols, ",") != test.symbols || c.SignalWord.SignalWordLabel.String != test.signalword || len(c.HazardStatements) != test.statements {
+			t.Errorf("GetProductClassification at %v%% - output: %+v expected: %s %s %d statements", test.concentration, c, test.symbols, test.signalword, test.statements)
+		}
+	}
+	if mixture, err = db.GetProduct(pid); err != nil || len(mixture.Components) != 2 || !mixture.Components[1].ProductComponentSolvent {
+		t.Errorf("the mixture should list its components - output: %+v %v", mixture.Components, err)
+	}
+
+	var sids []int
+	for _, p := range []int{ids[0], pid} {
+		id, err := db.CreateStorage(models.Storage{
+			StorageCreationDate:     time.Now(),
+			StorageModificationDate: time.Now(),
+			StorageQuantity:         sql.NullFloat64{Valid: true, Float64: 100},
+			Person:                  models.Person{PersonID: 1},
+			Product:                 models.Product{ProductID: p},
+			StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+			Unit:                    models.Unit{UnitID: ml.UnitID},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sids = append(sids, id)
+	}
+
+	preparation := models.MixturePreparation{
+		ProductID:       pid,
+		StorageQuantity: 50,
+		UnitID:          ml.UnitID,
+		StoreLocationID: slid,
+		Sources:         []models.MixtureSource{{StorageID: sids[0], Quantity: 10}, {StorageID: sids[1], Quantity: 10}},
+		PersonID:        1,
+	}
+	if _, err = db.PrepareMixture(preparation); err != models.ErrMixtureSource {
+		t.Errorf("a mixture should not be prepared from itself - output: %v", err)
+	}
+	preparation.Sources = preparation.Sources[:1]
+	id, err := db.PrepareMixture(preparation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := db.GetStorage(id); err != nil || s.ProductID != pid || s.StorageQuantity.Float64 != 50 {
+		t.Errorf("the mixture storage should be created - output: %+v %v", s, err)
+	}
+	for i, expected := range []float64{90, 100} {
+		if s, err := db.GetStorage(sids[i]); err != nil || s.StorageQuantity.Float64 != expected {
+			t.Errorf("the source storage %d quantity - output: %v %v expected: %v", sids[i], s.StorageQuantity, err, expected)
+		}
+	}
+}
+
+// TestStorageShelfLife checks the expiration dates computed from the product
+// and storage shelf-lives on creation, opening and recomputation
+func TestStorageShelfLife(t *testing.T) {
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	product, err := db.GetProduct(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	product.ProductShelfLifeReception = sql.NullInt64{Valid: true, Int64: 24}
+	product.ProductShelfLifeOpening = sql.NullInt64{Valid: true, Int64: 3}
+	if err = db.UpdateProduct(product); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	entry := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	date := func(months int) string { return entry.AddDate(0, months, 0).Format("2006-01-02") }
+	tests := []struct {
+		storage  models.Storage
+		computed bool
+		expected string
+	}{
+		{models.Storage{}, true, date(24)},
+		{models.Storage{StorageShelfLifeReception: sql.NullInt64{Valid: true, Int64: 6}}, true, date(6)},
+		{models.Storage{StorageExpirationDate: global.NullTime{Valid: true, Time: entry.AddDate(0, 1, 0)}}, false, date(1)},
+		{models.Storage{}, true, date(24)},
+	}
+	var ids []int
+	for _, test := range tests {
+		s := test.storage
+		s.StorageCreationDate = time.Now()
+		s.StorageModificationDate = time.Now()
+		s.StorageEntryDate = global.NullTime{Valid: true, Time: entry}
+		s.Person = models.Person{PersonID: 1}
+		s.Product = models.Product{ProductID: pid}
+		s.StoreLocation = models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}}
+		id, err := db.CreateStorage(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, err = db.GetStorage(id); err != nil || s.StorageExpirationComputed != test.computed ||
+			s.StorageExpirationDate.Time.Format("2006-01-02") != test.expected {
+			t.Errorf("CreateStorage expiration - output: %v %v %v expected: %v %v", s.StorageExpirationDate, s.StorageExpirationComputed, err, test.expected, test.computed)
+		}
+		ids = append(ids, id)
+	}
+
+	if err = db.OpenStorage(ids[0], 1); err != nil {
+		t.Fatal(err)
+	}
+	expected := now.AddDate(0, 3, 0).Format("2006-01-02")
+	if s, err := db.GetStorage(ids[0]); err != nil || !s.StorageOpeningDate.Valid || s.StorageExpirationDate.Time.Format("2006-01-02") != expected {
+		t.Errorf("OpenStorage expiration - output: %v %v expected: %v", s.StorageExpirationDate, err, expected)
+	}
+	if err = db.OpenStorage(ids[0], 1); err != models.ErrStorageOpened {
+		t.Errorf("a storage should not be opened twice - output: %v", err)
+	}
+
+	product.ProductShelfLifeReception = sql.NullInt64{Valid: true, Int64: 12}
+	if err = db.UpdateProduct(product); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.ComputeStoragesExpirationDates(); err != nil || n != 1 {
+		t.Errorf("ComputeStoragesExpirationDates - output: %d %v expected: 1", n, err)
+	}
+	for i, expected := range []string{expected, date(6), date(1), date(12)} {
+		if s, err := db.GetStorage(ids[i]); err != nil || s.StorageExpirationDate.Time.Format("2006-01-02") != expected {
+			t.Errorf("the storage %d expiration - output: %v %v expected: %v", ids[i], s.StorageExpirationDate, err, expected)
+		}
+	}
+}
+
+// TestUniqueStorageBarecodes regenerates the duplicated barecodes of a former database
+func TestUniqueStorageBarecodes(t *testing.T) {
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	var ids []int
+	for i := 0; i < 2; i++ {
+		id, err := db.CreateStorage(models.Storage{
+			StorageCreationDate:     time.Now(),
+			StorageModificationDate: time.Now(),
+			StorageBarecode:         sql.NullString{Valid: true, String: ""},
+			Person:                  models.Person{PersonID: 1},
+			Product:                 models.Product{ProductID: pid},
+			StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if _, err := db.Exec(`DROP INDEX idx_storage_barecode;
+	UPDATE storage SET storage_barecode = "DUPLICATE" WHERE storage_id IN (?, ?)`, ids[0], ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateDatabase(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, id := range ids {
+		s, err := db.GetStorage(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (i == 0) != (s.StorageBarecode.String == "DUPLICATE") || s.StorageBarecode.String == "" {
+			t.Errorf("only the oldest storage should keep its barecode - output: %d %s", id, s.StorageBarecode.String)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// TestDecideTransfer accepts and refuses storage transfers to another entity
+// and checks the barecode regeneration of the accepted one
+func TestDecideTransfer(t *testing.T) {
+	db, slid, pid, clean := newStorageTestDB(t)
+	defer clean()
+
+	sid, err := db.CreateStorage(models.Storage{
+		StorageCreationDate:     time.Now(),
+		StorageModificationDate: time.Now(),
+		StorageBarecode:         sql.NullString{Valid: true, String: ""},
+		Person:                  models.Person{PersonID: 1},
+		Product:                 models.Product{ProductID: pid},
+		StoreLocation:           models.StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(slid)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	teid, err := db.CreateEntity(models.Entity{EntityName: "target"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tslid, err := db.CreateStoreLocation(models.StoreLocation{
+		StoreLocationName:     sql.NullString{Valid: true, String: "[T] shelf"},
+		StoreLocationCanStore: sql.NullBool{Valid: true, Bool: true},
+		Entity:                models.Entity{EntityID: teid},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := models.Transfer{StorageID: sid, PersonID: 1, TargetStoreLocationID: tslid}
+
+	// refusal
+	id, err := db.CreateTransfer(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.CreateTransfer(tr); err != models.ErrTransferPending {
+		t.Errorf("only one pending transfer per storage - output: %v", err)
+	}
+	if err = db.RefuseTransfer(id, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AcceptTransfer(id, 1); err != models.ErrTransferNotPending {
+		t.Errorf("a refused transfer should not be accepted - output: %v", err)
+	}
+	s, err := db.GetStorage(sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.StoreLocationID.Int64 != int64(slid) || s.StorageBarecode.String != "C"+strconv.Itoa(pid)+".1" {
+		t.Errorf("the storage should not move - output: %d %s", s.StoreLocationID.Int64, s.StorageBarecode.String)
+	}
+
+	// acceptance
+	if id, err = db.CreateTransfer(tr); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AcceptTransfer(id, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AcceptTransfer(id, 1); err != models.ErrTransferNotPending {
+		t.Errorf("a transfer should not be accepted twice - output: %v", err)
+	}
+	if s, err = db.GetStorage(sid); err != nil {
+		t.Fatal(err)
+	}
+	if s.StoreLocationID.Int64 != int64(tslid) || s.StorageBarecode.String != "T"+strconv.Itoa(pid)+".1" {
+		t.Errorf("the storage should move with a new barecode - output: %d %s", s.StoreLocationID.Int64, s.StorageBarecode.String)
+	}
+	var sl []int
+	if err = db.Select(&sl, `SELECT storelocation FROM storage WHERE storage = ?`, sid); err != nil || len(sl) != 1 || sl[0] != slid || !s.StorageModifiedBy.Valid {
+		t.Errorf("the history should keep the former store location - output: %v %v %v", sl, s.StorageModifiedBy, err)
+	}
+	if tr, err = db.GetTransfer(id); err != nil || tr.TransferStatus != "accepted" || !tr.DeciderID.Valid {
+		t.Errorf("the transfer should be accepted - output: %s %v", tr.TransferStatus, err)
+	}
+
+	// the storage is in the target store location now
+	if _, err = db.CreateTransfer(tr); err != models.ErrTransferTarget {
+		t.Errorf("the target should be another store location - output: %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestUnits checks the parent units and multipliers of a new database
+// and their fix in a former database
+func TestUnits(t *testing.T) {
+	db, _, _, clean := newStorageTestDB(t)
+	defer clean()
+
+	check := func() {
+		for label, parent := range map[string]struct {
+			label      string
+			multiplier float64
+		}{
+			"mL": {"L", 0.001}, "µL": {"L", 0.000001},
+			"kg": {"g", 1000}, "mg": {"g", 0.001}, "µg": {"g", 0.000001},
+			"dm": {"m", 0.1}, "cm": {"m", 0.01},
+		} {
+			var (
+				l string
+				m float64
+			)
+			sqlr := `SELECT parent.unit_label, unit.unit_multiplier FROM unit
+			JOIN unit AS parent ON unit.unit = parent.unit_id
+			WHERE unit.unit_label = ?`
+			if err := db.QueryRow(sqlr, label).Scan(&l, &m); err != nil || l != parent.label || m != parent.multiplier {
+				t.Errorf("%s should be %v of %s - output: %v %s %v", label, parent.multiplier, parent.label, m, l, err)
+			}
+		}
+	}
+	check()
+
+	// the former databases units
+	if _, err := db.Exec(`UPDATE unit SET unit = (SELECT unit_id FROM unit WHERE unit_label = "mL") WHERE unit_label IN ("kg", "mg", "µg");
+	UPDATE unit SET unit = (SELECT unit_id FROM unit WHERE unit_label = "µL") WHERE unit_label IN ("dm", "cm");
+	UPDATE unit SET unit_multiplier = 0.00001 WHERE unit_label IN ("µL", "µg");`); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	check()
+}
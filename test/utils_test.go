@@ -1,7 +1,11 @@
 package main
 
 import (
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/tbellembois/gochimitheque/utils"
 )
@@ -54,3 +58,130 @@ func TestLinearToEmpiricalFormula(t *testing.T) {
 		t.Errorf("%s was not converted - output: %s", f, sortedf)
 	}
 }
+
+func TestLevenshtein(t *testing.T) {
+	a, b := "ETHANOL", "ETANOL"
+	if d := utils.Levenshtein(a, b); d != 1 {
+		t.Errorf("%s %s distance should be 1 - output: %d", a, b, d)
+	}
+}
+
+func TestSmilesToEmpiricalFormula(t *testing.T) {
+	for s, f := range map[string]string{
+		"CCO":            "C2H6O",
+		"OC(=O)c1ccccc1": "C7H6O2",
+		"c1cc[nH]c1":     "C4H5N",
+		"c1ccsc1":        "C4H4S",
+		"c1ccoc1":        "C4H4O",
+		"[Na+].[Cl-]":    "ClNa",
+	} {
+		ef, err := utils.SmilesToEmpiricalFormula(s)
+		if err != nil {
+			t.Errorf("%s is not a valid SMILES: %v", s, err)
+		}
+		if ef != f {
+			t.Errorf("%s was not converted - output: %s", s, ef)
+		}
+	}
+	for _, s := range []string{"C1CC", "C(C", "CC=", "C()C", "C((C))", "Xy"} {
+		if _, err := utils.SmilesToEmpiricalFormula(s); err == nil {
+			t.Errorf("%s should not be a valid SMILES", s)
+		}
+	}
+	if !utils.SameEmpiricalFormula("CuO4S.5H2O", "H10CuO9S") {
+		t.Errorf("CuO4S.5H2O and H10CuO9S should be the same formula")
+	}
+}
+
+func TestWasteCategory(t *testing.T) {
+	for c, p := range map[string][2][]string{
+		"flammable":     {{"SGH02", "SGH07"}, {"H225"}},
+		"oxidizing":     {{"SGH03", "SGH05"}, nil},
+		"cmr":           {{"SGH08"}, {"H360FD"}},
+		"corrosive":     {nil, {"H314"}},
+		"other":         {{"SGH07"}, {"H319"}},
+		"non hazardous": {nil, nil},
+	} {
+		if wc := utils.WasteCategory(p[0], p[1]); wc != c {
+			t.Errorf("%v %v should be %s - output: %s", p[0], p[1], c, wc)
+		}
+	}
+}
+
+func TestParseGS1(t *testing.T) {
+	for _, s := range []string{
+		"]d20103453120000011\x1d3153000750\x1d17191100\x1d10ABCD1234",
+		"0103453120000011315300075017191100\x1d10ABCD1234",
+		"(01)03453120000011(3153)000750(17)191100(10)ABCD1234",
+	} {
+		if !utils.IsGS1(s) {
+			t.Errorf("%q should be a GS1 element string", s)
+		}
+		g, err := utils.ParseGS1(s)
+		if err != nil {
+			t.Errorf("%q was not parsed: %v", s, err)
+			continue
+		}
+		if g.GTIN != "03453120000011" || g.Batch != "ABCD1234" || g.Quantity != 0.75 || g.QuantityUnit != "L" ||
+			g.Expiry.Format("2006-01-02") != "2019-11-30" {
+			t.Errorf("%q was not parsed - output: %+v", s, g)
+		}
+	}
+	for _, s := range []string{"CHIM000123", "012345", "(01)0345"} {
+		if _, err := utils.ParseGS1(s); err == nil && utils.IsGS1(s) {
+			t.Errorf("%q should not be a valid GS1 element string", s)
+		}
+	}
+}
+
+func TestBarecodeTemplate(t *testing.T) {
+	v := utils.BarecodeValues{Entity: "CHEM", StoreLocation: "A", Product: 42, Seq: 7, Date: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)}
+	for tpl, bc := range map[string]string{
+		utils.DefaultBarecodeTemplate:         "A42.7",
+		"{entity}-{yy}-{seq:5}":               "CHEM-20-00007",
+		"{entity}{year}{product:4}/{seq}":     "CHEM20200042/7",
+		"{product:6}{seq:4}{check}":           "00004200077",
+		"{storelocation}{entity}{seq}{check}": "ACHEM75",
+	} {
+		if r, err := utils.RenderBarecode(tpl, v); err != nil || r != bc {
+			t.Errorf("%s should render %s - output: %s %v", tpl, bc, r, err)
+		}
+		p, prefix, err := utils.BarecodeSeqPattern(tpl, v)
+		if err != nil || !regexp.MustCompile(p).MatchString(bc) || !strings.HasPrefix(bc, prefix) {
+			t.Errorf("%s pattern %s %s should match %s: %v", tpl, p, prefix, bc, err)
+		}
+	}
+	for _, tpl := range []string{"{entity}-{product}", "{seq}{check}-", "{foo}{seq}", "{entity:3}{seq}", "A {seq}"} {
+		if err := utils.ValidateBarecodeTemplate(tpl); err == nil {
+			t.Errorf("%s should not be a valid template", tpl)
+		}
+	}
+	if c := utils.BarecodeCheckDigit("7992739871"); c != "3" {
+		t.Errorf("7992739871 check digit should be 3 - output: %s", c)
+	}
+}
+
+func TestCode128(t *testing.T) {
+	for code, bars := range map[string]string{
+		// start B, A, B, checksum 102, stop
+		"AB": "211214" + "111323" + "131123" + "411131" + "2331112",
+		// start C, 12, 34, checksum 82, stop
+		"1234": "211232" + "112232" + "131123" + "121241" + "2331112",
+	} {
+		widths, err := utils.Code128(code)
+		if err != nil {
+			t.Errorf("%s should be encoded: %v", code, err)
+			continue
+		}
+		var s strings.Builder
+		for _, w := range widths {
+			s.WriteString(strconv.Itoa(w))
+		}
+		if s.String() != bars {
+			t.Errorf("%s should be encoded %s - output: %s", code, bars, s.String())
+		}
+	}
+	if _, err := utils.Code128("é"); err == nil {
+		t.Errorf("é should not be encoded")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/helpers"
+)
+
+// TestSendZPL sends a label to a local TCP listener standing in for a labels printer
+func TestSendZPL(t *testing.T) {
+	if a := helpers.LabelPrinterAddress("printer.local"); a != "printer.local:9100" {
+		t.Errorf("printer.local should default to port 9100 - output: %s", a)
+	}
+	if a := helpers.LabelPrinterAddress("10.0.0.2:6101"); a != "10.0.0.2:6101" {
+		t.Errorf("10.0.0.2:6101 should keep its port - output: %s", a)
+	}
+
+	// a 2x2 black and transparent checker
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.Black)
+	img.Set(1, 1, color.Black)
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+
+	z := helpers.NewZPL()
+	z.StartLabel(400, 240)
+	z.Text(10, 10, 30, 380, "ethanol ^~_")
+	z.Code128(10, 100, 2, 60, "A12.3")
+	if err := z.Image(300, 10, 16, 16, b.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	z.EndLabel()
+	zpl := z.Bytes()
+
+	for _, s := range []string{"^XA", "^FDethanol _5E_7E_5F^FS", "^BCN,60,N,N,N,A^FH^FDA12.3^FS", "^GFA,32,32,2,FF00FF00", "^XZ"} {
+		if !bytes.Contains(zpl, []byte(s)) {
+			t.Errorf("the ZPL should contain %s - output: %s", s, zpl)
+		}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := make(chan []byte)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		b, _ := ioutil.ReadAll(conn)
+		received <- b
+	}()
+
+	if err = helpers.SendZPL(l.Addr().String(), zpl, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-received; !bytes.Equal(r, zpl) {
+		t.Errorf("the printer should receive the ZPL - output: %s", r)
+	}
+
+	// nothing listens on a closed port
+	l.Close()
+	if err = helpers.SendZPL(l.Addr().String(), zpl, time.Second); err == nil {
+		t.Errorf("sending to a closed port should fail - output: %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBarecodeTemplate is the historical [prefix]major.minor storages barecodes format
+const DefaultBarecodeTemplate = "{storelocation}{product}.{seq}"
+
+var (
+	// barecodeToken matches the {name} and {name:width} tokens of a barecode template
+	barecodeToken = regexp.MustCompile(`\{([a-z]+)(?::([0-9]+))?\}`)
+	// barecodeCode matches the entities and store locations codes
+	barecodeCode = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	// storeLocationCode matches the [code] tag at the beginning of the store locations names
+	storeLocationCode = regexp.MustCompile(`^\[([a-zA-Z0-9_-]+)\]`)
+)
+
+// BarecodeValues are the values of a barecode template tokens
+type BarecodeValues struct {
+	Entity        string    // entity code
+	StoreLocation string    // store location code
+	Product       int       // product id
+	Seq           int       // sequence number
+	Date          time.Time // year
+}
+
+// IsBarecodeCode returns true if s can be used as an entity or store location code in the barecodes
+func IsBarecodeCode(s string) bool {
+	return barecodeCode.MatchString(s)
+}
+
+// StoreLocationCode returns the code of the store location with name "name"
+// taken from a [code] tag at its beginning, empty if none
+func StoreLocationCode(name string) string {
+	if m := storeLocationCode.FindStringSubmatch(name); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// ValidateBarecodeTemplate returns an error if the barecode template t has unknown tokens,
+// has no {seq} token or a {check} token not at its end.
+// Known tokens are {entity}, {storelocation}, {product}, {seq}, {year}, {yy} and {check},
+// {product} and {seq} accept a zero padding width such as {seq:5}.
+func ValidateBarecodeTemplate(t string) error {
+	var seq bool
+
+	for _, m := range barecodeToken.FindAllStringSubmatchIndex(t, -1) {
+		name := t[m[2]:m[3]]
+		width := m[4] != -1
+		switch name {
+		case "seq":
+			seq = true
+		case "product":
+		case "entity", "storelocation", "year", "yy":
+			if width {
+				return fmt.Errorf("the {%s} token has no width", name)
+			}
+		case "check":
+			if width {
+				return errors.New("the {check} token has no width")
+			}
+			if m[1] != len(t) {
+				return errors.New("the {check} token must end the template")
+			}
+		default:
+			return fmt.Errorf("unknown token {%s}", name)
+		}
+	}
+	if !seq {
+		return errors.New("the {seq} token is required")
+	}
+	if strings.ContainsAny(barecodeToken.ReplaceAllString(t, ""), "{} \t") {
+		return errors.New("wrong template characters")
+	}
+
+	return nil
+}
+
+// barecodeTokenValue returns the value of the token name with the zero padding width
+func barecodeTokenValue(name string, width string, v BarecodeValues) string {
+	var s string
+
+	switch name {
+	case "entity":
+		return v.Entity
+	case "storelocation":
+		return v.StoreLocation
+	case "year":
+		return v.Date.Format("2006")
+	case "yy":
+		return v.Date.Format("06")
+	case "product":
+		s = strconv.Itoa(v.Product)
+	case "seq":
+		s = strconv.Itoa(v.Seq)
+	}
+	if w, err := strconv.Atoi(width); err == nil && len(s) < w {
+		s = strings.Repeat("0", w-len(s)) + s
+	}
+	return s
+}
+
+// BarecodeCheckDigit returns the Luhn check digit of the digits of s,
+// the other characters being ignored
+func BarecodeCheckDigit(s string) string {
+	var (
+		sum    int
+		double = true
+	)
+
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		d := int(s[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+
+	return strconv.Itoa((10 - sum%10) % 10)
+}
+
+// RenderBarecode returns the barecode of the template t for the values v
+func RenderBarecode(t string, v BarecodeValues) (string, error) {
+	if err := ValidateBarecodeTemplate(t); err != nil {
+		return "", err
+	}
+	return renderBarecode(t, v), nil
+}
+
+// renderBarecode returns the barecode of the unchecked template t for the values v
+func renderBarecode(t string, v BarecodeValues) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range barecodeToken.FindAllStringSubmatchIndex(t, -1) {
+		b.WriteString(t[last:m[0]])
+		last = m[1]
+		name := t[m[2]:m[3]]
+		if name == "check" {
+			b.WriteString(BarecodeCheckDigit(b.String()))
+			continue
+		}
+		width := ""
+		if m[4] != -1 {
+			width = t[m[4]:m[5]]
+		}
+		b.WriteString(barecodeTokenValue(name, width, v))
+	}
+	b.WriteString(t[last:])
+
+	return b.String()
+}
+
+// BarecodeSeqPattern returns a regular expression matching the barecodes of the template t
+// sharing the values v but the sequence number, captured by its first group,
+// and the common prefix of these barecodes
+func BarecodeSeqPattern(t string, v BarecodeValues) (pattern string, prefix string, err error) {
+	if err = ValidateBarecodeTemplate(t); err != nil {
+		return "", "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	last := 0
+	seq := false
+	for _, m := range barecodeToken.FindAllStringSubmatchIndex(t, -1) {
+		b.WriteString(regexp.QuoteMeta(t[last:m[0]]))
+		last = m[1]
+		switch name := t[m[2]:m[3]]; name {
+		case "seq":
+			// the first {seq} is captured and ends the prefix
+			if seq {
+				b.WriteString(`[0-9]+`)
+			} else {
+				b.WriteString(`([0-9]+)`)
+				prefix = renderBarecode(t[:m[0]], v)
+				seq = true
+			}
+		case "check":
+			b.WriteString(`[0-9]`)
+		default:
+			width := ""
+			if m[4] != -1 {
+				width = t[m[4]:m[5]]
+			}
+			b.WriteString(regexp.QuoteMeta(barecodeTokenValue(name, width, v)))
+		}
+	}
+	b.WriteString(regexp.QuoteMeta(t[last:]))
+	b.WriteString("$")
+
+	return b.String(), prefix, nil
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// code128Patterns are the Code 128 symbols bars and spaces widths in modules,
+// from the value 0 to the start codes A, B and C and the stop code
+var code128Patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128StartB = 104
+	code128StartC = 105
+	code128Stop   = 106
+)
+
+// Code128 returns the Code 128 barcode of s as its bars and spaces widths in modules,
+// starting with a bar, without the quiet zones.
+// Even length digits strings are encoded with the compact code set C,
+// the others with the code set B restricted to the printable ASCII characters.
+func Code128(s string) ([]int, error) {
+	var values []int
+
+	if s == "" {
+		return nil, fmt.Errorf("empty code")
+	}
+
+	digits := len(s)%2 == 0
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			digits = false
+			break
+		}
+	}
+
+	if digits {
+		values = append(values, code128StartC)
+		for i := 0; i < len(s); i += 2 {
+			v, _ := strconv.Atoi(s[i : i+2])
+			values = append(values, v)
+		}
+	} else {
+		values = append(values, code128StartB)
+		for _, r := range s {
+			if r < ' ' || r > '~' {
+				return nil, fmt.Errorf("character %q can not be encoded", r)
+			}
+			values = append(values, int(r-' '))
+		}
+	}
+
+	// modulo 103 checksum weighted by the symbols positions
+	check := values[0]
+	for i, v := range values[1:] {
+		check += (i + 1) * v
+	}
+	values = append(values, check%103, code128Stop)
+
+	var widths []int
+	for _, v := range values {
+		for _, c := range code128Patterns[v] {
+			widths = append(widths, int(c-'0'))
+		}
+	}
+	return widths, nil
+}
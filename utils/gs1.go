@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gs1GroupSeparator is the FNC1 separator of the variable length GS1 element strings
+const gs1GroupSeparator = "\x1d"
+
+var (
+	// gs1AILengths are the application identifiers lengths by their two first digits
+	gs1AILengths = map[string]int{
+		"00": 2, "01": 2, "02": 2, "10": 2, "11": 2, "12": 2, "13": 2, "15": 2, "16": 2, "17": 2,
+		"20": 2, "21": 2, "22": 2, "30": 2, "37": 2,
+		"90": 2, "91": 2, "92": 2, "93": 2, "94": 2, "95": 2, "96": 2, "97": 2, "98": 2, "99": 2,
+		"23": 3, "24": 3, "25": 3, "40": 3, "41": 3, "42": 3, "43": 3,
+		"31": 4, "32": 4, "33": 4, "34": 4, "35": 4, "36": 4, "39": 4, "70": 4, "71": 4, "72": 4,
+		"80": 4, "81": 4, "82": 4,
+	}
+	// gs1FixedLengths are the predefined data lengths by the application identifiers two first digits,
+	// the others are variable length terminated by a group separator
+	gs1FixedLengths = map[string]int{
+		"00": 18, "01": 14, "02": 14, "11": 6, "12": 6, "13": 6, "15": 6, "16": 6, "17": 6, "20": 2,
+		"31": 6, "32": 6, "33": 6, "34": 6, "35": 6, "36": 6, "41": 13,
+	}
+	// gs1QuantityUnits are the units of the metric trade measures application identifiers
+	gs1QuantityUnits = map[string]string{
+		"310": "kg",
+		"311": "m",
+		"315": "L",
+	}
+)
+
+// GS1 is a parsed GS1 element string of a GS1-128 or GS1 DataMatrix barcode
+type GS1 struct {
+	AIs          map[string]string `json:"ais"`          // all the application identifiers values
+	GTIN         string            `json:"gtin"`         // AI 01
+	Batch        string            `json:"batch"`        // AI 10
+	Expiry       time.Time         `json:"expiry"`       // AI 17, zero if absent
+	Quantity     float64           `json:"quantity"`     // AI 310n, 311n, 315n or else 30, 0 if absent
+	QuantityUnit string            `json:"quantityunit"` // kg, m or L, empty for a count (AI 30)
+}
+
+// IsGS1 returns true if s looks like a GS1 element string:
+// with a symbology identifier, in the human readable (AI)value form,
+// with group separators or starting with a GTIN
+func IsGS1(s string) bool {
+	switch {
+	case strings.HasPrefix(s, "]C1"), strings.HasPrefix(s, "]d2"), strings.HasPrefix(s, "]Q3"), strings.HasPrefix(s, "]e0"):
+		return true
+	case strings.HasPrefix(s, "(") && strings.Contains(s, ")"):
+		return true
+	case strings.Contains(s, gs1GroupSeparator):
+		return true
+	case strings.HasPrefix(s, "01") && len(s) >= 16:
+		_, err := strconv.ParseUint(s[2:16], 10, 64)
+		return err == nil
+	}
+	return false
+}
+
+// gs1AI returns the application identifier at the beginning of s
+func gs1AI(s string) (string, error) {
+	if len(s) < 2 {
+		return "", fmt.Errorf("truncated GS1 application identifier %q", s)
+	}
+	l, ok := gs1AILengths[s[:2]]
+	if !ok || len(s) < l {
+		return "", fmt.Errorf("unknown GS1 application identifier %q", s)
+	}
+	ai := s[:l]
+	if _, err := strconv.Atoi(ai); err != nil {
+		return "", fmt.Errorf("wrong GS1 application identifier %q", ai)
+	}
+	return ai, nil
+}
+
+// gs1Elements returns the application identifiers values of the element string s
+func gs1Elements(s string) (map[string]string, error) {
+	ais := make(map[string]string)
+
+	// human readable form: (01)03453120000011(17)191125(10)ABCD1234
+	if strings.HasPrefix(s, "(") {
+		for _, e := range strings.Split(s[1:], "(") {
+			p := strings.SplitN(e, ")", 2)
+			if len(p) != 2 || p[0] == "" {
+				return nil, fmt.Errorf("wrong GS1 element %q", e)
+			}
+			ais[p[0]] = strings.TrimSpace(p[1])
+		}
+		return ais, nil
+	}
+
+	for len(s) > 0 {
+		ai, err := gs1AI(s)
+		if err != nil {
+			return nil, err
+		}
+		s = s[len(ai):]
+
+		var v string
+		if l, ok := gs1FixedLengths[ai[:2]]; ok {
+			if len(s) < l {
+				return nil, fmt.Errorf("truncated GS1 element %s", ai)
+			}
+			v, s = s[:l], s[l:]
+			// a separator may follow a fixed length element
+			s = strings.TrimPrefix(s, gs1GroupSeparator)
+		} else if i := strings.Index(s, gs1GroupSeparator); i >= 0 {
+			v, s = s[:i], s[i+1:]
+		} else {
+			v, s = s, ""
+		}
+		ais[ai] = v
+	}
+
+	return ais, nil
+}
+
+// gs1Date returns the date of the YYMMDD GS1 value v,
+// a 00 day being the last day of the month
+func gs1Date(v string) (time.Time, error) {
+	if len(v) != 6 {
+		return time.Time{}, fmt.Errorf("wrong GS1 date %q", v)
+	}
+	y, erry := strconv.Atoi(v[0:2])
+	m, errm := strconv.Atoi(v[2:4])
+	d, errd := strconv.Atoi(v[4:6])
+	if erry != nil || errm != nil || errd != nil || m < 1 || m > 12 || d > 31 {
+		return time.Time{}, fmt.Errorf("wrong GS1 date %q", v)
+	}
+	if d == 0 {
+		return time.Date(2000+y, time.Month(m)+1, 0, 0, 0, 0, 0, time.UTC), nil
+	}
+	return time.Date(2000+y, time.Month(m), d, 0, 0, 0, 0, time.UTC), nil
+}
+
+// ParseGS1 parses the GS1 element string s, raw with group separators
+// or in the human readable (AI)value form, and extracts the GTIN, batch, expiry date and quantity
+func ParseGS1(s string) (GS1, error) {
+	var (
+		g     GS1
+		count float64
+		err   error
+	)
+
+	// removing the symbology identifier and a leading FNC1
+	for _, p := range []string{"]C1", "]d2", "]Q3", "]e0"} {
+		s = strings.TrimPrefix(s, p)
+	}
+	s = strings.TrimPrefix(strings.TrimSpace(s), gs1GroupSeparator)
+	if s == "" {
+		return GS1{}, errors.New("empty GS1 element string")
+	}
+
+	if g.AIs, err = gs1Elements(s); err != nil {
+		return GS1{}, err
+	}
+
+	for ai, v := range g.AIs {
+		switch {
+		case ai == "01":
+			if len(v) != 14 {
+				return GS1{}, fmt.Errorf("wrong GTIN %q", v)
+			}
+			g.GTIN = v
+		case ai == "10":
+			g.Batch = v
+		case ai == "17":
+			if g.Expiry, err = gs1Date(v); err != nil {
+				return GS1{}, err
+			}
+		case ai == "30":
+			if count, err = strconv.ParseFloat(v, 64); err != nil {
+				return GS1{}, fmt.Errorf("wrong GS1 count %q", v)
+			}
+		case len(ai) == 4 && gs1QuantityUnits[ai[:3]] != "":
+			// the fourth digit is the number of decimals
+			q, err := strconv.Atoi(v)
+			if err != nil {
+				return GS1{}, fmt.Errorf("wrong GS1 quantity %q", v)
+			}
+			g.Quantity = float64(q) / math.Pow10(int(ai[3]-'0'))
+			g.QuantityUnit = gs1QuantityUnits[ai[:3]]
+		}
+	}
+	// a trade measure prevails over a count
+	if g.Quantity == 0 {
+		g.Quantity = count
+	}
+
+	return g, nil
+}
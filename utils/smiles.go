@@ -0,0 +1,413 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	// default valences of the SMILES organic subset atoms
+	smilesOrganicValences = map[string][]int{
+		"B":  {3},
+		"C":  {4},
+		"N":  {3, 5},
+		"O":  {2},
+		"P":  {3, 5},
+		"S":  {2, 4, 6},
+		"F":  {1},
+		"Cl": {1},
+		"Br": {1},
+		"I":  {1},
+	}
+
+	// SMILES aromatic atoms allowed outside and inside brackets
+	smilesAromatic        = map[string]bool{"b": true, "c": true, "n": true, "o": true, "p": true, "s": true}
+	smilesBracketAromatic = map[string]bool{"b": true, "c": true, "n": true, "o": true, "p": true, "s": true, "se": true, "as": true}
+)
+
+// smilesAtom is an atom of a parsed SMILES
+type smilesAtom struct {
+	symbol   string // capitalized element symbol
+	aromatic bool
+	bracket  bool
+	hcount   int // explicit hydrogen count of a bracket atom
+	valence  int // sum of the bond orders
+}
+
+// smilesRing is an opened SMILES ring closure
+type smilesRing struct {
+	atom int
+	bond byte
+}
+
+// implicitHydrogens returns the implicit hydrogen count of the atom a
+func (a smilesAtom) implicitHydrogens() int {
+	if a.bracket {
+		return a.hcount
+	}
+	v := a.valence
+	if a.aromatic {
+		// the aromatic bond counts for one more and
+		// the aromatic atoms only take hydrogens up to their lowest valence
+		if d := smilesOrganicValences[a.symbol][0]; d > v+1 {
+			return d - v - 1
+		}
+		return 0
+	}
+	for _, d := range smilesOrganicValences[a.symbol] {
+		if d >= v {
+			return d - v
+		}
+	}
+	return 0
+}
+
+// smilesBondOrder returns the order of the bond b
+func smilesBondOrder(b byte) int {
+	switch b {
+	case '=':
+		return 2
+	case '#':
+		return 3
+	case '$':
+		return 4
+	}
+	return 1
+}
+
+// parseSmilesBracketAtom parses the bracket atom s (without the brackets).
+func parseSmilesBracketAtom(s string) (smilesAtom, error) {
+	var (
+		a smilesAtom
+		i int
+	)
+	a.bracket = true
+
+	// isotope
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	// symbol
+	switch {
+	case i+1 < len(s) && smilesBracketAromatic[s[i:i+2]]:
+		a.symbol, a.aromatic = strings.ToUpper(s[i:i+1])+s[i+1:i+2], true
+		i += 2
+	case i < len(s) && smilesBracketAromatic[s[i:i+1]]:
+		a.symbol, a.aromatic = strings.ToUpper(s[i:i+1]), true
+		i++
+	case i+1 < len(s) && unicode.IsUpper(rune(s[i])) && unicode.IsLower(rune(s[i+1])) && atoms[s[i:i+2]] != "":
+		a.symbol = s[i : i+2]
+		i += 2
+	case i < len(s) && atoms[s[i:i+1]] != "":
+		a.symbol = s[i : i+1]
+		i++
+	default:
+		return smilesAtom{}, errors.New("invalid bracket atom: [" + s + "]")
+	}
+	if a.symbol == "D" {
+		a.symbol = "H"
+	}
+	// chirality
+	if i < len(s) && s[i] == '@' {
+		i++
+		if i < len(s) && s[i] == '@' {
+			i++
+		} else if i+1 < len(s) && strings.Contains("TH AL SP TB OH", s[i:i+2]) {
+			i += 2
+			for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+				i++
+			}
+		}
+	}
+	// hydrogen count
+	if i < len(s) && s[i] == 'H' {
+		i++
+		a.hcount = 1
+		if i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			a.hcount = int(s[i] - '0')
+			i++
+		}
+	}
+	// charge
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		c := s[i]
+		i++
+		if i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+				i++
+			}
+		} else {
+			for i < len(s) && s[i] == c {
+				i++
+			}
+		}
+	}
+	// atom class
+	if i < len(s) && s[i] == ':' {
+		i++
+		j := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == j {
+			return smilesAtom{}, errors.New("invalid atom class: [" + s + "]")
+		}
+	}
+	if i != len(s) {
+		return smilesAtom{}, errors.New("invalid bracket atom: [" + s + "]")
+	}
+
+	return a, nil
+}
+
+// parseSmiles parses and validates the s SMILES and returns its atoms.
+func parseSmiles(s string) ([]smilesAtom, error) {
+	var (
+		sa       []smilesAtom
+		branches []int                      // sa opening the branches
+		rings    = make(map[int]smilesRing) // opened ring closures
+		prev     = -1                       // previous atom
+		bond     byte                       // pending bond
+	)
+
+	// connect bonds the atom a to the previous atom
+	connect := func(a int, b byte) {
+		if prev != -1 {
+			o := smilesBondOrder(b)
+			sa[prev].valence += o
+			sa[a].valence += o
+		}
+	}
+
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == '(':
+			if prev == -1 || bond != 0 || s[i-1] == '(' {
+				return nil, fmt.Errorf("unexpected branch at position %d", i)
+			}
+			branches = append(branches, prev)
+			i++
+		case c == ')':
+			if len(branches) == 0 || bond != 0 || s[i-1] == '(' {
+				return nil, fmt.Errorf("unexpected branch closure at position %d", i)
+			}
+			prev = branches[len(branches)-1]
+			branches = branches[:len(branches)-1]
+			i++
+		case c == '.':
+			if prev == -1 || bond != 0 {
+				return nil, fmt.Errorf("unexpected dot at position %d", i)
+			}
+			prev = -1
+			i++
+		case strings.IndexByte("-=#$:/\\", c) >= 0:
+			if prev == -1 || bond != 0 {
+				return nil, fmt.Errorf("unexpected bond at position %d", i)
+			}
+			bond = c
+			i++
+		case c == '%' || (c >= '0' && c <= '9'):
+			if prev == -1 {
+				return nil, fmt.Errorf("unexpected ring closure at position %d", i)
+			}
+			var n int
+			if c == '%' {
+				if i+2 >= len(s) {
+					return nil, fmt.Errorf("invalid ring closure at position %d", i)
+				}
+				var err error
+				if n, err = strconv.Atoi(s[i+1 : i+3]); err != nil {
+					return nil, fmt.Errorf("invalid ring closure at position %d", i)
+				}
+				i += 3
+			} else {
+				n = int(c - '0')
+				i++
+			}
+			if r, ok := rings[n]; ok {
+				if r.atom == prev {
+					return nil, fmt.Errorf("ring closure %d on the same atom", n)
+				}
+				b := r.bond
+				if bond != 0 {
+					if b != 0 && smilesBondOrder(b) != smilesBondOrder(bond) {
+						return nil, fmt.Errorf("conflicting ring closure %d bonds", n)
+					}
+					b = bond
+				}
+				o := smilesBondOrder(b)
+				sa[r.atom].valence += o
+				sa[prev].valence += o
+				delete(rings, n)
+			} else {
+				rings[n] = smilesRing{atom: prev, bond: bond}
+			}
+			bond = 0
+		default:
+			var a smilesAtom
+			if c == '[' {
+				j := strings.IndexByte(s[i:], ']')
+				if j == -1 {
+					return nil, fmt.Errorf("unclosed bracket atom at position %d", i)
+				}
+				var err error
+				if a, err = parseSmilesBracketAtom(s[i+1 : i+j]); err != nil {
+					return nil, err
+				}
+				i += j + 1
+			} else if i+1 < len(s) && (s[i:i+2] == "Cl" || s[i:i+2] == "Br") {
+				a.symbol = s[i : i+2]
+				i += 2
+			} else if _, ok := smilesOrganicValences[s[i:i+1]]; ok {
+				a.symbol = s[i : i+1]
+				i++
+			} else if smilesAromatic[s[i:i+1]] {
+				a.symbol, a.aromatic = strings.ToUpper(s[i:i+1]), true
+				i++
+			} else {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+			sa = append(sa, a)
+			connect(len(sa)-1, bond)
+			prev = len(sa) - 1
+			bond = 0
+		}
+	}
+
+	if len(sa) == 0 {
+		return nil, errors.New("empty SMILES")
+	}
+	if len(branches) != 0 {
+		return nil, errors.New("unclosed branch")
+	}
+	if len(rings) != 0 {
+		return nil, errors.New("unclosed ring")
+	}
+	if bond != 0 {
+		return nil, errors.New("dangling bond")
+	}
+
+	return sa, nil
+}
+
+// formatAtomCount returns the formula of the c atom count
+// with C and H first and the other atoms sorted.
+func formatAtomCount(c map[string]int) string {
+	var (
+		others []string
+		f      strings.Builder
+	)
+
+	write := func(a string) {
+		if c[a] == 0 {
+			return
+		}
+		f.WriteString(a)
+		if c[a] > 1 {
+			f.WriteString(strconv.Itoa(c[a]))
+		}
+	}
+
+	for a := range c {
+		if a != "C" && a != "H" {
+			others = append(others, a)
+		}
+	}
+	sort.Strings(others)
+
+	write("C")
+	write("H")
+	for _, a := range others {
+		write(a)
+	}
+	return f.String()
+}
+
+// SmilesToEmpiricalFormula validates the s SMILES and returns its empirical formula.
+// The disconnected parts (salts, hydrates) are merged in one formula.
+// example:
+// c1ccccc1O will return C6H6O
+func SmilesToEmpiricalFormula(s string) (string, error) {
+	var (
+		err   error
+		sa    []smilesAtom
+		count = make(map[string]int)
+	)
+
+	if sa, err = parseSmiles(strings.TrimSpace(s)); err != nil {
+		return "", err
+	}
+	for _, a := range sa {
+		count[a.symbol]++
+		count["H"] += a.implicitHydrogens()
+	}
+
+	return formatAtomCount(count), nil
+}
+
+// empiricalFormulaAtomCount returns a count of the atoms of the f empirical formula
+// with dot separated parts and leading multipliers.
+// example:
+// CuO4S.5H2O will return "Cu":1, "O":9, "S":1, "H":10
+func empiricalFormulaAtomCount(f string) (map[string]int, error) {
+	c := make(map[string]int)
+
+	for _, p := range strings.Split(strings.Replace(f, " ", "", -1), ".") {
+		var (
+			i    int
+			mult = 1
+		)
+		// leading multiplier
+		for i < len(p) && p[i] >= '0' && p[i] <= '9' {
+			i++
+		}
+		if i > 0 {
+			mult, _ = strconv.Atoi(p[:i])
+		}
+		for i < len(p) {
+			j := i + 1
+			if !unicode.IsUpper(rune(p[i])) {
+				return nil, errors.New("invalid formula: " + f)
+			}
+			for j < len(p) && unicode.IsLower(rune(p[j])) {
+				j++
+			}
+			a := p[i:j]
+			if _, ok := atoms[a]; !ok {
+				return nil, errors.New("wrong atom in formula: " + a)
+			}
+			i = j
+			for j < len(p) && p[j] >= '0' && p[j] <= '9' {
+				j++
+			}
+			n := 1
+			if j > i {
+				n, _ = strconv.Atoi(p[i:j])
+			}
+			c[a] += n * mult
+			i = j
+		}
+	}
+
+	return c, nil
+}
+
+// SameEmpiricalFormula returns true if the f1 and f2 empirical formulas
+// have the same atom count.
+func SameEmpiricalFormula(f1, f2 string) bool {
+	c1, err := empiricalFormulaAtomCount(f1)
+	if err != nil {
+		return false
+	}
+	c2, err := empiricalFormulaAtomCount(f2)
+	if err != nil {
+		return false
+	}
+	return formatAtomCount(c1) == formatAtomCount(c2)
+}
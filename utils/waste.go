@@ -0,0 +1,74 @@
+package utils
+
+import "strings"
+
+// WasteCategories are the chemical waste categories, in decreasing order of precedence
+var WasteCategories = []string{
+	"explosive",
+	"oxidizing",
+	"flammable",
+	"cmr",
+	"toxic",
+	"corrosive",
+	"environment",
+	"other",
+	"non hazardous",
+}
+
+// wasteCategoryRules are the GHS pictograms and hazard statements
+// of each hazardous waste category
+var wasteCategoryRules = map[string]struct {
+	symbols          []string
+	hazardstatements []string
+}{
+	"explosive":   {[]string{"SGH01"}, []string{"H200", "H201", "H202", "H203", "H204", "H205", "H240", "H241"}},
+	"oxidizing":   {[]string{"SGH03"}, []string{"H270", "H271", "H272"}},
+	"flammable":   {[]string{"SGH02"}, []string{"H220", "H221", "H222", "H223", "H224", "H225", "H226", "H228", "H242", "H250", "H251", "H252", "H260", "H261"}},
+	"cmr":         {nil, []string{"H340", "H341", "H350", "H351", "H360", "H361", "H362"}},
+	"toxic":       {[]string{"SGH06"}, []string{"H300", "H301", "H310", "H311", "H330", "H331", "H370", "H372"}},
+	"corrosive":   {[]string{"SGH05"}, []string{"H290", "H314", "H318"}},
+	"environment": {[]string{"SGH09"}, []string{"H400", "H410", "H411", "H412", "H413"}},
+}
+
+// IsWasteCategory returns true if c is a known waste category
+func IsWasteCategory(c string) bool {
+	for _, wc := range WasteCategories {
+		if wc == c {
+			return true
+		}
+	}
+	return false
+}
+
+// WasteCategory returns the disposal waste category of a product
+// from its GHS pictograms labels (SGH01...) and hazard statements references (H225...).
+// The most hazardous category wins, a product with pictograms or statements
+// matching no rule is "other".
+func WasteCategory(symbols []string, hazardstatements []string) string {
+	for _, c := range WasteCategories {
+		rule, ok := wasteCategoryRules[c]
+		if !ok {
+			continue
+		}
+		for _, s := range symbols {
+			for _, rs := range rule.symbols {
+				if s == rs {
+					return c
+				}
+			}
+		}
+		for _, h := range hazardstatements {
+			for _, rh := range rule.hazardstatements {
+				// references may carry a suffix such as H360FD
+				if strings.HasPrefix(h, rh) {
+					return c
+				}
+			}
+		}
+	}
+
+	if len(symbols) > 0 || len(hazardstatements) > 0 {
+		return "other"
+	}
+	return "non hazardous"
+}